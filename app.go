@@ -3,18 +3,54 @@ package app
 import "time"
 
 type Account struct {
-	ID        uint64    `json:"id"` // This field is read-only
-	Name      string    `json:"name"`
-	CPF       string    `json:"cpf"`
-	Balance   uint64    `json:"balance"` // Account balance in cents
+	ID               uint64          `json:"id"` // This field is read-only
+	Name             string          `json:"name"`
+	CPF              string          `json:"cpf"`
+	Balance          uint64          `json:"balance"` // Account balance in cents
+	CreatedAt        time.Time       `json:"created_at"`
+	Type             string          `json:"type,omitempty"`
+	AccruedInterest  uint64          `json:"accrued_interest,omitempty"` // Interest accrued and not paid out yet, in cents
+	InterestFraction string          `json:"-"`                          // Fraction of a cent accrued on top of AccruedInterest, such as "5/18"
+	InterestDay      string          `json:"-"`                          // Last day interest was accrued for, such as "2020-03-12"
+	BalanceChangedAt time.Time       `json:"-"`                          // When Balance last changed by moving funds
+	OpeningBalance   uint64          `json:"-"`                          // Balance before the first change on the day of BalanceChangedAt
+	Secret           string          `json:"-"`                          // Hash of the customer password, never sent to clients
+	TOTPSecret       string          `json:"-"`                          // Base32 TOTP secret, set on enrollment
+	TOTPEnabled      bool            `json:"totp_enabled,omitempty"`     // Whether a code was verified for TOTPSecret
+	TOTPLastStep     int64           `json:"-"`                          // Time step of the last code used, to refuse replays
+	Keys             []AddressingKey `json:"-"`                          // Aliases the account can be found by, never listed with it
+	Charges          []Charge        `json:"-"`                          // Dynamic charges issued by the account
+}
+
+// AddressingKey is an alias an account can be found by, as a PIX key is: a
+// CPF, a CNPJ, an email, a phone number or a random UUID.
+type AddressingKey struct {
+	Type      string    `json:"type"`
+	Key       string    `json:"key"` // Normalized value of the key
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Charge is a dynamic BR Code charge issued by an account, to be paid once
+// with the amount it was issued for.
+type Charge struct {
+	TxID        string    `json:"txid"`
+	Key         string    `json:"key"`    // Addressing key the charge is paid to
+	Amount      uint64    `json:"amount"` // Amount in cents
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	TransferID  uint64    `json:"transfer_id,omitempty"` // Last transfer made to pay the charge
+}
+
 type Transfer struct {
-	ID                   uint64    `json:"id"` // This field is read-only
-	AccountOriginID      uint64    `json:"account_origin_id"`
-	AccountDestinationID uint64    `json:"account_destination_id"`
-	Amount               uint64    `json:"amount"` // Transfer amount in cents
-	CreatedAt            time.Time `json:"created_at"`
-	Status               string    `json:"status"`
+	ID                   uint64     `json:"id"` // This field is read-only
+	AccountOriginID      uint64     `json:"account_origin_id"`
+	AccountDestinationID uint64     `json:"account_destination_id"`
+	Amount               uint64     `json:"amount"`        // Transfer amount in cents
+	Fee                  uint64     `json:"fee,omitempty"` // Fee charged to the origin account in cents, on top of the amount
+	CreatedAt            time.Time  `json:"created_at"`
+	Status               string     `json:"status"`
+	Kind                 string     `json:"kind,omitempty"`
+	SplitID              uint64     `json:"split_id,omitempty"`     // ID of the first transfer of a split, shared by all of its legs
+	ExpiresAt            *time.Time `json:"expires_at,omitempty"`   // When a transfer pending confirmation expires
+	ConfirmedAt          *time.Time `json:"confirmed_at,omitempty"` // When the amount was exchanged
 }
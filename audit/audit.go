@@ -0,0 +1,262 @@
+// Package audit keeps an append-only, tamper-evident log of everything that
+// changes the state of the bank. Every entry carries the hash of the one
+// before it, so editing or removing an entry breaks the chain from that
+// point on.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"os"
+	"sync"
+	"time"
+)
+
+// GenesisHash is the previous hash of the first entry of a log.
+const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+type Entry struct {
+	Seq        uint64          `json:"seq"`
+	Time       time.Time       `json:"time"`
+	Actor      string          `json:"actor"`
+	RemoteAddr string          `json:"remote_addr,omitempty"` // Network address of API calls
+	Action     string          `json:"action"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Outcome    string          `json:"outcome"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// VerificationError tells which entry broke the hash chain and why.
+type VerificationError struct {
+	Seq    uint64
+	Reason string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("audit log entry %d: %s", e.Seq, e.Reason)
+}
+
+// Log is an audit log kept in memory and, optionally, in a file that is only
+// ever appended to, one JSON entry per line.
+type Log struct {
+	mu      sync.Mutex
+	entries []Entry
+	file    *os.File
+	path    string
+}
+
+// NewLog returns an empty audit log kept in memory only.
+func NewLog() *Log {
+	return &Log{}
+}
+
+// OpenLog returns an audit log backed by the file at path, creating it if
+// needed. Existing entries are loaded and verified, and new entries are
+// chained to the last one.
+func OpenLog(path string) (*Log, error) {
+	entries, err := ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	err = Verify(entries)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+	return &Log{entries: entries, file: file, path: path}, nil
+}
+
+// Record appends an entry to the log. Payload is marshaled to JSON; if that
+// fails the error is recorded in its place, so that the action is never left
+// out of the log.
+func (l *Log) Record(actor, action string, payload interface{}, outcome string) {
+	_, err := l.Append(actor, action, payload, outcome)
+	if err != nil {
+		logging.Default().Error("error recording on audit log", "action", action, "error", err)
+	}
+}
+
+// RecordRequest is Record for API calls, which also keep the network
+// address they came from.
+func (l *Log) RecordRequest(actor, remoteAddr, action string, payload interface{}, outcome string) {
+	_, err := l.append(Entry{Actor: actor, RemoteAddr: remoteAddr, Action: action, Outcome: outcome}, payload)
+	if err != nil {
+		logging.Default().Error("error recording on audit log", "action", action, "error", err)
+	}
+}
+
+// Append adds an entry to the log and returns it.
+func (l *Log) Append(actor, action string, payload interface{}, outcome string) (Entry, error) {
+	return l.append(Entry{Actor: actor, Action: action, Outcome: outcome}, payload)
+}
+
+// append chains entry, with payload marshaled into it, to the log.
+func (l *Log) append(entry Entry, payload interface{}) (Entry, error) {
+	rawPayload, err := marshalPayload(payload)
+	if err != nil {
+		rawPayload, _ = json.Marshal(map[string]string{"marshal_error": err.Error()})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = uint64(len(l.entries)) + 1
+	entry.Time = time.Now().UTC()
+	entry.Payload = rawPayload
+	entry.PrevHash = l.head()
+	entry.Hash = hashEntry(entry)
+
+	if l.file != nil {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return Entry{}, err
+		}
+		_, err = l.file.Write(append(line, '\n'))
+		if err != nil {
+			return Entry{}, fmt.Errorf("error writing audit log: %w", err)
+		}
+	}
+	l.entries = append(l.entries, entry)
+	return entry, nil
+}
+
+// Entries returns a copy of all entries recorded so far.
+func (l *Log) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]Entry, len(l.entries))
+	copy(entries, l.entries)
+	return entries
+}
+
+// Head returns the hash of the last entry, which can be kept somewhere else
+// to detect entries removed from the end of the log.
+func (l *Log) Head() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.head()
+}
+
+func (l *Log) head() string {
+	if len(l.entries) == 0 {
+		return GenesisHash
+	}
+	return l.entries[len(l.entries)-1].Hash
+}
+
+// Check verifies the log. File-backed logs are read back from disk, since
+// that is where they could have been tampered with.
+func (l *Log) Check() (entries int, head string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stored := l.entries
+	if l.file != nil {
+		stored, err = ReadFile(l.path)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	err = Verify(stored)
+	if err != nil {
+		return len(stored), "", err
+	}
+	if len(stored) != len(l.entries) {
+		return len(stored), "", &VerificationError{Seq: uint64(len(stored)) + 1, Reason: "entry is missing"}
+	}
+	if len(stored) == 0 {
+		return 0, GenesisHash, nil
+	}
+	return len(stored), stored[len(stored)-1].Hash, nil
+}
+
+// Close closes the file backing the log, if any.
+func (l *Log) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Verify walks the hash chain of entries and returns a *VerificationError
+// for the first entry that was edited, removed or reordered.
+func Verify(entries []Entry) error {
+	prevHash := GenesisHash
+	for i, entry := range entries {
+		seq := uint64(i) + 1
+		if entry.Seq != seq {
+			return &VerificationError{Seq: seq, Reason: fmt.Sprintf("found entry %d in its place", entry.Seq)}
+		}
+		if entry.PrevHash != prevHash {
+			return &VerificationError{Seq: seq, Reason: "previous hash does not match the entry before it"}
+		}
+		if hashEntry(entry) != entry.Hash {
+			return &VerificationError{Seq: seq, Reason: "hash does not match its contents"}
+		}
+		prevHash = entry.Hash
+	}
+	return nil
+}
+
+// ReadFile reads all entries of an audit log file.
+func ReadFile(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding audit log line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// hashEntry returns the SHA-256 of the entry, with its Hash field left
+// empty, in hexadecimal.
+func hashEntry(entry Entry) string {
+	entry.Hash = ""
+	data, _ := json.Marshal(entry)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func marshalPayload(payload interface{}) (json.RawMessage, error) {
+	if payload == nil {
+		return nil, nil
+	}
+	if raw, ok := payload.([]byte); ok {
+		payload = json.RawMessage(raw)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var compacted bytes.Buffer
+	err = json.Compact(&compacted, data)
+	if err != nil {
+		return nil, err
+	}
+	return compacted.Bytes(), nil
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	l := NewLog()
+
+	first, _ := l.Append("127.0.0.1:5000", "POST /accounts", []byte(`{"name": "Kevin Malone"}`), "201 Created")
+	second, _ := l.Append("store", "account.open", map[string]int{"id": 1}, "ok")
+
+	t.Run("should chain every entry to the one before it", func(t *testing.T) {
+		app.AssertString(t, first.PrevHash, GenesisHash)
+		app.AssertString(t, second.PrevHash, first.Hash)
+		app.AssertString(t, l.Head(), second.Hash)
+	})
+
+	t.Run("should number entries sequentially", func(t *testing.T) {
+		app.AssertUint64(t, first.Seq, 1)
+		app.AssertUint64(t, second.Seq, 2)
+	})
+
+	t.Run("should keep JSON payloads compacted", func(t *testing.T) {
+		app.AssertString(t, string(first.Payload), `{"name":"Kevin Malone"}`)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	newEntries := func() []Entry {
+		l := NewLog()
+		l.Append("a", "one", nil, "ok")
+		l.Append("b", "two", map[string]int{"amount": 1000}, "ok")
+		l.Append("c", "three", nil, "ok")
+		return l.Entries()
+	}
+
+	t.Run("should accept an untouched log", func(t *testing.T) {
+		app.AssertError(t, Verify(newEntries()), nil)
+	})
+
+	t.Run("should detect an edited entry", func(t *testing.T) {
+		entries := newEntries()
+		entries[1].Payload = json.RawMessage(`{"amount":1}`)
+
+		assertBrokenAt(t, Verify(entries), 2)
+	})
+
+	t.Run("should detect an edited entry with a recomputed hash", func(t *testing.T) {
+		entries := newEntries()
+		entries[1].Outcome = "failed"
+		entries[1].Hash = hashEntry(entries[1])
+
+		assertBrokenAt(t, Verify(entries), 3)
+	})
+
+	t.Run("should detect a deleted entry", func(t *testing.T) {
+		entries := newEntries()
+		entries = append(entries[:1], entries[2:]...)
+
+		assertBrokenAt(t, Verify(entries), 2)
+	})
+}
+
+func TestOpenLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("could not create temporary directory. error: %q", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := OpenLog(path)
+	if err != nil {
+		t.Fatalf("could not open audit log. error: %q", err)
+	}
+	l.Append("a", "one", nil, "ok")
+	l.Append("b", "two", nil, "ok")
+	l.Close()
+
+	t.Run("should chain new entries to the ones already in the file", func(t *testing.T) {
+		reopened, err := OpenLog(path)
+		if err != nil {
+			t.Fatalf("could not reopen audit log. error: %q", err)
+		}
+		defer reopened.Close()
+
+		entry, _ := reopened.Append("c", "three", nil, "ok")
+
+		app.AssertUint64(t, entry.Seq, 3)
+		entries, head, err := reopened.Check()
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, uint64(entries), 3)
+		app.AssertString(t, head, entry.Hash)
+	})
+
+	t.Run("should detect entries edited on disk", func(t *testing.T) {
+		data, _ := ioutil.ReadFile(path)
+		ioutil.WriteFile(path, []byte(strings.Replace(string(data), `"actor":"b"`, `"actor":"x"`, 1)), 0600)
+
+		_, err := OpenLog(path)
+
+		assertBrokenAt(t, err, 2)
+	})
+}
+
+func assertBrokenAt(t *testing.T, err error, seq uint64) {
+	t.Helper()
+	verificationErr, ok := err.(*VerificationError)
+	if !ok {
+		t.Fatalf("got error %v; want a *VerificationError", err)
+	}
+	app.AssertUint64(t, verificationErr.Seq, seq)
+}
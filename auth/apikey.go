@@ -0,0 +1,405 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API key roles, from the least to the most privileged. Each role can do
+// everything the ones before it can.
+const (
+	RoleReadOnly = "read-only"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// SignatureWindow is how far the timestamp of a signed request may be from
+// the server clock. Nonces are remembered for as long, so that a request
+// cannot be replayed while its timestamp is still accepted.
+const SignatureWindow = 5 * time.Minute
+
+var (
+	ErrInvalidRole      = errors.New("invalid role: it must be read-only, operator or admin")
+	ErrAPIKeyNotFound   = errors.New("there is no API key with this ID")
+	ErrInvalidAPIKey    = errors.New("API key is invalid or revoked")
+	ErrRevokedAPIKey    = errors.New("API key is revoked")
+	ErrInvalidSignature = errors.New("request signature is invalid")
+	ErrStaleRequest     = errors.New("request timestamp is too far from the server time")
+	ErrReplayedRequest  = errors.New("request nonce has already been used")
+)
+
+var roleRanks = map[string]int{
+	RoleReadOnly: 1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ValidRole tells whether role is one of the API key roles.
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// Allows tells whether a key with role may do what requires the role
+// required.
+func Allows(role, required string) bool {
+	return ValidRole(role) && roleRanks[role] >= roleRanks[required]
+}
+
+// APIKey identifies a back-office tool or partner system calling the API.
+// The secret is only returned when the key is created or rotated; only its
+// SHA-256 is kept.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	secretHash string
+}
+
+// savedKey is how a key is kept in the key store file, with the hash of its
+// secret.
+type savedKey struct {
+	APIKey
+	SecretHash string `json:"secret_sha256"`
+}
+
+// Revoked tells whether the key can no longer be used.
+func (k APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// KeyStore keeps the API keys and the nonces of recent signed requests.
+// Keys opened from a file are saved to it on every change.
+type KeyStore struct {
+	mu     sync.Mutex
+	keys   map[string]APIKey
+	nonces map[string]time.Time // Key ID and nonce to the time they can be forgotten
+	now    func() time.Time
+	path   string // File the keys are saved to; empty keeps them in memory
+}
+
+func NewKeyStore() *KeyStore {
+	return &KeyStore{
+		keys:   make(map[string]APIKey),
+		nonces: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// OpenKeyStore returns a key store that keeps its keys at path, loading the
+// ones saved there, if any.
+func OpenKeyStore(path string) (*KeyStore, error) {
+	s := NewKeyStore()
+	s.path = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading API keys: %w", err)
+	}
+	var saved []savedKey
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, fmt.Errorf("error loading API keys %s: %w", path, err)
+	}
+	for _, key := range saved {
+		key.APIKey.secretHash = key.SecretHash
+		s.keys[key.ID] = key.APIKey
+	}
+	return s, nil
+}
+
+// Create adds a key with role and returns it along with its secret.
+func (s *KeyStore) Create(name, role string) (APIKey, string, error) {
+	if !ValidRole(role) {
+		return APIKey{}, "", ErrInvalidRole
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	key := APIKey{ID: "key_" + id, Name: name, Role: role}
+	return s.Import(key, secret)
+}
+
+// Import adds a key with a known ID and secret, such as the one used to
+// bootstrap the admin endpoints. A key already kept with the ID gets the
+// secret, but keeps when it was created and revoked.
+func (s *KeyStore) Import(key APIKey, secret string) (APIKey, string, error) {
+	if !ValidRole(key.Role) {
+		return APIKey{}, "", ErrInvalidRole
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.keys[key.ID]
+	if ok {
+		key.CreatedAt, key.RotatedAt, key.RevokedAt = old.CreatedAt, old.RotatedAt, old.RevokedAt
+	} else {
+		key.CreatedAt = s.now().UTC()
+	}
+	key.secretHash = hashSecret(secret)
+	s.keys[key.ID] = key
+	if err := s.save(); err != nil {
+		s.restore(key.ID, old, ok)
+		return APIKey{}, "", err
+	}
+	return key, secret, nil
+}
+
+// Rotate replaces the secret of a key and returns the new one. The old
+// secret stops working at once.
+func (s *KeyStore) Rotate(ID string) (APIKey, string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[ID]
+	if !ok {
+		return APIKey{}, "", ErrAPIKeyNotFound
+	}
+	if key.Revoked() {
+		return APIKey{}, "", ErrRevokedAPIKey
+	}
+	old := key
+	now := s.now().UTC()
+	key.RotatedAt = &now
+	key.secretHash = hashSecret(secret)
+	s.keys[ID] = key
+	if err := s.save(); err != nil {
+		s.keys[ID] = old
+		return APIKey{}, "", err
+	}
+	return key, secret, nil
+}
+
+// Revoke disables a key for good. Revoked keys are kept, so they can still
+// be listed.
+func (s *KeyStore) Revoke(ID string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[ID]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if !key.Revoked() {
+		old := key
+		now := s.now().UTC()
+		key.RevokedAt = &now
+		s.keys[ID] = key
+		if err := s.save(); err != nil {
+			s.keys[ID] = old
+			return APIKey{}, err
+		}
+	}
+	return key, nil
+}
+
+// restore puts back the key kept with ID before a change that could not be
+// saved. The lock must be held.
+func (s *KeyStore) restore(ID string, old APIKey, existed bool) {
+	if existed {
+		s.keys[ID] = old
+	} else {
+		delete(s.keys, ID)
+	}
+}
+
+// save writes the keys to the file of the store, if any, replacing it at
+// once. The lock must be held.
+func (s *KeyStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	saved := make([]savedKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		saved = append(saved, savedKey{APIKey: key, SecretHash: key.secretHash})
+	}
+	sort.Slice(saved, func(i, j int) bool {
+		return saved[i].ID < saved[j].ID
+	})
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("error marshaling API keys: %w", err)
+	}
+
+	// TempFile creates the file readable only by its owner, which keeps the
+	// hashes away from other users.
+	file, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error saving API keys: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving API keys: %w", err)
+	}
+	return nil
+}
+
+// List returns all keys sorted by ID.
+func (s *KeyStore) List() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// Authenticate returns the key for a credential in the form <id>.<secret>.
+func (s *KeyStore) Authenticate(credential string) (APIKey, error) {
+	dot := strings.LastIndex(credential, ".")
+	if dot < 0 {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[credential[:dot]]
+	if !ok || key.Revoked() || subtle.ConstantTimeCompare([]byte(hashSecret(credential[dot+1:])), []byte(key.secretHash)) != 1 {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+// SignedRequest holds what a signature of a server-to-server call covers.
+type SignedRequest struct {
+	KeyID     string
+	Timestamp string // Unix time in seconds
+	Nonce     string // Any value unique to the request
+	Method    string
+	URI       string // Path and query
+	Body      []byte
+}
+
+// StringToSign returns the text signed by a request: the method, URI,
+// timestamp, nonce and the hex SHA-256 of the body, one per line.
+func (r SignedRequest) StringToSign() string {
+	bodyHash := sha256.Sum256(r.Body)
+	return strings.Join([]string{r.Method, r.URI, r.Timestamp, r.Nonce, hex.EncodeToString(bodyHash[:])}, "\n")
+}
+
+// Sign returns the hex HMAC-SHA256 of the request under the hex SHA-256 of
+// secret, which is what the server keeps of it.
+func Sign(r SignedRequest, secret string) string {
+	return sign(r, hashSecret(secret))
+}
+
+func sign(r SignedRequest, secretHash string) string {
+	mac := hmac.New(sha256.New, []byte(secretHash))
+	mac.Write([]byte(r.StringToSign()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// hashSecret returns the hex SHA-256 of an API key secret. Generated secrets
+// are random enough for a fast hash to be safe to keep.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySignature checks the signature of a server-to-server call, its
+// timestamp and that its nonce has not been seen before, and returns the
+// key that signed it.
+func (s *KeyStore) VerifySignature(r SignedRequest, signature string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[r.KeyID]
+	if !ok || key.Revoked() {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	if !hmac.Equal([]byte(signature), []byte(sign(r, key.secretHash))) {
+		return APIKey{}, ErrInvalidSignature
+	}
+
+	seconds, err := strconv.ParseInt(r.Timestamp, 10, 64)
+	if err != nil {
+		return APIKey{}, ErrStaleRequest
+	}
+	now := s.now()
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew > SignatureWindow || skew < -SignatureWindow {
+		return APIKey{}, ErrStaleRequest
+	}
+
+	if r.Nonce == "" {
+		return APIKey{}, ErrInvalidSignature
+	}
+	for nonce, expiry := range s.nonces {
+		if now.After(expiry) {
+			delete(s.nonces, nonce)
+		}
+	}
+	nonce := r.KeyID + " " + r.Nonce
+	if _, seen := s.nonces[nonce]; seen {
+		return APIKey{}, ErrReplayedRequest
+	}
+	s.nonces[nonce] = time.Unix(seconds, 0).Add(SignatureWindow)
+	return key, nil
+}
+
+type keyContextKey struct{}
+
+// NewKeyContext returns a copy of ctx carrying the API key of an
+// authenticated request.
+func NewKeyContext(ctx context.Context, key APIKey) context.Context {
+	return context.WithValue(ctx, keyContextKey{}, key)
+}
+
+// KeyFromContext returns the API key stored in ctx by NewKeyContext, if any.
+func KeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(keyContextKey{}).(APIKey)
+	return key, ok
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("error generating API key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	app "github.com/erikacarvalho/stone-challenge"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoles(t *testing.T) {
+	cases := []struct {
+		role, required string
+		want           bool
+	}{
+		{RoleReadOnly, RoleReadOnly, true},
+		{RoleReadOnly, RoleOperator, false},
+		{RoleOperator, RoleReadOnly, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleAdmin, RoleOperator, true},
+		{"root", RoleReadOnly, false},
+	}
+
+	for _, c := range cases {
+		if got := Allows(c.role, c.required); got != c.want {
+			t.Errorf("Allows(%q, %q) = %v; want %v", c.role, c.required, got, c.want)
+		}
+	}
+}
+
+func TestKeyStore(t *testing.T) {
+	t.Run("should authenticate keys by ID and secret", func(t *testing.T) {
+		keys := NewKeyStore()
+		created, secret, err := keys.Create("conciliação", RoleReadOnly)
+		app.AssertError(t, err, nil)
+
+		key, err := keys.Authenticate(created.ID + "." + secret)
+		app.AssertError(t, err, nil)
+		app.AssertString(t, key.Role, RoleReadOnly)
+
+		_, err = keys.Authenticate(created.ID + ".wrong")
+		app.AssertError(t, err, ErrInvalidAPIKey)
+	})
+
+	t.Run("should return ErrInvalidRole for unknown roles", func(t *testing.T) {
+		_, _, err := NewKeyStore().Create("conciliação", "superuser")
+
+		app.AssertError(t, err, ErrInvalidRole)
+	})
+
+	t.Run("should stop accepting the old secret after rotation", func(t *testing.T) {
+		keys := NewKeyStore()
+		created, oldSecret, _ := keys.Create("parceiro", RoleOperator)
+
+		rotated, newSecret, err := keys.Rotate(created.ID)
+		app.AssertError(t, err, nil)
+		if rotated.RotatedAt == nil {
+			t.Error("rotated key has no rotation time")
+		}
+
+		_, err = keys.Authenticate(created.ID + "." + oldSecret)
+		app.AssertError(t, err, ErrInvalidAPIKey)
+		_, err = keys.Authenticate(created.ID + "." + newSecret)
+		app.AssertError(t, err, nil)
+	})
+
+	t.Run("should refuse revoked keys", func(t *testing.T) {
+		keys := NewKeyStore()
+		created, secret, _ := keys.Create("parceiro", RoleOperator)
+
+		_, err := keys.Revoke(created.ID)
+		app.AssertError(t, err, nil)
+
+		_, err = keys.Authenticate(created.ID + "." + secret)
+		app.AssertError(t, err, ErrInvalidAPIKey)
+		_, _, err = keys.Rotate(created.ID)
+		app.AssertError(t, err, ErrRevokedAPIKey)
+		if !keys.List()[0].Revoked() {
+			t.Error("revoked key is not listed as revoked")
+		}
+	})
+
+	t.Run("should return ErrAPIKeyNotFound for unknown keys", func(t *testing.T) {
+		_, err := NewKeyStore().Revoke("key_0000")
+
+		app.AssertError(t, err, ErrAPIKeyNotFound)
+	})
+
+	t.Run("should keep keys across restarts without their secrets", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "keys")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "api-keys.json")
+
+		keys, err := OpenKeyStore(path)
+		app.AssertError(t, err, nil)
+		created, _, _ := keys.Create("conciliação", RoleReadOnly)
+		_, secret, _ := keys.Rotate(created.ID)
+		revoked, revokedSecret, _ := keys.Create("parceiro", RoleOperator)
+		keys.Revoke(revoked.ID)
+
+		keys, err = OpenKeyStore(path)
+		app.AssertError(t, err, nil)
+		key, err := keys.Authenticate(created.ID + "." + secret)
+		app.AssertError(t, err, nil)
+		if key.RotatedAt == nil {
+			t.Error("restored key has no rotation time")
+		}
+		_, err = keys.Authenticate(revoked.ID + "." + revokedSecret)
+		app.AssertError(t, err, ErrInvalidAPIKey)
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), secret) || strings.Contains(string(data), revokedSecret) {
+			t.Errorf("key store file has a secret: %s", data)
+		}
+	})
+
+	t.Run("should keep when an imported key was created and revoked", func(t *testing.T) {
+		keys := NewKeyStore()
+		imported, _, _ := keys.Import(APIKey{ID: "key_admin", Name: "bootstrap", Role: RoleAdmin}, "s3cr3t")
+		keys.Revoke("key_admin")
+
+		key, _, err := keys.Import(APIKey{ID: "key_admin", Name: "bootstrap", Role: RoleAdmin}, "0th3r")
+
+		app.AssertError(t, err, nil)
+		if !key.CreatedAt.Equal(imported.CreatedAt) || !key.Revoked() {
+			t.Errorf("got key %+v; want it created at %v and revoked", key, imported.CreatedAt)
+		}
+	})
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	newKeyStore := func() (*KeyStore, string) {
+		keys := NewKeyStore()
+		keys.now = func() time.Time { return now }
+		keys.Import(APIKey{ID: "key_partner", Role: RoleOperator}, "segredo")
+		return keys, "segredo"
+	}
+	request := SignedRequest{
+		KeyID:     "key_partner",
+		Timestamp: strconv.FormatInt(now.Unix(), 10),
+		Nonce:     "n-1",
+		Method:    "POST",
+		URI:       "/transfers",
+		Body:      []byte(`{"account_origin_id":1,"account_destination_id":2,"amount":100}`),
+	}
+
+	t.Run("should accept a request signed with the key secret", func(t *testing.T) {
+		keys, secret := newKeyStore()
+
+		key, err := keys.VerifySignature(request, Sign(request, secret))
+
+		app.AssertError(t, err, nil)
+		app.AssertString(t, key.ID, "key_partner")
+	})
+
+	t.Run("should refuse a request whose body was changed", func(t *testing.T) {
+		keys, secret := newKeyStore()
+		signature := Sign(request, secret)
+		tampered := request
+		tampered.Body = []byte(`{"account_origin_id":1,"account_destination_id":2,"amount":100000}`)
+
+		_, err := keys.VerifySignature(tampered, signature)
+
+		app.AssertError(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("should refuse a replayed request", func(t *testing.T) {
+		keys, secret := newKeyStore()
+		signature := Sign(request, secret)
+
+		keys.VerifySignature(request, signature)
+		_, err := keys.VerifySignature(request, signature)
+
+		app.AssertError(t, err, ErrReplayedRequest)
+	})
+
+	t.Run("should refuse a request signed too long ago", func(t *testing.T) {
+		keys, secret := newKeyStore()
+		old := request
+		old.Timestamp = strconv.FormatInt(now.Add(-SignatureWindow-time.Second).Unix(), 10)
+
+		_, err := keys.VerifySignature(old, Sign(old, secret))
+
+		app.AssertError(t, err, ErrStaleRequest)
+	})
+
+	t.Run("should forget nonces once their timestamp is no longer accepted", func(t *testing.T) {
+		keys, secret := newKeyStore()
+		keys.VerifySignature(request, Sign(request, secret))
+
+		now = now.Add(SignatureWindow + time.Second)
+		defer func() { now = now.Add(-SignatureWindow - time.Second) }()
+		later := request
+		later.Nonce = "n-2"
+		later.Timestamp = strconv.FormatInt(now.Unix(), 10)
+		keys.VerifySignature(later, Sign(later, secret))
+
+		if len(keys.nonces) != 1 {
+			t.Errorf("got %d nonces; want 1", len(keys.nonces))
+		}
+	})
+}
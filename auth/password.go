@@ -0,0 +1,100 @@
+// Package auth authenticates customers: it hashes their passwords and issues
+// the signed tokens they send on every request after logging in.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// Iterations is the PBKDF2 work factor used for new password hashes. Hashes
+// keep the number they were made with, so it can be raised at any time.
+const Iterations = 100000
+
+const (
+	hashScheme = "pbkdf2-sha256"
+	saltSize   = 16
+	keySize    = 32
+)
+
+var ErrMalformedHash = errors.New("password hash is malformed")
+
+// HashPassword returns a salted PBKDF2-HMAC-SHA256 hash of password in the
+// form pbkdf2-sha256$<iterations>$<salt>$<key>, ready to be stored.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, saltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("error generating salt: %w", err)
+	}
+	key := pbkdf2(sha256.New, []byte(password), salt, Iterations, keySize)
+	return strings.Join([]string{
+		hashScheme,
+		strconv.Itoa(Iterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// CheckPassword tells whether password matches a hash made by HashPassword.
+func CheckPassword(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return false, ErrMalformedHash
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false, ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false, ErrMalformedHash
+	}
+
+	got := pbkdf2(sha256.New, []byte(password), salt, iterations, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// pbkdf2 derives a key of keyLen bytes as described in RFC 8018, section 5.2.
+func pbkdf2(h func() hash.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var index [4]byte
+		binary.BigEndian.PutUint32(index[:], uint32(block))
+		prf.Write(index[:])
+		u = prf.Sum(u[:0])
+
+		t := make([]byte, hashLen)
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	app "github.com/erikacarvalho/stone-challenge"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	cases := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		want           string
+	}{
+		{"password", "salt", 1, 32, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 40, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+	}
+
+	for _, c := range cases {
+		got := pbkdf2(sha256.New, []byte(c.password), []byte(c.salt), c.iterations, c.keyLen)
+		app.AssertString(t, hex.EncodeToString(got), c.want)
+	}
+}
+
+func TestPasswords(t *testing.T) {
+	encoded, err := HashPassword("s3nh4-f0rt3")
+	if err != nil {
+		t.Fatalf("error hashing password. error: %q", err)
+	}
+
+	t.Run("should not store the password itself", func(t *testing.T) {
+		if strings.Contains(encoded, "s3nh4-f0rt3") {
+			t.Errorf("hash %q contains the password", encoded)
+		}
+	})
+
+	t.Run("should salt every hash", func(t *testing.T) {
+		other, _ := HashPassword("s3nh4-f0rt3")
+		if other == encoded {
+			t.Errorf("got the same hash twice: %q", encoded)
+		}
+	})
+
+	t.Run("should accept the right password only", func(t *testing.T) {
+		ok, err := CheckPassword("s3nh4-f0rt3", encoded)
+		app.AssertError(t, err, nil)
+		if !ok {
+			t.Error("right password was refused")
+		}
+
+		ok, _ = CheckPassword("s3nh4-fraca", encoded)
+		if ok {
+			t.Error("wrong password was accepted")
+		}
+	})
+
+	t.Run("should return ErrMalformedHash for hashes it did not make", func(t *testing.T) {
+		_, err := CheckPassword("s3nh4-f0rt3", "md5$5f4dcc3b5aa765d61d8327deb882cf99")
+		app.AssertError(t, err, ErrMalformedHash)
+	})
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("token is invalid")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Claims are the JWT claims carried by a token. Subject is the CPF of the
+// customer the token was issued to.
+type Claims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// jwtHeader is the only header issued and accepted: tokens signed with any
+// other algorithm are refused.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Issuer issues and verifies JSON Web Tokens signed with HMAC-SHA256.
+type Issuer struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewIssuer returns an Issuer that signs tokens with key, valid for ttl.
+func NewIssuer(key []byte, ttl time.Duration) *Issuer {
+	return &Issuer{key: key, ttl: ttl, now: time.Now}
+}
+
+// Issue returns a signed token for subject and the time it expires.
+func (i *Issuer) Issue(subject string) (token string, expiresAt time.Time, err error) {
+	now := i.now()
+	expiresAt = now.Add(i.ttl)
+	payload, err := json.Marshal(Claims{
+		Subject:   subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error marshaling token claims: %w", err)
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + i.sign(unsigned), expiresAt, nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims.
+func (i *Issuer) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return Claims{}, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(i.sign(parts[0]+"."+parts[1]))) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var claims Claims
+	err = json.Unmarshal(payload, &claims)
+	if err != nil || claims.Subject == "" {
+		return Claims{}, ErrInvalidToken
+	}
+	if !i.now().Before(time.Unix(claims.ExpiresAt, 0)) {
+		return Claims{}, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func (i *Issuer) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, i.key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the claims of an authenticated
+// request.
+func NewContext(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the claims stored in ctx by NewContext, if any.
+func FromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(Claims)
+	return claims, ok
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	app "github.com/erikacarvalho/stone-challenge"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssuer(t *testing.T) {
+	now := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	issuer := NewIssuer([]byte("chave-de-teste"), 15*time.Minute)
+	issuer.now = func() time.Time { return now }
+
+	token, expiresAt, err := issuer.Issue("48226581020")
+	if err != nil {
+		t.Fatalf("error issuing token. error: %q", err)
+	}
+
+	t.Run("should verify its own tokens", func(t *testing.T) {
+		claims, err := issuer.Verify(token)
+
+		app.AssertError(t, err, nil)
+		app.AssertString(t, claims.Subject, "48226581020")
+		app.AssertUint64(t, uint64(claims.ExpiresAt), uint64(expiresAt.Unix()))
+		app.AssertUint64(t, uint64(expiresAt.Sub(now)), uint64(15*time.Minute))
+	})
+
+	t.Run("should refuse tokens signed with another key", func(t *testing.T) {
+		other := NewIssuer([]byte("outra-chave"), 15*time.Minute)
+
+		_, err := other.Verify(token)
+
+		app.AssertError(t, err, ErrInvalidToken)
+	})
+
+	t.Run("should refuse tokens with a changed payload", func(t *testing.T) {
+		parts := strings.Split(token, ".")
+		forged, _, _ := NewIssuer([]byte("outra-chave"), time.Hour).Issue("71530184077")
+		parts[1] = strings.Split(forged, ".")[1]
+
+		_, err := issuer.Verify(strings.Join(parts, "."))
+
+		app.AssertError(t, err, ErrInvalidToken)
+	})
+
+	t.Run("should refuse unsigned tokens", func(t *testing.T) {
+		parts := strings.Split(token, ".")
+		unsigned := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + "."
+
+		_, err := issuer.Verify(unsigned)
+
+		app.AssertError(t, err, ErrInvalidToken)
+	})
+
+	t.Run("should refuse expired tokens", func(t *testing.T) {
+		later := NewIssuer([]byte("chave-de-teste"), 15*time.Minute)
+		later.now = func() time.Time { return now.Add(15 * time.Minute) }
+
+		_, err := later.Verify(token)
+
+		app.AssertError(t, err, ErrExpiredToken)
+	})
+
+	t.Run("should carry claims in a context", func(t *testing.T) {
+		_, ok := FromContext(context.Background())
+		if ok {
+			t.Error("got claims from an empty context")
+		}
+
+		claims, ok := FromContext(NewContext(context.Background(), Claims{Subject: "48226581020"}))
+		if !ok {
+			t.Fatal("got no claims from context")
+		}
+		app.AssertString(t, claims.Subject, "48226581020")
+	})
+}
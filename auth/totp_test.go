@@ -0,0 +1,79 @@
+package auth
+
+import (
+	app "github.com/erikacarvalho/stone-challenge"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHOTP uses the SHA-1 test vectors of RFC 6238, appendix B.
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, c := range cases {
+		got := hotp(key, uint64(c.unix/TOTPPeriod), 8)
+		app.AssertString(t, got, c.want)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+
+	t.Run("should generate six digit codes", func(t *testing.T) {
+		code, err := TOTPCode(secret, now)
+
+		app.AssertError(t, err, nil)
+		app.AssertString(t, code, "081804")
+	})
+
+	t.Run("should accept codes from the adjacent periods only", func(t *testing.T) {
+		previous, _ := TOTPCode(secret, now.Add(-TOTPPeriod*time.Second))
+		old, _ := TOTPCode(secret, now.Add(-2*TOTPPeriod*time.Second))
+
+		step, ok := ValidateTOTP(secret, previous, now)
+		if !ok {
+			t.Error("code from the previous period was refused")
+		}
+		app.AssertUint64(t, uint64(step), uint64(TOTPStep(now)-1))
+
+		_, ok = ValidateTOTP(secret, old, now)
+		if ok {
+			t.Error("code from two periods ago was accepted")
+		}
+	})
+
+	t.Run("should refuse malformed codes", func(t *testing.T) {
+		_, ok := ValidateTOTP(secret, "81804", now)
+		if ok {
+			t.Error("five digit code was accepted")
+		}
+	})
+
+	t.Run("should build a provisioning URI", func(t *testing.T) {
+		got := ProvisioningURI("Banco", "conta 7", "JBSWY3DPEHPK3PXP")
+
+		want := "otpauth://totp/Banco:conta%207?algorithm=SHA1&digits=6&issuer=Banco&period=30&secret=JBSWY3DPEHPK3PXP"
+		app.AssertString(t, got, want)
+	})
+
+	t.Run("should generate decodable secrets", func(t *testing.T) {
+		secret, err := NewTOTPSecret()
+		app.AssertError(t, err, nil)
+
+		_, err = TOTPCode(strings.ToLower(secret), now)
+		app.AssertError(t, err, nil)
+	})
+}
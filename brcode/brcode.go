@@ -0,0 +1,336 @@
+// Package brcode writes and reads BR Codes, the payloads of PIX QR codes, as
+// laid out by the Banco Central do Brasil over the EMV QR Code Merchant
+// Presented Mode.
+//
+// A payload is a sequence of TLV fields: a two-digit ID, a two-digit length
+// and the value, which may hold fields of its own. It ends with field 63,
+// a CRC16-CCITT-FALSE of everything before its value, in hexadecimal.
+package brcode
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GUI identifies the merchant account information of PIX payloads.
+const GUI = "br.gov.bcb.pix"
+
+// IDs of the fields of a payload, and of the fields inside fields 26
+// (merchant account information) and 62 (additional data).
+const (
+	idPayloadFormat    = "00"
+	idInitiationMethod = "01"
+	idMerchantAccount  = "26"
+	idMerchantCategory = "52"
+	idCurrency         = "53"
+	idAmount           = "54"
+	idCountry          = "58"
+	idMerchantName     = "59"
+	idMerchantCity     = "60"
+	idAdditionalData   = "62"
+	idCRC              = "63"
+
+	idGUI         = "00"
+	idKey         = "01"
+	idDescription = "02"
+	idLocation    = "25"
+	idTxID        = "05"
+)
+
+// Values of the fields that are the same in every payload written.
+const (
+	payloadFormat    = "01"
+	singleUse        = "12"
+	reusable         = "11"
+	merchantCategory = "0000"
+	currencyReal     = "986"
+	country          = "BR"
+	noTxID           = "***"
+	crcField         = idCRC + "04" // Field 63 up to its value
+	crcLength        = 4
+)
+
+// Longest values of the fields. The key and the description share field
+// 26 with the GUI, and each takes four more characters for its ID and
+// length.
+const (
+	maxValueLength       = 99
+	maxKeyAndDescription = maxValueLength - 4 - len(GUI) - 8
+	maxMerchantName      = 25
+	maxMerchantCity      = 15
+	maxTxID              = 25
+	maxAmountLength      = 13
+)
+
+var ErrInvalidPayload = errors.New("invalid BR Code")
+
+// Payload is a PIX charge. Static payloads may be paid any number of times;
+// dynamic ones are meant to be paid once and carry the TxID the receiver
+// knows the charge by.
+type Payload struct {
+	Dynamic      bool
+	Key          string // Addressing key of the receiver
+	Description  string // Shown to the payer
+	Amount       uint64 // Amount in cents; 0 lets the payer choose it
+	MerchantName string
+	MerchantCity string
+	TxID         string // Identifies the charge, with up to 25 letters and digits
+}
+
+// Encode returns the payload as a BR Code. Names are written without
+// accents, and must fit their fields along with the other values, or an
+// error wrapping ErrInvalidPayload is returned.
+func Encode(p Payload) (string, error) {
+	name, city := ascii(p.MerchantName), ascii(p.MerchantCity)
+	switch {
+	case p.Key == "":
+		return "", fmt.Errorf("%w: the key is required", ErrInvalidPayload)
+	case name == "" || len(name) > maxMerchantName:
+		return "", fmt.Errorf("%w: the merchant name must have from 1 to %d characters", ErrInvalidPayload, maxMerchantName)
+	case city == "" || len(city) > maxMerchantCity:
+		return "", fmt.Errorf("%w: the merchant city must have from 1 to %d characters", ErrInvalidPayload, maxMerchantCity)
+	case !validTxID(p.TxID):
+		return "", fmt.Errorf("%w: the txid must have up to %d letters and digits", ErrInvalidPayload, maxTxID)
+	}
+	amount := fmt.Sprintf("%d.%02d", p.Amount/100, p.Amount%100)
+	if len(amount) > maxAmountLength {
+		return "", fmt.Errorf("%w: the amount must have at most %d characters, as %s has %d", ErrInvalidPayload, maxAmountLength, amount, len(amount))
+	}
+
+	account := field(idGUI, GUI) + field(idKey, p.Key)
+	if p.Description != "" {
+		account += field(idDescription, ascii(p.Description))
+	}
+	if len(account) > maxValueLength {
+		return "", fmt.Errorf("%w: the key and the description must have at most %d characters together", ErrInvalidPayload, maxKeyAndDescription)
+	}
+	txID := p.TxID
+	if txID == "" {
+		txID = noTxID
+	}
+
+	var b strings.Builder
+	b.WriteString(field(idPayloadFormat, payloadFormat))
+	if p.Dynamic {
+		b.WriteString(field(idInitiationMethod, singleUse))
+	}
+	b.WriteString(field(idMerchantAccount, account))
+	b.WriteString(field(idMerchantCategory, merchantCategory))
+	b.WriteString(field(idCurrency, currencyReal))
+	if p.Amount > 0 {
+		b.WriteString(field(idAmount, amount))
+	}
+	b.WriteString(field(idCountry, country))
+	b.WriteString(field(idMerchantName, name))
+	b.WriteString(field(idMerchantCity, city))
+	b.WriteString(field(idAdditionalData, field(idTxID, txID)))
+	b.WriteString(crcField)
+	return b.String() + fmt.Sprintf("%04X", CRC16([]byte(b.String()))), nil
+}
+
+// Parse reads a BR Code. The CRC must match, the fields every payload has
+// must be there and it must be a PIX charge in reais with the key of the
+// receiver, or an error wrapping ErrInvalidPayload is returned. Payloads
+// that point to a location to fetch the charge from are not supported.
+func Parse(s string) (Payload, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < len(crcField)+crcLength || s[len(s)-crcLength-len(crcField):len(s)-crcLength] != crcField {
+		return Payload{}, fmt.Errorf("%w: it must end with the CRC, in field 63", ErrInvalidPayload)
+	}
+	body, checksum := s[:len(s)-crcLength], s[len(s)-crcLength:]
+	if want := fmt.Sprintf("%04X", CRC16([]byte(body))); !strings.EqualFold(checksum, want) {
+		return Payload{}, fmt.Errorf("%w: CRC %s does not match the payload", ErrInvalidPayload, checksum)
+	}
+
+	fields, err := splitFields(body[:len(body)-len(crcField)])
+	if err != nil {
+		return Payload{}, err
+	}
+	if !strings.HasPrefix(body, field(idPayloadFormat, payloadFormat)) {
+		return Payload{}, fmt.Errorf("%w: it must start with payload format indicator %s", ErrInvalidPayload, payloadFormat)
+	}
+	for _, id := range []string{idMerchantAccount, idMerchantCategory, idCurrency, idCountry, idMerchantName, idMerchantCity} {
+		if fields[id] == "" {
+			return Payload{}, fmt.Errorf("%w: field %s is required", ErrInvalidPayload, id)
+		}
+	}
+	if fields[idCurrency] != currencyReal {
+		return Payload{}, fmt.Errorf("%w: currency %s is not reais (%s)", ErrInvalidPayload, fields[idCurrency], currencyReal)
+	}
+	if fields[idCountry] != country {
+		return Payload{}, fmt.Errorf("%w: country %s is not %s", ErrInvalidPayload, fields[idCountry], country)
+	}
+	p := Payload{MerchantName: fields[idMerchantName], MerchantCity: fields[idMerchantCity]}
+	switch method := fields[idInitiationMethod]; method {
+	case "", reusable:
+	case singleUse:
+		p.Dynamic = true
+	default:
+		return Payload{}, fmt.Errorf("%w: point of initiation method %s is not %s or %s", ErrInvalidPayload, method, reusable, singleUse)
+	}
+
+	account, err := splitFields(fields[idMerchantAccount])
+	if err != nil {
+		return Payload{}, err
+	}
+	if !strings.EqualFold(account[idGUI], GUI) {
+		return Payload{}, fmt.Errorf("%w: the merchant account information is not of %s", ErrInvalidPayload, GUI)
+	}
+	if account[idLocation] != "" {
+		return Payload{}, fmt.Errorf("%w: payloads with a location URL are not supported", ErrInvalidPayload)
+	}
+	p.Key, p.Description = account[idKey], account[idDescription]
+	if p.Key == "" {
+		return Payload{}, fmt.Errorf("%w: the merchant account information has no key", ErrInvalidPayload)
+	}
+
+	if amount, ok := fields[idAmount]; ok {
+		p.Amount, err = parseAmount(amount)
+		if err != nil {
+			return Payload{}, err
+		}
+	}
+	if data, ok := fields[idAdditionalData]; ok {
+		additional, err := splitFields(data)
+		if err != nil {
+			return Payload{}, err
+		}
+		if txID := additional[idTxID]; txID != noTxID {
+			p.TxID = txID
+		}
+		if !validTxID(p.TxID) {
+			return Payload{}, fmt.Errorf("%w: the txid must have up to %d letters and digits", ErrInvalidPayload, maxTxID)
+		}
+	}
+	return p, nil
+}
+
+// CRC16 returns the CRC16-CCITT-FALSE of data: polynomial 0x1021, starting
+// at 0xFFFF, with no reflection and no final XOR.
+func CRC16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// field returns a TLV field. The value must have at most 99 characters.
+func field(id, value string) string {
+	return fmt.Sprintf("%s%02d%s", id, len(value), value)
+}
+
+// splitFields splits s into its TLV fields, by ID.
+func splitFields(s string) (map[string]string, error) {
+	values := map[string]string{}
+	for len(s) > 0 {
+		if len(s) < 4 {
+			return nil, fmt.Errorf("%w: field %q is cut short", ErrInvalidPayload, s)
+		}
+		id := s[:2]
+		length, err := strconv.Atoi(s[2:4])
+		if err != nil || !isDigits(id) || !isDigits(s[2:4]) {
+			return nil, fmt.Errorf("%w: %q is not the start of a field", ErrInvalidPayload, s[:4])
+		}
+		if len(s) < 4+length {
+			return nil, fmt.Errorf("%w: field %s has %d characters in place of %d", ErrInvalidPayload, id, len(s)-4, length)
+		}
+		if _, ok := values[id]; ok {
+			return nil, fmt.Errorf("%w: field %s is repeated", ErrInvalidPayload, id)
+		}
+		values[id] = s[4 : 4+length]
+		s = s[4+length:]
+	}
+	return values, nil
+}
+
+// parseAmount parses an amount in reais, such as 10.50, into cents.
+func parseAmount(s string) (uint64, error) {
+	invalid := fmt.Errorf("%w: amount %q must be in reais, such as 10.50", ErrInvalidPayload, s)
+	if len(s) > maxAmountLength {
+		return 0, invalid
+	}
+	parts := strings.SplitN(s, ".", 2)
+	if !isDigits(parts[0]) {
+		return 0, invalid
+	}
+	reais, _ := strconv.ParseUint(parts[0], 10, 64)
+	var cents uint64
+	if len(parts) == 2 {
+		if len(parts[1]) > 2 || !isDigits(parts[1]) {
+			return 0, invalid
+		}
+		cents, _ = strconv.ParseUint(parts[1], 10, 64)
+		if len(parts[1]) == 1 {
+			cents *= 10
+		}
+	}
+	if reais == 0 && cents == 0 {
+		return 0, invalid
+	}
+	return reais*100 + cents, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func validTxID(s string) bool {
+	if len(s) > maxTxID {
+		return false
+	}
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// accents maps the accented letters of Portuguese to their plain ones.
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a", "é", "e", "ê", "e", "è", "e",
+	"í", "i", "ï", "i", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ú", "u", "ü", "u", "ç", "c",
+	"Á", "A", "À", "A", "Â", "A", "Ã", "A", "Ä", "A", "É", "E", "Ê", "E", "È", "E",
+	"Í", "I", "Ï", "I", "Ó", "O", "Ô", "O", "Õ", "O", "Ö", "O", "Ú", "U", "Ü", "U", "Ç", "C",
+)
+
+// MerchantName returns name as it fits the merchant name field: without
+// accents and cut to its first 25 characters.
+func MerchantName(name string) string {
+	name = ascii(name)
+	if len(name) > maxMerchantName {
+		name = strings.TrimSpace(name[:maxMerchantName])
+	}
+	return name
+}
+
+// ascii returns s without accents and without any other character outside
+// printable ASCII, so that lengths count characters.
+func ascii(s string) string {
+	s = accents.Replace(strings.TrimSpace(s))
+	var b strings.Builder
+	for _, r := range s {
+		if r >= ' ' && r <= '~' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
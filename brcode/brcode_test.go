@@ -0,0 +1,135 @@
+package brcode
+
+import (
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"strings"
+	"testing"
+)
+
+// manualExample is the static payload of the BR Code manual of the Banco
+// Central do Brasil.
+const manualExample = "00020126580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-4266554400005204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***63041D3D"
+
+func TestCRC16(t *testing.T) {
+	if got := CRC16([]byte("123456789")); got != 0x29B1 {
+		t.Errorf("got CRC %04X; want 29B1", got)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	t.Run("should write the payload of the manual", func(t *testing.T) {
+		got, err := Encode(Payload{Key: "123e4567-e12b-12d1-a456-426655440000", MerchantName: "Fulano de Tal", MerchantCity: "BRASILIA"})
+
+		app.AssertError(t, err, nil)
+		app.AssertString(t, got, manualExample)
+	})
+
+	t.Run("should write dynamic payloads with amount, description and txid", func(t *testing.T) {
+		payload := Payload{Dynamic: true, Key: "+5511987654321", Description: "Pedido 42", Amount: 1050, MerchantName: "Papelaria Dunder Mifflin", MerchantCity: "São Paulo", TxID: "PEDIDO42"}
+
+		got, err := Encode(payload)
+
+		app.AssertError(t, err, nil)
+		for _, want := range []string{"010212", "0114+5511987654321", "0209Pedido 42", "540510.50", "6009Sao Paulo", "62120508PEDIDO42"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("got payload %s; want it to contain %s", got, want)
+			}
+		}
+		parsed, err := Parse(got)
+		app.AssertError(t, err, nil)
+		payload.MerchantCity = "Sao Paulo"
+		if parsed != payload {
+			t.Errorf("got %+v; want %+v", parsed, payload)
+		}
+	})
+
+	t.Run("should refuse values that do not fit", func(t *testing.T) {
+		for _, payload := range []Payload{
+			{MerchantName: "Fulano de Tal", MerchantCity: "BRASILIA"},
+			{Key: "fulano@exemplo.com", MerchantName: strings.Repeat("F", 26), MerchantCity: "BRASILIA"},
+			{Key: "fulano@exemplo.com", MerchantName: "Fulano de Tal", MerchantCity: "SAO JOSE DOS CAMPOS"},
+			{Key: "fulano@exemplo.com", MerchantName: "Fulano de Tal", MerchantCity: "BRASILIA", TxID: "pedido-42"},
+			{Key: "fulano@exemplo.com", Description: strings.Repeat("d", 60), MerchantName: "Fulano de Tal", MerchantCity: "BRASILIA"},
+			{Key: "fulano@exemplo.com", Amount: 10000000000000, MerchantName: "Fulano de Tal", MerchantCity: "BRASILIA"},
+		} {
+			_, err := Encode(payload)
+			if !errors.Is(err, ErrInvalidPayload) {
+				t.Errorf("got error %v for %+v; want %v", err, payload, ErrInvalidPayload)
+			}
+		}
+	})
+}
+
+func TestMerchantName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Fulano de Tal", "Fulano de Tal"},
+		{"Papelaria e Livraria São Dunder", "Papelaria e Livraria Sao"},
+		{"Conceição Aparecida Gonçalves", "Conceicao Aparecida Gonca"},
+	}
+	for _, tt := range tests {
+		app.AssertString(t, MerchantName(tt.name), tt.want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Run("should read the payload of the manual", func(t *testing.T) {
+		got, err := Parse(manualExample)
+
+		app.AssertError(t, err, nil)
+		want := Payload{Key: "123e4567-e12b-12d1-a456-426655440000", MerchantName: "Fulano de Tal", MerchantCity: "BRASILIA"}
+		if got != want {
+			t.Errorf("got %+v; want %+v", got, want)
+		}
+	})
+
+	t.Run("should read amounts in reais", func(t *testing.T) {
+		for amount, want := range map[string]uint64{"10": 1000, "10.5": 1050, "0.01": 1, "1234.56": 123456} {
+			got, err := parseAmount(amount)
+			app.AssertError(t, err, nil)
+			app.AssertUint64(t, got, want)
+		}
+		for _, amount := range []string{"", "0", "0.00", "10,50", "10.505", "-1", "1.2.3", "12345678901.00"} {
+			if _, err := parseAmount(amount); !errors.Is(err, ErrInvalidPayload) {
+				t.Errorf("got error %v for amount %q; want %v", err, amount, ErrInvalidPayload)
+			}
+		}
+	})
+
+	t.Run("should refuse invalid payloads", func(t *testing.T) {
+		// withCRC replaces the CRC of a payload with the right one for it.
+		withCRC := func(payload string) string {
+			body := payload[:len(payload)-crcLength]
+			return body + fmt.Sprintf("%04X", CRC16([]byte(body)))
+		}
+		tests := []struct {
+			name    string
+			payload string
+		}{
+			{"wrong CRC", strings.Replace(manualExample, "1D3D", "1D3E", 1)},
+			{"no CRC", strings.TrimSuffix(manualExample, "63041D3D")},
+			{"changed amount", strings.Replace(manualExample, "5802BR", "54031.05802BR", 1)},
+			{"cut field", withCRC("000201260814br.gov5204000053039865802BR5913Fulano de Tal6008BRASILIA63041D3D")},
+			{"other currency", withCRC(strings.Replace(manualExample, "5303986", "5303840", 1))},
+			{"other country", withCRC(strings.Replace(manualExample, "5802BR", "5802PT", 1))},
+			{"other GUI", withCRC(strings.Replace(manualExample, "0014br.gov.bcb.pix", "0014br.gov.bcb.xyz", 1))},
+			{"no merchant name", withCRC(strings.Replace(manualExample, "5913Fulano de Tal", "", 1))},
+			{"repeated field", withCRC(strings.Replace(manualExample, "5802BR", "5802BR5802BR", 1))},
+			{"unknown initiation method", withCRC(strings.Replace(manualExample, "000201", "000201010213", 1))},
+			{"location URL", withCRC(strings.Replace(manualExample, "26580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-426655440000", "26400014br.gov.bcb.pix2518pix.exemplo.com/42", 1))},
+			{"invalid amount", withCRC(strings.Replace(manualExample, "5802BR", "540510,505802BR", 1))},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := Parse(tt.payload)
+				if !errors.Is(err, ErrInvalidPayload) {
+					t.Errorf("got error %v; want %v", err, ErrInvalidPayload)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	api "github.com/erikacarvalho/stone-challenge/http"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// ListAPIKeys returns every API key, without secrets. It needs an admin
+// key.
+func (c *Client) ListAPIKeys(ctx context.Context) ([]api.APIKeyResponse, error) {
+	var keys []api.APIKeyResponse
+	_, err := c.do(ctx, http.MethodGet, "/admin/keys", nil, &keys)
+	return keys, err
+}
+
+// CreateAPIKey creates an API key with role and returns it along with its
+// secret, which cannot be read again. It needs an admin key.
+func (c *Client) CreateAPIKey(ctx context.Context, name, role string) (api.APIKeyResponse, error) {
+	var key api.APIKeyResponse
+	_, err := c.do(ctx, http.MethodPost, "/admin/keys", api.CreateAPIKeyRequest{Name: name, Role: role}, &key)
+	return key, err
+}
+
+// RotateAPIKey gives an API key a new secret and returns it. It needs an
+// admin key.
+func (c *Client) RotateAPIKey(ctx context.Context, keyID string) (api.APIKeyResponse, error) {
+	var key api.APIKeyResponse
+	_, err := c.do(ctx, http.MethodPost, "/admin/keys/"+url.PathEscape(keyID)+"/rotate", nil, &key)
+	return key, err
+}
+
+// RevokeAPIKey revokes an API key for good. It needs an admin key.
+func (c *Client) RevokeAPIKey(ctx context.Context, keyID string) (api.APIKeyResponse, error) {
+	var key api.APIKeyResponse
+	_, err := c.do(ctx, http.MethodDelete, "/admin/keys/"+url.PathEscape(keyID), nil, &key)
+	return key, err
+}
+
+// Export writes an export of every account and transfer to w, as NDJSON
+// ending in a checksum line. It needs an admin key. The export holds
+// password hashes and TOTP secrets, so it must be kept safe.
+func (c *Client) Export(ctx context.Context, w io.Writer) error {
+	_, err := c.send(ctx, http.MethodGet, "/admin/export", "", nil, w)
+	return err
+}
+
+// Import adds the accounts and transfers of the export read from r to the
+// bank. In merge mode, an export with IDs already in use is refused; in
+// replace mode, every account and transfer is dropped first. It needs an
+// admin key.
+func (c *Client) Import(ctx context.Context, r io.Reader, mode string) (api.ImportResponse, error) {
+	payload, err := ioutil.ReadAll(r)
+	if err != nil {
+		return api.ImportResponse{}, fmt.Errorf("error reading export: %w", err)
+	}
+	var result api.ImportResponse
+	_, err = c.send(ctx, http.MethodPost, "/admin/import?mode="+url.QueryEscape(mode), api.NDJSONContentType, payload, &result)
+	return result, err
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	api "github.com/erikacarvalho/stone-challenge/http"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"github.com/erikacarvalho/stone-challenge/webhook"
+	"strings"
+	"testing"
+)
+
+func TestAdmin(t *testing.T) {
+	ctx := context.Background()
+	keys := auth.NewKeyStore()
+	keys.Import(auth.APIKey{ID: "key_admin", Name: "admin", Role: auth.RoleAdmin}, "segredo")
+	server, _, _ := newTestServer(t, nil, api.WithAPIKeys(keys))
+	defer server.Close()
+	admin := New(server.URL, WithAPIKey("key_admin.segredo"))
+
+	created, err := admin.CreateAPIKey(ctx, "conciliação", auth.RoleReadOnly)
+	app.AssertError(t, err, nil)
+	app.AssertString(t, created.Role, auth.RoleReadOnly)
+	if created.Secret == "" {
+		t.Fatal("got no secret for the new key")
+	}
+
+	listed, err := admin.ListAPIKeys(ctx)
+	app.AssertError(t, err, nil)
+	app.AssertUint64(t, uint64(len(listed)), 2)
+
+	rotated, err := admin.RotateAPIKey(ctx, created.ID)
+	app.AssertError(t, err, nil)
+	if rotated.Secret == "" || rotated.Secret == created.Secret {
+		t.Errorf("got secret %q after rotating; want a new one", rotated.Secret)
+	}
+
+	revoked, err := admin.RevokeAPIKey(ctx, created.ID)
+	app.AssertError(t, err, nil)
+	if revoked.RevokedAt == nil {
+		t.Error("got the key without a revocation time")
+	}
+
+	_, err = admin.RotateAPIKey(ctx, created.ID)
+	if !errors.Is(err, ErrAPIKeyRevoked) {
+		t.Errorf("got error %v; want %v", err, ErrAPIKeyRevoked)
+	}
+	_, err = admin.RevokeAPIKey(ctx, "key_nenhuma")
+	if !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("got error %v; want %v", err, ErrAPIKeyNotFound)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	keys := auth.NewKeyStore()
+	keys.Import(auth.APIKey{ID: "key_admin", Name: "admin", Role: auth.RoleAdmin}, "segredo")
+	source, _, _ := newTestServer(t, nil, api.WithAPIKeys(keys))
+	defer source.Close()
+	target, accountStore, _ := newTestServer(t, nil, api.WithAPIKeys(keys))
+	defer target.Close()
+
+	var export bytes.Buffer
+	err := New(source.URL, WithAPIKey("key_admin.segredo")).Export(ctx, &export)
+	app.AssertError(t, err, nil)
+
+	admin := New(target.URL, WithAPIKey("key_admin.segredo"))
+	_, err = admin.Import(ctx, bytes.NewReader(export.Bytes()), store.ImportMerge)
+	if !errors.Is(err, ErrImportConflict) {
+		t.Errorf("got error %v; want %v", err, ErrImportConflict)
+	}
+	accountStore.CreateAccount(ctx, "Ana Lima", "12345678909", 0)
+	imported, err := admin.Import(ctx, bytes.NewReader(export.Bytes()), store.ImportReplace)
+	app.AssertError(t, err, nil)
+	app.AssertUint64(t, uint64(imported.Accounts), 2)
+	app.AssertUint64(t, imported.AccountMaxID, 2)
+	_, err = admin.Import(ctx, strings.NewReader("{}\n"), store.ImportMerge)
+	if !errors.Is(err, ErrInvalidExport) {
+		t.Errorf("got error %v; want %v", err, ErrInvalidExport)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	keys := auth.NewKeyStore()
+	keys.Import(auth.APIKey{ID: "key_admin", Name: "admin", Role: auth.RoleAdmin}, "segredo")
+	server, _, _ := newTestServer(t, nil, api.WithAPIKeys(keys), api.WithWebhooks(webhook.NewDispatcher(nil)))
+	defer server.Close()
+	admin := New(server.URL, WithAPIKey("key_admin.segredo"))
+
+	created, err := admin.CreateWebhook(ctx, "https://example.com/hooks", "transfer.*")
+	app.AssertError(t, err, nil)
+	if created.Secret == "" {
+		t.Fatal("got no secret for the new webhook")
+	}
+	_, err = admin.CreateWebhook(ctx, "example.com")
+	if !errors.Is(err, ErrInvalidWebhookURL) {
+		t.Errorf("got error %v; want %v", err, ErrInvalidWebhookURL)
+	}
+
+	listed, err := admin.ListWebhooks(ctx)
+	app.AssertError(t, err, nil)
+	app.AssertUint64(t, uint64(len(listed)), 1)
+	deadLetters, err := admin.ListDeadLetters(ctx)
+	app.AssertError(t, err, nil)
+	app.AssertUint64(t, uint64(len(deadLetters)), 0)
+	_, err = admin.Redeliver(ctx, "dlv_nenhuma")
+	if !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("got error %v; want %v", err, ErrDeliveryNotFound)
+	}
+
+	_, err = admin.DeleteWebhook(ctx, created.ID)
+	app.AssertError(t, err, nil)
+	_, err = admin.DeleteWebhook(ctx, created.ID)
+	if !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("got error %v; want %v", err, ErrWebhookNotFound)
+	}
+}
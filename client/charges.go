@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	api "github.com/erikacarvalho/stone-challenge/http"
+	"net/http"
+)
+
+// CreateCharge issues a BR Code paying an account through one of its
+// addressing keys.
+func (c *Client) CreateCharge(ctx context.Context, accountID uint64, request api.CreateChargeRequest) (api.ChargeResponse, error) {
+	var charge api.ChargeResponse
+	_, err := c.do(ctx, http.MethodPost, fmt.Sprintf("/accounts/%d/charges", accountID), request, &charge)
+	return charge, err
+}
+
+// ListCharges returns the dynamic charges an account has issued.
+func (c *Client) ListCharges(ctx context.Context, accountID uint64) ([]app.Charge, error) {
+	var charges []app.Charge
+	_, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/accounts/%d/charges", accountID), nil, &charges)
+	return charges, err
+}
+
+// PayBRCode pays the charge of a BR Code. Like CreateTransfer, transfers that
+// wait for a TOTP confirmation come back with the Pending Confirmation
+// status.
+func (c *Client) PayBRCode(ctx context.Context, request api.PayBRCodeRequest) (api.CreateTransferResponse, error) {
+	var response api.CreateTransferResponse
+	_, err := c.do(ctx, http.MethodPost, "/transfers/brcode", request, &response)
+	return response, err
+}
@@ -0,0 +1,363 @@
+// Package client calls the bank API from Go programs. It sends
+// idempotency keys with every POST, so that requests can be retried safely,
+// returns the API errors as *Error and walks paginated lists with
+// iterators.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	api "github.com/erikacarvalho/stone-challenge/http"
+	"io"
+	"io/ioutil"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds each attempt of a request made with the default
+	// HTTP client.
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultRetries is how many times a request is retried after the first
+	// attempt fails.
+	DefaultRetries = 2
+
+	// DefaultBackoff is the wait before the first retry. It doubles with
+	// each retry, up to MaxBackoff.
+	DefaultBackoff = 100 * time.Millisecond
+
+	// MaxBackoff is the longest wait between two attempts, unless the server
+	// asks for a longer one with Retry-After.
+	MaxBackoff = 5 * time.Second
+)
+
+// Client calls the bank API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	apiKey     string
+	retries    int
+	backoff    time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient makes requests with c instead of a client with
+// DefaultTimeout.
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// WithToken authenticates requests with a customer token, as returned by
+// Login.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithAPIKey authenticates requests with an API key, written as
+// <id>.<secret>.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithRetries retries failed requests up to retries times, waiting backoff
+// before the first retry and doubling the wait after each one. Zero retries
+// turns retrying off.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// New returns a client for the API served at baseURL, such as
+// http://localhost:3000.
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		retries:    DefaultRetries,
+		backoff:    DefaultBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+type idempotencyKey struct{}
+
+// ContextWithIdempotencyKey returns a context that makes the POST sent with
+// it use key as its idempotency key. Without one, each call gets a random
+// key, which protects its own retries but not calls repeated by the caller.
+func ContextWithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// Login returns a token for the customer with cpf, to be used with
+// WithToken.
+func (c *Client) Login(ctx context.Context, cpf, password string) (api.LoginResponse, error) {
+	var response api.LoginResponse
+	_, err := c.do(ctx, http.MethodPost, "/login", api.LoginRequest{CPF: cpf, Password: password}, &response)
+	return response, err
+}
+
+// CreateAccount opens an account and returns its ID.
+func (c *Client) CreateAccount(ctx context.Context, request api.CreateAccountRequest) (uint64, error) {
+	var response api.CreateAccountResponse
+	_, err := c.do(ctx, http.MethodPost, "/accounts", request, &response)
+	return response.ID, err
+}
+
+// GetBalance returns the balance of an account.
+func (c *Client) GetBalance(ctx context.Context, accountID uint64) (api.GetBalanceResponse, error) {
+	var response api.GetBalanceResponse
+	_, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/accounts/%d/balance", accountID), nil, &response)
+	return response, err
+}
+
+// StatementOptions selects the format and period of a statement. Zero
+// values get the defaults of the API: CSV for the current month up to
+// today, with ';' between fields and ',' before the cents.
+type StatementOptions struct {
+	Format    string    // api.StatementCSV or api.StatementOFX
+	From      time.Time // First day of the period, in UTC
+	To        time.Time // Last day of the period, in UTC
+	Delimiter rune      // Separates CSV fields
+	Decimal   rune      // Separates reais from cents in CSV amounts
+}
+
+func (o StatementOptions) query() string {
+	query := url.Values{}
+	if o.Format != "" {
+		query.Set("format", o.Format)
+	}
+	if !o.From.IsZero() {
+		query.Set("from", o.From.Format("2006-01-02"))
+	}
+	if !o.To.IsZero() {
+		query.Set("to", o.To.Format("2006-01-02"))
+	}
+	if o.Delimiter != 0 {
+		query.Set("delimiter", string(o.Delimiter))
+	}
+	if o.Decimal != 0 {
+		query.Set("decimal", string(o.Decimal))
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+// Statement writes the statement of an account to w, as CSV or OFX, with
+// its balances at the start and end of the period.
+func (c *Client) Statement(ctx context.Context, accountID uint64, options StatementOptions, w io.Writer) error {
+	_, err := c.send(ctx, http.MethodGet, fmt.Sprintf("/accounts/%d/statement", accountID)+options.query(), "", nil, w)
+	return err
+}
+
+// CreateTransfer transfers an amount between accounts. Transfers that wait
+// for a TOTP confirmation come back with the Pending Confirmation status.
+func (c *Client) CreateTransfer(ctx context.Context, request api.CreateTransferRequest) (api.CreateTransferResponse, error) {
+	var response api.CreateTransferResponse
+	_, err := c.do(ctx, http.MethodPost, "/transfers", request, &response)
+	return response, err
+}
+
+// GetTransfer returns a transfer.
+func (c *Client) GetTransfer(ctx context.Context, transferID uint64) (app.Transfer, error) {
+	var transfer app.Transfer
+	_, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/transfers/%d", transferID), nil, &transfer)
+	return transfer, err
+}
+
+// PayCNAB sends the CNAB 240 remessa read from r to be paid and writes the
+// retorno, which tells how each payment went, to w. It needs an operator
+// key. Retrying the request does not pay the remessa twice; calling PayCNAB
+// again does, unless ctx has the same key from ContextWithIdempotencyKey.
+func (c *Client) PayCNAB(ctx context.Context, r io.Reader, w io.Writer) error {
+	payload, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading remessa: %w", err)
+	}
+	_, err = c.send(ctx, http.MethodPost, "/batches/cnab240", api.CNABContentType, payload, w)
+	return err
+}
+
+// do sends a request with body encoded as JSON and decodes the response
+// into out, retrying it when it fails in a way a retry may fix. POST
+// requests are sent with an idempotency key, so retrying them does not
+// repeat their effect. It returns the headers of the last response.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) (http.Header, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding request: %w", err)
+		}
+	}
+	return c.send(ctx, method, path, api.JsonContentType, payload, out)
+}
+
+// send sends a request with payload, of the given content type, as do
+// does. If out is an io.Writer, the response body is copied to it as it
+// arrives, and the request is not retried once it starts arriving.
+func (c *Client) send(ctx context.Context, method, path, contentType string, payload []byte, out interface{}) (http.Header, error) {
+	var key string
+	if method == http.MethodPost {
+		key, _ = ctx.Value(idempotencyKey{}).(string)
+		if key == "" {
+			var err error
+			key, err = newIdempotencyKey()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		header, retryAfter, err := c.attempt(ctx, method, path, contentType, payload, key, out)
+		if err == nil || attempt >= c.retries || !retryable(err) {
+			return header, err
+		}
+		if ctx.Err() != nil {
+			return header, ctx.Err()
+		}
+
+		wait := c.backoffFor(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return header, ctx.Err()
+		}
+	}
+}
+
+// attempt sends a request once. Besides the response headers, it returns
+// how long the server asked to wait before a retry, if it did.
+func (c *Client) attempt(ctx context.Context, method, path, contentType string, payload []byte, key string, out interface{}) (http.Header, time.Duration, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	request, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Accept", api.JsonContentType)
+	if payload != nil {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if key != "" {
+		request.Header.Set(api.IdempotencyKeyHeader, key)
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.apiKey != "" {
+		request.Header.Set(api.APIKeyHeader, c.apiKey)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, 0, &networkError{err}
+	}
+	defer response.Body.Close()
+
+	if w, ok := out.(io.Writer); ok && response.StatusCode < http.StatusBadRequest {
+		_, err = io.Copy(w, response.Body)
+		if err != nil {
+			return response.Header, 0, fmt.Errorf("error reading response to %s %s: %w", method, path, err)
+		}
+		return response.Header, 0, nil
+	}
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return response.Header, 0, &networkError{err}
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return response.Header, retryAfter, newError(response, responseBody)
+	}
+	if out != nil {
+		err = json.Unmarshal(responseBody, out)
+		if err != nil {
+			return response.Header, 0, fmt.Errorf("error decoding response to %s %s: %w", method, path, err)
+		}
+	}
+	return response.Header, 0, nil
+}
+
+// backoffFor returns how long to wait before the retry that follows
+// attempt, with some jitter so that clients that failed together do not
+// retry together.
+func (c *Client) backoffFor(attempt int) time.Duration {
+	wait := c.backoff << uint(attempt)
+	if wait > MaxBackoff || wait <= 0 {
+		wait = MaxBackoff
+	}
+	return wait/2 + time.Duration(mathrand.Int63n(int64(wait/2)+1))
+}
+
+// networkError is a request that got no response, which is always worth
+// retrying: GET requests do not change anything and POST requests carry an
+// idempotency key.
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string {
+	return e.err.Error()
+}
+
+func (e *networkError) Unwrap() error {
+	return e.err
+}
+
+func retryable(err error) bool {
+	switch err := err.(type) {
+	case *networkError:
+		return true
+	case *Error:
+		return err.Temporary()
+	}
+	return false
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("error generating idempotency key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,536 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	api "github.com/erikacarvalho/stone-challenge/http"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newStores() (*store.AccountStore, *store.TransferStore) {
+	accountStore := store.NewAccountStore(app.StartingID(2),
+		app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 10000},
+		app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 0},
+	)
+	return accountStore, store.NewTransferStore(app.StartingID(0))
+}
+
+// newTestServer serves a bank API built from api.NewServer, letting wrap
+// tamper with the requests and responses to it. Callers must close it.
+func newTestServer(t *testing.T, wrap func(http.Handler) http.Handler, options ...api.Option) (*httptest.Server, *store.AccountStore, *store.TransferStore) {
+	t.Helper()
+	accountStore, transferStore := newStores()
+	var handler http.Handler = api.NewServer(accountStore, transferStore, options...)
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	return httptest.NewServer(handler), accountStore, transferStore
+}
+
+// dropResponses lets the API handle the first n requests but closes the
+// connection instead of answering them, as if the response got lost.
+func dropResponses(n int32) func(http.Handler) http.Handler {
+	var dropped int32
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&dropped, 1) > n {
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(httptest.NewRecorder(), r)
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		})
+	}
+}
+
+// countRequests counts the requests made to the API.
+func countRequests(requests *int32) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(requests, 1)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// failWith answers the first n requests with status, without passing them
+// on to the API.
+func failWith(n int32, status int, requests *int32) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(requests, 1) > n {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("content-type", api.JsonContentType)
+			w.WriteHeader(status)
+			w.Write([]byte(`{"code":"overloaded","message":"server is busy","request_id":"abc"}`))
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should open accounts and read their balance", func(t *testing.T) {
+		server, _, _ := newTestServer(t, nil)
+		defer server.Close()
+		c := New(server.URL)
+
+		ID, err := c.CreateAccount(ctx, api.CreateAccountRequest{Name: "Ana Lima", CPF: "38145671004", Balance: 500})
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, ID, 3)
+
+		balance, err := c.GetBalance(ctx, ID)
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, balance.Balance, 500)
+	})
+
+	t.Run("should transfer between accounts", func(t *testing.T) {
+		server, _, _ := newTestServer(t, nil)
+		defer server.Close()
+		c := New(server.URL)
+
+		created, err := c.CreateTransfer(ctx, api.CreateTransferRequest{AccountOriginID: 1, AccountDestinationID: 2, Amount: 300})
+		app.AssertError(t, err, nil)
+
+		transfer, err := c.GetTransfer(ctx, created.ID)
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, transfer.Amount, 300)
+		app.AssertString(t, transfer.Status, store.ToStatusMsg(store.StatusConfirmed))
+		balance, _ := c.GetBalance(ctx, 2)
+		app.AssertUint64(t, balance.Balance, 300)
+	})
+
+	t.Run("should return the API errors", func(t *testing.T) {
+		server, _, _ := newTestServer(t, nil)
+		defer server.Close()
+		c := New(server.URL)
+
+		_, err := c.GetBalance(ctx, 9)
+
+		if !errors.Is(err, ErrAccountNotFound) {
+			t.Fatalf("got error %v; want %v", err, ErrAccountNotFound)
+		}
+		if errors.Is(err, ErrTransferNotFound) {
+			t.Errorf("got error %v matching %v", err, ErrTransferNotFound)
+		}
+		var apiErr *Error
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("got error %T; want *Error", err)
+		}
+		app.AssertHTTPStatus(t, apiErr.StatusCode, http.StatusNotFound)
+		app.AssertString(t, apiErr.Field, "account_id")
+		if apiErr.RequestID == "" {
+			t.Error("got no request ID")
+		}
+
+		_, err = c.CreateTransfer(ctx, api.CreateTransferRequest{AccountOriginID: 1, AccountDestinationID: 2, Amount: 20000})
+		if !errors.Is(err, ErrInsufficientBalance) {
+			t.Errorf("got error %v; want %v", err, ErrInsufficientBalance)
+		}
+	})
+
+	t.Run("should authenticate with a token", func(t *testing.T) {
+		server, _, _ := newTestServer(t, nil, api.WithAuth(auth.NewIssuer([]byte("chave-de-teste"), time.Hour)))
+		defer server.Close()
+		anonymous := New(server.URL)
+		_, err := anonymous.CreateAccount(ctx, api.CreateAccountRequest{Name: "Ana Lima", CPF: "38145671004", Password: "123456"})
+		app.AssertError(t, err, nil)
+
+		_, err = anonymous.CreateTransfer(ctx, api.CreateTransferRequest{AccountOriginID: 3, AccountDestinationID: 2, Amount: 0})
+		if !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("got error %v; want %v", err, ErrUnauthenticated)
+		}
+
+		login, err := anonymous.Login(ctx, "38145671004", "123456")
+		app.AssertError(t, err, nil)
+		customer := New(server.URL, WithToken(login.Token))
+		_, err = customer.CreateTransfer(ctx, api.CreateTransferRequest{AccountOriginID: 3, AccountDestinationID: 2, Amount: 0})
+		if !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("got error %v; want %v", err, ErrInvalidAmount)
+		}
+	})
+
+	t.Run("should authenticate with an API key", func(t *testing.T) {
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_ops", Role: auth.RoleReadOnly}, "segredo")
+		server, _, _ := newTestServer(t, nil, api.WithAPIKeys(keys))
+		defer server.Close()
+
+		_, err := New(server.URL, WithAPIKey("key_ops.segredo")).CreateAccount(ctx, api.CreateAccountRequest{Name: "Ana Lima", CPF: "38145671004"})
+
+		if !errors.Is(err, ErrInsufficientRole) {
+			t.Errorf("got error %v; want %v", err, ErrInsufficientRole)
+		}
+	})
+
+	t.Run("should retry a transfer whose response got lost without repeating it", func(t *testing.T) {
+		server, accountStore, transferStore := newTestServer(t, dropResponses(1))
+		defer server.Close()
+		c := New(server.URL, WithRetries(2, time.Millisecond))
+
+		created, err := c.CreateTransfer(ctx, api.CreateTransferRequest{AccountOriginID: 1, AccountDestinationID: 2, Amount: 300})
+
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, created.ID, 1)
+		transfers, _ := transferStore.ListAllTransfers()
+		app.AssertUint64(t, uint64(len(transfers)), 1)
+		balance, _ := accountStore.GetBalance(2)
+		app.AssertUint64(t, balance, 300)
+	})
+
+	t.Run("should reuse the idempotency key from the context", func(t *testing.T) {
+		server, _, transferStore := newTestServer(t, nil)
+		defer server.Close()
+		c := New(server.URL)
+		request := api.CreateTransferRequest{AccountOriginID: 1, AccountDestinationID: 2, Amount: 300}
+		keyed := ContextWithIdempotencyKey(ctx, "pedido-42")
+
+		first, err := c.CreateTransfer(keyed, request)
+		app.AssertError(t, err, nil)
+		again, err := c.CreateTransfer(keyed, request)
+		app.AssertError(t, err, nil)
+
+		app.AssertUint64(t, again.ID, first.ID)
+		transfers, _ := transferStore.ListAllTransfers()
+		app.AssertUint64(t, uint64(len(transfers)), 1)
+
+		_, err = c.CreateTransfer(ctx, request)
+		if !errors.Is(err, ErrDuplicateTransfer) {
+			t.Errorf("got error %v; want %v", err, ErrDuplicateTransfer)
+		}
+	})
+
+	t.Run("should retry temporary errors", func(t *testing.T) {
+		var requests int32
+		server, _, _ := newTestServer(t, failWith(2, http.StatusServiceUnavailable, &requests))
+		defer server.Close()
+		c := New(server.URL, WithRetries(2, time.Millisecond))
+
+		_, err := c.GetBalance(ctx, 1)
+
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, uint64(atomic.LoadInt32(&requests)), 3)
+	})
+
+	t.Run("should give up after the configured retries", func(t *testing.T) {
+		var requests int32
+		server, _, _ := newTestServer(t, failWith(5, http.StatusServiceUnavailable, &requests))
+		defer server.Close()
+		c := New(server.URL, WithRetries(1, time.Millisecond))
+
+		_, err := c.GetBalance(ctx, 1)
+
+		if !errors.Is(err, ErrOverloaded) {
+			t.Errorf("got error %v; want %v", err, ErrOverloaded)
+		}
+		app.AssertUint64(t, uint64(atomic.LoadInt32(&requests)), 2)
+	})
+
+	t.Run("should not retry errors a retry cannot fix", func(t *testing.T) {
+		var requests int32
+		server, _, _ := newTestServer(t, countRequests(&requests))
+		defer server.Close()
+		c := New(server.URL, WithRetries(3, time.Millisecond))
+
+		_, err := c.CreateTransfer(ctx, api.CreateTransferRequest{AccountOriginID: 1, AccountDestinationID: 1, Amount: 300})
+
+		if !errors.Is(err, ErrSameAccount) {
+			t.Errorf("got error %v; want %v", err, ErrSameAccount)
+		}
+		app.AssertUint64(t, uint64(atomic.LoadInt32(&requests)), 1)
+	})
+
+	t.Run("should stop retrying when the context is done", func(t *testing.T) {
+		var requests int32
+		server, _, _ := newTestServer(t, failWith(100, http.StatusServiceUnavailable, &requests))
+		defer server.Close()
+		c := New(server.URL, WithRetries(100, time.Hour))
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		_, err := c.GetBalance(ctx, 1)
+
+		app.AssertError(t, err, context.DeadlineExceeded)
+		app.AssertUint64(t, uint64(atomic.LoadInt32(&requests)), 1)
+	})
+
+	t.Run("should describe responses that are not API errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}))
+		defer server.Close()
+		c := New(server.URL, WithRetries(0, 0))
+
+		_, err := c.GetTransfer(ctx, 1)
+
+		var apiErr *Error
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("got error %T; want *Error", err)
+		}
+		app.AssertHTTPStatus(t, apiErr.StatusCode, http.StatusBadGateway)
+		app.AssertString(t, apiErr.Message, "bad gateway")
+		if !apiErr.Temporary() {
+			t.Error("got a permanent error; want a temporary one")
+		}
+	})
+
+	t.Run("should know every error code the server documents", func(t *testing.T) {
+		server, _, _ := newTestServer(t, nil)
+		defer server.Close()
+		response, err := http.Get(server.URL + "/openapi.json")
+		if err != nil {
+			t.Fatalf("error fetching the spec: %v", err)
+		}
+		defer response.Body.Close()
+		var spec struct {
+			Components struct {
+				Schemas struct {
+					ErrorResponse struct {
+						Properties struct {
+							Code struct {
+								Enum []string `json:"enum"`
+							} `json:"code"`
+						} `json:"properties"`
+					}
+				} `json:"schemas"`
+			} `json:"components"`
+		}
+		json.NewDecoder(response.Body).Decode(&spec)
+		documented := spec.Components.Schemas.ErrorResponse.Properties.Code.Enum
+
+		var known []string
+		for _, e := range knownErrors {
+			known = append(known, e.Code)
+		}
+		sort.Strings(documented)
+		sort.Strings(known)
+
+		app.AssertString(t, strings.Join(known, " "), strings.Join(documented, " "))
+	})
+}
+
+func TestPagination(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should list a page of accounts", func(t *testing.T) {
+		server, _, _ := newTestServer(t, nil)
+		defer server.Close()
+		c := New(server.URL)
+
+		page, err := c.ListAccounts(ctx, ListOptions{Limit: 1})
+		app.AssertError(t, err, nil)
+		if len(page.Accounts) != 1 || page.Accounts[0].ID != 1 {
+			t.Fatalf("got accounts %v; want account 1", page.Accounts)
+		}
+		if page.Next == nil || *page.Next != (ListOptions{Limit: 1, After: 1}) {
+			t.Fatalf("got next page %v; want after 1", page.Next)
+		}
+
+		page, err = c.ListAccounts(ctx, *page.Next)
+		app.AssertError(t, err, nil)
+		if len(page.Accounts) != 1 || page.Accounts[0].ID != 2 || page.Next != nil {
+			t.Errorf("got accounts %v and next page %v; want account 2 and no next page", page.Accounts, page.Next)
+		}
+	})
+
+	t.Run("should walk every account a page at a time", func(t *testing.T) {
+		var requests int32
+		server, _, _ := newTestServer(t, countRequests(&requests))
+		defer server.Close()
+		c := New(server.URL)
+		for i := 0; i < 3; i++ {
+			_, err := c.CreateAccount(ctx, api.CreateAccountRequest{Name: "Ana Lima", CPF: "38145671004"})
+			app.AssertError(t, err, nil)
+		}
+		atomic.StoreInt32(&requests, 0)
+
+		var IDs []uint64
+		it := c.Accounts(ctx, 2)
+		for it.Next() {
+			IDs = append(IDs, it.Account().ID)
+		}
+
+		app.AssertError(t, it.Err(), nil)
+		if len(IDs) != 5 {
+			t.Fatalf("got accounts %v; want 5 of them", IDs)
+		}
+		for i, ID := range IDs {
+			app.AssertUint64(t, ID, uint64(i+1))
+		}
+		app.AssertUint64(t, uint64(atomic.LoadInt32(&requests)), 3)
+	})
+
+	t.Run("should walk every transfer", func(t *testing.T) {
+		server, _, _ := newTestServer(t, nil)
+		defer server.Close()
+		c := New(server.URL)
+		for amount := uint64(1); amount <= 3; amount++ {
+			_, err := c.CreateTransfer(ctx, api.CreateTransferRequest{AccountOriginID: 1, AccountDestinationID: 2, Amount: amount})
+			app.AssertError(t, err, nil)
+		}
+
+		var amounts []uint64
+		it := c.Transfers(ctx, 2)
+		for it.Next() {
+			amounts = append(amounts, it.Transfer().Amount)
+		}
+
+		app.AssertError(t, it.Err(), nil)
+		if len(amounts) != 3 || amounts[0] != 1 || amounts[2] != 3 {
+			t.Errorf("got amounts %v; want 1, 2 and 3", amounts)
+		}
+	})
+
+	t.Run("should stop when a page cannot be fetched", func(t *testing.T) {
+		var requests int32
+		server, _, _ := newTestServer(t, failWith(1, http.StatusServiceUnavailable, &requests))
+		defer server.Close()
+		c := New(server.URL, WithRetries(0, 0))
+
+		it := c.Transfers(ctx, 0)
+
+		if it.Next() {
+			t.Fatal("got a transfer; want none")
+		}
+		if !errors.Is(it.Err(), ErrOverloaded) {
+			t.Errorf("got error %v; want %v", it.Err(), ErrOverloaded)
+		}
+	})
+}
+
+func TestStatement(t *testing.T) {
+	ctx := context.Background()
+	server, _, _ := newTestServer(t, nil)
+	defer server.Close()
+	c := New(server.URL)
+	_, err := c.CreateTransfer(ctx, api.CreateTransferRequest{AccountOriginID: 1, AccountDestinationID: 2, Amount: 2500})
+	app.AssertError(t, err, nil)
+	today := time.Now().UTC()
+
+	var csv strings.Builder
+	err = c.Statement(ctx, 2, StatementOptions{From: today, To: today, Delimiter: ';', Decimal: '.'}, &csv)
+	app.AssertError(t, err, nil)
+	if !strings.Contains(csv.String(), ";1;transfer;1;25.00;25.00\n") {
+		t.Errorf("got statement %q; want the transfer from account 1", csv.String())
+	}
+
+	var ofx strings.Builder
+	err = c.Statement(ctx, 2, StatementOptions{Format: api.StatementOFX}, &ofx)
+	app.AssertError(t, err, nil)
+	if !strings.Contains(ofx.String(), "<BALAMT>25.00") {
+		t.Errorf("got statement %q; want a closing balance of 25.00", ofx.String())
+	}
+
+	err = c.Statement(ctx, 2, StatementOptions{From: today, To: today.AddDate(0, 0, -1)}, &csv)
+	if !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("got error %v; want %v", err, ErrInvalidPeriod)
+	}
+}
+
+func TestPayCNAB(t *testing.T) {
+	ctx := context.Background()
+	keys := auth.NewKeyStore()
+	keys.Import(auth.APIKey{ID: "key_operator", Name: "operator", Role: auth.RoleOperator}, "segredo")
+	server, accountStore, _ := newTestServer(t, nil, api.WithAPIKeys(keys))
+	defer server.Close()
+	c := New(server.URL, WithAPIKey("key_operator.segredo"))
+	line := func(fields ...string) string {
+		return fmt.Sprintf("%-240s", strings.Join(fields, ""))
+	}
+	today := time.Now().UTC().Format("02012006")
+	remessa := strings.Join([]string{
+		line("34100000", strings.Repeat(" ", 9), "2", "00048226581020", strings.Repeat(" ", 110), "1"),
+		line("34100011C  01", strings.Repeat(" ", 5), "00048226581020", strings.Repeat(" ", 26), "000000000001"),
+		line("3410001300001A0", strings.Repeat(" ", 5), "341", strings.Repeat(" ", 6), "000000000002", strings.Repeat(" ", 52), today, "BRL", strings.Repeat(" ", 15), "000000000002500"),
+		line("34100015", strings.Repeat(" ", 9), "000003", "000000000000002500"),
+		line("34199999", strings.Repeat(" ", 9), "000001", "000005"),
+	}, "\r\n")
+
+	var retorno strings.Builder
+	err := c.PayCNAB(ctx, strings.NewReader(remessa), &retorno)
+	app.AssertError(t, err, nil)
+	lines := strings.Split(retorno.String(), "\r\n")
+	app.AssertString(t, strings.TrimSpace(lines[2][230:]), "00")
+	account, _ := accountStore.GetAccount(2)
+	app.AssertUint64(t, account.Balance, 2500)
+
+	err = c.PayCNAB(ctx, strings.NewReader(remessa[:240]), &retorno)
+	if !errors.Is(err, ErrInvalidCNAB) {
+		t.Errorf("got error %v; want %v", err, ErrInvalidCNAB)
+	}
+}
+
+func TestAddressingKeys(t *testing.T) {
+	ctx := context.Background()
+	server, accountStore, _ := newTestServer(t, nil)
+	defer server.Close()
+	c := New(server.URL)
+
+	key, err := c.RegisterKey(ctx, 2, "email", "Caio@Exemplo.com")
+	app.AssertError(t, err, nil)
+	app.AssertString(t, key.Key, "caio@exemplo.com")
+	keys, err := c.ListKeys(ctx, 2)
+	app.AssertError(t, err, nil)
+	if len(keys) != 1 || keys[0].Key != key.Key {
+		t.Errorf("got keys %v; want %v", keys, key)
+	}
+	holder, err := c.LookupKey(ctx, "caio@exemplo.com")
+	app.AssertError(t, err, nil)
+	app.AssertString(t, holder.Name, "Caio B*** A***")
+
+	_, err = c.CreateTransfer(ctx, api.CreateTransferRequest{AccountOriginID: 1, DestinationKey: "caio@exemplo.com", Amount: 2500})
+	app.AssertError(t, err, nil)
+	account, _ := accountStore.GetAccount(2)
+	app.AssertUint64(t, account.Balance, 2500)
+
+	_, err = c.RegisterKey(ctx, 1, "email", "caio@exemplo.com")
+	if !errors.Is(err, ErrKeyInUse) {
+		t.Errorf("got error %v; want %v", err, ErrKeyInUse)
+	}
+	_, err = c.RemoveKey(ctx, 2, "caio@exemplo.com")
+	app.AssertError(t, err, nil)
+	_, err = c.LookupKey(ctx, "caio@exemplo.com")
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got error %v; want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestCharges(t *testing.T) {
+	ctx := context.Background()
+	server, accountStore, _ := newTestServer(t, nil)
+	defer server.Close()
+	c := New(server.URL)
+	_, err := c.RegisterKey(ctx, 2, "email", "caio@exemplo.com")
+	app.AssertError(t, err, nil)
+
+	charge, err := c.CreateCharge(ctx, 2, api.CreateChargeRequest{Key: "caio@exemplo.com", Amount: 1500, Dynamic: true})
+	app.AssertError(t, err, nil)
+	_, err = c.PayBRCode(ctx, api.PayBRCodeRequest{AccountOriginID: 1, Payload: charge.Payload})
+	app.AssertError(t, err, nil)
+
+	account, _ := accountStore.GetAccount(2)
+	app.AssertUint64(t, account.Balance, 1500)
+	charges, err := c.ListCharges(ctx, 2)
+	app.AssertError(t, err, nil)
+	if len(charges) != 1 || charges[0].TxID != charge.TxID || charges[0].TransferID == 0 {
+		t.Errorf("got charges %+v; want %s paid", charges, charge.TxID)
+	}
+	_, err = c.PayBRCode(ctx, api.PayBRCodeRequest{AccountOriginID: 1, Payload: charge.Payload})
+	if !errors.Is(err, ErrChargeAlreadyPaid) {
+		t.Errorf("got error %v; want %v", err, ErrChargeAlreadyPaid)
+	}
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	api "github.com/erikacarvalho/stone-challenge/http"
+	"net/http"
+	"strings"
+)
+
+// Error is an error response from the API. Compare it with the errors
+// below using errors.Is, which matches on Code:
+//
+//	if errors.Is(err, client.ErrInsufficientBalance) {
+//		...
+//	}
+type Error struct {
+	StatusCode int    // HTTP status of the response
+	Code       string // Stable identifier of the error, empty when the response was not an API error
+	Message    string // Human readable description, which may change
+	Field      string // Request field that caused the error, if any
+	RequestID  string // ID of the request in the server logs
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("bank: ")
+	if e.Message != "" {
+		b.WriteString(e.Message)
+	} else {
+		b.WriteString(e.Code)
+	}
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, " (%d %s", e.StatusCode, e.Code)
+		if e.RequestID != "" {
+			fmt.Fprintf(&b, ", request %s", e.RequestID)
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// Is tells whether target is an *Error with the same code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code != "" && t.Code == e.Code
+}
+
+// Temporary tells whether retrying the request may succeed: when the
+// client was rate limited or the server, or a proxy in front of it, could
+// not answer at the time.
+func (e *Error) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// newError returns the error for a response with an error status and the
+// given body.
+func newError(response *http.Response, body []byte) *Error {
+	var errorResponse api.ErrorResponse
+	err := json.Unmarshal(body, &errorResponse)
+	if err != nil || errorResponse.Code == "" {
+		message := strings.TrimSpace(string(body))
+		if len(message) > 200 {
+			message = message[:200]
+		}
+		if message == "" {
+			message = http.StatusText(response.StatusCode)
+		}
+		return &Error{StatusCode: response.StatusCode, Message: message, RequestID: response.Header.Get(api.RequestIDHeader)}
+	}
+	return &Error{
+		StatusCode: response.StatusCode,
+		Code:       errorResponse.Code,
+		Message:    errorResponse.Message,
+		Field:      errorResponse.Field,
+		RequestID:  errorResponse.RequestID,
+	}
+}
+
+// The errors the API answers with, by code.
+var (
+	ErrInvalidRequest       = &Error{Code: "invalid_request"}
+	ErrInvalidID            = &Error{Code: "invalid_id"}
+	ErrMethodNotAllowed     = &Error{Code: "method_not_allowed"}
+	ErrRouteNotFound        = &Error{Code: "route_not_found"}
+	ErrUnsupportedMediaType = &Error{Code: "unsupported_media_type"}
+	ErrBodyTooLarge         = &Error{Code: "body_too_large"}
+	ErrInvalidCPF           = &Error{Code: "invalid_cpf"}
+	ErrInvalidName          = &Error{Code: "invalid_name"}
+	ErrInvalidType          = &Error{Code: "invalid_type"}
+	ErrInvalidPercentage    = &Error{Code: "invalid_percentage"}
+	ErrInvalidPassword      = &Error{Code: "invalid_password"}
+	ErrInvalidCredentials   = &Error{Code: "invalid_credentials"}
+	ErrUnauthenticated      = &Error{Code: "unauthenticated"}
+	ErrInvalidToken         = &Error{Code: "invalid_token"}
+	ErrExpiredToken         = &Error{Code: "expired_token"}
+	ErrAccountNotOwned      = &Error{Code: "account_not_owned"}
+	ErrPasswordNotSet       = &Error{Code: "password_not_set"}
+	ErrAPIKeyRequired       = &Error{Code: "api_key_required"}
+	ErrInsufficientRole     = &Error{Code: "insufficient_role"}
+	ErrInvalidRole          = &Error{Code: "invalid_role"}
+	ErrAPIKeyNotFound       = &Error{Code: "api_key_not_found"}
+	ErrInvalidAPIKey        = &Error{Code: "invalid_api_key"}
+	ErrAPIKeyRevoked        = &Error{Code: "api_key_revoked"}
+	ErrInvalidSignature     = &Error{Code: "invalid_signature"}
+	ErrStaleRequest         = &Error{Code: "stale_request"}
+	ErrReplayedRequest      = &Error{Code: "replayed_request"}
+	ErrTOTPRequired         = &Error{Code: "totp_required"}
+	ErrInvalidTOTPCode      = &Error{Code: "invalid_totp_code"}
+	ErrTOTPNotEnrolled      = &Error{Code: "totp_not_enrolled"}
+	ErrTOTPAlreadyEnabled   = &Error{Code: "totp_already_enabled"}
+	ErrTOTPReplayed         = &Error{Code: "totp_replayed"}
+	ErrTOTPLocked           = &Error{Code: "totp_locked"}
+	ErrTransferNotPending   = &Error{Code: "transfer_not_pending"}
+	ErrConfirmationExpired  = &Error{Code: "confirmation_expired"}
+	ErrRateLimited          = &Error{Code: "rate_limited"}
+	ErrOverloaded           = &Error{Code: "overloaded"}
+	ErrAccountNotFound      = &Error{Code: "account_not_found"}
+	ErrTransferNotFound     = &Error{Code: "transfer_not_found"}
+	ErrInsufficientBalance  = &Error{Code: "insufficient_balance"}
+	ErrDuplicateTransfer    = &Error{Code: "duplicate_transfer"}
+	ErrIdempotencyKeyReused = &Error{Code: "idempotency_key_reused"}
+	ErrSameAccount          = &Error{Code: "same_account"}
+	ErrInvalidAmount        = &Error{Code: "invalid_amount"}
+	ErrInvalidShares        = &Error{Code: "invalid_shares"}
+	ErrInvalidPeriod        = &Error{Code: "invalid_period"}
+	ErrInvalidExport        = &Error{Code: "invalid_export"}
+	ErrImportConflict       = &Error{Code: "import_conflict"}
+	ErrInvalidCNAB          = &Error{Code: "invalid_cnab"}
+	ErrInvalidKey           = &Error{Code: "invalid_key"}
+	ErrKeyNotOwned          = &Error{Code: "key_not_owned"}
+	ErrKeyInUse             = &Error{Code: "key_in_use"}
+	ErrKeyLimitReached      = &Error{Code: "key_limit_reached"}
+	ErrKeyNotFound          = &Error{Code: "key_not_found"}
+	ErrInvalidBRCode        = &Error{Code: "invalid_brcode"}
+	ErrChargeNotFound       = &Error{Code: "charge_not_found"}
+	ErrChargeAlreadyPaid    = &Error{Code: "charge_already_paid"}
+	ErrRemessaProcessed     = &Error{Code: "remessa_already_processed"}
+	ErrInvalidWebhookURL    = &Error{Code: "invalid_webhook_url"}
+	ErrInvalidEventType     = &Error{Code: "invalid_event_type"}
+	ErrWebhookNotFound      = &Error{Code: "webhook_not_found"}
+	ErrDeliveryNotFound     = &Error{Code: "delivery_not_found"}
+	ErrDeliveryNotFailed    = &Error{Code: "delivery_not_failed"}
+	ErrInternal             = &Error{Code: "internal_error"}
+)
+
+// knownErrors lists every error above, so that tests can check them against
+// the codes the server documents.
+var knownErrors = []*Error{
+	ErrInvalidRequest, ErrInvalidID, ErrMethodNotAllowed, ErrRouteNotFound,
+	ErrUnsupportedMediaType, ErrBodyTooLarge, ErrInvalidCPF, ErrInvalidName,
+	ErrInvalidType, ErrInvalidPercentage, ErrInvalidPassword,
+	ErrInvalidCredentials, ErrUnauthenticated, ErrInvalidToken,
+	ErrExpiredToken, ErrAccountNotOwned, ErrPasswordNotSet, ErrAPIKeyRequired,
+	ErrInsufficientRole, ErrInvalidRole, ErrAPIKeyNotFound, ErrInvalidAPIKey,
+	ErrAPIKeyRevoked, ErrInvalidSignature, ErrStaleRequest,
+	ErrReplayedRequest, ErrTOTPRequired, ErrInvalidTOTPCode,
+	ErrTOTPNotEnrolled, ErrTOTPAlreadyEnabled, ErrTOTPReplayed, ErrTOTPLocked,
+	ErrTransferNotPending, ErrConfirmationExpired, ErrRateLimited,
+	ErrOverloaded, ErrAccountNotFound, ErrTransferNotFound,
+	ErrInsufficientBalance, ErrDuplicateTransfer, ErrIdempotencyKeyReused,
+	ErrSameAccount, ErrInvalidAmount, ErrInvalidShares, ErrInvalidPeriod, ErrInvalidExport,
+	ErrImportConflict, ErrInvalidCNAB, ErrInvalidKey, ErrKeyNotOwned,
+	ErrKeyInUse, ErrKeyLimitReached, ErrKeyNotFound, ErrInvalidBRCode,
+	ErrChargeNotFound, ErrChargeAlreadyPaid, ErrRemessaProcessed, ErrInvalidWebhookURL,
+	ErrInvalidEventType, ErrWebhookNotFound, ErrDeliveryNotFound,
+	ErrDeliveryNotFailed, ErrInternal,
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	api "github.com/erikacarvalho/stone-challenge/http"
+	"net/http"
+	"net/url"
+)
+
+// ListKeys returns the addressing keys of an account.
+func (c *Client) ListKeys(ctx context.Context, accountID uint64) ([]app.AddressingKey, error) {
+	var keys []app.AddressingKey
+	_, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/accounts/%d/keys", accountID), nil, &keys)
+	return keys, err
+}
+
+// RegisterKey adds an addressing key of keyType, such as "email", to an
+// account and returns it as stored. value is left empty for random keys,
+// which the bank generates.
+func (c *Client) RegisterKey(ctx context.Context, accountID uint64, keyType, value string) (app.AddressingKey, error) {
+	var key app.AddressingKey
+	_, err := c.do(ctx, http.MethodPost, fmt.Sprintf("/accounts/%d/keys", accountID), api.RegisterKeyRequest{Type: keyType, Value: value}, &key)
+	return key, err
+}
+
+// RemoveKey takes an addressing key out of an account and returns it.
+func (c *Client) RemoveKey(ctx context.Context, accountID uint64, key string) (app.AddressingKey, error) {
+	var removed app.AddressingKey
+	_, err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/accounts/%d/keys/%s", accountID, url.PathEscape(key)), nil, &removed)
+	return removed, err
+}
+
+// LookupKey tells who an addressing key belongs to, with the name and CPF
+// of the holder masked, so that it can be confirmed before a transfer.
+func (c *Client) LookupKey(ctx context.Context, key string) (api.KeyLookupResponse, error) {
+	var response api.KeyLookupResponse
+	_, err := c.do(ctx, http.MethodGet, "/keys/"+url.PathEscape(key), nil, &response)
+	return response, err
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"context"
+	app "github.com/erikacarvalho/stone-challenge"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultPageSize is the page size used by iterators when none is given.
+const DefaultPageSize = 100
+
+// ListOptions selects a page of a list: at most Limit items, or every
+// item when it is zero, whose ID is greater than After.
+type ListOptions struct {
+	Limit int
+	After uint64
+}
+
+func (o ListOptions) query() string {
+	query := url.Values{}
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.After > 0 {
+		query.Set("after", strconv.FormatUint(o.After, 10))
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+// AccountPage is a page of accounts. Next selects the following page, and
+// is nil on the last one.
+type AccountPage struct {
+	Accounts []app.Account
+	Next     *ListOptions
+}
+
+// TransferPage is a page of transfers. Next selects the following page,
+// and is nil on the last one.
+type TransferPage struct {
+	Transfers []app.Transfer
+	Next      *ListOptions
+}
+
+// ListAccounts returns the page of accounts selected by options, sorted by
+// ID.
+func (c *Client) ListAccounts(ctx context.Context, options ListOptions) (AccountPage, error) {
+	var page AccountPage
+	header, err := c.do(ctx, http.MethodGet, "/accounts"+options.query(), nil, &page.Accounts)
+	if err != nil {
+		return page, err
+	}
+	page.Next = nextPage(header)
+	return page, nil
+}
+
+// ListTransfers returns the page of transfers selected by options, sorted
+// by ID.
+func (c *Client) ListTransfers(ctx context.Context, options ListOptions) (TransferPage, error) {
+	var page TransferPage
+	header, err := c.do(ctx, http.MethodGet, "/transfers"+options.query(), nil, &page.Transfers)
+	if err != nil {
+		return page, err
+	}
+	page.Next = nextPage(header)
+	return page, nil
+}
+
+// nextPage returns the options for the page that the Link header of a
+// response points at with rel="next", or nil if there is none.
+func nextPage(header http.Header) *ListOptions {
+	for _, link := range strings.Split(header.Get("Link"), ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		isNext := false
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				isNext = true
+			}
+		}
+		if !isNext {
+			continue
+		}
+		u, err := url.Parse(strings.Trim(target, "<>"))
+		if err != nil {
+			continue
+		}
+		var options ListOptions
+		options.Limit, _ = strconv.Atoi(u.Query().Get("limit"))
+		options.After, _ = strconv.ParseUint(u.Query().Get("after"), 10, 64)
+		return &options
+	}
+	return nil
+}
+
+// AccountIterator walks every account, fetching a page at a time:
+//
+//	it := c.Accounts(ctx, 0)
+//	for it.Next() {
+//		account := it.Account()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type AccountIterator struct {
+	client   *Client
+	ctx      context.Context
+	next     *ListOptions
+	accounts []app.Account
+	account  app.Account
+	err      error
+}
+
+// Accounts returns an iterator over every account that fetches pageSize of
+// them at a time, or DefaultPageSize when pageSize is not positive.
+func (c *Client) Accounts(ctx context.Context, pageSize int) *AccountIterator {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return &AccountIterator{client: c, ctx: ctx, next: &ListOptions{Limit: pageSize}}
+}
+
+// Next advances to the next account, fetching a page when needed. It
+// returns false at the end or when fetching fails, which Err tells apart.
+func (it *AccountIterator) Next() bool {
+	for len(it.accounts) == 0 {
+		if it.err != nil || it.next == nil {
+			return false
+		}
+		page, err := it.client.ListAccounts(it.ctx, *it.next)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.accounts, it.next = page.Accounts, page.Next
+	}
+	it.account, it.accounts = it.accounts[0], it.accounts[1:]
+	return true
+}
+
+// Account returns the current account.
+func (it *AccountIterator) Account() app.Account {
+	return it.account
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *AccountIterator) Err() error {
+	return it.err
+}
+
+// TransferIterator walks every transfer, fetching a page at a time, the
+// same way as AccountIterator.
+type TransferIterator struct {
+	client    *Client
+	ctx       context.Context
+	next      *ListOptions
+	transfers []app.Transfer
+	transfer  app.Transfer
+	err       error
+}
+
+// Transfers returns an iterator over every transfer that fetches pageSize
+// of them at a time, or DefaultPageSize when pageSize is not positive.
+func (c *Client) Transfers(ctx context.Context, pageSize int) *TransferIterator {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return &TransferIterator{client: c, ctx: ctx, next: &ListOptions{Limit: pageSize}}
+}
+
+// Next advances to the next transfer, fetching a page when needed. It
+// returns false at the end or when fetching fails, which Err tells apart.
+func (it *TransferIterator) Next() bool {
+	for len(it.transfers) == 0 {
+		if it.err != nil || it.next == nil {
+			return false
+		}
+		page, err := it.client.ListTransfers(it.ctx, *it.next)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.transfers, it.next = page.Transfers, page.Next
+	}
+	it.transfer, it.transfers = it.transfers[0], it.transfers[1:]
+	return true
+}
+
+// Transfer returns the current transfer.
+func (it *TransferIterator) Transfer() app.Transfer {
+	return it.transfer
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *TransferIterator) Err() error {
+	return it.err
+}
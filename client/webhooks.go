@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	api "github.com/erikacarvalho/stone-challenge/http"
+	"github.com/erikacarvalho/stone-challenge/webhook"
+	"net/http"
+	"net/url"
+)
+
+// ListWebhooks returns every webhook, without secrets. It needs an admin
+// key.
+func (c *Client) ListWebhooks(ctx context.Context) ([]api.WebhookResponse, error) {
+	var webhooks []api.WebhookResponse
+	_, err := c.do(ctx, http.MethodGet, "/webhooks", nil, &webhooks)
+	return webhooks, err
+}
+
+// CreateWebhook subscribes rawURL to the given event types, or to every one
+// if there are none, and returns the webhook along with the secret its
+// deliveries are signed with, which cannot be read again. It needs an admin
+// key.
+func (c *Client) CreateWebhook(ctx context.Context, rawURL string, eventTypes ...string) (api.WebhookResponse, error) {
+	var created api.WebhookResponse
+	_, err := c.do(ctx, http.MethodPost, "/webhooks", api.CreateWebhookRequest{URL: rawURL, Events: eventTypes}, &created)
+	return created, err
+}
+
+// DeleteWebhook removes a webhook along with its pending deliveries and dead
+// letters. It needs an admin key.
+func (c *Client) DeleteWebhook(ctx context.Context, webhookID string) (api.WebhookResponse, error) {
+	var deleted api.WebhookResponse
+	_, err := c.do(ctx, http.MethodDelete, "/webhooks/"+url.PathEscape(webhookID), nil, &deleted)
+	return deleted, err
+}
+
+// ListDeadLetters returns the webhook deliveries that ran out of attempts,
+// oldest first. It needs an admin key.
+func (c *Client) ListDeadLetters(ctx context.Context) ([]webhook.Delivery, error) {
+	var deliveries []webhook.Delivery
+	_, err := c.do(ctx, http.MethodGet, "/webhooks/dead-letters", nil, &deliveries)
+	return deliveries, err
+}
+
+// Redeliver sends a dead letter again, with its attempts reset. It needs an
+// admin key.
+func (c *Client) Redeliver(ctx context.Context, deliveryID string) (webhook.Delivery, error) {
+	var delivery webhook.Delivery
+	_, err := c.do(ctx, http.MethodPost, "/webhooks/dead-letters/"+url.PathEscape(deliveryID)+"/redeliver", nil, &delivery)
+	return delivery, err
+}
@@ -0,0 +1,42 @@
+// Command auditverify checks the hash chain of an audit log file and exits
+// with a non-zero status if any entry was edited or deleted.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/audit"
+	"os"
+)
+
+var (
+	file = flag.String("file", "audit.log", "path to the audit log file")
+	head = flag.String("head", "", "expected hash of the last entry, to detect entries removed from the end")
+)
+
+func main() {
+	flag.Parse()
+
+	entries, err := audit.ReadFile(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	err = audit.Verify(entries)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "audit log is not valid:", err)
+		os.Exit(1)
+	}
+
+	last := audit.GenesisHash
+	if len(entries) > 0 {
+		last = entries[len(entries)-1].Hash
+	}
+	if *head != "" && *head != last {
+		fmt.Fprintf(os.Stderr, "audit log is not valid: last entry hash is %s; want %s\n", last, *head)
+		os.Exit(1)
+	}
+
+	fmt.Printf("audit log is valid: %d entries, head %s\n", len(entries), last)
+}
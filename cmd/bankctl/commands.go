@@ -0,0 +1,665 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/client"
+	api "github.com/erikacarvalho/stone-challenge/http"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// flagSet returns the flag set for the command name.
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("bankctl "+name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	return flags
+}
+
+// parse parses the flags of a command, which must be followed by the
+// positional arguments named, and returns those arguments.
+func (c *cli) parse(flags *flag.FlagSet, args []string, positional ...string) ([]string, error) {
+	if len(positional) > 0 {
+		flags.Usage = func() {
+			fmt.Fprintf(c.stderr, "Usage: %s [flags] %s\n", flags.Name(), strings.Join(positional, " "))
+			flags.PrintDefaults()
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if flags.NArg() != len(positional) {
+		flags.Usage()
+		return nil, errUsage
+	}
+	return flags.Args(), nil
+}
+
+// required checks that the flags named were given.
+func (c *cli) required(flags *flag.FlagSet, names ...string) error {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range names {
+		if !set[name] {
+			fmt.Fprintf(c.stderr, "%s: -%s is required\n", flags.Name(), name)
+			flags.Usage()
+			return errUsage
+		}
+	}
+	return nil
+}
+
+// parseID parses the ID argument of a command.
+func (c *cli) parseID(name, s string) (uint64, error) {
+	ID, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "bankctl: %s must be a number, not %q\n", name, s)
+		return 0, errUsage
+	}
+	return ID, nil
+}
+
+// print writes v as JSON, or the rows under header as a table.
+func (c *cli) print(v interface{}, header []string, rows [][]string) error {
+	if c.json {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// money formats an amount in cents as reais.
+func money(cents uint64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func id(ID uint64) string {
+	return strconv.FormatUint(ID, 10)
+}
+
+func (c *cli) login(ctx context.Context, args []string) error {
+	flags := c.flagSet("login")
+	cpf := flags.String("cpf", "", "CPF of the customer")
+	password := flags.String("password", os.Getenv(envPrefix+"PASSWORD"), "password of the customer; defaults to BANKCTL_PASSWORD")
+	save := flags.Bool("save", false, "save the token to the config file")
+	if _, err := c.parse(flags, args); err != nil {
+		return err
+	}
+	if err := c.required(flags, "cpf"); err != nil {
+		return err
+	}
+
+	login, err := c.client.Login(ctx, *cpf, *password)
+	if err != nil {
+		return err
+	}
+	if *save {
+		var saved config
+		err = readConfig(c.configPath, &saved)
+		if err != nil {
+			return err
+		}
+		saved.Token = login.Token
+		err = writeConfig(c.configPath, saved)
+		if err != nil {
+			return err
+		}
+	}
+	return c.print(login, []string{"TOKEN", "EXPIRES_AT"}, [][]string{{login.Token, formatTime(&login.ExpiresAt)}})
+}
+
+func (c *cli) createAccount(ctx context.Context, args []string) error {
+	flags := c.flagSet("accounts create")
+	var request api.CreateAccountRequest
+	flags.StringVar(&request.Name, "name", "", "name of the customer")
+	flags.StringVar(&request.CPF, "cpf", "", "CPF of the customer, 11 numbers")
+	flags.Uint64Var(&request.Balance, "balance", 0, "initial balance in cents")
+	flags.StringVar(&request.Type, "type", "", "account type: checking, savings or business; defaults to checking")
+	flags.StringVar(&request.Password, "password", os.Getenv(envPrefix+"PASSWORD"), "password of the customer; defaults to BANKCTL_PASSWORD")
+	if _, err := c.parse(flags, args); err != nil {
+		return err
+	}
+	if err := c.required(flags, "name", "cpf"); err != nil {
+		return err
+	}
+
+	ID, err := c.client.CreateAccount(ctx, request)
+	if err != nil {
+		return err
+	}
+	return c.print(api.CreateAccountResponse{ID: ID}, []string{"ID"}, [][]string{{id(ID)}})
+}
+
+// listFlags adds the flags of the list commands: -limit and -after fetch
+// a single page, and otherwise every item is fetched -page-size at a time.
+func listFlags(flags *flag.FlagSet) (options *client.ListOptions, pageSize *int) {
+	options = &client.ListOptions{}
+	flags.IntVar(&options.Limit, "limit", 0, "only list this many items")
+	flags.Uint64Var(&options.After, "after", 0, "only list items whose ID is greater than this one")
+	pageSize = flags.Int("page-size", client.DefaultPageSize, "how many items are fetched at a time when listing all of them")
+	return options, pageSize
+}
+
+// notePage tells how to list the items after a single page, if any.
+func (c *cli) notePage(next *client.ListOptions) {
+	if next != nil && !c.json {
+		fmt.Fprintf(c.stderr, "more items follow: use -after %d\n", next.After)
+	}
+}
+
+func (c *cli) listAccounts(ctx context.Context, args []string) error {
+	flags := c.flagSet("accounts list")
+	options, pageSize := listFlags(flags)
+	if _, err := c.parse(flags, args); err != nil {
+		return err
+	}
+
+	accounts := []app.Account{}
+	if options.Limit > 0 {
+		page, err := c.client.ListAccounts(ctx, *options)
+		if err != nil {
+			return err
+		}
+		accounts = append(accounts, page.Accounts...)
+		defer c.notePage(page.Next)
+	} else {
+		it := c.client.Accounts(ctx, *pageSize)
+		for it.Next() {
+			if account := it.Account(); account.ID > options.After {
+				accounts = append(accounts, account)
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+	}
+
+	var rows [][]string
+	for _, account := range accounts {
+		rows = append(rows, []string{id(account.ID), account.Name, account.CPF, account.Type, money(account.Balance), formatTime(&account.CreatedAt)})
+	}
+	return c.print(accounts, []string{"ID", "NAME", "CPF", "TYPE", "BALANCE", "CREATED_AT"}, rows)
+}
+
+func (c *cli) balance(ctx context.Context, args []string) error {
+	flags := c.flagSet("accounts balance")
+	positional, err := c.parse(flags, args, "ACCOUNT_ID")
+	if err != nil {
+		return err
+	}
+	ID, err := c.parseID("ACCOUNT_ID", positional[0])
+	if err != nil {
+		return err
+	}
+
+	balance, err := c.client.GetBalance(ctx, ID)
+	if err != nil {
+		return err
+	}
+	return c.print(balance, []string{"ID", "BALANCE", "ACCRUED_INTEREST"}, [][]string{{id(balance.ID), money(balance.Balance), money(balance.AccruedInterest)}})
+}
+
+func (c *cli) statement(ctx context.Context, args []string) error {
+	flags := c.flagSet("accounts statement")
+	format := flags.String("format", api.StatementCSV, "statement format: csv or ofx")
+	from := flags.String("from", "", "first day of the period, as 2006-01-02 in UTC; defaults to the first day of the month")
+	to := flags.String("to", "", "last day of the period, as 2006-01-02 in UTC; defaults to today")
+	delimiter := flags.String("delimiter", ";", "character separating CSV fields")
+	decimal := flags.String("decimal", ",", "character separating reais from cents in CSV amounts")
+	out := flags.String("out", "", "file to write the statement to, readable only by its owner; defaults to stdout")
+	positional, err := c.parse(flags, args, "ACCOUNT_ID")
+	if err != nil {
+		return err
+	}
+	ID, err := c.parseID("ACCOUNT_ID", positional[0])
+	if err != nil {
+		return err
+	}
+
+	options := client.StatementOptions{Format: *format}
+	for _, date := range []struct {
+		name  string
+		value string
+		to    *time.Time
+	}{{"from", *from, &options.From}, {"to", *to, &options.To}} {
+		if date.value == "" {
+			continue
+		}
+		*date.to, err = time.Parse("2006-01-02", date.value)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "bankctl: -%s must be a date such as 2006-01-02, not %q\n", date.name, date.value)
+			return errUsage
+		}
+	}
+	for _, char := range []struct {
+		name  string
+		value string
+		to    *rune
+	}{{"delimiter", *delimiter, &options.Delimiter}, {"decimal", *decimal, &options.Decimal}} {
+		runes := []rune(char.value)
+		if len(runes) != 1 {
+			fmt.Fprintf(c.stderr, "bankctl: -%s must be a single character, not %q\n", char.name, char.value)
+			return errUsage
+		}
+		*char.to = runes[0]
+	}
+
+	return c.writeOut(*out, "statement", func(w io.Writer) error {
+		return c.client.Statement(ctx, ID, options, w)
+	})
+}
+
+func (c *cli) createTransfer(ctx context.Context, args []string) error {
+	flags := c.flagSet("transfers create")
+	var request api.CreateTransferRequest
+	flags.Uint64Var(&request.AccountOriginID, "from", 0, "ID of the origin account")
+	flags.Uint64Var(&request.AccountDestinationID, "to", 0, "ID of the destination account")
+	flags.StringVar(&request.DestinationKey, "to-key", "", "addressing key of the destination account, instead of -to")
+	flags.Uint64Var(&request.Amount, "amount", 0, "amount in cents")
+	key := flags.String("idempotency-key", "", "key that makes running the command again return the same transfer instead of making another")
+	if _, err := c.parse(flags, args); err != nil {
+		return err
+	}
+	destination := "to"
+	if request.DestinationKey != "" {
+		destination = "to-key"
+	}
+	if err := c.required(flags, "from", destination, "amount"); err != nil {
+		return err
+	}
+	if *key != "" {
+		ctx = client.ContextWithIdempotencyKey(ctx, *key)
+	}
+
+	created, err := c.client.CreateTransfer(ctx, request)
+	if err != nil {
+		return err
+	}
+	return c.printCreatedTransfer(created)
+}
+
+// printCreatedTransfer prints a transfer just made, which has no status
+// when it was confirmed at once.
+func (c *cli) printCreatedTransfer(created api.CreateTransferResponse) error {
+	status := created.Status
+	if status == "" {
+		status = "Confirmed"
+	}
+	return c.print(created, []string{"ID", "STATUS", "EXPIRES_AT"}, [][]string{{id(created.ID), status, formatTime(created.ExpiresAt)}})
+}
+
+func transferRows(transfers []app.Transfer) [][]string {
+	var rows [][]string
+	for _, t := range transfers {
+		rows = append(rows, []string{id(t.ID), id(t.AccountOriginID), id(t.AccountDestinationID), money(t.Amount), money(t.Fee), t.Status, t.Kind, formatTime(&t.CreatedAt)})
+	}
+	return rows
+}
+
+var transferHeader = []string{"ID", "FROM", "TO", "AMOUNT", "FEE", "STATUS", "KIND", "CREATED_AT"}
+
+func (c *cli) listTransfers(ctx context.Context, args []string) error {
+	flags := c.flagSet("transfers list")
+	options, pageSize := listFlags(flags)
+	if _, err := c.parse(flags, args); err != nil {
+		return err
+	}
+
+	transfers := []app.Transfer{}
+	if options.Limit > 0 {
+		page, err := c.client.ListTransfers(ctx, *options)
+		if err != nil {
+			return err
+		}
+		transfers = append(transfers, page.Transfers...)
+		defer c.notePage(page.Next)
+	} else {
+		it := c.client.Transfers(ctx, *pageSize)
+		for it.Next() {
+			if transfer := it.Transfer(); transfer.ID > options.After {
+				transfers = append(transfers, transfer)
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+	}
+	return c.print(transfers, transferHeader, transferRows(transfers))
+}
+
+func (c *cli) getTransfer(ctx context.Context, args []string) error {
+	flags := c.flagSet("transfers get")
+	positional, err := c.parse(flags, args, "TRANSFER_ID")
+	if err != nil {
+		return err
+	}
+	ID, err := c.parseID("TRANSFER_ID", positional[0])
+	if err != nil {
+		return err
+	}
+
+	transfer, err := c.client.GetTransfer(ctx, ID)
+	if err != nil {
+		return err
+	}
+	return c.print(transfer, transferHeader, transferRows([]app.Transfer{transfer}))
+}
+
+func (c *cli) payCNAB(ctx context.Context, args []string) error {
+	flags := c.flagSet("transfers cnab240")
+	out := flags.String("out", "", "file to write the retorno to; defaults to stdout")
+	key := flags.String("idempotency-key", "", "key that makes running the command again return the same retorno instead of paying the remessa again")
+	positional, err := c.parse(flags, args, "FILE")
+	if err != nil {
+		return err
+	}
+	if *key != "" {
+		ctx = client.ContextWithIdempotencyKey(ctx, *key)
+	}
+
+	file, err := os.Open(positional[0])
+	if err != nil {
+		return fmt.Errorf("error opening remessa file: %w", err)
+	}
+	defer file.Close()
+	return c.writeOut(*out, "retorno", func(w io.Writer) error {
+		return c.client.PayCNAB(ctx, file, w)
+	})
+}
+
+func addressingKeyRows(keys ...app.AddressingKey) [][]string {
+	var rows [][]string
+	for _, key := range keys {
+		rows = append(rows, []string{key.Type, key.Key, formatTime(&key.CreatedAt)})
+	}
+	return rows
+}
+
+var addressingKeyHeader = []string{"TYPE", "KEY", "CREATED_AT"}
+
+func (c *cli) listAddressingKeys(ctx context.Context, args []string) error {
+	positional, err := c.parse(c.flagSet("accounts keys list"), args, "ACCOUNT_ID")
+	if err != nil {
+		return err
+	}
+	ID, err := c.parseID("ACCOUNT_ID", positional[0])
+	if err != nil {
+		return err
+	}
+
+	keys, err := c.client.ListKeys(ctx, ID)
+	if err != nil {
+		return err
+	}
+	return c.print(keys, addressingKeyHeader, addressingKeyRows(keys...))
+}
+
+func (c *cli) registerAddressingKey(ctx context.Context, args []string) error {
+	flags := c.flagSet("accounts keys register")
+	keyType := flags.String("type", "", "type of the key: cpf, cnpj, email, phone or random")
+	value := flags.String("value", "", "the key, left out for random keys, which the bank generates")
+	positional, err := c.parse(flags, args, "ACCOUNT_ID")
+	if err != nil {
+		return err
+	}
+	if err := c.required(flags, "type"); err != nil {
+		return err
+	}
+	ID, err := c.parseID("ACCOUNT_ID", positional[0])
+	if err != nil {
+		return err
+	}
+
+	key, err := c.client.RegisterKey(ctx, ID, *keyType, *value)
+	if err != nil {
+		return err
+	}
+	return c.print(key, addressingKeyHeader, addressingKeyRows(key))
+}
+
+func (c *cli) removeAddressingKey(ctx context.Context, args []string) error {
+	positional, err := c.parse(c.flagSet("accounts keys remove"), args, "ACCOUNT_ID", "KEY")
+	if err != nil {
+		return err
+	}
+	ID, err := c.parseID("ACCOUNT_ID", positional[0])
+	if err != nil {
+		return err
+	}
+
+	key, err := c.client.RemoveKey(ctx, ID, positional[1])
+	if err != nil {
+		return err
+	}
+	return c.print(key, addressingKeyHeader, addressingKeyRows(key))
+}
+
+func (c *cli) lookupAddressingKey(ctx context.Context, args []string) error {
+	positional, err := c.parse(c.flagSet("accounts keys lookup"), args, "KEY")
+	if err != nil {
+		return err
+	}
+
+	holder, err := c.client.LookupKey(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return c.print(holder, []string{"TYPE", "KEY", "NAME", "CPF", "ACCOUNT_TYPE"}, [][]string{{holder.Type, holder.Key, holder.Name, holder.CPF, holder.AccountType}})
+}
+
+func (c *cli) createCharge(ctx context.Context, args []string) error {
+	flags := c.flagSet("accounts charges create")
+	var request api.CreateChargeRequest
+	flags.StringVar(&request.Key, "key", "", "addressing key of the account the charge is paid to")
+	flags.Uint64Var(&request.Amount, "amount", 0, "amount in cents, left out for the payer to choose it")
+	flags.StringVar(&request.Description, "description", "", "description shown to the payer")
+	flags.StringVar(&request.City, "city", "", "merchant city written in the BR Code")
+	flags.BoolVar(&request.Dynamic, "dynamic", false, "issue a charge that is paid once, instead of any number of times")
+	positional, err := c.parse(flags, args, "ACCOUNT_ID")
+	if err != nil {
+		return err
+	}
+	if err := c.required(flags, "key"); err != nil {
+		return err
+	}
+	ID, err := c.parseID("ACCOUNT_ID", positional[0])
+	if err != nil {
+		return err
+	}
+
+	charge, err := c.client.CreateCharge(ctx, ID, request)
+	if err != nil {
+		return err
+	}
+	return c.print(charge, []string{"TXID", "KEY", "AMOUNT", "PAYLOAD"}, [][]string{{charge.TxID, charge.Key, money(charge.Amount), charge.Payload}})
+}
+
+func (c *cli) listCharges(ctx context.Context, args []string) error {
+	positional, err := c.parse(c.flagSet("accounts charges list"), args, "ACCOUNT_ID")
+	if err != nil {
+		return err
+	}
+	ID, err := c.parseID("ACCOUNT_ID", positional[0])
+	if err != nil {
+		return err
+	}
+
+	charges, err := c.client.ListCharges(ctx, ID)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, charge := range charges {
+		transfer := ""
+		if charge.TransferID != 0 {
+			transfer = id(charge.TransferID)
+		}
+		rows = append(rows, []string{charge.TxID, charge.Key, money(charge.Amount), charge.Description, formatTime(&charge.CreatedAt), transfer})
+	}
+	return c.print(charges, []string{"TXID", "KEY", "AMOUNT", "DESCRIPTION", "CREATED_AT", "TRANSFER_ID"}, rows)
+}
+
+func (c *cli) payBRCode(ctx context.Context, args []string) error {
+	flags := c.flagSet("transfers brcode")
+	var request api.PayBRCodeRequest
+	flags.Uint64Var(&request.AccountOriginID, "from", 0, "ID of the account that pays")
+	flags.Uint64Var(&request.Amount, "amount", 0, "amount in cents, for BR Codes that have none")
+	key := flags.String("idempotency-key", "", "key that makes running the command again return the same transfer instead of making another")
+	positional, err := c.parse(flags, args, "PAYLOAD")
+	if err != nil {
+		return err
+	}
+	if err := c.required(flags, "from"); err != nil {
+		return err
+	}
+	if *key != "" {
+		ctx = client.ContextWithIdempotencyKey(ctx, *key)
+	}
+	request.Payload = positional[0]
+
+	created, err := c.client.PayBRCode(ctx, request)
+	if err != nil {
+		return err
+	}
+	return c.printCreatedTransfer(created)
+}
+
+func keyRows(keys ...api.APIKeyResponse) [][]string {
+	var rows [][]string
+	for _, key := range keys {
+		secret := key.Secret
+		if secret != "" {
+			secret = key.ID + "." + secret
+		}
+		rows = append(rows, []string{key.ID, key.Name, key.Role, formatTime(&key.CreatedAt), formatTime(key.RotatedAt), formatTime(key.RevokedAt), secret})
+	}
+	return rows
+}
+
+var keyHeader = []string{"ID", "NAME", "ROLE", "CREATED_AT", "ROTATED_AT", "REVOKED_AT", "KEY"}
+
+func (c *cli) listKeys(ctx context.Context, args []string) error {
+	if _, err := c.parse(c.flagSet("admin keys list"), args); err != nil {
+		return err
+	}
+	keys, err := c.client.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(keys, keyHeader, keyRows(keys...))
+}
+
+func (c *cli) createKey(ctx context.Context, args []string) error {
+	flags := c.flagSet("admin keys create")
+	name := flags.String("name", "", "name of the system or person the key is for")
+	role := flags.String("role", "", "role of the key: read-only, operator or admin")
+	if _, err := c.parse(flags, args); err != nil {
+		return err
+	}
+	if err := c.required(flags, "name", "role"); err != nil {
+		return err
+	}
+	key, err := c.client.CreateAPIKey(ctx, *name, *role)
+	if err != nil {
+		return err
+	}
+	return c.print(key, keyHeader, keyRows(key))
+}
+
+func (c *cli) rotateKey(ctx context.Context, args []string) error {
+	positional, err := c.parse(c.flagSet("admin keys rotate"), args, "KEY_ID")
+	if err != nil {
+		return err
+	}
+	key, err := c.client.RotateAPIKey(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return c.print(key, keyHeader, keyRows(key))
+}
+
+func (c *cli) revokeKey(ctx context.Context, args []string) error {
+	positional, err := c.parse(c.flagSet("admin keys revoke"), args, "KEY_ID")
+	if err != nil {
+		return err
+	}
+	key, err := c.client.RevokeAPIKey(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return c.print(key, keyHeader, keyRows(key))
+}
+
+func (c *cli) export(ctx context.Context, args []string) error {
+	flags := c.flagSet("admin export")
+	out := flags.String("out", "", "file to write the export to, readable only by its owner; defaults to stdout")
+	if _, err := c.parse(flags, args); err != nil {
+		return err
+	}
+	return c.writeOut(*out, "export", func(w io.Writer) error {
+		return c.client.Export(ctx, w)
+	})
+}
+
+// writeOut calls write with stdout, or with a new file at path, readable
+// only by its owner, if path is not empty. The file is removed if write
+// fails.
+func (c *cli) writeOut(path, what string, write func(w io.Writer) error) error {
+	if path == "" {
+		return write(c.stdout)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating %s file: %w", what, err)
+	}
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+func (c *cli) importExport(ctx context.Context, args []string) error {
+	flags := c.flagSet("admin import")
+	mode := flags.String("mode", "merge", "merge refuses an export with IDs already in use; replace drops every account and transfer first")
+	positional, err := c.parse(flags, args, "FILE")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(positional[0])
+	if err != nil {
+		return fmt.Errorf("error opening export file: %w", err)
+	}
+	defer file.Close()
+	result, err := c.client.Import(ctx, file, *mode)
+	if err != nil {
+		return err
+	}
+	return c.print(result, []string{"MODE", "ACCOUNTS", "TRANSFERS", "ACCOUNT_MAX_ID", "TRANSFER_MAX_ID"},
+		[][]string{{result.Mode, strconv.Itoa(result.Accounts), strconv.Itoa(result.Transfers), id(result.AccountMaxID), id(result.TransferMaxID)}})
+}
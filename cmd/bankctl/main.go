@@ -0,0 +1,343 @@
+// Command bankctl operates the bank from the command line through its API.
+// It prints tables for people and, with -output json, JSON for scripts, and
+// its exit status tells which kind of error the API answered with.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/client"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// envPrefix starts the environment variables read for global flags not
+// given on the command line: -api-key is read from BANKCTL_API_KEY.
+const envPrefix = "BANKCTL_"
+
+const usage = `Usage: bankctl [flags] <command> [arguments]
+
+Commands:
+  login -cpf CPF [-password PASSWORD] [-save]
+  accounts create -name NAME -cpf CPF [-balance CENTS] [-type TYPE] [-password PASSWORD]
+  accounts list [-limit N] [-after ID] [-page-size N]
+  accounts balance ACCOUNT_ID
+  accounts statement [-format csv|ofx] [-from DATE] [-to DATE] [-delimiter C] [-decimal C] [-out FILE] ACCOUNT_ID
+  accounts keys list ACCOUNT_ID
+  accounts keys register -type TYPE [-value VALUE] ACCOUNT_ID
+  accounts keys remove ACCOUNT_ID KEY
+  accounts keys lookup KEY
+  accounts charges create -key KEY [-amount CENTS] [-description TEXT] [-city CITY] [-dynamic] ACCOUNT_ID
+  accounts charges list ACCOUNT_ID
+  transfers create -from ACCOUNT_ID (-to ACCOUNT_ID | -to-key KEY) -amount CENTS [-idempotency-key KEY]
+  transfers list [-limit N] [-after ID] [-page-size N]
+  transfers get TRANSFER_ID
+  transfers cnab240 [-out FILE] [-idempotency-key KEY] FILE
+  transfers brcode -from ACCOUNT_ID [-amount CENTS] [-idempotency-key KEY] PAYLOAD
+  admin keys list
+  admin keys create -name NAME -role ROLE
+  admin keys rotate KEY_ID
+  admin keys revoke KEY_ID
+  admin export [-out FILE]
+  admin import [-mode merge|replace] FILE
+
+Flags:
+`
+
+// Exit statuses, by the kind of error. Every API error code has a fixed
+// HTTP status, so the status tells the kind of error; the code itself is
+// printed, and written as JSON to stderr with -output json.
+const (
+	exitOK              = 0
+	exitFailure         = 1  // The API could not be reached, or another error
+	exitUsage           = 2  // Unknown command or invalid flags
+	exitInvalid         = 3  // 400, 405, 413 and 415: the request is malformed
+	exitUnauthenticated = 4  // 401: credentials are missing or invalid
+	exitForbidden       = 5  // 403: the credentials do not allow the request
+	exitNotFound        = 6  // 404: the account, transfer or key does not exist
+	exitConflict        = 7  // 409 and 410: a duplicate or a state that does not allow it
+	exitRefused         = 8  // 422: the bank rules refuse the operation
+	exitUnavailable     = 9  // 429 and 503, after retrying
+	exitInternal        = 10 // 500 and other server errors
+)
+
+var errUsage = errors.New("invalid usage")
+
+// config holds the settings read from the config file, which can be
+// overridden by environment variables and flags.
+type config struct {
+	Server string `json:"server,omitempty"`
+	Token  string `json:"token,omitempty"`
+	APIKey string `json:"api_key,omitempty"`
+	Output string `json:"output,omitempty"`
+}
+
+// cli runs the commands with the client and settings given.
+type cli struct {
+	client     *client.Client
+	config     config
+	configPath string
+	stdout     io.Writer
+	stderr     io.Writer
+	json       bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command in args and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("bankctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", defaultConfigPath(), "path to the JSON config file with server, token, api_key and output")
+	server := flags.String("server", "http://localhost:3000", "base URL of the bank API")
+	token := flags.String("token", "", "customer token, as printed by login")
+	apiKey := flags.String("api-key", "", "API key, as <id>.<secret>")
+	output := flags.String("output", "table", "output format: table or json")
+	timeout := flags.Duration("timeout", 30*time.Second, "longest time to wait for each request")
+	retries := flags.Int("retries", client.DefaultRetries, "how many times failed requests are retried")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	lookup := func(name string) (string, bool) {
+		value, ok := os.LookupEnv(envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1)))
+		return value, ok
+	}
+	if value, ok := lookup("config"); ok && !set["config"] {
+		*configPath = value
+	}
+
+	cfg := config{Server: *server, Output: *output}
+	err := readConfig(*configPath, &cfg)
+	if err != nil {
+		fmt.Fprintln(stderr, "bankctl:", err)
+		return exitUsage
+	}
+	for name, target := range map[string]*string{"server": &cfg.Server, "token": &cfg.Token, "api-key": &cfg.APIKey, "output": &cfg.Output} {
+		if value, ok := lookup(name); ok && !set[name] {
+			*target = value
+		}
+	}
+	if set["server"] {
+		cfg.Server = *server
+	}
+	if set["token"] {
+		cfg.Token = *token
+	}
+	if set["api-key"] {
+		cfg.APIKey = *apiKey
+	}
+	if set["output"] {
+		cfg.Output = *output
+	}
+	if cfg.Output != "table" && cfg.Output != "json" {
+		fmt.Fprintf(stderr, "bankctl: output must be table or json, not %q\n", cfg.Output)
+		return exitUsage
+	}
+
+	options := []client.Option{
+		client.WithHTTPClient(&http.Client{Timeout: *timeout}),
+		client.WithRetries(*retries, client.DefaultBackoff),
+	}
+	if cfg.Token != "" {
+		options = append(options, client.WithToken(cfg.Token))
+	}
+	if cfg.APIKey != "" {
+		options = append(options, client.WithAPIKey(cfg.APIKey))
+	}
+	c := &cli{
+		client:     client.New(cfg.Server, options...),
+		config:     cfg,
+		configPath: *configPath,
+		stdout:     stdout,
+		stderr:     stderr,
+		json:       cfg.Output == "json",
+	}
+
+	command, ok := c.lookup(flags.Args())
+	if !ok {
+		flags.Usage()
+		return exitUsage
+	}
+	err = command.run(c, context.Background(), flags.Args()[len(command.name):])
+	if err != nil {
+		return c.fail(stderr, err)
+	}
+	return exitOK
+}
+
+// command is a bankctl command, such as accounts create.
+type command struct {
+	name []string
+	run  func(c *cli, ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{[]string{"login"}, (*cli).login},
+	{[]string{"accounts", "create"}, (*cli).createAccount},
+	{[]string{"accounts", "list"}, (*cli).listAccounts},
+	{[]string{"accounts", "balance"}, (*cli).balance},
+	{[]string{"accounts", "statement"}, (*cli).statement},
+	{[]string{"accounts", "keys", "list"}, (*cli).listAddressingKeys},
+	{[]string{"accounts", "keys", "register"}, (*cli).registerAddressingKey},
+	{[]string{"accounts", "keys", "remove"}, (*cli).removeAddressingKey},
+	{[]string{"accounts", "keys", "lookup"}, (*cli).lookupAddressingKey},
+	{[]string{"accounts", "charges", "create"}, (*cli).createCharge},
+	{[]string{"accounts", "charges", "list"}, (*cli).listCharges},
+	{[]string{"transfers", "create"}, (*cli).createTransfer},
+	{[]string{"transfers", "list"}, (*cli).listTransfers},
+	{[]string{"transfers", "get"}, (*cli).getTransfer},
+	{[]string{"transfers", "cnab240"}, (*cli).payCNAB},
+	{[]string{"transfers", "brcode"}, (*cli).payBRCode},
+	{[]string{"admin", "keys", "list"}, (*cli).listKeys},
+	{[]string{"admin", "keys", "create"}, (*cli).createKey},
+	{[]string{"admin", "keys", "rotate"}, (*cli).rotateKey},
+	{[]string{"admin", "keys", "revoke"}, (*cli).revokeKey},
+	{[]string{"admin", "export"}, (*cli).export},
+	{[]string{"admin", "import"}, (*cli).importExport},
+}
+
+// lookup returns the command args start with.
+func (c *cli) lookup(args []string) (command, bool) {
+	for _, cmd := range commands {
+		if len(args) < len(cmd.name) {
+			continue
+		}
+		if strings.Join(args[:len(cmd.name)], " ") == strings.Join(cmd.name, " ") {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// fail reports err and returns the exit status for it.
+func (c *cli) fail(stderr io.Writer, err error) int {
+	if err == errUsage {
+		return exitUsage
+	}
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		fmt.Fprintln(stderr, "bankctl:", err)
+		return exitFailure
+	}
+	if c.json {
+		encoder := json.NewEncoder(stderr)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(map[string]interface{}{
+			"status":     apiErr.StatusCode,
+			"code":       apiErr.Code,
+			"message":    apiErr.Message,
+			"field":      apiErr.Field,
+			"request_id": apiErr.RequestID,
+		})
+	} else {
+		fmt.Fprintln(stderr, "bankctl:", apiErr)
+	}
+	return exitStatus(apiErr.StatusCode)
+}
+
+// exitStatus returns the exit status for an error response with the given
+// HTTP status.
+func exitStatus(status int) int {
+	switch status {
+	case http.StatusBadRequest, http.StatusMethodNotAllowed, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		return exitInvalid
+	case http.StatusUnauthorized:
+		return exitUnauthenticated
+	case http.StatusForbidden:
+		return exitForbidden
+	case http.StatusNotFound:
+		return exitNotFound
+	case http.StatusConflict, http.StatusGone:
+		return exitConflict
+	case http.StatusUnprocessableEntity:
+		return exitRefused
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return exitUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return exitInternal
+	}
+	return exitFailure
+}
+
+// defaultConfigPath returns where the config file is looked for when
+// -config is not given.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bankctl", "config.json")
+}
+
+// readConfig fills cfg with the settings in the file at path. A missing
+// file is not an error.
+func readConfig(path string, cfg *config) error {
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+	var file config
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return fmt.Errorf("error reading config %s: %w", path, err)
+	}
+	if file.Server != "" {
+		cfg.Server = file.Server
+	}
+	if file.Token != "" {
+		cfg.Token = file.Token
+	}
+	if file.APIKey != "" {
+		cfg.APIKey = file.APIKey
+	}
+	if file.Output != "" {
+		cfg.Output = file.Output
+	}
+	return nil
+}
+
+// writeConfig saves cfg to the file at path, readable only by its owner
+// as it may hold credentials.
+func writeConfig(path string, cfg config) error {
+	if path == "" {
+		return errors.New("no config file to save to: use -config")
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("error saving config: %w", err)
+	}
+	err = ioutil.WriteFile(path, append(data, '\n'), 0600)
+	if err != nil {
+		return fmt.Errorf("error saving config: %w", err)
+	}
+	return nil
+}
@@ -1,24 +1,425 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/audit"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/events"
 	http2 "github.com/erikacarvalho/stone-challenge/http"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"github.com/erikacarvalho/stone-challenge/metrics"
+	"github.com/erikacarvalho/stone-challenge/ratelimit"
 	"github.com/erikacarvalho/stone-challenge/store"
-	"log"
+	"github.com/erikacarvalho/stone-challenge/webhook"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// envPrefix starts the environment variables read for flags not given on
+// the command line: -read-timeout is read from BANK_READ_TIMEOUT.
+const envPrefix = "BANK_"
+
 var (
-	accountStoreStartingID  = uint64(0)
-	transferStoreStartingID = uint64(0)
+	address          = flag.String("addr", ":3000", "address the server listens on")
+	tlsCert          = flag.String("tls-cert", "", "path to the TLS certificate; serves HTTPS along with -tls-key")
+	tlsKey           = flag.String("tls-key", "", "path to the TLS private key")
+	storage          = flag.String("storage", store.StorageMemory, "storage backend: memory; file to keep a snapshot at -data-path; or events to keep every change in -journal, with snapshots at -data-path")
+	dataPath         = flag.String("data-path", "bank.json", "path to the snapshot file of the file and events storage backends")
+	journalPath      = flag.String("journal", "bank.journal", "path to the journal of changes of the events storage backend")
+	snapshotInterval = flag.Duration("snapshot-interval", time.Minute, "how often the file and events storage backends save a snapshot, besides on shutdown")
+	readTimeout      = flag.Duration("read-timeout", 10*time.Second, "longest time to read a request, body included")
+	writeTimeout     = flag.Duration("write-timeout", 30*time.Second, "longest time to serve a request and write its response")
+	idleTimeout      = flag.Duration("idle-timeout", 2*time.Minute, "longest time a keep-alive connection waits for the next request")
+	drainDelay       = flag.Duration("drain-delay", 0, "how long /readyz fails on shutdown before the server stops taking connections")
+	shutdownTimeout  = flag.Duration("shutdown-timeout", 30*time.Second, "longest time to wait for requests in flight on shutdown")
+	feeRulesPath     = flag.String("fee-rules", "", "path to a JSON file with the transfer fee rules")
+	savingsRate      = flag.String("savings-rate", "", "annual interest rate paid on savings accounts, such as 0.065; empty disables interest")
+	dayCount         = flag.String("day-count", store.DayCountActual365, "day-count convention for interest: ACT/365, ACT/360 or ACT/ACT")
+	auditLogPath     = flag.String("audit-log", "audit.log", "path to the append-only audit log file; empty keeps it in memory")
+	interestBudget   = flag.Uint64("interest-budget", 0, "initial balance in cents of the bank account interest is paid from")
+	tokenKey         = flag.String("token-key", "", "secret key used to sign customer tokens; empty generates one, which invalidates tokens on restart")
+	tokenTTL         = flag.Duration("token-ttl", 15*time.Minute, "how long customer tokens are valid")
+	stepUpAmount     = flag.Uint64("step-up-threshold", 500000, "amount in cents above which customer transfers must be confirmed with a TOTP code")
+	confirmTTL       = flag.Duration("confirmation-ttl", 5*time.Minute, "how long transfers wait for a TOTP confirmation; 0 disables step-up")
+	readRate         = flag.Float64("read-rate", 20, "reads per second allowed per client and per account; 0 disables the limit")
+	readBurst        = flag.Int("read-burst", 40, "reads allowed at once per client and per account")
+	writeRate        = flag.Float64("write-rate", 2, "writes per second allowed per client and per account; 0 disables the limit")
+	writeBurst       = flag.Int("write-burst", 10, "writes allowed at once per client and per account")
+	maxInFlight      = flag.Int("max-in-flight", 256, "requests served at once before shedding load; 0 disables the limit")
+	metricsToken     = flag.String("metrics-token", "", "bearer token Prometheus may scrape GET /metrics with, set as the credentials of the authorization setting of its scrape config; empty only accepts API keys")
+	adminKey         = flag.String("admin-key", "", "secret of the bootstrap admin API key, whose ID is key_admin; empty generates one")
+	webhookAttempts  = flag.Int("webhook-max-attempts", webhook.DefaultMaxAttempts, "attempts to deliver a webhook event before it is kept as a dead letter")
+	keysPath         = flag.String("api-keys", "api-keys.json", "path to the file API keys and the hashes of their secrets are kept in; empty keeps them in memory")
+	webhookDead      = flag.Int("webhook-max-dead-letters", webhook.DefaultMaxDeadLetters, "webhook dead letters kept, the oldest ones being dropped past it; 0 keeps every one")
+	webhooksPath     = flag.String("webhooks", "webhooks.json", "path to the file webhook subscriptions and their secrets are kept in; empty keeps them in memory")
+	webhookBackoff   = flag.Duration("webhook-backoff", webhook.DefaultBackoff, "wait after the first failed webhook delivery, doubled after each one up to an hour")
+	eventBuffer      = flag.Int("event-buffer", events.DefaultBufferSize, "latest events kept for GET /events streams to resume from")
+	eventLogPath     = flag.String("event-log", "", "path to a file events are appended to, one JSON event per line; empty disables it")
+	logLevel         = flag.String("log-level", "info", "least severe level logged: debug, info, warn or error")
 )
 
-const address = ":3000"
-
 func main() {
-	log.Println("initializing server on", address)
-	server := http2.NewServer(
-		store.NewAccountStore(&accountStoreStartingID),
-		store.NewTransferStore(&transferStoreStartingID),
-	)
-	log.Fatal(http.ListenAndServe(address, server))
+	flag.Parse()
+	err := applyEnv(flag.CommandLine)
+	if err != nil {
+		fatal(err)
+	}
+	err = run()
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func run() error {
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		return err
+	}
+	logger := logging.New(os.Stderr, level)
+	logging.SetDefault(logger)
+	ctx := logging.NewContext(context.Background(), logger.With("component", "main"))
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return errors.New("-tls-cert and -tls-key must be given together")
+	}
+
+	accountStore, transferStore, journal, err := openStores(*storage, *dataPath, *journalPath)
+	if err != nil {
+		return err
+	}
+	if journal != nil {
+		defer journal.Close()
+		logger.Info("keeping every change in a journal", "path", *journalPath, "changes", journal.Seq())
+	}
+
+	auditLog := audit.NewLog()
+	if *auditLogPath != "" {
+		auditLog, err = audit.OpenLog(*auditLogPath)
+		if err != nil {
+			return err
+		}
+		defer auditLog.Close()
+	}
+	accountStore.SetAuditor(auditLog)
+	transferStore.SetAuditor(auditLog)
+
+	registry := metrics.NewRegistry()
+	accountStore.SetMetrics(registry)
+	transferStore.SetMetrics(registry)
+
+	// The stores publish their events to the outbox, which the relay sends
+	// to the webhooks, the event stream and the event log.
+	outbox := accountStore.Outbox()
+	relay := events.NewRelay(outbox)
+
+	// Background jobs run until stop is closed, and jobs waits for them to
+	// finish what they are doing.
+	stop := make(chan struct{})
+	var jobs sync.WaitGroup
+	startJob := func(job func()) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job()
+		}()
+	}
+
+	if *feeRulesPath != "" {
+		fees, err := store.LoadFeeEngine(*feeRulesPath)
+		if err != nil {
+			return err
+		}
+		fees.AccountID, err = bankAccount(ctx, accountStore, "Fee Revenue", 0)
+		if err != nil {
+			return err
+		}
+		transferStore.SetFeeEngine(fees)
+		logger.Info("charging fees", "rules", len(fees.Rules), "account_id", fees.AccountID)
+	}
+
+	if *savingsRate != "" {
+		expenseAccountID, err := bankAccount(ctx, accountStore, "Interest Expense", *interestBudget)
+		if err != nil {
+			return err
+		}
+		interest, err := store.NewInterestEngine(accountStore, transferStore, *savingsRate, *dayCount, expenseAccountID, time.Now())
+		if err != nil {
+			return err
+		}
+		startJob(func() { interest.Run(stop) })
+		logger.Info("accruing interest on savings accounts", "settings", interest)
+	}
+
+	key := []byte(*tokenKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, err = rand.Read(key)
+		if err != nil {
+			return err
+		}
+		logger.Warn("no -token-key given: tokens will not be valid after a restart")
+	}
+	issuer := auth.NewIssuer(key, *tokenTTL)
+
+	keys := auth.NewKeyStore()
+	if *keysPath != "" {
+		keys, err = auth.OpenKeyStore(*keysPath)
+		if err != nil {
+			return err
+		}
+	}
+	if *adminKey != "" {
+		_, _, err = keys.Import(auth.APIKey{ID: "key_admin", Name: "bootstrap", Role: auth.RoleAdmin}, *adminKey)
+		if err != nil {
+			return err
+		}
+	} else if !hasAdminKey(keys) {
+		admin, secret, err := keys.Create("bootstrap", auth.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		logger.Warn("no -admin-key given: created an admin API key", "api_key", admin.ID+"."+secret)
+	}
+
+	options := []http2.Option{
+		http2.WithAuditLog(auditLog),
+		http2.WithLogger(logger),
+		http2.WithMetrics(registry),
+		http2.WithMetricsToken(*metricsToken),
+		http2.WithAuth(issuer),
+		http2.WithAPIKeys(keys),
+		http2.WithRateLimits(http2.RateLimits{
+			Read:        ratelimit.Rate{PerSecond: *readRate, Burst: *readBurst},
+			Write:       ratelimit.Rate{PerSecond: *writeRate, Burst: *writeBurst},
+			MaxInFlight: *maxInFlight,
+		}),
+	}
+	if *confirmTTL > 0 {
+		options = append(options, http2.WithStepUp(*stepUpAmount, *confirmTTL))
+		startJob(func() { transferStore.RunExpiry(10*time.Second, stop) })
+		logger.Info("transfers above the threshold need a TOTP confirmation", "threshold", *stepUpAmount, "confirmation_ttl", *confirmTTL)
+	}
+
+	// The webhooks offset only moves past events once they are delivered or
+	// dead letters, so the ones still being delivered are sent again after
+	// a restart.
+	dispatcher := webhook.NewDispatcher(nil)
+	if *webhooksPath != "" {
+		dispatcher, err = webhook.OpenDispatcher(nil, *webhooksPath)
+		if err != nil {
+			return err
+		}
+	}
+	dispatcher.MaxAttempts = *webhookAttempts
+	dispatcher.Backoff = *webhookBackoff
+	dispatcher.MaxDeadLetters = *webhookDead
+	relay.AddSink("webhooks", dispatcher)
+	options = append(options, http2.WithWebhooks(dispatcher))
+	startJob(func() { dispatcher.Run(stop) })
+
+	// Streams end a little before the write timeout would cut them, and
+	// clients reconnect and resume.
+	hub := events.NewHub(*eventBuffer)
+	relay.AddSink("stream", events.HandlerSink(hub.Handle))
+	options = append(options, http2.WithEventStream(hub, *writeTimeout*9/10))
+
+	if *eventLogPath != "" {
+		eventLog, err := events.OpenFileSink(*eventLogPath)
+		if err != nil {
+			return err
+		}
+		defer eventLog.Close()
+		relay.AddSink("log", eventLog)
+		logger.Info("appending events to a file", "path", *eventLogPath)
+	}
+	startJob(func() { relay.Run(stop) })
+
+	var snapshots *snapshotter
+	if journal != nil {
+		options = append(options, http2.WithReadinessCheck("journal", journal.Err))
+	}
+	if *storage == store.StorageFile || *storage == store.StorageEvents {
+		snapshots = &snapshotter{path: *dataPath, accounts: accountStore, transfers: transferStore}
+		options = append(options, http2.WithReadinessCheck("snapshot", snapshots.lastError))
+		startJob(func() { snapshots.run(*snapshotInterval, stop) })
+		logger.Info("keeping a snapshot of the stores", "path", *dataPath, "interval", *snapshotInterval)
+	}
+
+	server := http2.NewServer(accountStore, transferStore, options...)
+	httpServer := &http.Server{
+		Addr:         *address,
+		Handler:      server,
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		logger.Info("initializing server", "address", *address, "tls", *tlsCert != "")
+		if *tlsCert != "" {
+			served <- httpServer.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			served <- httpServer.ListenAndServe()
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err = <-served:
+		return err
+	case sig := <-signals:
+		logger.Info("shutting down", "signal", sig.String())
+	}
+
+	// Fail the readiness probe first, so that load balancers stop sending
+	// requests, then wait for the transfers in flight before stopping.
+	server.Drain()
+	time.Sleep(*drainDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	err = httpServer.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Error("requests still in flight after the shutdown timeout", "error", err)
+	}
+	close(stop)
+	jobs.Wait()
+
+	if snapshots != nil {
+		err = snapshots.save()
+		if err != nil {
+			return err
+		}
+		logger.Info("saved the final snapshot", "path", *dataPath)
+	}
+	logger.Info("server stopped")
+	return nil
+}
+
+// openStores returns the stores of the given storage backend, and the
+// journal they keep their changes in with the events backend.
+func openStores(backend, path, journalPath string) (*store.AccountStore, *store.TransferStore, *store.Journal, error) {
+	switch backend {
+	case store.StorageMemory:
+		accounts, transfers := store.Snapshot{}.Restore()
+		return accounts, transfers, nil, nil
+	case store.StorageFile:
+		accounts, transfers, err := store.LoadSnapshot(path)
+		return accounts, transfers, nil, err
+	case store.StorageEvents:
+		return store.OpenEventStore(journalPath, path)
+	default:
+		return nil, nil, nil, fmt.Errorf("invalid -storage %q: it must be %s, %s or %s", backend, store.StorageMemory, store.StorageFile, store.StorageEvents)
+	}
+}
+
+// bankAccount returns the ID of the bank-owned account named name, opening
+// it with balance if a snapshot did not bring it back.
+func bankAccount(ctx context.Context, accounts *store.AccountStore, name string, balance uint64) (uint64, error) {
+	all, err := accounts.ListAllAccounts()
+	if err != nil && err != store.ErrNoRecords {
+		return 0, err
+	}
+	for _, account := range all {
+		if account.Type == store.AccountTypeBank && account.Name == name {
+			return account.ID, nil
+		}
+	}
+	ID, err := accounts.OpenAccount(ctx, store.AccountTypeBank, name, "", balance)
+	if err != nil {
+		return 0, fmt.Errorf("error opening bank account %s: %w", name, err)
+	}
+	return ID, nil
+}
+
+// hasAdminKey tells whether keys has an admin key that was not revoked.
+func hasAdminKey(keys *auth.KeyStore) bool {
+	for _, key := range keys.List() {
+		if key.Role == auth.RoleAdmin && !key.Revoked() {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnv sets the flags of fs not given on the command line from their
+// environment variables, if set.
+func applyEnv(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || err != nil {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %v", name, setErr)
+		}
+	})
+	return err
+}
+
+// snapshotter saves snapshots of the stores for the file and events storage
+// backends and keeps the outcome of the last one for the readiness probe.
+type snapshotter struct {
+	path      string
+	accounts  *store.AccountStore
+	transfers *store.TransferStore
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+func (s *snapshotter) run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := s.save()
+			if err != nil {
+				logging.Default().Error("error saving snapshot", "path", s.path, "error", err)
+			}
+		}
+	}
+}
+
+func (s *snapshotter) save() error {
+	err := store.SaveSnapshot(s.path, s.accounts, s.transfers)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err
+	return err
+}
+
+func (s *snapshotter) lastError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr
+}
+
+// fatal logs err with the default logger and exits.
+func fatal(err error) {
+	logging.Default().Error(err.Error())
+	os.Exit(1)
 }
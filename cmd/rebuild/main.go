@@ -0,0 +1,75 @@
+// Command rebuild replays the journal of the events storage backend to
+// rebuild the accounts and transfers from it, and checks them against a
+// snapshot of the stores, exiting with a non-zero status if they differ.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"os"
+)
+
+var (
+	journal  = flag.String("journal", "bank.journal", "path to the journal to replay")
+	snapshot = flag.String("snapshot", "", "path to a snapshot to check the rebuilt stores against; only the changes it has are replayed")
+	out      = flag.String("out", "", "path to save a snapshot of the rebuilt stores to")
+)
+
+func main() {
+	flag.Parse()
+
+	changes, err := store.ReadJournal(*journal)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var expected store.Snapshot
+	if *snapshot != "" {
+		expected, err = store.ReadSnapshot(*snapshot)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if expected.JournalSeq > uint64(len(changes)) {
+			fmt.Fprintf(os.Stderr, "snapshot is at change %d, but the journal ends at change %d\n", expected.JournalSeq, len(changes))
+			os.Exit(1)
+		}
+		if expected.JournalSeq > 0 {
+			changes = changes[:expected.JournalSeq]
+		}
+	}
+
+	accounts, transfers, err := store.Replay(changes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rebuilt := store.TakeSnapshot(accounts, transfers)
+	rebuilt.JournalSeq = uint64(len(changes))
+
+	if *out != "" {
+		err = rebuilt.Save(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	if *snapshot != "" {
+		diff := expected.Diff(rebuilt)
+		if len(diff) > 0 {
+			fmt.Fprintln(os.Stderr, "rebuilt stores do not match the snapshot:")
+			for _, line := range diff {
+				fmt.Fprintln(os.Stderr, " ", line)
+			}
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("rebuilt %d accounts and %d transfers from %d changes\n", len(rebuilt.Accounts), len(rebuilt.Transfers), len(changes))
+	if *snapshot != "" {
+		fmt.Println("they match the snapshot")
+	}
+}
@@ -0,0 +1,347 @@
+// Package cnab reads CNAB 240 remittance files (remessas) of payments by
+// credit to account, as laid out by FEBRABAN, and writes the return files
+// (retornos) telling how each payment went.
+//
+// A remessa is made of 240-character lines: a file header, batches (lotes)
+// of a header, detail records and a trailer, and a file trailer. Problems
+// with the file as a whole are errors; problems with a batch or a payment
+// are kept as FEBRABAN occurrence codes, which the retorno carries back.
+package cnab
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LineLength is the length of every line of a CNAB 240 file.
+const LineLength = 240
+
+// Record types, in position 8 of every line.
+const (
+	recordFileHeader   = '0'
+	recordBatchHeader  = '1'
+	recordDetail       = '3'
+	recordBatchTrailer = '5'
+	recordFileTrailer  = '9'
+)
+
+// Occurrence codes from the FEBRABAN table, sent back in the retorno.
+const (
+	OccurrencePaid               = "00" // Crédito efetivado
+	OccurrenceInsufficientFunds  = "01" // Insuficiência de fundos
+	OccurrenceInvalidOperation   = "AB" // Tipo de operação inválido
+	OccurrenceInvalidEntryType   = "AD" // Forma de lançamento inválida
+	OccurrenceInvalidSequence    = "AH" // Nº sequencial do registro no lote inválido
+	OccurrenceInvalidSegment     = "AI" // Código de segmento de detalhe inválido
+	OccurrenceInvalidMovement    = "AJ" // Tipo de movimento inválido
+	OccurrenceInvalidBank        = "AL" // Código do banco favorecido inválido
+	OccurrenceInvalidAccount     = "AN" // Conta corrente/DV do favorecido inválido
+	OccurrenceInvalidDate        = "AP" // Data lançamento inválida
+	OccurrenceInvalidCurrency    = "AQ" // Tipo/quantidade da moeda inválido
+	OccurrenceInvalidAmount      = "AR" // Valor do lançamento inválido
+	OccurrenceInvalidCompany     = "HB" // Inscrição da empresa inválida para o contrato
+	OccurrenceInvalidDebit       = "HD" // Agência/conta corrente da empresa inválida
+	OccurrenceBatchOutOfSequence = "HG" // Lote de serviço fora de sequência
+	OccurrenceInvalidTotals      = "TA" // Lote não aceito - totais do lote com diferença
+
+	// OccurrenceRefused is this bank's own code, not in the FEBRABAN
+	// table, for payments refused for any other reason, such as looking
+	// like a duplicate.
+	OccurrenceRefused = "99"
+)
+
+// Entry types (formas de lançamento) of the batches paid: credit to a
+// checking or a savings account, which for this bank are the same.
+var entryTypes = map[string]bool{"01": true, "05": true}
+
+// maxOccurrences is how many codes fit in the occurrences field.
+const maxOccurrences = 5
+
+var ErrInvalidFile = errors.New("invalid CNAB 240 file")
+
+// File is a remessa.
+type File struct {
+	BankCode        string
+	CompanyDocument string // CPF or CNPJ of the company sending the file
+	CompanyName     string
+	Sequence        int // Number the company gives the file (NSA)
+	Batches         []*Batch
+
+	lines []string
+}
+
+// Batch is a batch of payments, all debited from Account.
+type Batch struct {
+	Number          int
+	CompanyDocument string // CPF or CNPJ of the owner of Account
+	Account         uint64
+	Payments        []*Payment
+	Occurrences     []string // Why the whole batch is refused, if it is
+
+	header, trailer int
+}
+
+// Payment is a segment A detail record: a credit to Account.
+type Payment struct {
+	Sequence    int
+	BankCode    string
+	Account     uint64
+	Name        string
+	Reference   string // The company's number for the payment (seu número)
+	Date        time.Time
+	Amount      uint64   // Amount in cents
+	Occurrences []string // Why the payment is refused, if it is
+	TransferID  uint64   // The transfer made for the payment
+	PaidAt      time.Time
+
+	line int
+}
+
+// Refuse refuses the whole batch with an occurrence code.
+func (b *Batch) Refuse(code string) {
+	b.Occurrences = append(b.Occurrences, code)
+}
+
+// Refused tells whether the batch is refused.
+func (b *Batch) Refused() bool {
+	return len(b.Occurrences) > 0
+}
+
+// Refuse refuses the payment with an occurrence code.
+func (p *Payment) Refuse(code string) {
+	p.Occurrences = append(p.Occurrences, code)
+}
+
+// Refused tells whether the payment is refused.
+func (p *Payment) Refused() bool {
+	return len(p.Occurrences) > 0
+}
+
+// Pay records that the payment was made by the transfer with transferID.
+func (p *Payment) Pay(transferID uint64, at time.Time) {
+	p.TransferID = transferID
+	p.PaidAt = at
+	p.Occurrences = []string{OccurrencePaid}
+}
+
+// Parse reads a remessa from r. The file header, the file trailer and the
+// order of the records must be right, or ErrInvalidFile is returned;
+// batches and payments that are wrong are refused with the occurrence code
+// for the problem.
+func Parse(r io.Reader) (*File, error) {
+	file := &File{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(line) != LineLength {
+			return nil, invalid(len(file.lines)+1, "it has %d characters in place of %d", len(line), LineLength)
+		}
+		file.lines = append(file.lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(file.lines) < 2 {
+		return nil, fmt.Errorf("%w: it must have at least a header and a trailer", ErrInvalidFile)
+	}
+
+	err := file.parseHeader(file.lines[0])
+	if err != nil {
+		return nil, err
+	}
+	last := len(file.lines) - 1
+	if trailer := file.lines[last]; trailer[7] != recordFileTrailer || field(trailer, 4, 7) != "9999" {
+		return nil, invalid(last+1, "the file must end with a file trailer")
+	}
+	var batch *Batch
+	for i, line := range file.lines[1:last] {
+		n := i + 2
+		if field(line, 1, 3) != file.BankCode {
+			return nil, invalid(n, "bank code %q differs from the one in the header", field(line, 1, 3))
+		}
+		switch line[7] {
+		case recordBatchHeader:
+			if batch != nil {
+				return nil, invalid(n, "batch %d has no trailer", batch.Number)
+			}
+			batch = parseBatchHeader(line, i+1)
+			if batch.Number != len(file.Batches)+1 {
+				batch.Refuse(OccurrenceBatchOutOfSequence)
+			}
+			file.Batches = append(file.Batches, batch)
+		case recordDetail, recordBatchTrailer:
+			if batch == nil {
+				return nil, invalid(n, "record of type %c is outside a batch", line[7])
+			}
+			if number, _ := digits(line, 4, 7); number != uint64(batch.Number) {
+				return nil, invalid(n, "record of batch %s is inside batch %d", field(line, 4, 7), batch.Number)
+			}
+			if line[7] == recordDetail {
+				file.parseDetail(batch, line, i+1)
+				continue
+			}
+			batch.trailer = i + 1
+			batch.checkTrailer(line)
+			batch = nil
+		default:
+			return nil, invalid(n, "record type %q is not a batch header, detail or trailer", line[7])
+		}
+	}
+	if batch != nil {
+		return nil, invalid(last+1, "batch %d has no trailer", batch.Number)
+	}
+	err = file.checkTrailer(file.lines[last], last+1)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// parseHeader reads the file header.
+func (f *File) parseHeader(line string) error {
+	if line[7] != recordFileHeader || field(line, 4, 7) != "0000" {
+		return invalid(1, "the file must start with a file header")
+	}
+	if line[142] != '1' {
+		return invalid(1, "the file is not a remessa: its code is %q in place of 1", line[142])
+	}
+	f.BankCode = field(line, 1, 3)
+	f.CompanyDocument = field(line, 19, 32)
+	f.CompanyName = strings.TrimSpace(field(line, 73, 102))
+	sequence, _ := digits(line, 158, 163)
+	f.Sequence = int(sequence)
+	return nil
+}
+
+// checkTrailer reads the file trailer, which holds how many batches and
+// lines the file has.
+func (f *File) checkTrailer(line string, n int) error {
+	batches, ok := digits(line, 18, 23)
+	if !ok || batches != uint64(len(f.Batches)) {
+		return invalid(n, "the trailer counts %s batches, but the file has %d", field(line, 18, 23), len(f.Batches))
+	}
+	records, ok := digits(line, 24, 29)
+	if !ok || records != uint64(len(f.lines)) {
+		return invalid(n, "the trailer counts %s records, but the file has %d", field(line, 24, 29), len(f.lines))
+	}
+	return nil
+}
+
+// parseBatchHeader reads a batch header, refusing the batch if it is not
+// a batch of credits to accounts.
+func parseBatchHeader(line string, index int) *Batch {
+	number, _ := digits(line, 4, 7)
+	batch := &Batch{Number: int(number), CompanyDocument: field(line, 19, 32), header: index}
+	if line[8] != 'C' {
+		batch.Refuse(OccurrenceInvalidOperation)
+	}
+	if !entryTypes[field(line, 12, 13)] {
+		batch.Refuse(OccurrenceInvalidEntryType)
+	}
+	account, ok := digits(line, 59, 70)
+	if !ok || account == 0 {
+		batch.Refuse(OccurrenceInvalidDebit)
+	}
+	batch.Account = account
+	return batch
+}
+
+// parseDetail reads a detail record of batch. Segment A records are
+// payments; segment B records only add details about the payee of the
+// segment A before them.
+func (f *File) parseDetail(batch *Batch, line string, index int) {
+	sequence, _ := digits(line, 9, 13)
+	if sequence != uint64(index-batch.header) {
+		batch.Refuse(OccurrenceInvalidSequence)
+	}
+	switch line[13] {
+	case 'A':
+	case 'B':
+		if len(batch.Payments) == 0 {
+			batch.Refuse(OccurrenceInvalidSegment)
+		}
+		return
+	default:
+		batch.Refuse(OccurrenceInvalidSegment)
+		return
+	}
+
+	payment := &Payment{
+		Sequence:  int(sequence),
+		BankCode:  field(line, 21, 23),
+		Name:      strings.TrimSpace(field(line, 44, 73)),
+		Reference: strings.TrimSpace(field(line, 74, 93)),
+		line:      index,
+	}
+	batch.Payments = append(batch.Payments, payment)
+	if line[14] != '0' {
+		payment.Refuse(OccurrenceInvalidMovement)
+	}
+	if payment.BankCode != f.BankCode {
+		payment.Refuse(OccurrenceInvalidBank)
+	}
+	account, ok := digits(line, 30, 41)
+	if !ok || account == 0 {
+		payment.Refuse(OccurrenceInvalidAccount)
+	}
+	payment.Account = account
+	date, err := time.Parse("02012006", field(line, 94, 101))
+	if err != nil {
+		payment.Refuse(OccurrenceInvalidDate)
+	}
+	payment.Date = date
+	if currency := field(line, 102, 104); currency != "BRL" && currency != "REA" {
+		payment.Refuse(OccurrenceInvalidCurrency)
+	}
+	amount, ok := digits(line, 120, 134)
+	if !ok || amount == 0 {
+		payment.Refuse(OccurrenceInvalidAmount)
+	}
+	payment.Amount = amount
+}
+
+// checkTrailer reads the trailer of the batch, refusing it if its totals
+// differ from the records in it.
+func (b *Batch) checkTrailer(line string) {
+	var total uint64
+	for _, payment := range b.Payments {
+		total += payment.Amount
+	}
+	records, ok := digits(line, 18, 23)
+	if !ok || records != uint64(b.trailer-b.header+1) {
+		b.Refuse(OccurrenceInvalidTotals)
+		return
+	}
+	sum, ok := digits(line, 24, 41)
+	if !ok || sum != total {
+		b.Refuse(OccurrenceInvalidTotals)
+	}
+}
+
+// field returns the characters of line from position from to position to,
+// both counted from 1 and included, as the FEBRABAN layouts give them.
+func field(line string, from, to int) string {
+	return line[from-1 : to]
+}
+
+// digits returns the number in a field of line, and false if the field has
+// anything but digits.
+func digits(line string, from, to int) (uint64, bool) {
+	value := field(line, from, to)
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	return n, err == nil
+}
+
+func invalid(n int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: line %d: %s", ErrInvalidFile, n, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,242 @@
+package cnab
+
+import (
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// record builds a 240-character line with the values given at positions
+// counted from 1, blank everywhere else.
+func record(fields map[int]string) string {
+	line := strings.Repeat(" ", LineLength)
+	positions := make([]int, 0, len(fields))
+	for position := range fields {
+		positions = append(positions, position)
+	}
+	sort.Ints(positions)
+	for _, position := range positions {
+		line = patch(line, position, fields[position])
+	}
+	return line
+}
+
+func fileHeader() string {
+	return record(map[int]string{1: "341", 4: "0000", 8: "0", 18: "2", 19: "00048226581020", 73: "PAPELARIA DUNDER MIFFLIN", 143: "1", 144: "18102026", 152: "090000", 158: "000042", 164: "089"})
+}
+
+func batchHeader(batch, account int) string {
+	return record(map[int]string{1: "341", 4: fmt.Sprintf("%04d", batch), 8: "1", 9: "C", 10: "20", 12: "01", 14: "045", 18: "2", 19: "00048226581020", 59: fmt.Sprintf("%012d", account), 73: "PAPELARIA DUNDER MIFFLIN"})
+}
+
+func segmentA(batch, sequence, account int, amount uint64) string {
+	return record(map[int]string{1: "341", 4: fmt.Sprintf("%04d", batch), 8: "3", 9: fmt.Sprintf("%05d", sequence), 14: "A", 15: "0", 16: "00", 18: "000", 21: "341", 30: fmt.Sprintf("%012d", account), 44: "CAIO BARROS ANTUNES", 74: fmt.Sprintf("NF-%d", sequence), 94: "18102026", 102: "BRL", 120: fmt.Sprintf("%015d", amount)})
+}
+
+func segmentB(batch, sequence int) string {
+	return record(map[int]string{1: "341", 4: fmt.Sprintf("%04d", batch), 8: "3", 9: fmt.Sprintf("%05d", sequence), 14: "B", 18: "1", 19: "00071530184077"})
+}
+
+func batchTrailer(batch, records int, total uint64) string {
+	return record(map[int]string{1: "341", 4: fmt.Sprintf("%04d", batch), 8: "5", 18: fmt.Sprintf("%06d", records), 24: fmt.Sprintf("%018d", total)})
+}
+
+func fileTrailer(batches, records int) string {
+	return record(map[int]string{1: "341", 4: "9999", 8: "9", 18: fmt.Sprintf("%06d", batches), 24: fmt.Sprintf("%06d", records)})
+}
+
+// remessa returns a file with one batch, debited from account 1, paying
+// 1500 to account 2, with a segment B, and 2500 to account 3.
+func remessa() []string {
+	return []string{
+		fileHeader(),
+		batchHeader(1, 1),
+		segmentA(1, 1, 2, 1500),
+		segmentB(1, 2),
+		segmentA(1, 3, 3, 2500),
+		batchTrailer(1, 5, 4000),
+		fileTrailer(1, 7),
+	}
+}
+
+func parse(t *testing.T, lines []string) *File {
+	t.Helper()
+	file, err := Parse(strings.NewReader(strings.Join(lines, "\r\n") + "\r\n"))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	return file
+}
+
+func TestParse(t *testing.T) {
+	t.Run("should read the batches and payments", func(t *testing.T) {
+		file := parse(t, remessa())
+
+		app.AssertString(t, file.BankCode, "341")
+		app.AssertString(t, file.CompanyDocument, "00048226581020")
+		app.AssertString(t, file.CompanyName, "PAPELARIA DUNDER MIFFLIN")
+		app.AssertUint64(t, uint64(file.Sequence), 42)
+		if len(file.Batches) != 1 || file.Batches[0].Refused() {
+			t.Fatalf("got batches %v; want one accepted", file.Batches)
+		}
+		batch := file.Batches[0]
+		app.AssertUint64(t, batch.Account, 1)
+		if len(batch.Payments) != 2 {
+			t.Fatalf("got payments %v; want 2", batch.Payments)
+		}
+		payment := batch.Payments[1]
+		app.AssertUint64(t, payment.Account, 3)
+		app.AssertUint64(t, payment.Amount, 2500)
+		app.AssertUint64(t, uint64(payment.Sequence), 3)
+		app.AssertString(t, payment.Name, "CAIO BARROS ANTUNES")
+		app.AssertString(t, payment.Reference, "NF-3")
+		if !payment.Date.Equal(time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)) || payment.Refused() {
+			t.Errorf("got date %v and occurrences %v; want 2026-10-18 and none", payment.Date, payment.Occurrences)
+		}
+	})
+
+	t.Run("should refuse files with the wrong structure", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			lines func(lines []string) []string
+			want  string
+		}{
+			{"short line", func(l []string) []string { l[2] = l[2][:239]; return l }, "line 3: it has 239 characters"},
+			{"not a remessa", func(l []string) []string { l[0] = patch(l[0], 143, "2"); return l }, "not a remessa"},
+			{"without a header", func(l []string) []string { return l[1:] }, "must start with a file header"},
+			{"without a trailer", func(l []string) []string { return l[:6] }, "must end with a file trailer"},
+			{"with the wrong record count", func(l []string) []string { l[6] = fileTrailer(1, 8); return l }, "counts 000008 records"},
+			{"with the wrong batch count", func(l []string) []string { l[6] = fileTrailer(2, 7); return l }, "counts 000002 batches"},
+			{"with another bank", func(l []string) []string { l[2] = patch(l[2], 1, "001"); return l }, `bank code "001"`},
+			{"with a detail outside a batch", func(l []string) []string {
+				return []string{l[0], l[2], fileTrailer(0, 3)}
+			}, "outside a batch"},
+			{"with a batch without trailer", func(l []string) []string {
+				return append(append(l[:5:5], batchHeader(2, 1)), fileTrailer(2, 7))
+			}, "batch 1 has no trailer"},
+			{"with a detail of another batch", func(l []string) []string { l[2] = patch(l[2], 4, "0002"); return l }, "record of batch 0002"},
+			{"with an unknown record type", func(l []string) []string { l[3] = patch(l[3], 8, "4"); return l }, "record type '4'"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				lines := tt.lines(remessa())
+				_, err := Parse(strings.NewReader(strings.Join(lines, "\n")))
+				if !errors.Is(err, ErrInvalidFile) || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("got error %v; want %q", err, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("should refuse batches that are wrong", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			lines func(lines []string) []string
+			want  string
+		}{
+			{"debit", func(l []string) []string { l[1] = patch(l[1], 9, "D"); return l }, OccurrenceInvalidOperation},
+			{"by TED", func(l []string) []string { l[1] = patch(l[1], 12, "41"); return l }, OccurrenceInvalidEntryType},
+			{"without a debit account", func(l []string) []string { l[1] = patch(l[1], 59, "ABC"); return l }, OccurrenceInvalidDebit},
+			{"out of sequence", func(l []string) []string {
+				for i := 1; i < 6; i++ {
+					l[i] = patch(l[i], 4, "0002")
+				}
+				return l
+			}, OccurrenceBatchOutOfSequence},
+			{"with records out of sequence", func(l []string) []string { l[4] = patch(l[4], 9, "00004"); return l }, OccurrenceInvalidSequence},
+			{"with an unknown segment", func(l []string) []string { l[3] = patch(l[3], 14, "J"); return l }, OccurrenceInvalidSegment},
+			{"with the wrong total", func(l []string) []string { l[5] = batchTrailer(1, 5, 4001); return l }, OccurrenceInvalidTotals},
+			{"with the wrong record count", func(l []string) []string { l[5] = batchTrailer(1, 4, 4000); return l }, OccurrenceInvalidTotals},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				file := parse(t, tt.lines(remessa()))
+				app.AssertString(t, strings.Join(file.Batches[0].Occurrences, " "), tt.want)
+			})
+		}
+	})
+
+	t.Run("should refuse payments that are wrong", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			position int
+			value    string
+			want     string
+		}{
+			{"movement", 15, "9", OccurrenceInvalidMovement},
+			{"bank", 21, "001", OccurrenceInvalidBank},
+			{"account", 30, "00000000000X", OccurrenceInvalidAccount},
+			{"date", 94, "31022026", OccurrenceInvalidDate},
+			{"currency", 102, "USD", OccurrenceInvalidCurrency},
+			{"amount", 120, "000000000000000", OccurrenceInvalidAmount},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				lines := remessa()
+				lines[4] = patch(lines[4], tt.position, tt.value)
+				if tt.name == "amount" {
+					lines[5] = batchTrailer(1, 5, 1500)
+				}
+				file := parse(t, lines)
+
+				batch := file.Batches[0]
+				if batch.Refused() || batch.Payments[0].Refused() {
+					t.Fatalf("got batch occurrences %v and first payment occurrences %v; want none", batch.Occurrences, batch.Payments[0].Occurrences)
+				}
+				app.AssertString(t, strings.Join(batch.Payments[1].Occurrences, " "), tt.want)
+			})
+		}
+	})
+}
+
+func TestWriteReturn(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 14, 30, 5, 0, time.UTC)
+
+	t.Run("should tell how each payment went", func(t *testing.T) {
+		lines := remessa()
+		file := parse(t, lines)
+		file.Batches[0].Payments[0].Pay(17, now)
+		file.Batches[0].Payments[1].TransferID = 18
+		file.Batches[0].Payments[1].Refuse(OccurrenceInsufficientFunds)
+		var b strings.Builder
+
+		err := file.WriteReturn(&b, now)
+
+		app.AssertError(t, err, nil)
+		got := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+		if len(got) != len(lines) {
+			t.Fatalf("got %d lines; want %d", len(got), len(lines))
+		}
+		app.AssertString(t, field(got[0], 143, 157), "218102026143005")
+		app.AssertString(t, field(got[1], 231, 240), "          ")
+		paid := got[2]
+		app.AssertString(t, field(paid, 135, 154), "17                  ")
+		app.AssertString(t, field(paid, 155, 177), "18102026000000000001500")
+		app.AssertString(t, field(paid, 231, 240), "00        ")
+		app.AssertString(t, field(paid, 1, 134), field(lines[2], 1, 134))
+		app.AssertString(t, got[3], lines[3])
+		refused := got[4]
+		app.AssertString(t, field(refused, 135, 154), "18                  ")
+		app.AssertString(t, field(refused, 155, 177), field(lines[4], 155, 177))
+		app.AssertString(t, field(refused, 231, 240), "01        ")
+		app.AssertString(t, got[6], lines[6])
+	})
+
+	t.Run("should send the occurrences of a refused batch on all its records", func(t *testing.T) {
+		lines := remessa()
+		lines[5] = batchTrailer(1, 5, 1)
+		file := parse(t, lines)
+		var b strings.Builder
+
+		file.WriteReturn(&b, now)
+
+		got := strings.Split(b.String(), "\r\n")
+		for _, i := range []int{1, 2, 4, 5} {
+			app.AssertString(t, field(got[i], 231, 240), "TA        ")
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package cnab
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteReturn writes the retorno of the file to w: the lines of the
+// remessa, marked as a retorno generated at now, with the occurrences of
+// each batch on its header and trailer and, on each payment, its
+// occurrences, the ID of its transfer as the bank's number (nosso número)
+// and, if it was paid, when and how much. Lines end in CRLF.
+func (f *File) WriteReturn(w io.Writer, now time.Time) error {
+	lines := make([]string, len(f.lines))
+	copy(lines, f.lines)
+
+	lines[0] = patch(lines[0], 143, "2")
+	lines[0] = patch(lines[0], 144, now.Format("02012006150405"))
+	for _, batch := range f.Batches {
+		occurrences := occurrenceField(batch.Occurrences)
+		lines[batch.header] = patch(lines[batch.header], 231, occurrences)
+		lines[batch.trailer] = patch(lines[batch.trailer], 231, occurrences)
+		for _, payment := range batch.Payments {
+			line := lines[payment.line]
+			if batch.Refused() {
+				line = patch(line, 231, occurrences)
+				lines[payment.line] = line
+				continue
+			}
+			if payment.TransferID != 0 {
+				line = patch(line, 135, fmt.Sprintf("%-20d", payment.TransferID))
+			}
+			if !payment.PaidAt.IsZero() {
+				line = patch(line, 155, payment.PaidAt.Format("02012006"))
+				line = patch(line, 163, fmt.Sprintf("%015d", payment.Amount))
+			}
+			lines[payment.line] = patch(line, 231, occurrenceField(payment.Occurrences))
+		}
+	}
+
+	buffered := bufio.NewWriter(w)
+	for _, line := range lines {
+		buffered.WriteString(line)
+		buffered.WriteString("\r\n")
+	}
+	return buffered.Flush()
+}
+
+// patch returns line with value written over it from position from,
+// counted from 1.
+func patch(line string, from int, value string) string {
+	return line[:from-1] + value + line[from-1+len(value):]
+}
+
+// occurrenceField formats up to five occurrence codes for the 10
+// characters of the occurrences field.
+func occurrenceField(codes []string) string {
+	if len(codes) > maxOccurrences {
+		codes = codes[:maxOccurrences]
+	}
+	return fmt.Sprintf("%-10s", strings.Join(codes, ""))
+}
+
+// Paid returns how many payments of the file were paid and their total
+// amount in cents.
+func (f *File) Paid() (payments int, total uint64) {
+	for _, batch := range f.Batches {
+		for _, payment := range batch.Payments {
+			if !payment.PaidAt.IsZero() {
+				payments++
+				total += payment.Amount
+			}
+		}
+	}
+	return payments, total
+}
@@ -0,0 +1,120 @@
+// Package events describes what happens to accounts and transfers, as the
+// stores publish it, so that other parts of the bank, such as webhooks, can
+// react to it without the stores knowing about them.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types. Transfer events carry the transfer as it is after the change.
+// Every transfer status has its own event type, published when a transfer
+// gets to it.
+const (
+	AccountCreated        = "account.created"
+	AccountBalanceChanged = "account.balance_changed"
+	TransferCreated       = "transfer.created"
+	TransferAuthorizing   = "transfer.authorizing"
+	TransferAuthorized    = "transfer.authorized"
+	TransferRejected      = "transfer.rejected" // Not authorized by the bank rules
+	TransferConfirmed     = "transfer.confirmed"
+	TransferCancelled     = "transfer.cancelled"
+	TransferExpired       = "transfer.expired"
+
+	TransferPendingConfirmation = "transfer.pending_confirmation"
+	// TransferReleased is published when a transfer pending confirmation is
+	// confirmed with a second factor and goes back to created, to be
+	// authorized.
+	TransferReleased = "transfer.released"
+)
+
+// ErrInvalidType is returned for event types, or patterns of them, that
+// match no event type.
+var ErrInvalidType = errors.New("invalid event type: it must be one of " + strings.Join(Types, ", ") + ", or a prefix ending in *")
+
+// Types lists every event type.
+var Types = []string{
+	AccountCreated, AccountBalanceChanged, TransferCreated,
+	TransferAuthorizing, TransferAuthorized, TransferRejected,
+	TransferConfirmed, TransferCancelled, TransferExpired,
+	TransferPendingConfirmation, TransferReleased,
+}
+
+type Event struct {
+	ID         uint64          `json:"id"` // Set by the bus, increasing in the order events are published
+	Type       string          `json:"type"`
+	Time       time.Time       `json:"time"`
+	AccountIDs []uint64        `json:"account_ids"` // Accounts the event is about
+	Data       json.RawMessage `json:"data"`
+}
+
+// Involves tells whether the event is about the account with the given ID.
+func (e Event) Involves(accountID uint64) bool {
+	for _, ID := range e.AccountIDs {
+		if ID == accountID {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidPattern tells whether pattern is an event type or a prefix ending in
+// a wildcard, such as transfer.*, that matches at least one event type.
+func ValidPattern(pattern string) bool {
+	for _, eventType := range Types {
+		if Match(pattern, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match tells whether eventType matches pattern, which is either an event
+// type, a prefix ending in a wildcard such as transfer.*, or * alone.
+func Match(pattern, eventType string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == eventType
+}
+
+// Bus numbers the events published on it and hands them to its handlers,
+// in order.
+type Bus struct {
+	mu       sync.Mutex
+	lastID   uint64
+	handlers []func(Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds a handler for every event published from now on. Handlers
+// are called while the stores are locked, so they must not block nor call
+// back into the stores.
+func (b *Bus) Subscribe(handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish gives e the next ID, and the current time if it has none, and
+// hands it to every handler.
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, handler := range b.handlers {
+		handler(e)
+	}
+}
@@ -0,0 +1,46 @@
+package events
+
+import (
+	app "github.com/erikacarvalho/stone-challenge"
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	var got []Event
+	bus.Subscribe(func(e Event) { got = append(got, e) })
+
+	bus.Publish(Event{Type: AccountCreated, AccountIDs: []uint64{1}})
+	bus.Publish(Event{Type: TransferCreated, AccountIDs: []uint64{1, 2}})
+
+	app.AssertUint64(t, uint64(len(got)), 2)
+	app.AssertUint64(t, got[0].ID, 1)
+	app.AssertUint64(t, got[1].ID, 2)
+	if got[0].Time.IsZero() {
+		t.Error("got an event without a time")
+	}
+	if !got[1].Involves(2) || got[1].Involves(3) {
+		t.Errorf("got accounts %v; want 1 and 2", got[1].AccountIDs)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, eventType string
+		want               bool
+	}{
+		{"*", AccountCreated, true},
+		{"transfer.*", TransferConfirmed, true},
+		{"transfer.*", AccountCreated, false},
+		{AccountCreated, AccountCreated, true},
+		{AccountCreated, AccountBalanceChanged, false},
+	}
+	for _, c := range cases {
+		if got := Match(c.pattern, c.eventType); got != c.want {
+			t.Errorf("got Match(%q, %q) = %v; want %v", c.pattern, c.eventType, got, c.want)
+		}
+	}
+	if ValidPattern("conta.*") || ValidPattern("transfer") {
+		t.Error("got patterns that match no event type as valid")
+	}
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileSink appends events to a file, one JSON event per line. Since events
+// are relayed at least once, the same event may show up again after a
+// restart; its ID tells.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenFileSink returns a sink appending to the file at path, creating it if
+// needed.
+func OpenFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening event log: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Send appends e to the file and syncs it to disk.
+func (f *FileSink) Send(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.file.Write(append(line, '\n'))
+	if err == nil {
+		err = f.file.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("error writing event log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file.
+func (f *FileSink) Close() error {
+	return f.file.Close()
+}
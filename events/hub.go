@@ -0,0 +1,120 @@
+package events
+
+import (
+	"errors"
+	"sync"
+)
+
+// Defaults of a new Hub.
+const (
+	DefaultBufferSize     = 1000
+	DefaultMaxSubscribers = 100
+)
+
+// streamQueueSize is how many events a stream may fall behind before the
+// hub gives up on it.
+const streamQueueSize = 64
+
+var ErrTooManySubscribers = errors.New("too many event streams open")
+
+// Hub keeps the latest events published, so that streams can resume from
+// them, and hands every new event to the open streams.
+type Hub struct {
+	MaxSubscribers int
+
+	mu      sync.Mutex
+	size    int
+	buffer  []Event // Oldest first
+	lastID  uint64
+	streams map[*Stream]struct{}
+}
+
+// NewHub returns a hub that keeps the last size events.
+func NewHub(size int) *Hub {
+	return &Hub{
+		MaxSubscribers: DefaultMaxSubscribers,
+		size:           size,
+		streams:        make(map[*Stream]struct{}),
+	}
+}
+
+// Stream is a subscription to the events of a hub that pass its filter.
+type Stream struct {
+	// Backlog holds the buffered events the stream resumes from.
+	Backlog []Event
+	// Gap tells that events after the last one seen were lost, because
+	// they are no longer buffered or the hub started over, and that
+	// Backlog has every event still buffered.
+	Gap bool
+	// C receives the events published after Backlog. It is closed if the
+	// stream falls too far behind, and the subscriber should then resume
+	// from the last event it got.
+	C <-chan Event
+
+	c      chan Event
+	filter func(Event) bool
+	hub    *Hub
+}
+
+// Handle keeps e and hands it to every stream it passes the filter of. It
+// never blocks, so it can be subscribed to a Bus: streams too far behind
+// are closed instead.
+func (h *Hub) Handle(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.buffer) == h.size && h.size > 0 {
+		h.buffer = append(h.buffer[:0], h.buffer[1:]...)
+	}
+	if h.size > 0 {
+		h.buffer = append(h.buffer, e)
+	}
+	h.lastID = e.ID
+
+	for stream := range h.streams {
+		if !stream.filter(e) {
+			continue
+		}
+		select {
+		case stream.c <- e:
+		default:
+			delete(h.streams, stream)
+			close(stream.c)
+		}
+	}
+}
+
+// Subscribe opens a stream of the events that pass filter. With resume, it
+// starts after the event with lastID, taking what is still buffered as the
+// backlog; otherwise it only gets new events.
+func (h *Hub) Subscribe(lastID uint64, resume bool, filter func(Event) bool) (*Stream, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.streams) >= h.MaxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	c := make(chan Event, streamQueueSize)
+	stream := &Stream{C: c, c: c, filter: filter, hub: h}
+	if resume {
+		stream.Gap = lastID > h.lastID || (len(h.buffer) > 0 && h.buffer[0].ID > lastID+1)
+		for _, e := range h.buffer {
+			if (e.ID > lastID || stream.Gap) && filter(e) {
+				stream.Backlog = append(stream.Backlog, e)
+			}
+		}
+	}
+	h.streams[stream] = struct{}{}
+	return stream, nil
+}
+
+// Close stops the stream.
+func (s *Stream) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, ok := s.hub.streams[s]; ok {
+		delete(s.hub.streams, s)
+		close(s.c)
+	}
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	app "github.com/erikacarvalho/stone-challenge"
+	"testing"
+)
+
+func TestHub(t *testing.T) {
+	all := func(Event) bool { return true }
+	publish := func(hub *Hub, from, to uint64) {
+		for ID := from; ID <= to; ID++ {
+			hub.Handle(Event{ID: ID, Type: TransferCreated, AccountIDs: []uint64{ID % 2}})
+		}
+	}
+
+	t.Run("should hand new events to open streams that want them", func(t *testing.T) {
+		hub := NewHub(10)
+		odd, _ := hub.Subscribe(0, false, func(e Event) bool { return e.Involves(1) })
+		defer odd.Close()
+
+		publish(hub, 1, 4)
+
+		app.AssertUint64(t, uint64(len(odd.Backlog)), 0)
+		app.AssertUint64(t, (<-odd.C).ID, 1)
+		app.AssertUint64(t, (<-odd.C).ID, 3)
+		app.AssertUint64(t, uint64(len(odd.C)), 0)
+	})
+
+	t.Run("should resume after the last event seen", func(t *testing.T) {
+		hub := NewHub(10)
+		publish(hub, 1, 5)
+
+		stream, _ := hub.Subscribe(3, true, all)
+		defer stream.Close()
+
+		assertIDs(t, ids(stream.Backlog), 4, 5)
+		if stream.Gap {
+			t.Error("got a gap resuming from a buffered event")
+		}
+	})
+
+	t.Run("should tell when events to resume from were dropped", func(t *testing.T) {
+		hub := NewHub(3)
+		publish(hub, 1, 6)
+
+		stream, _ := hub.Subscribe(1, true, all)
+		defer stream.Close()
+
+		assertIDs(t, ids(stream.Backlog), 4, 5, 6)
+		if !stream.Gap {
+			t.Error("got no gap resuming from a dropped event")
+		}
+
+		restarted, _ := NewHub(3).Subscribe(6, true, all)
+		if !restarted.Gap {
+			t.Error("got no gap resuming from an event the hub never saw")
+		}
+	})
+
+	t.Run("should close streams that fall too far behind", func(t *testing.T) {
+		hub := NewHub(10)
+		slow, _ := hub.Subscribe(0, false, all)
+
+		publish(hub, 1, streamQueueSize+1)
+
+		received := 0
+		for range slow.C {
+			received++
+		}
+		app.AssertUint64(t, uint64(received), streamQueueSize)
+		slow.Close()
+	})
+
+	t.Run("should limit the streams open", func(t *testing.T) {
+		hub := NewHub(10)
+		hub.MaxSubscribers = 1
+		stream, err := hub.Subscribe(0, false, all)
+		app.AssertError(t, err, nil)
+
+		_, err = hub.Subscribe(0, false, all)
+		app.AssertError(t, err, ErrTooManySubscribers)
+
+		stream.Close()
+		_, err = hub.Subscribe(0, false, all)
+		app.AssertError(t, err, nil)
+	})
+}
+
+func assertIDs(t *testing.T, got []uint64, want ...uint64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got events %v; want %v", got, want)
+	}
+	for i := range want {
+		app.AssertUint64(t, got[i], want[i])
+	}
+}
@@ -0,0 +1,293 @@
+package events
+
+import (
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"sync"
+	"time"
+)
+
+// Defaults of a new Relay.
+const (
+	DefaultRelayBackoff    = time.Second
+	DefaultRelayMaxBackoff = time.Minute
+)
+
+// Outbox keeps the events published to it until every sink of a Relay got
+// them. Stores publish to it while they are locked, so an event is kept in
+// the same step as the change it describes, and it is saved in snapshots
+// with them: after a crash, the state and the events about it go back to
+// the same point.
+type Outbox struct {
+	mu      sync.Mutex
+	lastID  uint64
+	events  []Event           // Oldest first
+	offsets map[string]uint64 // ID of the last event each sink got
+	sinks   map[string]bool   // Sinks being relayed to, which events are kept for
+	changed chan struct{}     // Closed when an event is published
+}
+
+// OutboxState is what an outbox keeps, as saved in snapshots.
+type OutboxState struct {
+	LastID  uint64            `json:"last_id"`
+	Events  []Event           `json:"events,omitempty"`
+	Offsets map[string]uint64 `json:"offsets,omitempty"`
+}
+
+// NewOutbox returns an empty outbox.
+func NewOutbox() *Outbox {
+	return RestoreOutbox(OutboxState{})
+}
+
+// RestoreOutbox returns an outbox holding state, whose sinks resume after
+// their offsets.
+func RestoreOutbox(state OutboxState) *Outbox {
+	offsets := make(map[string]uint64)
+	for name, offset := range state.Offsets {
+		offsets[name] = offset
+	}
+	return &Outbox{
+		lastID:  state.LastID,
+		events:  append([]Event(nil), state.Events...),
+		offsets: offsets,
+		sinks:   make(map[string]bool),
+		changed: make(chan struct{}),
+	}
+}
+
+// Publish gives e the next ID, and the current time if it has none, and
+// keeps it to be relayed.
+func (o *Outbox) Publish(e Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.lastID++
+	e.ID = o.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	o.events = append(o.events, e)
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// State returns a copy of what the outbox keeps.
+func (o *Outbox) State() OutboxState {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	state := OutboxState{
+		LastID:  o.lastID,
+		Events:  append([]Event(nil), o.events...),
+		Offsets: make(map[string]uint64),
+	}
+	for name, offset := range o.offsets {
+		state.Offsets[name] = offset
+	}
+	return state
+}
+
+// Len returns how many events are kept because some sink did not get them
+// yet.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.events)
+}
+
+// register starts keeping events for the sink called name. A sink with no
+// offset yet starts with the events still kept.
+func (o *Outbox) register(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.sinks[name] = true
+	if _, ok := o.offsets[name]; ok {
+		return
+	}
+	o.offsets[name] = o.lastID
+	if len(o.events) > 0 {
+		o.offsets[name] = o.events[0].ID - 1
+	}
+}
+
+// pending returns the events the sink called name did not get yet, and a
+// channel closed once another one is published.
+func (o *Outbox) pending(name string) ([]Event, <-chan struct{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	offset := o.offsets[name]
+	var pending []Event
+	for _, e := range o.events {
+		if e.ID > offset {
+			pending = append(pending, e)
+		}
+	}
+	return pending, o.changed
+}
+
+// offset returns the ID of the last event the sink called name got.
+func (o *Outbox) offset(name string) uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.offsets[name]
+}
+
+// ack records that the sink called name got the events up to ID, and drops
+// the ones every sink got.
+func (o *Outbox) ack(name string, ID uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.offsets[name] = ID
+	lowest := o.lastID
+	for sink := range o.sinks {
+		if o.offsets[sink] < lowest {
+			lowest = o.offsets[sink]
+		}
+	}
+	kept := 0
+	for kept < len(o.events) && o.events[kept].ID <= lowest {
+		kept++
+	}
+	o.events = append(o.events[:0], o.events[kept:]...)
+}
+
+// Sink is where a Relay sends events. Send must only return nil once the
+// event is safe with it; otherwise it is sent again.
+type Sink interface {
+	Send(e Event) error
+}
+
+// TrackedSink is a Sink that goes on with events after Send returns, such
+// as one delivering them in the background. Its offset only moves past the
+// events it finished with, so that the ones still in progress when the
+// server stops are sent to it again after a restart.
+type TrackedSink interface {
+	Sink
+	// Unfinished returns the ID of the oldest event sent to the sink that it
+	// did not finish with, or 0 if there is none, and a channel closed once
+	// that may have changed.
+	Unfinished() (uint64, <-chan struct{})
+}
+
+// HandlerSink is a Sink calling a handler that never fails, such as
+// (*Hub).Handle.
+type HandlerSink func(e Event)
+
+func (h HandlerSink) Send(e Event) error {
+	h(e)
+	return nil
+}
+
+// Relay sends the events of an outbox to its sinks, each in order and at
+// least once. Every sink has its own offset, so a failing sink is retried
+// with exponential backoff without holding back the others.
+type Relay struct {
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	outbox *Outbox
+	sinks  map[string]Sink
+}
+
+func NewRelay(outbox *Outbox) *Relay {
+	return &Relay{
+		Backoff:    DefaultRelayBackoff,
+		MaxBackoff: DefaultRelayMaxBackoff,
+		outbox:     outbox,
+		sinks:      make(map[string]Sink),
+	}
+}
+
+// AddSink sends events to sink from now on. Its offset is kept under name,
+// which must not change between restarts. Sinks must be added before Run.
+func (r *Relay) AddSink(name string, sink Sink) {
+	r.sinks[name] = sink
+	r.outbox.register(name)
+}
+
+// Run relays events until stop is closed.
+func (r *Relay) Run(stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for name, sink := range r.sinks {
+		wg.Add(1)
+		go func(name string, sink Sink) {
+			defer wg.Done()
+			r.relay(name, sink, stop)
+		}(name, sink)
+	}
+	wg.Wait()
+}
+
+func (r *Relay) relay(name string, sink Sink, stop <-chan struct{}) {
+	logger := logging.Default().With("component", "relay", "sink", name)
+	tracked, isTracked := sink.(TrackedSink)
+	// Tracked sinks are acked behind what was sent to them, so sent keeps
+	// them from getting the same event twice before a restart.
+	sent := r.outbox.offset(name)
+	acked := sent
+	failures := 0
+	for {
+		pending, changed := r.outbox.pending(name)
+		for _, e := range pending {
+			if e.ID <= sent {
+				continue
+			}
+			err := sink.Send(e)
+			if err != nil {
+				failures++
+				logger.Warn("error relaying event", "event_id", e.ID, "type", e.Type, "failures", failures, "error", err)
+				break
+			}
+			failures = 0
+			sent = e.ID
+			if !isTracked {
+				r.outbox.ack(name, e.ID)
+			}
+		}
+
+		var finished <-chan struct{}
+		if isTracked {
+			var oldest uint64
+			oldest, finished = tracked.Unfinished()
+			done := sent
+			if oldest != 0 && oldest <= sent {
+				done = oldest - 1
+			}
+			if done > acked {
+				acked = done
+				r.outbox.ack(name, acked)
+			}
+		}
+
+		if failures == 0 {
+			select {
+			case <-stop:
+				return
+			case <-changed:
+			case <-finished:
+			}
+			continue
+		}
+		timer := time.NewTimer(r.backoff(failures))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the wait before sending again after failures in a row.
+func (r *Relay) backoff(failures int) time.Duration {
+	wait := r.Backoff
+	for i := 1; i < failures && wait < r.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > r.MaxBackoff {
+		wait = r.MaxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,242 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	app "github.com/erikacarvalho/stone-challenge"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a sink keeping the IDs of the events sent to it, which fails
+// the first failures sends.
+type recorder struct {
+	mu       sync.Mutex
+	IDs      []uint64
+	failures int
+	sends    int
+}
+
+func (r *recorder) Send(e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sends++
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("sink is down")
+	}
+	r.IDs = append(r.IDs, e.ID)
+	return nil
+}
+
+// waitFor waits until the recorder got n events.
+func (r *recorder) waitFor(t *testing.T, n int) []uint64 {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		IDs := append([]uint64(nil), r.IDs...)
+		r.mu.Unlock()
+		if len(IDs) >= n {
+			return IDs
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("got %v; want %d events", r.IDs, n)
+	return nil
+}
+
+// background is a tracked sink that finishes with the events sent to it
+// only when told to.
+type background struct {
+	recorder
+	finished chan struct{}
+	done     uint64
+}
+
+func (b *background) Unfinished() (uint64, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ID := range b.IDs {
+		if ID > b.done {
+			return ID, b.finished
+		}
+	}
+	return 0, b.finished
+}
+
+// finish finishes with the events up to ID.
+func (b *background) finish(ID uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done = ID
+	close(b.finished)
+	b.finished = make(chan struct{})
+}
+
+func TestOutbox(t *testing.T) {
+	publish := func(outbox *Outbox, n int) {
+		for i := 0; i < n; i++ {
+			outbox.Publish(Event{Type: TransferCreated})
+		}
+	}
+
+	t.Run("should relay every event to every sink in order", func(t *testing.T) {
+		outbox := NewOutbox()
+		publish(outbox, 2)
+		relay := NewRelay(outbox)
+		webhooks, stream := &recorder{}, &recorder{}
+		relay.AddSink("webhooks", webhooks)
+		relay.AddSink("stream", stream)
+		stop := make(chan struct{})
+		defer close(stop)
+		go relay.Run(stop)
+
+		publish(outbox, 1)
+
+		assertIDs(t, webhooks.waitFor(t, 3), 1, 2, 3)
+		assertIDs(t, stream.waitFor(t, 3), 1, 2, 3)
+		deadline := time.Now().Add(5 * time.Second)
+		for outbox.Len() > 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		app.AssertUint64(t, uint64(outbox.Len()), 0)
+	})
+
+	t.Run("should send again to a failing sink without holding back the others", func(t *testing.T) {
+		outbox := NewOutbox()
+		relay := NewRelay(outbox)
+		relay.Backoff = time.Millisecond
+		failing, healthy := &recorder{failures: 2}, &recorder{}
+		relay.AddSink("failing", failing)
+		relay.AddSink("healthy", healthy)
+		stop := make(chan struct{})
+		defer close(stop)
+		go relay.Run(stop)
+
+		publish(outbox, 2)
+
+		assertIDs(t, healthy.waitFor(t, 2), 1, 2)
+		assertIDs(t, failing.waitFor(t, 2), 1, 2)
+		failing.mu.Lock()
+		defer failing.mu.Unlock()
+		app.AssertUint64(t, uint64(failing.sends), 4)
+	})
+
+	t.Run("should keep events until every sink got them", func(t *testing.T) {
+		outbox := NewOutbox()
+		outbox.register("webhooks")
+		outbox.register("stream")
+		publish(outbox, 3)
+
+		outbox.ack("webhooks", 3)
+		outbox.ack("stream", 1)
+
+		state := outbox.State()
+		assertIDs(t, ids(state.Events), 2, 3)
+		app.AssertUint64(t, state.Offsets["webhooks"], 3)
+		app.AssertUint64(t, state.Offsets["stream"], 1)
+	})
+
+	t.Run("should resume every sink after its offset when restored", func(t *testing.T) {
+		outbox := NewOutbox()
+		outbox.register("webhooks")
+		publish(outbox, 3)
+		outbox.ack("webhooks", 2)
+
+		restored := RestoreOutbox(outbox.State())
+		relay := NewRelay(restored)
+		webhooks, added := &recorder{}, &recorder{}
+		relay.AddSink("webhooks", webhooks)
+		relay.AddSink("log", added)
+		stop := make(chan struct{})
+		defer close(stop)
+		go relay.Run(stop)
+		restored.Publish(Event{Type: TransferCreated})
+
+		assertIDs(t, webhooks.waitFor(t, 2), 3, 4)
+		assertIDs(t, added.waitFor(t, 2), 3, 4)
+	})
+
+	t.Run("should only move the offset of tracked sinks past finished events", func(t *testing.T) {
+		outbox := NewOutbox()
+		relay := NewRelay(outbox)
+		webhooks := &background{finished: make(chan struct{})}
+		relay.AddSink("webhooks", webhooks)
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			relay.Run(stop)
+			close(done)
+		}()
+
+		publish(outbox, 3)
+		assertIDs(t, webhooks.waitFor(t, 3), 1, 2, 3)
+		webhooks.finish(1)
+		deadline := time.Now().Add(5 * time.Second)
+		for outbox.State().Offsets["webhooks"] < 1 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		close(stop)
+		<-done
+		app.AssertUint64(t, outbox.State().Offsets["webhooks"], 1)
+		assertIDs(t, webhooks.IDs, 1, 2, 3)
+
+		restored := RestoreOutbox(outbox.State())
+		relay = NewRelay(restored)
+		restarted := &recorder{}
+		relay.AddSink("webhooks", restarted)
+		stop = make(chan struct{})
+		defer close(stop)
+		go relay.Run(stop)
+		assertIDs(t, restarted.waitFor(t, 2), 2, 3)
+	})
+
+	t.Run("should double the backoff up to the maximum", func(t *testing.T) {
+		relay := NewRelay(NewOutbox())
+
+		app.AssertUint64(t, uint64(relay.backoff(1)), uint64(time.Second))
+		app.AssertUint64(t, uint64(relay.backoff(3)), uint64(4*time.Second))
+		app.AssertUint64(t, uint64(relay.backoff(30)), uint64(time.Minute))
+	})
+
+	t.Run("should append events to a file", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "events.log")
+
+		sink, err := OpenFileSink(path)
+		app.AssertError(t, err, nil)
+		sink.Send(Event{ID: 1, Type: AccountCreated})
+		sink.Send(Event{ID: 2, Type: TransferCreated})
+		sink.Close()
+
+		file, _ := os.Open(path)
+		defer file.Close()
+		var written []Event
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var e Event
+			json.Unmarshal(scanner.Bytes(), &e)
+			written = append(written, e)
+		}
+		assertIDs(t, ids(written), 1, 2)
+		app.AssertString(t, written[1].Type, TransferCreated)
+	})
+}
+
+func ids(events []Event) []uint64 {
+	var IDs []uint64
+	for _, e := range events {
+		IDs = append(IDs, e.ID)
+	}
+	return IDs
+}
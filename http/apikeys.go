@@ -0,0 +1,214 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// Headers of requests made with an API key. Plain requests send the key as
+// <id>.<secret> in APIKeyHeader. Signed requests send only the key ID there,
+// along with the other headers, and never send the secret.
+const (
+	APIKeyHeader    = "X-Api-Key"
+	TimestampHeader = "X-Timestamp"
+	NonceHeader     = "X-Nonce"
+	SignatureHeader = "X-Signature"
+)
+
+var (
+	ErrInsufficientRole = errors.New("API key role does not allow this request")
+	ErrAPIKeyRequired   = errors.New("API key required")
+)
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"` // read-only, operator or admin
+}
+
+type APIKeyResponse struct {
+	auth.APIKey
+	Secret string `json:"secret,omitempty"` // Only sent when the key is created or rotated
+}
+
+// permissions maps the methods of a route to the least privileged API key
+// role allowed to call them.
+type permissions map[string]string
+
+// WithAPIKeys lets back-office tools and partner systems call the API with
+// the keys in keys, within the permissions of their roles, and serves the
+// admin endpoints that manage them under /admin/keys.
+func WithAPIKeys(keys *auth.KeyStore) Option {
+	return func(s *Server) {
+		s.keys = keys
+	}
+}
+
+// apiKeyMiddleware authenticates requests sent with an API key, plain or
+// signed, and adds the key to the request context. Requests without one are
+// left for the customer authentication.
+func (s *Server) apiKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential := r.Header.Get(APIKeyHeader)
+		if credential == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var key auth.APIKey
+		var err error
+		if signature := r.Header.Get(SignatureHeader); signature != "" {
+			var body []byte
+			body, err = peekBody(r)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "", fmt.Sprintf("error reading body: %v", err))
+				return
+			}
+			key, err = s.keys.VerifySignature(auth.SignedRequest{
+				KeyID:     credential,
+				Timestamp: r.Header.Get(TimestampHeader),
+				Nonce:     r.Header.Get(NonceHeader),
+				Method:    r.Method,
+				URI:       r.URL.RequestURI(),
+				Body:      body,
+			}, signature)
+		} else {
+			key, err = s.keys.Authenticate(credential)
+		}
+		if err != nil {
+			writeError(w, r, http.StatusUnauthorized, err, "", err.Error())
+			return
+		}
+		noteActor(r, "key:"+key.ID)
+		next.ServeHTTP(w, r.WithContext(auth.NewKeyContext(r.Context(), key)))
+	})
+}
+
+// guard checks the role of requests made with an API key against the
+// permissions of a route. Methods the permissions do not list are refused,
+// so that a route is never left open by a missing entry. Requests made by
+// customers are left for the handler, which checks what they own.
+func (s *Server) guard(handler http.HandlerFunc, perms permissions) http.HandlerFunc {
+	if s.keys == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := auth.KeyFromContext(r.Context())
+		if !ok {
+			handler(w, r)
+			return
+		}
+		required, ok := perms[r.Method]
+		if !ok || !auth.Allows(key.Role, required) {
+			writeError(w, r, http.StatusForbidden, ErrInsufficientRole, "", fmt.Sprintf("API key role %s cannot %s %s", key.Role, r.Method, r.URL.Path))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// adminOnly allows only requests made with admin API keys.
+func (s *Server) adminOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return s.keyOnly(handler, auth.RoleAdmin)
+}
+
+// keyOnly allows only requests made with API keys whose role can do what
+// role can.
+func (s *Server) keyOnly(handler http.HandlerFunc, role string) http.HandlerFunc {
+	if s.keys == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := auth.KeyFromContext(r.Context())
+		if !ok {
+			writeError(w, r, http.StatusUnauthorized, ErrAPIKeyRequired, "", fmt.Sprintf("%s requires an %s API key", r.URL.Path, role))
+			return
+		}
+		if !auth.Allows(key.Role, role) {
+			writeError(w, r, http.StatusForbidden, ErrInsufficientRole, "", fmt.Sprintf("API key role %s cannot %s %s", key.Role, r.Method, r.URL.Path))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// keysHandler lists API keys on GET and creates one, based on a
+// CreateAPIKeyRequest, on POST /admin/keys.
+func (s *Server) keysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, r, http.StatusOK, s.keys.List())
+	case http.MethodPost:
+		creationRequest := CreateAPIKeyRequest{}
+		if !decodeBody(w, r, &creationRequest) {
+			return
+		}
+		key, secret, err := s.keys.Create(creationRequest.Name, creationRequest.Role)
+		if err == auth.ErrInvalidRole {
+			writeError(w, r, http.StatusBadRequest, err, "role", err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error creating API key: %v", err))
+			return
+		}
+		w.Header().Set("Location", "/admin/keys/"+key.ID)
+		writeJSON(w, r, http.StatusCreated, APIKeyResponse{APIKey: key, Secret: secret})
+	default:
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// keyHandler revokes an API key on DELETE /admin/keys/{key_id}.
+func (s *Server) keyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, r, http.MethodDelete)
+		return
+	}
+	ID := mux.Vars(r)["key_id"]
+	key, err := s.keys.Revoke(ID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "key_id", fmt.Sprintf("API key %s not found", ID))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, APIKeyResponse{APIKey: key})
+}
+
+// rotateKeyHandler gives an API key a new secret on POST
+// /admin/keys/{key_id}/rotate.
+func (s *Server) rotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	ID := mux.Vars(r)["key_id"]
+	key, secret, err := s.keys.Rotate(ID)
+	if err == auth.ErrAPIKeyNotFound {
+		writeError(w, r, http.StatusNotFound, err, "key_id", fmt.Sprintf("API key %s not found", ID))
+		return
+	}
+	if err == auth.ErrRevokedAPIKey {
+		writeError(w, r, http.StatusConflict, err, "key_id", fmt.Sprintf("API key %s is revoked", ID))
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error rotating API key: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, APIKeyResponse{APIKey: key, Secret: secret})
+}
+
+// writeJSON responds with v marshaled to JSON.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling response: %v", err))
+		return
+	}
+	w.Header().Set("content-type", JsonContentType)
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
@@ -0,0 +1,170 @@
+package http
+
+import (
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	newServer := func() (*Server, *auth.KeyStore, *store.AccountStore) {
+		accountStore := store.NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 1000},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 1000},
+		)
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_admin", Role: auth.RoleAdmin}, "admin-secret")
+		server := NewServer(accountStore, store.NewTransferStore(app.StartingID(0)),
+			WithAuth(auth.NewIssuer([]byte("chave-de-teste"), time.Hour)),
+			WithAPIKeys(keys),
+		)
+		return server, keys, accountStore
+	}
+
+	do := func(server *Server, method, path, key, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			request.Header.Set(APIKeyHeader, key)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	createKey := func(t *testing.T, server *Server, role string) string {
+		t.Helper()
+		response := do(server, http.MethodPost, "/admin/keys", "key_admin.admin-secret", `{"name":"backoffice","role":"`+role+`"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+
+		var got APIKeyResponse
+		json.NewDecoder(response.Body).Decode(&got)
+		app.AssertString(t, got.Role, role)
+		app.AssertString(t, response.Header().Get("Location"), "/admin/keys/"+got.ID)
+		return got.ID + "." + got.Secret
+	}
+
+	transfer := `{"account_origin_id":1,"account_destination_id":2,"amount":300}`
+
+	t.Run("should let read-only keys read but not write", func(t *testing.T) {
+		server, _, _ := newServer()
+		key := createKey(t, server, auth.RoleReadOnly)
+
+		response := do(server, http.MethodGet, "/accounts/1/balance", key, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+
+		response = do(server, http.MethodPost, "/transfers", key, transfer)
+		app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "insufficient_role",
+			Message: "API key role read-only cannot POST /transfers",
+		})
+	})
+
+	t.Run("should let operator keys move money from any account", func(t *testing.T) {
+		server, _, accountStore := newServer()
+		key := createKey(t, server, auth.RoleOperator)
+
+		response := do(server, http.MethodPost, "/transfers", key, transfer)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		balance, _ := accountStore.GetBalance(2)
+		app.AssertUint64(t, balance, 1300)
+	})
+
+	t.Run("should refuse methods a route does not list, whatever the role", func(t *testing.T) {
+		server, _, _ := newServer()
+
+		response := do(server, http.MethodDelete, "/accounts/1/balance", "key_admin.admin-secret", "")
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "insufficient_role",
+			Message: "API key role admin cannot DELETE /accounts/1/balance",
+		})
+	})
+
+	t.Run("should keep the admin endpoints to admin keys", func(t *testing.T) {
+		server, _, _ := newServer()
+		key := createKey(t, server, auth.RoleOperator)
+
+		response := do(server, http.MethodGet, "/admin/keys", key, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+
+		response = do(server, http.MethodGet, "/admin/keys", "", "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "api_key_required",
+			Message: "/admin/keys requires an admin API key",
+		})
+	})
+
+	t.Run("should rotate and revoke keys", func(t *testing.T) {
+		server, _, _ := newServer()
+		key := createKey(t, server, auth.RoleReadOnly)
+		ID := strings.Split(key, ".")[0]
+
+		response := do(server, http.MethodPost, "/admin/keys/"+ID+"/rotate", "key_admin.admin-secret", "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		var rotated APIKeyResponse
+		json.NewDecoder(response.Body).Decode(&rotated)
+
+		response = do(server, http.MethodGet, "/accounts", key, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+		response = do(server, http.MethodGet, "/accounts", ID+"."+rotated.Secret, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+
+		response = do(server, http.MethodDelete, "/admin/keys/"+ID, "key_admin.admin-secret", "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		if strings.Contains(response.Body.String(), "secret") {
+			t.Errorf("revoked key response has a secret: %s", response.Body)
+		}
+
+		response = do(server, http.MethodGet, "/accounts", ID+"."+rotated.Secret, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_api_key",
+			Message: auth.ErrInvalidAPIKey.Error(),
+		})
+	})
+
+	t.Run("should accept signed requests only once", func(t *testing.T) {
+		server, keys, _ := newServer()
+		keys.Import(auth.APIKey{ID: "key_partner", Role: auth.RoleOperator}, "partner-secret")
+
+		signed := auth.SignedRequest{
+			KeyID:     "key_partner",
+			Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+			Nonce:     "6f1c2a",
+			Method:    http.MethodPost,
+			URI:       "/transfers",
+			Body:      []byte(transfer),
+		}
+		send := func() *httptest.ResponseRecorder {
+			request, _ := http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(transfer))
+			request.Header.Set(APIKeyHeader, signed.KeyID)
+			request.Header.Set(TimestampHeader, signed.Timestamp)
+			request.Header.Set(NonceHeader, signed.Nonce)
+			request.Header.Set(SignatureHeader, auth.Sign(signed, "partner-secret"))
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			return response
+		}
+
+		response := send()
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+
+		response = send()
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "replayed_request",
+			Message: auth.ErrReplayedRequest.Error(),
+		})
+	})
+}
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+type AuditVerificationResponse struct {
+	Valid   bool   `json:"valid"`
+	Entries int    `json:"entries"`
+	Head    string `json:"head,omitempty"`  // Hash of the last entry
+	Error   string `json:"error,omitempty"` // Why the log is not valid
+}
+
+// statusRecorder keeps the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush sends what the handler wrote so far, for handlers that stream.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// auditMiddleware records every state-changing API call on the audit log,
+// along with its request payload and response status. It runs before the
+// credentials are checked, so that refused calls are recorded too, and
+// learns who made the call from the middleware that checks them.
+func (s *Server) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !changesState(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if !unrecordedBodies[r.URL.Path] {
+			body, _ = peekBody(r)
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		s.auditLog.RecordRequest(
+			actor(r),
+			r.RemoteAddr,
+			fmt.Sprintf("%s %s", r.Method, r.URL.Path),
+			requestPayload(body),
+			fmt.Sprintf("%d %s", recorder.status, http.StatusText(recorder.status)),
+		)
+	})
+}
+
+// auditHandler returns all audit log entries.
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	jsonBytes, err := json.Marshal(s.auditLog.Entries())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling audit log: %v", err))
+		return
+	}
+
+	w.Header().Set("content-type", JsonContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonBytes)
+}
+
+// auditVerifyHandler checks the hash chain of the audit log and responds
+// with 409 Conflict if any entry was edited or deleted.
+func (s *Server) auditVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	entries, head, err := s.auditLog.Check()
+	response := AuditVerificationResponse{Valid: err == nil, Entries: entries, Head: head}
+	status := http.StatusOK
+	if err != nil {
+		logging.FromContext(r.Context()).Error("audit log verification failed", "error", err)
+		response.Error = err.Error()
+		status = http.StatusConflict
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling audit log verification: %v", err))
+		return
+	}
+
+	w.Header().Set("content-type", JsonContentType)
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
+
+// readCloser reads a body of which a part has already been read, closing
+// the original one.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// peekBody reads the body of r and puts it back for the handler. Bodies
+// over MaxBodySize are left for the handler to refuse, so only as much as
+// it would accept is returned.
+func peekBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	return body, err
+}
+
+// anonymousActor is the actor of the API calls made without credentials, or
+// with credentials that were refused.
+const anonymousActor = "anonymous"
+
+// actor identifies who made a request: the API key, as key:<id>, or the
+// customer, as customer:<cpf>, noted with noteActor.
+func actor(r *http.Request) string {
+	entry, ok := r.Context().Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return anonymousActor
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.actor == "" {
+		return anonymousActor
+	}
+	return entry.actor
+}
+
+// redactedFields are the request fields never written to the audit log.
+var redactedFields = []string{"password"}
+
+// unrecordedBodies are the paths whose request bodies are never written to
+// the audit log: imports hold every password hash and TOTP secret, and
+// CNAB 240 remessas are recorded payment by payment as the transfers they
+// make.
+var unrecordedBodies = map[string]bool{"/admin/import": true, "/batches/cnab240": true}
+
+// requestPayload returns body as it should be recorded: JSON bodies as they
+// are, without secrets, and anything else as a string.
+func requestPayload(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	if !json.Valid(body) {
+		return string(body)
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+	redacted := false
+	for _, field := range redactedFields {
+		if _, ok := fields[field]; ok {
+			fields[field] = json.RawMessage(`"[redacted]"`)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return body
+	}
+	return fields
+}
+
+func changesState(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/audit"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	newServer := func() (*Server, *audit.Log) {
+		auditLog := audit.NewLog()
+		accountStore := store.NewAccountStore(app.StartingID(0))
+		accountStore.SetAuditor(auditLog)
+		return NewServer(accountStore, nil, WithAuditLog(auditLog)), auditLog
+	}
+
+	t.Run("should record state-changing calls and the store mutations they cause", func(t *testing.T) {
+		server, auditLog := newServer()
+
+		request, _ := http.NewRequest(http.MethodPost, "/accounts", bytes.NewBufferString(`{"name":"Kevin Malone","cpf":"66648111038","balance":2000}`))
+		request.RemoteAddr = "10.0.0.7:51000"
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		request, _ = http.NewRequest(http.MethodGet, "/accounts", nil)
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		entries := auditLog.Entries()
+		if len(entries) != 2 {
+			t.Fatalf("got %d audit entries; want 2", len(entries))
+		}
+		app.AssertString(t, entries[0].Action, "account.open")
+		app.AssertString(t, entries[1].Action, "POST /accounts")
+		app.AssertString(t, entries[1].Actor, "anonymous")
+		app.AssertString(t, entries[1].RemoteAddr, "10.0.0.7:51000")
+		app.AssertString(t, entries[1].Outcome, "201 Created")
+		app.AssertString(t, string(entries[1].Payload), `{"name":"Kevin Malone","cpf":"66648111038","balance":2000}`)
+	})
+
+	t.Run("should record the API key or customer that made the call", func(t *testing.T) {
+		auditLog := audit.NewLog()
+		accountStore := store.NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 1000},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077"},
+		)
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_operator", Role: auth.RoleOperator}, "segredo")
+		issuer := auth.NewIssuer([]byte("chave-de-teste"), time.Hour)
+		server := NewServer(accountStore, store.NewTransferStore(app.StartingID(0)), WithAuditLog(auditLog), WithAuth(issuer), WithAPIKeys(keys))
+		token, _, _ := issuer.Issue("48226581020")
+		transfer := `{"account_origin_id":1,"account_destination_id":2,"amount":100}`
+
+		request, _ := http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(transfer))
+		request.Header.Set(APIKeyHeader, "key_operator.segredo")
+		server.ServeHTTP(httptest.NewRecorder(), request)
+		request, _ = http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(transfer))
+		request.Header.Set("Authorization", "Bearer "+token)
+		server.ServeHTTP(httptest.NewRecorder(), request)
+		request, _ = http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(transfer))
+		request.Header.Set(APIKeyHeader, "key_operator.errado")
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		var actors []string
+		for _, entry := range auditLog.Entries() {
+			if entry.Action == "POST /transfers" {
+				actors = append(actors, entry.Actor)
+			}
+		}
+		want := []string{"key:key_operator", "customer:48226581020", "anonymous"}
+		if !reflect.DeepEqual(actors, want) {
+			t.Errorf("got actors %v; want %v", actors, want)
+		}
+	})
+
+	t.Run("should not record passwords", func(t *testing.T) {
+		server, auditLog := newServer()
+
+		request, _ := http.NewRequest(http.MethodPost, "/accounts", bytes.NewBufferString(`{"name":"Kevin Malone","cpf":"66648111038","password":"123456"}`))
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		entries := auditLog.Entries()
+		last := entries[len(entries)-1]
+		app.AssertString(t, string(last.Payload), `{"cpf":"66648111038","name":"Kevin Malone","password":"[redacted]"}`)
+	})
+
+	t.Run("should report a valid log on GET /audit/verify", func(t *testing.T) {
+		server, auditLog := newServer()
+		auditLog.Append("test", "something", nil, "ok")
+
+		request, _ := http.NewRequest(http.MethodGet, "/audit/verify", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		var got AuditVerificationResponse
+		json.NewDecoder(response.Body).Decode(&got)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		app.AssertString(t, got.Head, auditLog.Head())
+		if !got.Valid || got.Entries != 1 {
+			t.Errorf("got %+v; want a valid log with 1 entry", got)
+		}
+	})
+}
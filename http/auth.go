@@ -0,0 +1,238 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MinPasswordLength is the shortest password, or PIN, a customer may set.
+const MinPasswordLength = 6
+
+var (
+	ErrInvalidPassword     = fmt.Errorf("invalid password: it must have at least %d characters", MinPasswordLength)
+	ErrInvalidCredentials  = errors.New("invalid credentials: cpf or password is wrong")
+	ErrUnauthenticated     = errors.New("authentication required")
+	ErrAccountNotOwned     = errors.New("account does not belong to the authenticated customer")
+	ErrMalformedAuthHeader = errors.New("authorization header must be Bearer <token>")
+	ErrPasswordNotSet      = errors.New("the cpf has accounts without a password, which only an operator can set")
+)
+
+type LoginRequest struct {
+	CPF      string `json:"cpf"`
+	Password string `json:"password"`
+}
+
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"` // Always Bearer
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WithAuth requires customers to log in with their CPF and password to
+// move money, using tokens signed by issuer. Accounts must then be opened
+// with a password.
+func WithAuth(issuer *auth.Issuer) Option {
+	return func(s *Server) {
+		s.tokens = issuer
+		// Logins for unknown CPFs are checked against this hash, so that
+		// they take as long as the ones for existing customers.
+		s.decoySecret, _ = auth.HashPassword("")
+	}
+}
+
+// login checks the CPF and password given by a customer, based on a
+// LoginRequest generated by method POST on /login endpoint, and responds
+// with a token for the customer.
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	loginRequest := LoginRequest{}
+
+	if !decodeBody(w, r, &loginRequest) {
+		return
+	}
+
+	secret, known := s.customerSecret(loginRequest.CPF), true
+	if secret == "" {
+		secret, known = s.decoySecret, false
+	}
+	ok, err := auth.CheckPassword(loginRequest.Password, secret)
+	if err != nil || !ok || !known {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="bank"`)
+		writeError(w, r, http.StatusUnauthorized, ErrInvalidCredentials, "", ErrInvalidCredentials.Error())
+		return
+	}
+
+	token, expiresAt, err := s.tokens.Issue(loginRequest.CPF)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error issuing token: %v", err))
+		return
+	}
+	jsonBytes, err := json.Marshal(LoginResponse{Token: token, TokenType: "Bearer", ExpiresAt: expiresAt.UTC()})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling token: %v", err))
+		return
+	}
+	w.Header().Set("content-type", JsonContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonBytes)
+}
+
+// authMiddleware verifies the bearer token of a request, if any, and adds
+// its claims to the request context. Requests that read accounts, transfers
+// or keys, or that change the state of the bank, are refused without a valid
+// token, except for opening an account and logging in. Requests made with an
+// API key or the metrics token are left alone.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := auth.KeyFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == "/metrics" && s.hasMetricsToken(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			if requiresAuth(r) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="bank"`)
+				writeError(w, r, http.StatusUnauthorized, ErrUnauthenticated, "", fmt.Sprintf("%s %s requires a bearer token", r.Method, r.URL.Path))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == header {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bank", error="invalid_request"`)
+			writeError(w, r, http.StatusUnauthorized, ErrMalformedAuthHeader, "", ErrMalformedAuthHeader.Error())
+			return
+		}
+		claims, err := s.tokens.Verify(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bank", error="invalid_token"`)
+			writeError(w, r, http.StatusUnauthorized, err, "", err.Error())
+			return
+		}
+		noteActor(r, "customer:"+claims.Subject)
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), claims)))
+	})
+}
+
+// checkOwner responds with an error and returns false if auth is enabled
+// and account does not belong to the customer who made the request. API keys
+// may act on any account their role allows.
+func (s *Server) checkOwner(w http.ResponseWriter, r *http.Request, account app.Account, field string) bool {
+	if s.tokens == nil {
+		return true
+	}
+	if _, ok := auth.KeyFromContext(r.Context()); ok {
+		return true
+	}
+	claims, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, ErrUnauthenticated, "", fmt.Sprintf("%s %s requires a bearer token", r.Method, r.URL.Path))
+		return false
+	}
+	if account.CPF != claims.Subject {
+		writeError(w, r, http.StatusForbidden, ErrAccountNotOwned, field, fmt.Sprintf("account %d does not belong to the authenticated customer", account.ID))
+		return false
+	}
+	return true
+}
+
+// ownedAccounts returns the accounts of the customer who made the request,
+// and whether what the request reads must be limited to them. Requests made
+// with an API key, or to a server without auth, may read every account.
+func (s *Server) ownedAccounts(r *http.Request) (map[uint64]bool, bool) {
+	if s.tokens == nil {
+		return nil, false
+	}
+	if _, ok := auth.KeyFromContext(r.Context()); ok {
+		return nil, false
+	}
+	owned := make(map[uint64]bool)
+	if claims, ok := auth.FromContext(r.Context()); ok {
+		for _, account := range s.accountStore.ListAccountsByCPF(claims.Subject) {
+			owned[account.ID] = true
+		}
+	}
+	return owned, true
+}
+
+// secretFor returns the password hash to store for a new account of CPF.
+// Customers opening another account must use the password they already
+// have. If the CPF has accounts but no password, as accounts opened before
+// auth or imported may not, whoever sets one gets hold of them, so only
+// requests made with an API key may.
+func (s *Server) secretFor(r *http.Request, CPF, password string) (string, error) {
+	secret := s.customerSecret(CPF)
+	if secret == "" {
+		_, operator := auth.KeyFromContext(r.Context())
+		if !operator && len(s.accountStore.ListAccountsByCPF(CPF)) > 0 {
+			return "", ErrPasswordNotSet
+		}
+		return auth.HashPassword(password)
+	}
+	ok, err := auth.CheckPassword(password, secret)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrInvalidCredentials
+	}
+	return secret, nil
+}
+
+// customerSecret returns the password hash of the customer with CPF, or an
+// empty string if the customer has never set a password.
+func (s *Server) customerSecret(CPF string) string {
+	for _, account := range s.accountStore.ListAccountsByCPF(CPF) {
+		if account.Secret != "" {
+			return account.Secret
+		}
+	}
+	return ""
+}
+
+func checkPassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+func requiresAuth(r *http.Request) bool {
+	if !changesState(r.Method) {
+		return readsCustomerData(r.URL.Path)
+	}
+	switch r.URL.Path {
+	case "/accounts", "/login":
+		return false
+	}
+	return true
+}
+
+// readsCustomerData tells whether a read of path may reveal accounts,
+// transfers or keys of customers.
+func readsCustomerData(path string) bool {
+	for _, prefix := range []string{"/accounts", "/transfers", "/keys/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuth(t *testing.T) {
+	newServer := func() (*Server, *store.AccountStore) {
+		accountStore := store.NewAccountStore(app.StartingID(0))
+		transferStore := store.NewTransferStore(app.StartingID(0))
+		server := NewServer(accountStore, transferStore, WithAuth(auth.NewIssuer([]byte("chave-de-teste"), time.Hour)))
+		return server, accountStore
+	}
+
+	do := func(server *Server, method, path, token, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	login := func(t *testing.T, server *Server, cpf, password string) string {
+		t.Helper()
+		response := do(server, http.MethodPost, "/login", "", `{"cpf":"`+cpf+`","password":"`+password+`"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+
+		var got LoginResponse
+		json.NewDecoder(response.Body).Decode(&got)
+		app.AssertString(t, got.TokenType, "Bearer")
+		return got.Token
+	}
+
+	// Both customers start with 1000 cents in account 1 and 2.
+	setUp := func(t *testing.T) (*Server, *store.AccountStore) {
+		t.Helper()
+		server, accountStore := newServer()
+		for _, body := range []string{
+			`{"name":"Roberta Pinheiro Sá","cpf":"48226581020","balance":1000,"password":"123456"}`,
+			`{"name":"Caio Barros Antunes","cpf":"71530184077","balance":1000,"password":"654321"}`,
+		} {
+			response := do(server, http.MethodPost, "/accounts", "", body)
+			app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		}
+		return server, accountStore
+	}
+
+	t.Run("should store a hash of the password and never send it", func(t *testing.T) {
+		server, accountStore := setUp(t)
+
+		account, _ := accountStore.GetAccount(1)
+		ok, err := auth.CheckPassword("123456", account.Secret)
+		if err != nil || !ok {
+			t.Errorf("stored secret %q does not match the password. error: %v", account.Secret, err)
+		}
+
+		response := do(server, http.MethodGet, "/accounts", login(t, server, "48226581020", "123456"), "")
+		if bytes.Contains(response.Body.Bytes(), []byte(account.Secret)) {
+			t.Errorf("account list exposes the password hash: %s", response.Body)
+		}
+	})
+
+	t.Run("should allow transfers from accounts the customer owns", func(t *testing.T) {
+		server, accountStore := setUp(t)
+		token := login(t, server, "48226581020", "123456")
+
+		response := do(server, http.MethodPost, "/transfers", token, `{"account_origin_id":1,"account_destination_id":2,"amount":300}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		balance, _ := accountStore.GetBalance(2)
+		app.AssertUint64(t, balance, 1300)
+	})
+
+	t.Run("should refuse transfers from someone else's account", func(t *testing.T) {
+		server, accountStore := setUp(t)
+		token := login(t, server, "71530184077", "654321")
+
+		response := do(server, http.MethodPost, "/transfers", token, `{"account_origin_id":1,"account_destination_id":2,"amount":300}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "account_not_owned",
+			Message: "account 1 does not belong to the authenticated customer",
+			Field:   "account_origin_id",
+		})
+		balance, _ := accountStore.GetBalance(1)
+		app.AssertUint64(t, balance, 1000)
+	})
+
+	t.Run("should refuse split transfers from someone else's account", func(t *testing.T) {
+		server, _ := setUp(t)
+		token := login(t, server, "71530184077", "654321")
+
+		response := do(server, http.MethodPost, "/transfers/split", token, `{"account_origin_id":1,"amount":300,"shares":[{"account_destination_id":2,"amount":300}]}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+	})
+
+	t.Run("should require a token to move money", func(t *testing.T) {
+		server, _ := setUp(t)
+
+		response := do(server, http.MethodPost, "/transfers", "", `{"account_origin_id":1,"account_destination_id":2,"amount":300}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+		app.AssertString(t, response.Header().Get("WWW-Authenticate"), `Bearer realm="bank"`)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "unauthenticated",
+			Message: "POST /transfers requires a bearer token",
+		})
+	})
+
+	t.Run("should require a token to read accounts and transfers", func(t *testing.T) {
+		server, _ := setUp(t)
+
+		for _, path := range []string{"/accounts", "/accounts/1/balance", "/transfers", "/transfers/1"} {
+			response := do(server, http.MethodGet, path, "", "")
+
+			app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+			assertErrorResponse(t, response, ErrorResponse{
+				Code:    "unauthenticated",
+				Message: "GET " + path + " requires a bearer token",
+			})
+		}
+	})
+
+	t.Run("should only show customers their own accounts and transfers", func(t *testing.T) {
+		server, _ := setUp(t)
+		do(server, http.MethodPost, "/accounts", "", `{"name":"Ana Lima","cpf":"39053344705","balance":1000,"password":"abcdef"}`)
+		token := login(t, server, "48226581020", "123456")
+		do(server, http.MethodPost, "/transfers", token, `{"account_origin_id":1,"account_destination_id":2,"amount":300}`)
+		do(server, http.MethodPost, "/transfers", login(t, server, "71530184077", "654321"), `{"account_origin_id":2,"account_destination_id":3,"amount":100}`)
+
+		var accounts []app.Account
+		json.NewDecoder(do(server, http.MethodGet, "/accounts", token, "").Body).Decode(&accounts)
+		if len(accounts) != 1 || accounts[0].ID != 1 {
+			t.Errorf("got accounts %+v; want only account 1", accounts)
+		}
+		var transfers []app.Transfer
+		json.NewDecoder(do(server, http.MethodGet, "/transfers", token, "").Body).Decode(&transfers)
+		if len(transfers) != 1 || transfers[0].ID != 1 {
+			t.Errorf("got transfers %+v; want only transfer 1", transfers)
+		}
+
+		app.AssertHTTPStatus(t, do(server, http.MethodGet, "/accounts/1/balance", token, "").Code, http.StatusOK)
+		app.AssertHTTPStatus(t, do(server, http.MethodGet, "/transfers/1", token, "").Code, http.StatusOK)
+		response := do(server, http.MethodGet, "/accounts/2/balance", token, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "account_not_owned",
+			Field:   "account_id",
+			Message: "account 2 does not belong to the authenticated customer",
+		})
+		response = do(server, http.MethodGet, "/transfers/2", token, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "account_not_owned",
+			Field:   "transfer_id",
+			Message: "transfer 2 is not to or from an account of the authenticated customer",
+		})
+	})
+
+	t.Run("should refuse tokens it did not sign", func(t *testing.T) {
+		server, _ := setUp(t)
+		forged, _, _ := auth.NewIssuer([]byte("outra-chave"), time.Hour).Issue("48226581020")
+
+		response := do(server, http.MethodPost, "/transfers", forged, `{"account_origin_id":1,"account_destination_id":2,"amount":300}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_token",
+			Message: auth.ErrInvalidToken.Error(),
+		})
+	})
+
+	t.Run("should refuse logins with the wrong password or an unknown cpf", func(t *testing.T) {
+		server, _ := setUp(t)
+
+		for _, body := range []string{
+			`{"cpf":"48226581020","password":"654321"}`,
+			`{"cpf":"38145671004","password":"123456"}`,
+			`{"cpf":"38145671004","password":""}`,
+		} {
+			response := do(server, http.MethodPost, "/login", "", body)
+
+			app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+			assertErrorResponse(t, response, ErrorResponse{
+				Code:    "invalid_credentials",
+				Message: ErrInvalidCredentials.Error(),
+			})
+		}
+	})
+
+	t.Run("should require a password to open an account", func(t *testing.T) {
+		server, _ := newServer()
+
+		response := do(server, http.MethodPost, "/accounts", "", `{"name":"Ana Lima","cpf":"38145671004"}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_password",
+			Message: ErrInvalidPassword.Error(),
+			Field:   "password",
+		})
+	})
+
+	t.Run("should keep the customer password for new accounts", func(t *testing.T) {
+		server, _ := setUp(t)
+
+		response := do(server, http.MethodPost, "/accounts", "", `{"name":"Roberta Pinheiro Sá","cpf":"48226581020","password":"000000","type":"savings"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+
+		response = do(server, http.MethodPost, "/accounts", "", `{"name":"Roberta Pinheiro Sá","cpf":"48226581020","password":"123456","type":"savings"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+
+		token := login(t, server, "48226581020", "123456")
+		response = do(server, http.MethodPost, "/transfers", token, `{"account_origin_id":3,"account_destination_id":1,"amount":0}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("should let only operators set the password of accounts that have none", func(t *testing.T) {
+		accountStore := store.NewAccountStore(app.StartingID(1),
+			app.Account{ID: 1, Name: "Ana Lima", CPF: "38145671004", Balance: 5000},
+		)
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_operator", Role: auth.RoleOperator}, "segredo")
+		server := NewServer(accountStore, store.NewTransferStore(app.StartingID(0)), WithAuth(auth.NewIssuer([]byte("chave-de-teste"), time.Hour)), WithAPIKeys(keys))
+		open := `{"name":"Ana Lima","cpf":"38145671004","password":"123456"}`
+
+		response := do(server, http.MethodPost, "/accounts", "", open)
+		app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "password_not_set",
+			Message: ErrPasswordNotSet.Error(),
+			Field:   "password",
+		})
+		response = do(server, http.MethodPost, "/login", "", `{"cpf":"38145671004","password":"123456"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+
+		request, _ := http.NewRequest(http.MethodPost, "/accounts", strings.NewReader(open))
+		request.Header.Set(APIKeyHeader, "key_operator.segredo")
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		token := login(t, server, "38145671004", "123456")
+		response = do(server, http.MethodPost, "/transfers", token, `{"account_origin_id":1,"account_destination_id":2,"amount":100}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+	})
+}
@@ -0,0 +1,233 @@
+package http
+
+import (
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/brcode"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"sync"
+)
+
+// DefaultChargeCity is the merchant city written in BR Codes whose request
+// has none.
+const DefaultChargeCity = "SAO PAULO"
+
+// CreateChargeRequest asks for a BR Code paying an account through one of
+// its addressing keys. Static charges may be paid any number of times, with
+// Amount or, without one, with the amount the payer chooses; dynamic ones
+// are paid once, with Amount.
+type CreateChargeRequest struct {
+	Key         string `json:"key"`
+	Amount      uint64 `json:"amount,omitempty"` // Amount in cents; required for dynamic charges
+	Description string `json:"description,omitempty"`
+	City        string `json:"city,omitempty"` // Merchant city; defaults to DefaultChargeCity
+	Dynamic     bool   `json:"dynamic,omitempty"`
+}
+
+// ChargeResponse is a charge along with its BR Code.
+type ChargeResponse struct {
+	Payload     string `json:"payload"` // BR Code, to be shown as a QR code or copied and pasted
+	Dynamic     bool   `json:"dynamic"`
+	TxID        string `json:"txid,omitempty"` // Only sent for dynamic charges
+	Key         string `json:"key"`
+	Amount      uint64 `json:"amount,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// PayBRCodeRequest pays the charge of a BR Code from an account. Amount is
+// only needed when the BR Code has none.
+type PayBRCodeRequest struct {
+	AccountOriginID uint64 `json:"account_origin_id"`
+	Payload         string `json:"payload"`
+	Amount          uint64 `json:"amount,omitempty"`
+}
+
+// chargesHandler lists the dynamic charges of an account on GET and issues
+// a charge on POST /accounts/{account_id}/charges.
+func (s *Server) chargesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+		return
+	}
+	account, ok := s.pathAccount(w, r)
+	if !ok || !s.checkOwner(w, r, account, "account_id") {
+		return
+	}
+	if r.Method == http.MethodGet {
+		charges := account.Charges
+		if charges == nil {
+			charges = []app.Charge{}
+		}
+		writeJSON(w, r, http.StatusOK, charges)
+		return
+	}
+
+	request := CreateChargeRequest{}
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	if request.City == "" {
+		request.City = DefaultChargeCity
+	}
+	holder, key, err := s.accountStore.FindKey(request.Key)
+	if err == nil && holder.ID != account.ID {
+		err = store.ErrKeyNotFound
+	}
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "key", fmt.Sprintf("error issuing charge for account %d: %s", account.ID, err))
+		return
+	}
+	payload := brcode.Payload{Key: key.Key, Description: request.Description, Amount: request.Amount, MerchantName: brcode.MerchantName(account.Name), MerchantCity: request.City}
+	if _, err := brcode.Encode(payload); err != nil {
+		writeError(w, r, errorStatus(err), err, "", err.Error())
+		return
+	}
+
+	if request.Dynamic {
+		charge, err := s.accountStore.CreateCharge(r.Context(), account.ID, key.Key, request.Amount, request.Description)
+		if err != nil {
+			writeError(w, r, errorStatus(err), err, "amount", fmt.Sprintf("error issuing charge for account %d: %s", account.ID, err))
+			return
+		}
+		payload.Dynamic, payload.TxID = true, charge.TxID
+	}
+	encoded, err := brcode.Encode(payload)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, ChargeResponse{
+		Payload:     encoded,
+		Dynamic:     payload.Dynamic,
+		TxID:        payload.TxID,
+		Key:         payload.Key,
+		Amount:      payload.Amount,
+		Description: payload.Description,
+	})
+}
+
+// payBRCodeHandler pays a BR Code on POST /transfers/brcode, with a
+// transfer to the account of its key. Dynamic charges must have been issued
+// by that account, for the amount in the BR Code, and are only paid once.
+func (s *Server) payBRCodeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	request := PayBRCodeRequest{}
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	payload, err := brcode.Parse(request.Payload)
+	if err == nil && payload.Dynamic && payload.TxID == "" {
+		err = fmt.Errorf("%w: dynamic BR Codes must have a txid", brcode.ErrInvalidPayload)
+	}
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "payload", err.Error())
+		return
+	}
+	amount := payload.Amount
+	switch {
+	case amount == 0 && request.Amount == 0:
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "amount", "amount is required, as the BR Code has none")
+		return
+	case amount == 0:
+		amount = request.Amount
+	case request.Amount != 0 && request.Amount != amount:
+		writeError(w, r, http.StatusUnprocessableEntity, store.ErrInvalidAmount, "amount", fmt.Sprintf("the amount must be the one of the BR Code, %d", amount))
+		return
+	}
+	destination, key, err := s.accountStore.FindKey(payload.Key)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "payload", err.Error())
+		return
+	}
+	transfer := CreateTransferRequest{AccountOriginID: request.AccountOriginID, AccountDestinationID: destination.ID, Amount: amount}
+	if !payload.Dynamic {
+		s.sendTransfer(w, r, transfer)
+		return
+	}
+
+	unlock := s.charges.lock(fmt.Sprintf("%d/%s", destination.ID, payload.TxID))
+	defer unlock()
+	charge, err := s.accountStore.GetCharge(destination.ID, payload.TxID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "payload", err.Error())
+		return
+	}
+	if charge.Amount != amount || charge.Key != key.Key {
+		err = fmt.Errorf("%w: it differs from the charge it was issued for", brcode.ErrInvalidPayload)
+		writeError(w, r, errorStatus(err), err, "payload", err.Error())
+		return
+	}
+	if s.chargePaid(charge) {
+		writeError(w, r, http.StatusConflict, store.ErrChargePaid, "payload", fmt.Sprintf("charge %s has already been paid by transfer %d", charge.TxID, charge.TransferID))
+		return
+	}
+	transferID := s.sendTransfer(w, r, transfer)
+	if transferID == 0 {
+		return
+	}
+	err = s.accountStore.SetChargeTransfer(r.Context(), destination.ID, charge.TxID, transferID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("error recording charge payment", "txid", charge.TxID, "transfer_id", transferID, "error", err)
+	}
+}
+
+// chargePaid tells whether the last transfer made to pay a charge was
+// confirmed or may still be.
+func (s *Server) chargePaid(charge app.Charge) bool {
+	if charge.TransferID == 0 {
+		return false
+	}
+	transfer, err := s.transferStore.GetTransfer(charge.TransferID)
+	if err != nil {
+		return false
+	}
+	switch transfer.Status {
+	case store.ToStatusMsg(store.StatusNotAuthorized), store.ToStatusMsg(store.StatusCancelled), store.ToStatusMsg(store.StatusExpired):
+		return false
+	}
+	return true
+}
+
+// chargeLocks hands out a lock for each dynamic charge, so that paying one
+// does not hold up payments of the others. The zero value is ready to use.
+type chargeLocks struct {
+	mu    sync.Mutex
+	locks map[string]*chargeLock // The map key is the account ID and the txid
+}
+
+type chargeLock struct {
+	sync.Mutex
+	waiting int // Payments holding or waiting for the lock
+}
+
+// lock locks the charge with the given key and returns the function that
+// unlocks it. Locks are dropped once no payment is waiting for them.
+func (c *chargeLocks) lock(key string) func() {
+	c.mu.Lock()
+	if c.locks == nil {
+		c.locks = make(map[string]*chargeLock)
+	}
+	l, ok := c.locks[key]
+	if !ok {
+		l = &chargeLock{}
+		c.locks[key] = l
+	}
+	l.waiting++
+	c.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		c.mu.Lock()
+		l.waiting--
+		if l.waiting == 0 {
+			delete(c.locks, key)
+		}
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,181 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/brcode"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBRCode(t *testing.T) {
+	newServer := func() (*Server, *store.AccountStore) {
+		accountStore := store.NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 5000},
+			app.Account{ID: 2, Name: "Papelaria Dunder Mifflin", CPF: "71530184077", Type: store.AccountTypeBusiness},
+		)
+		server := NewServer(accountStore, store.NewTransferStore(app.StartingID(0)))
+		accountStore.RegisterKey(context.Background(), 2, store.KeyTypeEmail, "vendas@dunder.com")
+		return server, accountStore
+	}
+	send := func(server *Server, method, path, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+	charge := func(t *testing.T, server *Server, body string) ChargeResponse {
+		t.Helper()
+		response := send(server, http.MethodPost, "/accounts/2/charges", body)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		var charge ChargeResponse
+		json.NewDecoder(response.Body).Decode(&charge)
+		return charge
+	}
+	pay := func(server *Server, payload string, amount uint64) *httptest.ResponseRecorder {
+		return send(server, http.MethodPost, "/transfers/brcode", fmt.Sprintf(`{"account_origin_id":1,"payload":%q,"amount":%d}`, payload, amount))
+	}
+
+	t.Run("should issue static charges to a key of the account", func(t *testing.T) {
+		server, _ := newServer()
+
+		got := charge(t, server, `{"key":"Vendas@Dunder.com","amount":1050,"description":"Pedido 42"}`)
+
+		payload, err := brcode.Parse(got.Payload)
+		app.AssertError(t, err, nil)
+		want := brcode.Payload{Key: "vendas@dunder.com", Description: "Pedido 42", Amount: 1050, MerchantName: "Papelaria Dunder Mifflin", MerchantCity: DefaultChargeCity}
+		if payload != want {
+			t.Errorf("got %+v; want %+v", payload, want)
+		}
+		app.AssertString(t, got.TxID, "")
+	})
+
+	t.Run("should cut account names that do not fit the BR Code", func(t *testing.T) {
+		server, accountStore := newServer()
+		account, _ := accountStore.GetAccount(2)
+		account.Name = "Papelaria e Livraria São Dunder"
+		accountStore.SetAccount(context.Background(), account)
+
+		got := charge(t, server, `{"key":"vendas@dunder.com"}`)
+
+		payload, err := brcode.Parse(got.Payload)
+		app.AssertError(t, err, nil)
+		app.AssertString(t, payload.MerchantName, "Papelaria e Livraria Sao")
+	})
+
+	t.Run("should pay static charges as many times as asked", func(t *testing.T) {
+		server, accountStore := newServer()
+		withAmount := charge(t, server, `{"key":"vendas@dunder.com","amount":1050}`)
+		withoutAmount := charge(t, server, `{"key":"vendas@dunder.com"}`)
+
+		app.AssertHTTPStatus(t, pay(server, withAmount.Payload, 0).Code, http.StatusCreated)
+		app.AssertHTTPStatus(t, pay(server, withoutAmount.Payload, 700).Code, http.StatusCreated)
+		app.AssertHTTPStatus(t, pay(server, withoutAmount.Payload, 300).Code, http.StatusCreated)
+
+		merchant, _ := accountStore.GetAccount(2)
+		app.AssertUint64(t, merchant.Balance, 2050)
+		assertErrorCode(t, pay(server, withAmount.Payload, 1000), http.StatusUnprocessableEntity, "invalid_amount", "amount")
+		assertErrorCode(t, pay(server, withoutAmount.Payload, 0), http.StatusBadRequest, "invalid_request", "amount")
+	})
+
+	t.Run("should pay dynamic charges once", func(t *testing.T) {
+		server, accountStore := newServer()
+		dynamic := charge(t, server, `{"key":"vendas@dunder.com","amount":4000,"dynamic":true}`)
+		if len(dynamic.TxID) != 25 {
+			t.Fatalf("got txid %q; want one of 25 characters", dynamic.TxID)
+		}
+
+		response := pay(server, dynamic.Payload, 0)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		issued, _ := accountStore.GetCharge(2, dynamic.TxID)
+		app.AssertUint64(t, issued.TransferID, 1)
+		assertErrorCode(t, pay(server, dynamic.Payload, 0), http.StatusConflict, "charge_already_paid", "payload")
+		response = send(server, http.MethodGet, "/accounts/2/charges", "")
+		var charges []app.Charge
+		json.NewDecoder(response.Body).Decode(&charges)
+		if len(charges) != 1 || charges[0].TransferID != 1 {
+			t.Errorf("got charges %+v; want the one paid by transfer 1", charges)
+		}
+	})
+
+	t.Run("should let dynamic charges be paid again after a refused transfer", func(t *testing.T) {
+		server, accountStore := newServer()
+		dynamic := charge(t, server, `{"key":"vendas@dunder.com","amount":6000,"dynamic":true}`)
+
+		assertErrorCode(t, pay(server, dynamic.Payload, 0), http.StatusUnprocessableEntity, "insufficient_balance", "amount")
+		payer, _ := accountStore.GetAccount(1)
+		payer.Balance = 10000
+		accountStore.SetAccount(context.Background(), payer)
+
+		app.AssertHTTPStatus(t, pay(server, dynamic.Payload, 0).Code, http.StatusCreated)
+	})
+
+	t.Run("should refuse BR Codes that differ from the charge issued", func(t *testing.T) {
+		server, _ := newServer()
+		dynamic := charge(t, server, `{"key":"vendas@dunder.com","amount":4000,"dynamic":true}`)
+		payload, _ := brcode.Parse(dynamic.Payload)
+		payload.Amount = 1
+		cheaper, _ := brcode.Encode(payload)
+		payload.Amount, payload.TxID = 4000, "OUTRACOBRANCA"
+		unknown, _ := brcode.Encode(payload)
+
+		assertErrorCode(t, pay(server, cheaper, 0), http.StatusBadRequest, "invalid_brcode", "payload")
+		assertErrorCode(t, pay(server, unknown, 0), http.StatusNotFound, "charge_not_found", "payload")
+	})
+
+	t.Run("should refuse invalid requests", func(t *testing.T) {
+		server, _ := newServer()
+		send(server, http.MethodPost, "/accounts/1/keys", `{"type":"cpf","value":"48226581020"}`)
+		static := charge(t, server, `{"key":"vendas@dunder.com","amount":1050}`)
+		other, _ := brcode.Encode(brcode.Payload{Key: "caio@exemplo.com", MerchantName: "Caio", MerchantCity: "SAO PAULO"})
+
+		assertErrorCode(t, send(server, http.MethodPost, "/accounts/2/charges", `{"key":"48226581020"}`), http.StatusNotFound, "key_not_found", "key")
+		assertErrorCode(t, send(server, http.MethodPost, "/accounts/2/charges", `{"key":"vendas@dunder.com","dynamic":true}`), http.StatusUnprocessableEntity, "invalid_amount", "amount")
+		assertErrorCode(t, send(server, http.MethodPost, "/accounts/2/charges", `{"key":"vendas@dunder.com","city":"SAO JOSE DOS CAMPOS"}`), http.StatusBadRequest, "invalid_brcode", "")
+		assertErrorCode(t, pay(server, strings.Replace(static.Payload, "5802BR", "5802PT", 1), 0), http.StatusBadRequest, "invalid_brcode", "payload")
+		assertErrorCode(t, pay(server, other, 100), http.StatusNotFound, "key_not_found", "payload")
+	})
+}
+
+func TestChargeLocks(t *testing.T) {
+	var locks chargeLocks
+	unlock := locks.lock("2/PEDIDO42")
+
+	t.Run("should not hold up other charges", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			locks.lock("2/PEDIDO43")()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("the lock of another charge was held up")
+		}
+	})
+
+	t.Run("should hold up the same charge until it is unlocked", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			locks.lock("2/PEDIDO42")()
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("the charge was locked twice")
+		case <-time.After(50 * time.Millisecond):
+		}
+		unlock()
+		<-done
+		if len(locks.locks) != 0 {
+			t.Errorf("got %d locks left; want 0", len(locks.locks))
+		}
+	})
+}
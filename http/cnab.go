@@ -0,0 +1,174 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/cnab"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CNABContentType is the media type of CNAB 240 remessas and retornos,
+// which are plain text. Remessas may also be sent as
+// application/octet-stream.
+const CNABContentType = "text/plain"
+
+// cnabHandler pays the batches of a CNAB 240 remessa on POST
+// /batches/cnab240 and responds with the retorno, which tells how each
+// payment went. The remessa is claimed along with the transfers paying it,
+// so that each is paid once: another one from the same company with the
+// same sequence number is refused.
+func (s *Server) cnabHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	if contentType := r.Header.Get("content-type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != CNABContentType && mediaType != "application/octet-stream") {
+			writeError(w, r, http.StatusUnsupportedMediaType, ErrUnsupportedMedia, "", fmt.Sprintf("content type %q is not supported: it must be %s", contentType, CNABContentType))
+			return
+		}
+	}
+	if r.Body == nil {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "", "request body is empty")
+		return
+	}
+	tooLarge := fmt.Sprintf("request body must have at most %d bytes", MaxBodySize)
+	if r.ContentLength > MaxBodySize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, ErrBodyTooLarge, "", tooLarge)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "", fmt.Sprintf("error reading body: %v", err))
+		return
+	}
+	if len(body) > MaxBodySize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, ErrBodyTooLarge, "", tooLarge)
+		return
+	}
+
+	file, err := cnab.Parse(bytes.NewReader(body))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err, "", err.Error())
+		return
+	}
+	var payments []*cnab.Payment
+	var requests []store.RemessaPayment
+	for _, batch := range file.Batches {
+		noteAccounts(r, batch.Account)
+		for _, payment := range s.checkBatch(batch) {
+			payments = append(payments, payment)
+			requests = append(requests, store.RemessaPayment{AccountOriginID: batch.Account, AccountDestinationID: payment.Account, Amount: payment.Amount})
+		}
+	}
+	ids, err := s.transferStore.CreateRemessaTransfers(r.Context(), file.CompanyDocument, file.Sequence, requests)
+	if err == store.ErrRemessaProcessed {
+		writeError(w, r, http.StatusConflict, err, "", fmt.Sprintf("remessa %d of company %s was already processed", file.Sequence, file.CompanyDocument))
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error creating transfers: %v", err))
+		return
+	}
+	for i, payment := range payments {
+		s.payPayment(r.Context(), payment, requests[i].AccountOriginID, ids[i])
+	}
+	paid, total := file.Paid()
+	logging.FromContext(r.Context()).Info("cnab remessa paid", "sequence", file.Sequence, "payments", paid, "total", total)
+
+	w.Header().Set("content-type", CNABContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="retorno-%06d.ret"`, file.Sequence))
+	w.WriteHeader(http.StatusOK)
+	err = file.WriteReturn(w, time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("error writing cnab retorno", "error", err)
+	}
+}
+
+// checkBatch returns the payments of batch that were not refused, refusing
+// the ones that cannot be made. The batch is refused if its account does not
+// exist or belongs to someone other than the company in its header.
+// Payments dated after today are refused, as they are not scheduled, and so
+// are the ones to accounts that do not exist.
+func (s *Server) checkBatch(batch *cnab.Batch) []*cnab.Payment {
+	if batch.Refused() {
+		return nil
+	}
+	origin, err := s.accountStore.GetAccount(batch.Account)
+	if err != nil {
+		batch.Refuse(cnab.OccurrenceInvalidDebit)
+		return nil
+	}
+	if strings.TrimLeft(batch.CompanyDocument, "0") != strings.TrimLeft(origin.CPF, "0") {
+		batch.Refuse(cnab.OccurrenceInvalidCompany)
+		return nil
+	}
+
+	var payments []*cnab.Payment
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for _, payment := range batch.Payments {
+		if payment.Refused() {
+			continue
+		}
+		if payment.Date.After(today) {
+			payment.Refuse(cnab.OccurrenceInvalidDate)
+			continue
+		}
+		if _, err := s.accountStore.GetAccount(payment.Account); err != nil {
+			payment.Refuse(cnab.OccurrenceInvalidAccount)
+			continue
+		}
+		payments = append(payments, payment)
+	}
+	return payments
+}
+
+// payPayment authorizes and completes the transfer created for payment,
+// from the account with ID originID, and records how it went.
+func (s *Server) payPayment(ctx context.Context, payment *cnab.Payment, originID, transferID uint64) {
+	payment.TransferID = transferID
+	// The balance of the origin changes with every payment.
+	origin, err := s.accountStore.GetAccount(originID)
+	if err != nil {
+		s.transferStore.Cancel(ctx, transferID)
+		payment.Refuse(cnab.OccurrenceRefused)
+		return
+	}
+	destination, err := s.accountStore.GetAccount(payment.Account)
+	if err != nil {
+		s.transferStore.Cancel(ctx, transferID)
+		payment.Refuse(cnab.OccurrenceInvalidAccount)
+		return
+	}
+
+	err = s.completeTransfer(ctx, &origin, &destination, payment.Amount, transferID)
+	if err != nil {
+		payment.Refuse(occurrenceFor(err))
+		return
+	}
+	payment.Pay(transferID, time.Now())
+}
+
+// occurrenceFor returns the CNAB occurrence code for the error a transfer
+// was refused with.
+func occurrenceFor(err error) string {
+	switch {
+	case errors.Is(err, store.ErrInsufficientBalance):
+		return cnab.OccurrenceInsufficientFunds
+	case errors.Is(err, store.ErrSameID):
+		return cnab.OccurrenceInvalidAccount
+	case errors.Is(err, store.ErrInvalidAmount):
+		return cnab.OccurrenceInvalidAmount
+	}
+	return cnab.OccurrenceRefused
+}
@@ -0,0 +1,199 @@
+package http
+
+import (
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cnabLine builds a 240-character CNAB line with the values given at
+// positions counted from 1, blank everywhere else.
+func cnabLine(fields map[int]string) string {
+	line := []byte(strings.Repeat(" ", 240))
+	positions := make([]int, 0, len(fields))
+	for position := range fields {
+		positions = append(positions, position)
+	}
+	sort.Ints(positions)
+	for _, position := range positions {
+		copy(line[position-1:], fields[position])
+	}
+	return string(line)
+}
+
+// cnabCredit is a payment of a remessa built by cnabRemessa.
+type cnabCredit struct {
+	account uint64
+	amount  uint64
+	date    time.Time
+}
+
+// cnabRemessa builds a remessa with one batch of the company with document
+// paying credits from account origin.
+func cnabRemessa(document string, origin uint64, credits ...cnabCredit) string {
+	lines := []string{
+		cnabLine(map[int]string{1: "341", 4: "0000", 8: "0", 18: "2", 19: fmt.Sprintf("%014s", document), 73: "PAPELARIA DUNDER MIFFLIN", 143: "1", 158: "000042"}),
+		cnabLine(map[int]string{1: "341", 4: "0001", 8: "1", 9: "C", 12: "01", 19: fmt.Sprintf("%014s", document), 59: fmt.Sprintf("%012d", origin)}),
+	}
+	var total uint64
+	for i, credit := range credits {
+		lines = append(lines, cnabLine(map[int]string{1: "341", 4: "0001", 8: "3", 9: fmt.Sprintf("%05d", i+1), 14: "A", 15: "0", 21: "341", 30: fmt.Sprintf("%012d", credit.account), 44: "FAVORECIDO", 94: credit.date.Format("02012006"), 102: "BRL", 120: fmt.Sprintf("%015d", credit.amount)}))
+		total += credit.amount
+	}
+	lines = append(lines,
+		cnabLine(map[int]string{1: "341", 4: "0001", 8: "5", 18: fmt.Sprintf("%06d", len(credits)+2), 24: fmt.Sprintf("%018d", total)}),
+		cnabLine(map[int]string{1: "341", 4: "9999", 8: "9", 18: "000001", 24: fmt.Sprintf("%06d", len(credits)+4)}),
+	)
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func TestCNAB(t *testing.T) {
+	today := time.Now().UTC()
+	newServer := func() (*Server, *store.AccountStore) {
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_operator", Role: auth.RoleOperator}, "operator-secret")
+		keys.Import(auth.APIKey{ID: "key_reader", Role: auth.RoleReadOnly}, "reader-secret")
+		accountStore := store.NewAccountStore(app.StartingID(3),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 5000},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 0},
+			app.Account{ID: 3, Name: "Ana Lima", CPF: "63000399003", Balance: 0},
+		)
+		server := NewServer(accountStore, store.NewTransferStore(app.StartingID(0)), WithAPIKeys(keys))
+		return server, accountStore
+	}
+	post := func(server *Server, key, contentType, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPost, "/batches/cnab240", strings.NewReader(body))
+		request.Header.Set(APIKeyHeader, key)
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+	const operator = "key_operator.operator-secret"
+	// occurrences returns the occurrences field of each line of a retorno.
+	occurrences := func(t *testing.T, response *httptest.ResponseRecorder) []string {
+		t.Helper()
+		var got []string
+		for _, line := range strings.Split(strings.TrimSuffix(response.Body.String(), "\r\n"), "\r\n") {
+			if len(line) != 240 {
+				t.Fatalf("got line of %d characters; want 240", len(line))
+			}
+			got = append(got, strings.TrimSpace(line[230:]))
+		}
+		return got
+	}
+
+	t.Run("should pay each payment and tell how it went", func(t *testing.T) {
+		server, accountStore := newServer()
+		remessa := cnabRemessa("48226581020", 1,
+			cnabCredit{account: 2, amount: 1500, date: today},
+			cnabCredit{account: 3, amount: 4000, date: today},
+			cnabCredit{account: 9, amount: 100, date: today},
+			cnabCredit{account: 3, amount: 100, date: today.AddDate(0, 0, 2)},
+			cnabCredit{account: 3, amount: 2500, date: today.AddDate(0, 0, -3)},
+		)
+
+		response := post(server, operator, CNABContentType, remessa)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		app.AssertString(t, response.Header().Get("content-type"), CNABContentType)
+		app.AssertString(t, response.Header().Get("Content-Disposition"), `attachment; filename="retorno-000042.ret"`)
+		app.AssertString(t, strings.Join(occurrences(t, response), ","), ",,00,01,AN,AP,00,,")
+		lines := strings.Split(response.Body.String(), "\r\n")
+		app.AssertString(t, lines[0][142:143], "2")
+		app.AssertString(t, strings.TrimSpace(lines[2][134:154]), "1")
+		app.AssertString(t, lines[2][154:162], today.Format("02012006"))
+		app.AssertString(t, strings.TrimSpace(lines[3][134:154]), "2")
+		origin, _ := accountStore.GetAccount(1)
+		app.AssertUint64(t, origin.Balance, 1000)
+		destination, _ := accountStore.GetAccount(3)
+		app.AssertUint64(t, destination.Balance, 2500)
+	})
+
+	t.Run("should refuse batches debited from accounts of someone else", func(t *testing.T) {
+		server, accountStore := newServer()
+
+		response := post(server, operator, "", cnabRemessa("71530184077", 1, cnabCredit{account: 2, amount: 1500, date: today}))
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		app.AssertString(t, strings.Join(occurrences(t, response), ","), ",HB,HB,HB,")
+		origin, _ := accountStore.GetAccount(1)
+		app.AssertUint64(t, origin.Balance, 5000)
+	})
+
+	t.Run("should refuse batches debited from accounts that do not exist", func(t *testing.T) {
+		server, _ := newServer()
+
+		response := post(server, operator, "", cnabRemessa("48226581020", 7, cnabCredit{account: 2, amount: 1500, date: today}))
+
+		app.AssertString(t, strings.Join(occurrences(t, response), ","), ",HD,HD,HD,")
+	})
+
+	t.Run("should not pay a remessa again when the request is retried", func(t *testing.T) {
+		server, accountStore := newServer()
+		remessa := cnabRemessa("48226581020", 1, cnabCredit{account: 2, amount: 1500, date: today})
+		send := func() *httptest.ResponseRecorder {
+			request, _ := http.NewRequest(http.MethodPost, "/batches/cnab240", strings.NewReader(remessa))
+			request.Header.Set(APIKeyHeader, operator)
+			request.Header.Set(IdempotencyKeyHeader, "remessa-42")
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			return response
+		}
+
+		first := send()
+		again := send()
+
+		app.AssertString(t, again.Body.String(), first.Body.String())
+		app.AssertString(t, again.Header().Get(ReplayedHeader), "true")
+		origin, _ := accountStore.GetAccount(1)
+		app.AssertUint64(t, origin.Balance, 3500)
+	})
+
+	t.Run("should refuse a remessa with a sequence number already paid", func(t *testing.T) {
+		server, accountStore := newServer()
+		remessa := cnabRemessa("48226581020", 1, cnabCredit{account: 2, amount: 1500, date: today})
+
+		app.AssertHTTPStatus(t, post(server, operator, CNABContentType, remessa).Code, http.StatusOK)
+		assertErrorCode(t, post(server, operator, CNABContentType, remessa), http.StatusConflict, "remessa_already_processed", "")
+		origin, _ := accountStore.GetAccount(1)
+		app.AssertUint64(t, origin.Balance, 3500)
+
+		other := cnabRemessa("71530184077", 2, cnabCredit{account: 3, amount: 500, date: today})
+		app.AssertHTTPStatus(t, post(server, operator, CNABContentType, other).Code, http.StatusOK)
+		destination, _ := accountStore.GetAccount(3)
+		app.AssertUint64(t, destination.Balance, 500)
+	})
+
+	t.Run("should refuse a remessa paid before a restart", func(t *testing.T) {
+		server, accountStore := newServer()
+		remessa := cnabRemessa("48226581020", 1, cnabCredit{account: 2, amount: 1500, date: today})
+		app.AssertHTTPStatus(t, post(server, operator, CNABContentType, remessa).Code, http.StatusOK)
+
+		accounts, transfers := store.TakeSnapshot(accountStore, server.transferStore).Restore()
+		restarted := NewServer(accounts, transfers, WithAPIKeys(server.keys))
+
+		assertErrorCode(t, post(restarted, operator, CNABContentType, remessa), http.StatusConflict, "remessa_already_processed", "")
+		origin, _ := accounts.GetAccount(1)
+		app.AssertUint64(t, origin.Balance, 3500)
+	})
+
+	t.Run("should refuse invalid requests", func(t *testing.T) {
+		server, _ := newServer()
+		remessa := cnabRemessa("48226581020", 1, cnabCredit{account: 2, amount: 1500, date: today})
+
+		assertErrorCode(t, post(server, operator, CNABContentType, remessa[:300]), http.StatusBadRequest, "invalid_cnab", "")
+		assertErrorCode(t, post(server, operator, JsonContentType, remessa), http.StatusUnsupportedMediaType, "unsupported_media_type", "")
+		assertErrorCode(t, post(server, "", CNABContentType, remessa), http.StatusUnauthorized, "api_key_required", "")
+		assertErrorCode(t, post(server, "key_reader.reader-secret", CNABContentType, remessa), http.StatusForbidden, "insufficient_role", "")
+	})
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestContract checks the status, error code and headers of every path our
+// clients rely on to decide whether to retry a request.
+func TestContract(t *testing.T) {
+	accounts := []app.Account{
+		{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 10000, CreatedAt: time.Now()},
+		{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 0, CreatedAt: time.Now()},
+	}
+
+	cases := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		code        string            // Empty for successful responses
+		headers     map[string]string // Headers expected besides the content type
+	}{
+		{name: "list accounts", method: http.MethodGet, path: "/accounts", status: http.StatusOK},
+		{name: "create account", method: http.MethodPost, path: "/accounts", body: `{"name":"Ana","cpf":"38145671004"}`, status: http.StatusCreated},
+		{name: "create account with charset", method: http.MethodPost, path: "/accounts", contentType: "application/json; charset=utf-8", body: `{"name":"Ana","cpf":"38145671004"}`, status: http.StatusCreated},
+		{name: "create account with invalid cpf", method: http.MethodPost, path: "/accounts", body: `{"name":"Ana","cpf":"381"}`, status: http.StatusBadRequest, code: "invalid_cpf"},
+		{name: "create account with malformed JSON", method: http.MethodPost, path: "/accounts", body: `{"name":`, status: http.StatusBadRequest, code: "invalid_request"},
+		{name: "create account as form", method: http.MethodPost, path: "/accounts", contentType: "application/x-www-form-urlencoded", body: `name=Ana`, status: http.StatusUnsupportedMediaType, code: "unsupported_media_type"},
+		{name: "create account with oversized body", method: http.MethodPost, path: "/accounts", body: `{"name":"` + strings.Repeat("a", MaxBodySize) + `"}`, status: http.StatusRequestEntityTooLarge, code: "body_too_large"},
+		{name: "delete accounts", method: http.MethodDelete, path: "/accounts", status: http.StatusMethodNotAllowed, code: "method_not_allowed", headers: map[string]string{"Allow": "GET, POST"}},
+		{name: "get balance", method: http.MethodGet, path: "/accounts/1/balance", status: http.StatusOK},
+		{name: "get balance of missing account", method: http.MethodGet, path: "/accounts/9/balance", status: http.StatusNotFound, code: "account_not_found"},
+		{name: "get balance with invalid ID", method: http.MethodGet, path: "/accounts/one/balance", status: http.StatusBadRequest, code: "invalid_id"},
+		{name: "post balance", method: http.MethodPost, path: "/accounts/1/balance", status: http.StatusMethodNotAllowed, code: "method_not_allowed", headers: map[string]string{"Allow": "GET"}},
+		{name: "list transfers", method: http.MethodGet, path: "/transfers", status: http.StatusOK},
+		{name: "create transfer", method: http.MethodPost, path: "/transfers", body: `{"account_origin_id":1,"account_destination_id":2,"amount":100}`, status: http.StatusCreated, headers: map[string]string{"Location": "/transfers/1"}},
+		{name: "create transfer from missing account", method: http.MethodPost, path: "/transfers", body: `{"account_origin_id":9,"account_destination_id":2,"amount":100}`, status: http.StatusNotFound, code: "account_not_found"},
+		{name: "create transfer to missing account", method: http.MethodPost, path: "/transfers", body: `{"account_origin_id":1,"account_destination_id":9,"amount":100}`, status: http.StatusNotFound, code: "account_not_found"},
+		{name: "create transfer to the same account", method: http.MethodPost, path: "/transfers", body: `{"account_origin_id":1,"account_destination_id":1,"amount":100}`, status: http.StatusUnprocessableEntity, code: "same_account"},
+		{name: "create transfer of zero", method: http.MethodPost, path: "/transfers", body: `{"account_origin_id":1,"account_destination_id":2,"amount":0}`, status: http.StatusUnprocessableEntity, code: "invalid_amount"},
+		{name: "create transfer over balance", method: http.MethodPost, path: "/transfers", body: `{"account_origin_id":1,"account_destination_id":2,"amount":1000000}`, status: http.StatusUnprocessableEntity, code: "insufficient_balance"},
+		{name: "create duplicated transfer", method: http.MethodPost, path: "/transfers", body: `{"account_origin_id":1,"account_destination_id":2,"amount":100}`, status: http.StatusConflict, code: "duplicate_transfer"},
+		{name: "create transfer as text", method: http.MethodPost, path: "/transfers", contentType: "text/plain", body: `{}`, status: http.StatusUnsupportedMediaType, code: "unsupported_media_type"},
+		{name: "get transfer", method: http.MethodGet, path: "/transfers/1", status: http.StatusOK},
+		{name: "get missing transfer", method: http.MethodGet, path: "/transfers/99", status: http.StatusNotFound, code: "transfer_not_found"},
+		{name: "delete transfer", method: http.MethodDelete, path: "/transfers/1", status: http.StatusMethodNotAllowed, code: "method_not_allowed", headers: map[string]string{"Allow": "GET"}},
+		{name: "create split transfer", method: http.MethodPost, path: "/transfers/split", body: `{"account_origin_id":1,"amount":300,"shares":[{"account_destination_id":2,"percentage":100}]}`, status: http.StatusCreated, headers: map[string]string{"Location": "/transfers/6"}},
+		{name: "create split transfer with mismatched shares", method: http.MethodPost, path: "/transfers/split", body: `{"account_origin_id":1,"amount":300,"shares":[{"account_destination_id":2,"amount":100}]}`, status: http.StatusUnprocessableEntity, code: "invalid_shares"},
+		{name: "create split transfer to missing account", method: http.MethodPost, path: "/transfers/split", body: `{"account_origin_id":1,"amount":300,"shares":[{"account_destination_id":9,"amount":300}]}`, status: http.StatusNotFound, code: "account_not_found"},
+		{name: "get split transfers", method: http.MethodGet, path: "/transfers/split", status: http.StatusMethodNotAllowed, code: "method_not_allowed", headers: map[string]string{"Allow": "POST"}},
+		{name: "unknown route", method: http.MethodGet, path: "/loans", status: http.StatusNotFound, code: "route_not_found"},
+	}
+
+	// Cases run in order against the same server, as some depend on the
+	// transfers created by the ones before them.
+	server := NewServer(store.NewAccountStore(app.StartingID(2), accounts...), store.NewTransferStore(app.StartingID(0)))
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request, _ := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			if c.contentType != "" {
+				request.Header.Set("content-type", c.contentType)
+			}
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+
+			app.AssertHTTPStatus(t, response.Code, c.status)
+			app.AssertString(t, response.Header().Get("content-type"), JsonContentType)
+			if response.Header().Get(RequestIDHeader) == "" {
+				t.Errorf("response has no %s header", RequestIDHeader)
+			}
+			for header, want := range c.headers {
+				app.AssertString(t, response.Header().Get(header), want)
+			}
+			if !json.Valid(response.Body.Bytes()) {
+				t.Errorf("response body is not valid JSON: %q", response.Body)
+			}
+
+			if c.code != "" {
+				var got ErrorResponse
+				json.Unmarshal(response.Body.Bytes(), &got)
+				app.AssertString(t, got.Code, c.code)
+			}
+		})
+	}
+}
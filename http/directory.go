@@ -0,0 +1,150 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RegisterKeyRequest adds an addressing key to an account. Value is left
+// out for random keys, which the bank generates.
+type RegisterKeyRequest struct {
+	Type  string `json:"type"` // cpf, cnpj, email, phone or random
+	Value string `json:"value,omitempty"`
+}
+
+// KeyLookupResponse tells who a key belongs to, masked, so that payers can
+// confirm it before transferring to it.
+type KeyLookupResponse struct {
+	Type        string `json:"type"`
+	Key         string `json:"key"`
+	Name        string `json:"name"`          // First name of the holder, with only the initials of the others
+	CPF         string `json:"cpf,omitempty"` // CPF of the holder, with only its middle digits
+	AccountType string `json:"account_type,omitempty"`
+}
+
+// accountKeysHandler lists the keys of an account on GET and registers one
+// on POST /accounts/{account_id}/keys.
+func (s *Server) accountKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+		return
+	}
+	account, ok := s.pathAccount(w, r)
+	if !ok || !s.checkOwner(w, r, account, "account_id") {
+		return
+	}
+	if r.Method == http.MethodGet {
+		keys := account.Keys
+		if keys == nil {
+			keys = []app.AddressingKey{}
+		}
+		writeJSON(w, r, http.StatusOK, keys)
+		return
+	}
+
+	request := RegisterKeyRequest{}
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	key, err := s.accountStore.RegisterKey(r.Context(), account.ID, request.Type, request.Value)
+	if err != nil {
+		field := "value"
+		switch {
+		case errors.Is(err, store.ErrInvalidKeyType):
+			field = "type"
+		case errors.Is(err, store.ErrAccountNotFound):
+			field = "account_id"
+		}
+		writeError(w, r, errorStatus(err), err, field, fmt.Sprintf("error registering %s key for account %d: %s", request.Type, account.ID, err))
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/accounts/%d/keys/%s", account.ID, url.PathEscape(key.Key)))
+	writeJSON(w, r, http.StatusCreated, key)
+}
+
+// accountKeyHandler removes a key of an account on DELETE
+// /accounts/{account_id}/keys/{key}.
+func (s *Server) accountKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, r, http.MethodDelete)
+		return
+	}
+	account, ok := s.pathAccount(w, r)
+	if !ok || !s.checkOwner(w, r, account, "account_id") {
+		return
+	}
+	key, err := s.accountStore.RemoveKey(r.Context(), account.ID, mux.Vars(r)["key"])
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "key", fmt.Sprintf("error removing key of account %d: %s", account.ID, err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, key)
+}
+
+// lookupKeyHandler tells who a key belongs to on GET /keys/{key}. With
+// authentication enabled, only customers and API keys may look keys up.
+func (s *Server) lookupKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	if !s.checkAuthenticated(w, r) {
+		return
+	}
+	account, key, err := s.accountStore.FindKey(mux.Vars(r)["key"])
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "key", err.Error())
+		return
+	}
+	noteAccounts(r, account.ID)
+	writeJSON(w, r, http.StatusOK, KeyLookupResponse{
+		Type:        key.Type,
+		Key:         key.Key,
+		Name:        maskName(account.Name),
+		CPF:         maskCPF(account.CPF),
+		AccountType: account.Type,
+	})
+}
+
+// checkAuthenticated responds with an error and returns false if
+// authentication is enabled and the request has neither a bearer token nor
+// an API key.
+func (s *Server) checkAuthenticated(w http.ResponseWriter, r *http.Request) bool {
+	if s.tokens == nil {
+		return true
+	}
+	if _, ok := auth.KeyFromContext(r.Context()); ok {
+		return true
+	}
+	if _, ok := auth.FromContext(r.Context()); ok {
+		return true
+	}
+	writeError(w, r, http.StatusUnauthorized, ErrUnauthenticated, "", fmt.Sprintf("%s %s requires a bearer token", r.Method, r.URL.Path))
+	return false
+}
+
+// maskName keeps the first name and the initials of the other names, as in
+// "Roberta P*** S***".
+func maskName(name string) string {
+	names := strings.Fields(name)
+	for i := 1; i < len(names); i++ {
+		names[i] = string([]rune(names[i])[0]) + "***"
+	}
+	return strings.Join(names, " ")
+}
+
+// maskCPF shows only the middle six digits of a CPF, as in
+// "***.265.810-**".
+func maskCPF(CPF string) string {
+	if len(CPF) != 11 {
+		return ""
+	}
+	return fmt.Sprintf("***.%s.%s-**", CPF[3:6], CPF[6:9])
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAddressingKeys(t *testing.T) {
+	newServer := func() (*Server, *store.AccountStore) {
+		accountStore := store.NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 5000},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 0},
+		)
+		return NewServer(accountStore, store.NewTransferStore(app.StartingID(0))), accountStore
+	}
+	send := func(server *Server, method, path, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("should register, list and remove keys", func(t *testing.T) {
+		server, _ := newServer()
+
+		response := send(server, http.MethodPost, "/accounts/1/keys", `{"type":"email","value":"Roberta@Exemplo.com"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		app.AssertString(t, response.Header().Get("Location"), "/accounts/1/keys/roberta@exemplo.com")
+		response = send(server, http.MethodPost, "/accounts/1/keys", `{"type":"random"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+
+		response = send(server, http.MethodGet, "/accounts/1/keys", "")
+		var keys []app.AddressingKey
+		json.NewDecoder(response.Body).Decode(&keys)
+		if len(keys) != 2 || keys[0].Key != "roberta@exemplo.com" || keys[1].Type != store.KeyTypeRandom {
+			t.Errorf("got keys %v; want the email and a random key", keys)
+		}
+
+		response = send(server, http.MethodDelete, "/accounts/1/keys/ROBERTA@exemplo.com", "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		response = send(server, http.MethodGet, "/accounts/1/keys", "")
+		json.NewDecoder(response.Body).Decode(&keys)
+		app.AssertUint64(t, uint64(len(keys)), 1)
+		response = send(server, http.MethodGet, "/accounts/2/keys", "")
+		app.AssertString(t, strings.TrimSpace(response.Body.String()), "[]")
+	})
+
+	t.Run("should tell who a key belongs to, masked", func(t *testing.T) {
+		server, _ := newServer()
+		send(server, http.MethodPost, "/accounts/1/keys", `{"type":"cpf","value":"482.265.810-20"}`)
+
+		response := send(server, http.MethodGet, "/keys/482.265.810-20", "")
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		var got KeyLookupResponse
+		json.NewDecoder(response.Body).Decode(&got)
+		want := KeyLookupResponse{Type: store.KeyTypeCPF, Key: "48226581020", Name: "Roberta P*** S***", CPF: "***.265.810-**"}
+		if got != want {
+			t.Errorf("got %+v; want %+v", got, want)
+		}
+		assertErrorCode(t, send(server, http.MethodGet, "/keys/71530184077", ""), http.StatusNotFound, "key_not_found", "key")
+	})
+
+	t.Run("should transfer to the account of a key", func(t *testing.T) {
+		server, accountStore := newServer()
+		send(server, http.MethodPost, "/accounts/2/keys", `{"type":"phone","value":"+5511987654321"}`)
+
+		response := send(server, http.MethodPost, "/transfers", `{"account_origin_id":1,"destination_key":"+5511987654321","amount":1500}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		destination, _ := accountStore.GetAccount(2)
+		app.AssertUint64(t, destination.Balance, 1500)
+		assertErrorCode(t, send(server, http.MethodPost, "/transfers", `{"account_origin_id":1,"destination_key":"+5511900000000","amount":1500}`), http.StatusNotFound, "key_not_found", "destination_key")
+		assertErrorCode(t, send(server, http.MethodPost, "/transfers", `{"account_origin_id":1,"account_destination_id":2,"destination_key":"+5511987654321","amount":1500}`), http.StatusBadRequest, "invalid_request", "destination_key")
+	})
+
+	t.Run("should refuse invalid keys", func(t *testing.T) {
+		server, _ := newServer()
+		send(server, http.MethodPost, "/accounts/1/keys", `{"type":"email","value":"roberta@exemplo.com"}`)
+
+		tests := []struct {
+			name   string
+			path   string
+			body   string
+			status int
+			code   string
+			field  string
+		}{
+			{"unknown type", "/accounts/1/keys", `{"type":"apelido","value":"roberta"}`, http.StatusBadRequest, "invalid_key", "type"},
+			{"phone not in E.164", "/accounts/1/keys", `{"type":"phone","value":"11987654321"}`, http.StatusBadRequest, "invalid_key", "value"},
+			{"cpf of someone else", "/accounts/1/keys", `{"type":"cpf","value":"71530184077"}`, http.StatusUnprocessableEntity, "key_not_owned", "value"},
+			{"key of another account", "/accounts/2/keys", `{"type":"email","value":"roberta@exemplo.com"}`, http.StatusConflict, "key_in_use", "value"},
+			{"unknown account", "/accounts/9/keys", `{"type":"random"}`, http.StatusNotFound, "account_not_found", "account_id"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assertErrorCode(t, send(server, http.MethodPost, tt.path, tt.body), tt.status, tt.code, tt.field)
+			})
+		}
+		assertErrorCode(t, send(server, http.MethodDelete, "/accounts/2/keys/roberta@exemplo.com", ""), http.StatusNotFound, "key_not_found", "key")
+	})
+}
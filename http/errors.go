@@ -0,0 +1,205 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/brcode"
+	"github.com/erikacarvalho/stone-challenge/cnab"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"github.com/erikacarvalho/stone-challenge/webhook"
+	"net/http"
+	"strings"
+)
+
+// RequestIDHeader carries the ID that identifies a request in the logs and
+// in error responses. It is taken from the request when the client sends
+// one, or generated otherwise.
+const RequestIDHeader = "X-Request-ID"
+
+var (
+	ErrInvalidRequest   = errors.New("invalid request")
+	ErrInvalidID        = errors.New("invalid id")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrRouteNotFound    = errors.New("route not found")
+	ErrInternal         = errors.New("internal error")
+	ErrUnsupportedMedia = errors.New("unsupported media type: the body must be application/json")
+	ErrBodyTooLarge     = errors.New("request body is too large")
+)
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Code      string `json:"code"`            // Stable identifier of the error, see errorCodes
+	Message   string `json:"message"`         // Human readable description, which may change
+	Field     string `json:"field,omitempty"` // Request field that caused the error, if any
+	RequestID string `json:"request_id"`
+}
+
+// errorCodes maps the errors reported by the API to the stable codes sent to
+// clients and to the status they are usually answered with. Errors are
+// matched with errors.Is, so wrapped errors get the code of the sentinel they
+// wrap. Anything not listed here is an internal error.
+//
+// Malformed requests get 400, references to something that does not exist
+// get 404, requests the bank rules refuse get 422 and duplicated transfers
+// get 409, as retrying them would not help. Missing or bad credentials get
+// 401 and acting on someone else's account gets 403.
+var errorCodes = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{ErrInvalidRequest, "invalid_request", http.StatusBadRequest},
+	{ErrInvalidID, "invalid_id", http.StatusBadRequest},
+	{ErrInvalidPage, "invalid_request", http.StatusBadRequest},
+	{ErrIdempotencyKeyReused, "idempotency_key_reused", http.StatusUnprocessableEntity},
+	{ErrMethodNotAllowed, "method_not_allowed", http.StatusMethodNotAllowed},
+	{ErrRouteNotFound, "route_not_found", http.StatusNotFound},
+	{ErrUnsupportedMedia, "unsupported_media_type", http.StatusUnsupportedMediaType},
+	{ErrBodyTooLarge, "body_too_large", http.StatusRequestEntityTooLarge},
+	{ErrInvalidCPF, "invalid_cpf", http.StatusBadRequest},
+	{ErrInvalidName, "invalid_name", http.StatusBadRequest},
+	{ErrInvalidType, "invalid_type", http.StatusBadRequest},
+	{ErrInvalidPercentage, "invalid_percentage", http.StatusBadRequest},
+	{ErrInvalidPassword, "invalid_password", http.StatusBadRequest},
+	{ErrInvalidCredentials, "invalid_credentials", http.StatusUnauthorized},
+	{ErrUnauthenticated, "unauthenticated", http.StatusUnauthorized},
+	{ErrMalformedAuthHeader, "invalid_token", http.StatusUnauthorized},
+	{auth.ErrInvalidToken, "invalid_token", http.StatusUnauthorized},
+	{auth.ErrExpiredToken, "expired_token", http.StatusUnauthorized},
+	{ErrAccountNotOwned, "account_not_owned", http.StatusForbidden},
+	{ErrPasswordNotSet, "password_not_set", http.StatusForbidden},
+	{ErrAPIKeyRequired, "api_key_required", http.StatusUnauthorized},
+	{ErrInsufficientRole, "insufficient_role", http.StatusForbidden},
+	{auth.ErrInvalidRole, "invalid_role", http.StatusBadRequest},
+	{auth.ErrAPIKeyNotFound, "api_key_not_found", http.StatusNotFound},
+	{auth.ErrInvalidAPIKey, "invalid_api_key", http.StatusUnauthorized},
+	{auth.ErrRevokedAPIKey, "api_key_revoked", http.StatusConflict},
+	{auth.ErrInvalidSignature, "invalid_signature", http.StatusUnauthorized},
+	{auth.ErrStaleRequest, "stale_request", http.StatusUnauthorized},
+	{auth.ErrReplayedRequest, "replayed_request", http.StatusUnauthorized},
+	{ErrTOTPRequired, "totp_required", http.StatusForbidden},
+	{ErrInvalidTOTPCode, "invalid_totp_code", http.StatusForbidden},
+	{store.ErrTOTPNotEnrolled, "totp_not_enrolled", http.StatusConflict},
+	{store.ErrTOTPAlreadyEnabled, "totp_already_enabled", http.StatusConflict},
+	{store.ErrTOTPReplayed, "totp_replayed", http.StatusForbidden},
+	{store.ErrStepUpLocked, "totp_locked", http.StatusForbidden},
+	{store.ErrNotPending, "transfer_not_pending", http.StatusConflict},
+	{store.ErrConfirmationExpired, "confirmation_expired", http.StatusGone},
+	{ErrRateLimited, "rate_limited", http.StatusTooManyRequests},
+	{ErrOverloaded, "overloaded", http.StatusServiceUnavailable},
+	{store.ErrAccountNotFound, "account_not_found", http.StatusNotFound},
+	{store.ErrTransferNotFound, "transfer_not_found", http.StatusNotFound},
+	{store.ErrInsufficientBalance, "insufficient_balance", http.StatusUnprocessableEntity},
+	{store.ErrChargeBack, "duplicate_transfer", http.StatusConflict},
+	{store.ErrSameID, "same_account", http.StatusUnprocessableEntity},
+	{store.ErrInvalidAmount, "invalid_amount", http.StatusUnprocessableEntity},
+	{store.ErrNoShares, "invalid_shares", http.StatusUnprocessableEntity},
+	{store.ErrInvalidShare, "invalid_shares", http.StatusUnprocessableEntity},
+	{store.ErrSharesMismatch, "invalid_shares", http.StatusUnprocessableEntity},
+	{store.ErrInvalidPeriod, "invalid_period", http.StatusBadRequest},
+	{store.ErrInvalidExport, "invalid_export", http.StatusBadRequest},
+	{cnab.ErrInvalidFile, "invalid_cnab", http.StatusBadRequest},
+	{store.ErrRemessaProcessed, "remessa_already_processed", http.StatusConflict},
+	{store.ErrImportConflict, "import_conflict", http.StatusConflict},
+	{store.ErrInvalidKeyType, "invalid_key", http.StatusBadRequest},
+	{store.ErrInvalidKey, "invalid_key", http.StatusBadRequest},
+	{store.ErrKeyNotOwned, "key_not_owned", http.StatusUnprocessableEntity},
+	{store.ErrKeyInUse, "key_in_use", http.StatusConflict},
+	{store.ErrKeyLimit, "key_limit_reached", http.StatusUnprocessableEntity},
+	{store.ErrKeyNotFound, "key_not_found", http.StatusNotFound},
+	{brcode.ErrInvalidPayload, "invalid_brcode", http.StatusBadRequest},
+	{store.ErrChargeNotFound, "charge_not_found", http.StatusNotFound},
+	{store.ErrChargePaid, "charge_already_paid", http.StatusConflict},
+	{webhook.ErrInvalidURL, "invalid_webhook_url", http.StatusBadRequest},
+	{events.ErrInvalidType, "invalid_event_type", http.StatusBadRequest},
+	{webhook.ErrSubscriptionNotFound, "webhook_not_found", http.StatusNotFound},
+	{webhook.ErrDeliveryNotFound, "delivery_not_found", http.StatusNotFound},
+	{webhook.ErrDeliveryNotFailed, "delivery_not_failed", http.StatusConflict},
+}
+
+func errorCode(err error) string {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e.code
+		}
+	}
+	return "internal_error"
+}
+
+// errorStatus returns the HTTP status for err.
+func errorStatus(err error) int {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError logs an error and responds with it as an ErrorResponse. The
+// code comes from err, message is meant for humans and field names the
+// offending request field, if any.
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error, field, message string) {
+	response := ErrorResponse{
+		Code:      errorCode(err),
+		Message:   message,
+		Field:     field,
+		RequestID: r.Header.Get(RequestIDHeader),
+	}
+	logger := logging.FromContext(r.Context())
+	if status >= http.StatusInternalServerError {
+		logger.Error(message, "code", response.Code, "status", status, "error", err)
+	} else {
+		logger.Info(message, "code", response.Code, "status", status, "error", err)
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		logger.Error("error marshaling error response", "error", err)
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("content-type", JsonContentType)
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
+
+// methodNotAllowed responds to requests whose method a route does not
+// handle, listing the methods it does in the Allow header.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, r, http.StatusMethodNotAllowed, ErrMethodNotAllowed, "", r.Method+" is not allowed on "+r.URL.Path)
+}
+
+// routeNotFound responds to requests for paths the API does not serve.
+func routeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, ErrRouteNotFound, "", r.URL.Path+" does not exist")
+}
+
+// withRequestID makes sure every request has an ID, generating one when
+// the client does not send it, and echoes it in the response.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		logging.Default().Error("error generating request ID", "error", err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	t.Run("should map wrapped store errors to their code", func(t *testing.T) {
+		err := fmt.Errorf("impossible to exchange amount: %w", store.ErrInsufficientBalance)
+
+		app.AssertString(t, errorCode(err), "insufficient_balance")
+	})
+
+	t.Run("should map unknown errors to internal_error", func(t *testing.T) {
+		app.AssertString(t, errorCode(errors.New("disk on fire")), "internal_error")
+	})
+}
+
+func TestErrorResponses(t *testing.T) {
+	t.Run("should echo the request ID sent by the client", func(t *testing.T) {
+		server := NewServer(store.NewAccountStore(app.StartingID(0)), nil)
+
+		request, _ := http.NewRequest(http.MethodGet, "/accounts/97/balance", nil)
+		request.Header.Set(RequestIDHeader, "checkout-1234")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		app.AssertString(t, response.Header().Get(RequestIDHeader), "checkout-1234")
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "account_not_found",
+			Message: "account 97 not found",
+			Field:   "account_id",
+		})
+	})
+
+	t.Run("should answer unknown routes with a JSON error", func(t *testing.T) {
+		server := NewServer(nil, nil)
+
+		request, _ := http.NewRequest(http.MethodGet, "/loans", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusNotFound)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "route_not_found",
+			Message: "/loans does not exist",
+		})
+	})
+
+	t.Run("should answer unsupported methods with a JSON error", func(t *testing.T) {
+		server := NewServer(nil, nil)
+
+		request, _ := http.NewRequest(http.MethodPut, "/transfers", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusMethodNotAllowed)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "method_not_allowed",
+			Message: "PUT is not allowed on /transfers",
+		})
+	})
+}
+
+// assertErrorResponse checks that response carries the error in want, along
+// with the ID of the request that caused it.
+func assertErrorResponse(t *testing.T, response *httptest.ResponseRecorder, want ErrorResponse) {
+	t.Helper()
+
+	var got ErrorResponse
+	err := json.Unmarshal(response.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("unable to parse error response. response: %q; error: '%v'", response.Body, err)
+	}
+
+	want.RequestID = response.Header().Get(RequestIDHeader)
+	if want.RequestID == "" {
+		t.Errorf("response has no %s header", RequestIDHeader)
+	}
+	if got != want {
+		t.Errorf("got error response %+v; want %+v", got, want)
+	}
+	app.AssertString(t, response.Header().Get("content-type"), JsonContentType)
+}
+
+// assertErrorCode checks the status of an error response and the code and
+// field it blames, leaving out the message.
+func assertErrorCode(t *testing.T, response *httptest.ResponseRecorder, status int, code, field string) {
+	t.Helper()
+	app.AssertHTTPStatus(t, response.Code, status)
+	var got ErrorResponse
+	json.NewDecoder(response.Body).Decode(&got)
+	app.AssertString(t, got.Code, code)
+	app.AssertString(t, got.Field, field)
+}
@@ -0,0 +1,209 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LastEventIDHeader is sent by clients reconnecting to GET /events with the
+// ID of the last event they got.
+const LastEventIDHeader = "Last-Event-ID"
+
+// EventStreamContentType is the media type of Server-Sent Events.
+const EventStreamContentType = "text/event-stream"
+
+// KeepAliveInterval is how often an idle event stream gets a comment, so
+// that proxies do not close it.
+const KeepAliveInterval = 15 * time.Second
+
+// WithEventStream serves the events kept by hub as a Server-Sent Events
+// stream on GET /events. Streams end after maxDuration, if it is not zero,
+// so that they finish before the server write timeout; clients then
+// reconnect and resume.
+func WithEventStream(hub *events.Hub, maxDuration time.Duration) Option {
+	return func(s *Server) {
+		s.eventHub = hub
+		s.streamDuration = maxDuration
+	}
+}
+
+// eventsHandler streams events on GET /events, optionally only the ones
+// about the accounts given as account_id and of the types given as type,
+// which may end in *. Customers only get the events of their own accounts.
+// A Last-Event-ID header resumes the stream after that event; an events.lost
+// event tells the client when some could not be resumed and it should
+// reload what it shows.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	query := r.URL.Query()
+	var accountIDs []uint64
+	for _, value := range query["account_id"] {
+		ID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrInvalidID, "account_id", fmt.Sprintf("invalid account_id %q", value))
+			return
+		}
+		accountIDs = append(accountIDs, ID)
+	}
+	accountIDs, customer, ok := s.streamAccounts(w, r, accountIDs)
+	if !ok {
+		return
+	}
+	types := query["type"]
+	for _, pattern := range types {
+		if !events.ValidPattern(pattern) {
+			writeError(w, r, http.StatusBadRequest, events.ErrInvalidType, "type", fmt.Sprintf("invalid event type %q", pattern))
+			return
+		}
+	}
+	var lastID uint64
+	lastEventID := r.Header.Get(LastEventIDHeader)
+	if lastEventID != "" {
+		var err error
+		lastID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrInvalidID, "Last-Event-ID", fmt.Sprintf("invalid %s %q", LastEventIDHeader, lastEventID))
+			return
+		}
+	}
+	flusher, canFlush := w.(http.Flusher)
+	if !canFlush {
+		writeError(w, r, http.StatusInternalServerError, ErrInternal, "", "response does not support streaming")
+		return
+	}
+
+	filter := func(e events.Event) bool {
+		if customer && len(accountIDs) == 0 {
+			return false
+		}
+		return wantsEvent(e, accountIDs, types)
+	}
+	stream, err := s.eventHub.Subscribe(lastID, lastEventID != "", filter)
+	if err == events.ErrTooManySubscribers {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, r, http.StatusServiceUnavailable, ErrOverloaded, "", err.Error())
+		return
+	}
+	defer stream.Close()
+	noteAccounts(r, accountIDs...)
+
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 1000\n\n")
+	if stream.Gap {
+		fmt.Fprint(w, "event: events.lost\ndata: {}\n\n")
+	}
+	for _, e := range stream.Backlog {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	var deadline <-chan time.Time
+	if s.streamDuration > 0 {
+		timer := time.NewTimer(s.streamDuration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	keepAlive := time.NewTicker(KeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-stream.C:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-deadline:
+			return
+		case <-s.drained:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// streamAccounts returns the accounts a request may stream the events of,
+// out of the ones asked for, and whether it was made by a customer, whose
+// streams are limited to them even when none are. Customers may only ask for
+// their own accounts and get all of them otherwise; accounts they open later
+// are streamed once they reconnect. Without a customer token or an API key,
+// streams are refused unless the server has no authentication at all.
+func (s *Server) streamAccounts(w http.ResponseWriter, r *http.Request, accountIDs []uint64) ([]uint64, bool, bool) {
+	if _, ok := auth.KeyFromContext(r.Context()); ok {
+		return accountIDs, false, true
+	}
+	claims, ok := auth.FromContext(r.Context())
+	if !ok {
+		if s.tokens != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bank"`)
+			writeError(w, r, http.StatusUnauthorized, ErrUnauthenticated, "", fmt.Sprintf("%s %s requires a bearer token", r.Method, r.URL.Path))
+			return nil, false, false
+		}
+		if s.keys != nil {
+			writeError(w, r, http.StatusUnauthorized, ErrAPIKeyRequired, "", fmt.Sprintf("%s requires an API key", r.URL.Path))
+			return nil, false, false
+		}
+		return accountIDs, false, true
+	}
+
+	owned := make(map[uint64]bool)
+	var ownedIDs []uint64
+	for _, account := range s.accountStore.ListAccountsByCPF(claims.Subject) {
+		owned[account.ID] = true
+		ownedIDs = append(ownedIDs, account.ID)
+	}
+	if len(accountIDs) == 0 {
+		return ownedIDs, true, true
+	}
+	for _, ID := range accountIDs {
+		if !owned[ID] {
+			writeError(w, r, http.StatusForbidden, ErrAccountNotOwned, "account_id", fmt.Sprintf("account %d does not belong to the authenticated customer", ID))
+			return nil, false, false
+		}
+	}
+	return accountIDs, true, true
+}
+
+// writeEvent writes e in the Server-Sent Events format, named after its
+// type and with its ID, so that clients can resume after it.
+func writeEvent(w http.ResponseWriter, e events.Event) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+}
+
+// wantsEvent tells whether e is about one of accountIDs and of one of
+// types. Empty lists allow any.
+func wantsEvent(e events.Event, accountIDs []uint64, types []string) bool {
+	if len(accountIDs) > 0 {
+		involved := false
+		for _, ID := range accountIDs {
+			involved = involved || e.Involves(ID)
+		}
+		if !involved {
+			return false
+		}
+	}
+	if len(types) == 0 {
+		return true
+	}
+	for _, pattern := range types {
+		if events.Match(pattern, e.Type) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseMessage is a message read from an event stream.
+type sseMessage struct {
+	id, event, data string
+}
+
+// readMessage reads the next message with an event from an event stream,
+// skipping comments and retry hints.
+func readMessage(t *testing.T, reader *bufio.Reader) sseMessage {
+	t.Helper()
+	var message sseMessage
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("error reading event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && message.event != "":
+			return message
+		case strings.HasPrefix(line, "id: "):
+			message.id = line[len("id: "):]
+		case strings.HasPrefix(line, "event: "):
+			message.event = line[len("event: "):]
+		case strings.HasPrefix(line, "data: "):
+			message.data = line[len("data: "):]
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	newServer := func(bufferSize int, options ...Option) (*Server, *httptest.Server) {
+		accountStore := store.NewAccountStore(app.StartingID(3),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 10000},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 10000},
+			app.Account{ID: 3, Name: "Ana Lima", CPF: "10000000001", Balance: 10000},
+		)
+		transferStore := store.NewTransferStore(app.StartingID(0))
+		bus := events.NewBus()
+		hub := events.NewHub(bufferSize)
+		bus.Subscribe(hub.Handle)
+		accountStore.SetPublisher(bus)
+		transferStore.SetPublisher(bus)
+		server := NewServer(accountStore, transferStore, append(options, WithEventStream(hub, 0))...)
+		return server, httptest.NewServer(server)
+	}
+	openAs := func(t *testing.T, ctx context.Context, url, lastEventID, token string) (*http.Response, *bufio.Reader) {
+		t.Helper()
+		request, _ := http.NewRequest(http.MethodGet, url, nil)
+		request = request.WithContext(ctx)
+		if lastEventID != "" {
+			request.Header.Set(LastEventIDHeader, lastEventID)
+		}
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("error opening event stream: %v", err)
+		}
+		return response, bufio.NewReader(response.Body)
+	}
+	open := func(t *testing.T, ctx context.Context, url, lastEventID string) (*http.Response, *bufio.Reader) {
+		t.Helper()
+		return openAs(t, ctx, url, lastEventID, "")
+	}
+	transfer := func(t *testing.T, server *Server, origin, destination int) {
+		t.Helper()
+		body := `{"account_origin_id":` + strconv.Itoa(origin) + `,"account_destination_id":` + strconv.Itoa(destination) + `,"amount":100}`
+		request, _ := http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(body))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+	}
+
+	t.Run("should stream the events about the accounts asked for", func(t *testing.T) {
+		server, httpServer := newServer(100)
+		defer httpServer.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		response, reader := open(t, ctx, httpServer.URL+"/events?account_id=1&type=transfer.*", "")
+		defer response.Body.Close()
+		app.AssertHTTPStatus(t, response.StatusCode, http.StatusOK)
+		app.AssertString(t, response.Header.Get("Content-Type"), EventStreamContentType)
+
+		transfer(t, server, 2, 3)
+		transfer(t, server, 1, 2)
+
+		for _, want := range []string{events.TransferCreated, events.TransferAuthorizing, events.TransferAuthorized, events.TransferConfirmed} {
+			message := readMessage(t, reader)
+			var e events.Event
+			json.Unmarshal([]byte(message.data), &e)
+			app.AssertString(t, message.event, want)
+			app.AssertString(t, message.id, strconv.FormatUint(e.ID, 10))
+			if !e.Involves(1) {
+				t.Errorf("got event %s about accounts %v; want only account 1", message.event, e.AccountIDs)
+			}
+		}
+	})
+
+	t.Run("should resume after Last-Event-ID", func(t *testing.T) {
+		server, httpServer := newServer(100)
+		defer httpServer.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		transfer(t, server, 1, 2)
+
+		// The transfer published 4 transfer events and 2 balance changes.
+		response, reader := open(t, ctx, httpServer.URL+"/events", "4")
+		defer response.Body.Close()
+
+		app.AssertString(t, readMessage(t, reader).id, "5")
+		app.AssertString(t, readMessage(t, reader).id, "6")
+		transfer(t, server, 2, 3)
+		message := readMessage(t, reader)
+		app.AssertString(t, message.id, "7")
+		app.AssertString(t, message.event, events.TransferCreated)
+	})
+
+	t.Run("should tell when events could not be resumed", func(t *testing.T) {
+		server, httpServer := newServer(2)
+		defer httpServer.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		transfer(t, server, 1, 2)
+
+		response, reader := open(t, ctx, httpServer.URL+"/events", "1")
+		defer response.Body.Close()
+
+		app.AssertString(t, readMessage(t, reader).event, "events.lost")
+		app.AssertString(t, readMessage(t, reader).id, "5")
+	})
+
+	t.Run("should end streams when the server drains", func(t *testing.T) {
+		server, httpServer := newServer(100)
+		defer httpServer.Close()
+
+		response, reader := open(t, context.Background(), httpServer.URL+"/events", "")
+		defer response.Body.Close()
+		server.Drain()
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := reader.ReadString(0)
+			done <- err
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("got the stream open after draining")
+		}
+	})
+
+	t.Run("should refuse anonymous streams when there is authentication", func(t *testing.T) {
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_support", Role: auth.RoleReadOnly}, "segredo")
+		issuer := auth.NewIssuer([]byte("chave-de-teste"), time.Hour)
+		for _, options := range [][]Option{{WithAuth(issuer)}, {WithAPIKeys(keys)}, {WithAuth(issuer), WithAPIKeys(keys)}} {
+			server, httpServer := newServer(100, options...)
+			httpServer.Close()
+
+			request, _ := http.NewRequest(http.MethodGet, "/events", nil)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("should stream to customers only the events of their accounts", func(t *testing.T) {
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_operator", Role: auth.RoleOperator}, "segredo")
+		issuer := auth.NewIssuer([]byte("chave-de-teste"), time.Hour)
+		server, httpServer := newServer(100, WithAuth(issuer), WithAPIKeys(keys))
+		defer httpServer.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		token, _, _ := issuer.Issue("71530184077")
+
+		request, _ := http.NewRequest(http.MethodGet, "/events?account_id=1", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertErrorCode(t, response, http.StatusForbidden, "account_not_owned", "account_id")
+
+		stream, reader := openAs(t, ctx, httpServer.URL+"/events?type=transfer.created", "", token)
+		defer stream.Body.Close()
+		app.AssertHTTPStatus(t, stream.StatusCode, http.StatusOK)
+
+		// Account 2, of the customer, only takes part in the second one.
+		for _, origin := range []uint64{1, 2} {
+			body := fmt.Sprintf(`{"account_origin_id":%d,"account_destination_id":3,"amount":100}`, origin)
+			request, _ := http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(body))
+			request.Header.Set(APIKeyHeader, "key_operator.segredo")
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		}
+		var e events.Event
+		json.Unmarshal([]byte(readMessage(t, reader).data), &e)
+		if e.Involves(1) || !e.Involves(2) {
+			t.Errorf("got event about accounts %v; want only the ones of account 2", e.AccountIDs)
+		}
+	})
+
+	t.Run("should refuse invalid filters", func(t *testing.T) {
+		server, httpServer := newServer(100)
+		defer httpServer.Close()
+
+		for _, path := range []string{"/events?account_id=x", "/events?type=conta.*"} {
+			request, _ := http.NewRequest(http.MethodGet, path, nil)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+		}
+		request, _ := http.NewRequest(http.MethodGet, "/events", nil)
+		request.Header.Set(LastEventIDHeader, "x")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertErrorResponse(t, response, ErrorResponse{Code: "invalid_id", Message: `invalid Last-Event-ID "x"`, Field: "Last-Event-ID"})
+	})
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// NDJSONContentType is the media type of exports: one JSON value per line.
+const NDJSONContentType = "application/x-ndjson"
+
+// MaxImportSize is the largest export accepted by POST /admin/import, in
+// bytes.
+const MaxImportSize = 256 << 20
+
+// ImportResponse is the body of a successful import.
+type ImportResponse struct {
+	Mode string `json:"mode"`
+	store.ImportResult
+}
+
+// exportHandler streams every account and transfer, and the IDs given
+// last, as an export on GET /admin/export.
+func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	w.Header().Set("content-type", NDJSONContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="bank-%s.ndjson"`, time.Now().UTC().Format("20060102T150405Z")))
+	w.WriteHeader(http.StatusOK)
+	err := store.Export(w, s.accountStore, s.transferStore)
+	if err != nil {
+		// The status is already sent; a client missing the checksum line
+		// knows the export is incomplete.
+		logging.FromContext(r.Context()).Error("error streaming export", "error", err)
+	}
+}
+
+// importHandler adds the accounts and transfers of an export to the stores
+// on POST /admin/import. The mode query parameter, merge by default, tells
+// whether IDs already in use are refused or everything is replaced.
+func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = store.ImportMerge
+	}
+	if mode != store.ImportMerge && mode != store.ImportReplace {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "mode", store.ErrInvalidImportMode.Error())
+		return
+	}
+
+	if contentType := r.Header.Get("content-type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != NDJSONContentType {
+			writeError(w, r, http.StatusUnsupportedMediaType, ErrUnsupportedMedia, "", fmt.Sprintf("content type %q is not supported: it must be %s", contentType, NDJSONContentType))
+			return
+		}
+	}
+	if r.Body == nil {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "", "request body is empty")
+		return
+	}
+	tooLarge := fmt.Sprintf("request body must have at most %d bytes", MaxImportSize)
+	if r.ContentLength > MaxImportSize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, ErrBodyTooLarge, "", tooLarge)
+		return
+	}
+	body := &countingReader{Reader: io.LimitReader(r.Body, MaxImportSize+1)}
+
+	snapshot, err := store.ReadExport(body)
+	if body.read > MaxImportSize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, ErrBodyTooLarge, "", tooLarge)
+		return
+	}
+	if errors.Is(err, store.ErrInvalidExport) {
+		writeError(w, r, http.StatusBadRequest, err, "", err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "", fmt.Sprintf("error reading body: %v", err))
+		return
+	}
+
+	result, err := store.Import(r.Context(), s.accountStore, s.transferStore, snapshot, mode)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "", err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusOK, ImportResponse{Mode: mode, ImportResult: result})
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.Reader
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
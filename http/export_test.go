@@ -0,0 +1,110 @@
+package http
+
+import (
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/audit"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	newServer := func(accounts ...app.Account) (*Server, *audit.Log) {
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_admin", Role: auth.RoleAdmin}, "admin-secret")
+		keys.Import(auth.APIKey{ID: "key_operator", Role: auth.RoleOperator}, "operator-secret")
+		log := audit.NewLog()
+		server := NewServer(store.NewAccountStore(app.StartingID(len(accounts)), accounts...), store.NewTransferStore(app.StartingID(0)),
+			WithAPIKeys(keys),
+			WithAuditLog(log),
+		)
+		return server, log
+	}
+	do := func(server *Server, method, path, key, contentType, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set(APIKeyHeader, key)
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+	const admin = "key_admin.admin-secret"
+
+	source, _ := newServer(
+		app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 1000, Secret: "hash-da-roberta"},
+		app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 1000},
+	)
+	response := do(source, http.MethodGet, "/admin/export", admin, "", "")
+	app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+	app.AssertString(t, response.Header().Get("content-type"), NDJSONContentType)
+	export := response.Body.String()
+
+	t.Run("should import an export in another bank", func(t *testing.T) {
+		server, log := newServer()
+
+		response := do(server, http.MethodPost, "/admin/import", admin, NDJSONContentType, export)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		var got ImportResponse
+		json.NewDecoder(response.Body).Decode(&got)
+		app.AssertString(t, got.Mode, store.ImportMerge)
+		app.AssertUint64(t, uint64(got.Accounts), 2)
+		app.AssertUint64(t, got.AccountMaxID, 2)
+		account, _ := server.accountStore.GetAccount(1)
+		app.AssertString(t, account.Secret, "hash-da-roberta")
+		for _, entry := range log.Entries() {
+			if strings.Contains(string(entry.Payload), "hash-da-roberta") {
+				t.Errorf("got the password hash in the audit log: %s", entry.Payload)
+			}
+		}
+	})
+
+	t.Run("should refuse IDs in use unless replacing", func(t *testing.T) {
+		server, _ := newServer(app.Account{ID: 1, Name: "Ana Lima", CPF: "12345678909"}, app.Account{ID: 2}, app.Account{ID: 3})
+
+		response := do(server, http.MethodPost, "/admin/import", admin, NDJSONContentType, export)
+		assertErrorCode(t, response, http.StatusConflict, "import_conflict", "")
+
+		response = do(server, http.MethodPost, "/admin/import?mode=replace", admin, NDJSONContentType, export)
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		accounts, _ := server.accountStore.ListAllAccounts()
+		app.AssertUint64(t, uint64(len(accounts)), 2)
+		app.AssertString(t, accounts[0].Name, "Roberta Pinheiro Sá")
+		app.AssertUint64(t, server.accountStore.GetMaxID(), 2)
+	})
+
+	t.Run("should refuse invalid imports", func(t *testing.T) {
+		server, _ := newServer()
+		tests := []struct {
+			name        string
+			path        string
+			key         string
+			contentType string
+			body        string
+			status      int
+			code        string
+			field       string
+		}{
+			{"changed", "/admin/import", admin, NDJSONContentType, strings.Replace(export, `"balance":1000`, `"balance":9000`, 1), http.StatusBadRequest, "invalid_export", ""},
+			{"empty", "/admin/import", admin, NDJSONContentType, "", http.StatusBadRequest, "invalid_export", ""},
+			{"in an unknown mode", "/admin/import?mode=append", admin, NDJSONContentType, export, http.StatusBadRequest, "invalid_request", "mode"},
+			{"as JSON", "/admin/import", admin, JsonContentType, export, http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+			{"by an operator", "/admin/import", "key_operator.operator-secret", NDJSONContentType, export, http.StatusForbidden, "insufficient_role", ""},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				response := do(server, http.MethodPost, tt.path, tt.key, tt.contentType, tt.body)
+				assertErrorCode(t, response, tt.status, tt.code, tt.field)
+			})
+		}
+		if accounts, _ := server.accountStore.ListAllAccounts(); len(accounts) > 0 {
+			t.Errorf("got accounts %v imported", accounts)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// HealthCheckTimeout is how long /readyz waits for each check.
+const HealthCheckTimeout = 2 * time.Second
+
+var (
+	ErrDraining     = errors.New("server is shutting down")
+	ErrCheckTimeout = errors.New("check timed out")
+)
+
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+type HealthResponse struct {
+	Status string            `json:"status"`           // ok or unavailable
+	Checks map[string]string `json:"checks,omitempty"` // Outcome of each readiness check
+}
+
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+// WithReadinessCheck adds check to the ones /readyz runs, besides the
+// stores, reporting its outcome under name.
+func WithReadinessCheck(name string, check func() error) Option {
+	return func(s *Server) {
+		s.checks = append(s.checks, readinessCheck{name, check})
+	}
+}
+
+// Drain makes /readyz fail, so that load balancers stop sending requests
+// to the server before it shuts down.
+func (s *Server) Drain() {
+	atomic.StoreInt32(&s.draining, 1)
+	s.drainOnce.Do(func() { close(s.drained) })
+}
+
+// healthHandler tells the server is up on GET /healthz.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, HealthResponse{Status: HealthOK})
+}
+
+// readyHandler tells whether the server can serve requests on GET /readyz,
+// which it cannot while draining or if any store or check fails.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	checks := s.readinessChecks()
+	response := HealthResponse{Status: HealthOK, Checks: make(map[string]string, len(checks))}
+	results := make([]chan error, len(checks))
+	for i, c := range checks {
+		results[i] = runCheck(c.check)
+	}
+	for i, c := range checks {
+		err := <-results[i]
+		if err != nil {
+			response.Status = HealthUnavailable
+			response.Checks[c.name] = err.Error()
+		} else {
+			response.Checks[c.name] = HealthOK
+		}
+	}
+
+	status := http.StatusOK
+	if response.Status != HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, r, status, response)
+}
+
+func (s *Server) readinessChecks() []readinessCheck {
+	checks := []readinessCheck{{"server", func() error {
+		if atomic.LoadInt32(&s.draining) == 1 {
+			return ErrDraining
+		}
+		return nil
+	}}}
+	if s.accountStore != nil {
+		checks = append(checks, readinessCheck{"accounts", s.accountStore.Ping})
+	}
+	if s.transferStore != nil {
+		checks = append(checks, readinessCheck{"transfers", s.transferStore.Ping})
+	}
+	checks = append(checks, s.checks...)
+	sort.SliceStable(checks, func(i, j int) bool { return checks[i].name < checks[j].name })
+	return checks
+}
+
+// runCheck runs check in the background, giving up on it after
+// HealthCheckTimeout, as a store stuck behind its lock never returns.
+func runCheck(check func() error) chan error {
+	result := make(chan error, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- check()
+	}()
+	go func() {
+		select {
+		case err := <-done:
+			result <- err
+		case <-time.After(HealthCheckTimeout):
+			result <- ErrCheckTimeout
+		}
+	}()
+	return result
+}
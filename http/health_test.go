@@ -0,0 +1,64 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	newServer := func(options ...Option) *Server {
+		return NewServer(store.NewAccountStore(app.StartingID(0)), store.NewTransferStore(app.StartingID(0)), options...)
+	}
+
+	get := func(server *Server, path string) (int, HealthResponse) {
+		request, _ := http.NewRequest(http.MethodGet, path, nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		var got HealthResponse
+		json.NewDecoder(response.Body).Decode(&got)
+		return response.Code, got
+	}
+
+	t.Run("should report the server alive on GET /healthz", func(t *testing.T) {
+		status, got := get(newServer(), "/healthz")
+
+		app.AssertHTTPStatus(t, status, http.StatusOK)
+		app.AssertString(t, got.Status, HealthOK)
+	})
+
+	t.Run("should report ready when the stores respond", func(t *testing.T) {
+		status, got := get(newServer(), "/readyz")
+
+		app.AssertHTTPStatus(t, status, http.StatusOK)
+		app.AssertString(t, got.Status, HealthOK)
+		app.AssertString(t, got.Checks["accounts"], HealthOK)
+		app.AssertString(t, got.Checks["transfers"], HealthOK)
+	})
+
+	t.Run("should report unavailable when a check fails", func(t *testing.T) {
+		server := newServer(WithReadinessCheck("snapshot", func() error { return errors.New("disk full") }))
+
+		status, got := get(server, "/readyz")
+
+		app.AssertHTTPStatus(t, status, http.StatusServiceUnavailable)
+		app.AssertString(t, got.Status, HealthUnavailable)
+		app.AssertString(t, got.Checks["snapshot"], "disk full")
+	})
+
+	t.Run("should report unavailable while draining but stay alive", func(t *testing.T) {
+		server := newServer()
+		server.Drain()
+
+		status, got := get(server, "/readyz")
+		app.AssertHTTPStatus(t, status, http.StatusServiceUnavailable)
+		app.AssertString(t, got.Checks["server"], ErrDraining.Error())
+
+		status, _ = get(server, "/healthz")
+		app.AssertHTTPStatus(t, status, http.StatusOK)
+	})
+}
@@ -0,0 +1,172 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader lets clients retry a POST safely: requests with
+	// the same key get the response of the first one instead of running
+	// again.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// ReplayedHeader is set on responses replayed for an idempotency key.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// IdempotencyKeyTTL is how long the response to a key is kept.
+	IdempotencyKeyTTL = 24 * time.Hour
+
+	// MaxIdempotencyKeyLength is the longest idempotency key accepted.
+	MaxIdempotencyKeyLength = 255
+)
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused: it was sent with a different request")
+
+// idempotentResponse is the response to the first request sent with an
+// idempotency key. done is closed once the response is known; until then,
+// requests with the same key wait for it.
+type idempotentResponse struct {
+	fingerprint [sha256.Size]byte
+	done        chan struct{}
+	stored      bool
+	status      int
+	header      http.Header
+	body        []byte
+	expiresAt   time.Time
+}
+
+// idempotencyCache keeps the responses to requests sent with idempotency
+// keys, by client and key.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+	prunedAt  time.Time
+	now       func() time.Time
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{responses: make(map[string]*idempotentResponse), now: time.Now}
+}
+
+// claim returns the response kept for key, or a new one for the caller to
+// fill when there is none, along with whether it is new.
+func (c *idempotencyCache) claim(key string, fingerprint [sha256.Size]byte) (*idempotentResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.prunedAt) > time.Minute {
+		for k, response := range c.responses {
+			if response.stored && now.After(response.expiresAt) {
+				delete(c.responses, k)
+			}
+		}
+		c.prunedAt = now
+	}
+	if response, ok := c.responses[key]; ok && !(response.stored && now.After(response.expiresAt)) {
+		return response, false
+	}
+	response := &idempotentResponse{fingerprint: fingerprint, done: make(chan struct{})}
+	c.responses[key] = response
+	return response, true
+}
+
+// finish keeps the response to key, or forgets key when the response is not
+// worth replaying, so that a retry runs again.
+func (c *idempotencyCache) finish(key string, response *idempotentResponse, recorder *responseRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if recorder.status >= http.StatusInternalServerError || recorder.status == http.StatusTooManyRequests {
+		delete(c.responses, key)
+	} else {
+		response.stored = true
+		response.status = recorder.status
+		response.header = recorder.Header().Clone()
+		response.body = recorder.body.Bytes()
+		response.expiresAt = c.now().Add(IdempotencyKeyTTL)
+	}
+	close(response.done)
+}
+
+// responseRecorder keeps a copy of the status and body written by a
+// handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotencyMiddleware replays the response to the first POST sent by a
+// client with an idempotency key to every later POST with the same key, so
+// that retrying a transfer whose response was lost does not make it twice.
+// Reusing a key for a different request is refused.
+func (s *Server) idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+		if r.Method != http.MethodPost || idempotencyKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(idempotencyKey) > MaxIdempotencyKeyLength {
+			writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, IdempotencyKeyHeader, fmt.Sprintf("idempotency key must have at most %d characters", MaxIdempotencyKeyLength))
+			return
+		}
+
+		body, err := peekBody(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "", fmt.Sprintf("error reading body: %v", err))
+			return
+		}
+		fingerprint := sha256.Sum256(append([]byte(r.URL.Path+"\n"), body...))
+		key := clientID(r) + " " + idempotencyKey
+
+		for {
+			response, isNew := s.idempotency.claim(key, fingerprint)
+			if response.fingerprint != fingerprint {
+				writeError(w, r, http.StatusUnprocessableEntity, ErrIdempotencyKeyReused, IdempotencyKeyHeader, fmt.Sprintf("idempotency key %q was already sent with a different request", idempotencyKey))
+				return
+			}
+			if isNew {
+				recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+				next.ServeHTTP(recorder, r)
+				s.idempotency.finish(key, response, recorder)
+				return
+			}
+
+			select {
+			case <-response.done:
+			case <-r.Context().Done():
+				return
+			}
+			if !response.stored {
+				continue
+			}
+			for name, values := range response.header {
+				if name != RequestIDHeader {
+					w.Header()[name] = values
+				}
+			}
+			w.Header().Set(ReplayedHeader, "true")
+			w.WriteHeader(response.status)
+			w.Write(response.body)
+			return
+		}
+	})
+}
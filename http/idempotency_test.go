@@ -0,0 +1,156 @@
+package http
+
+import (
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	newServer := func() (*Server, *store.AccountStore, *store.TransferStore) {
+		accountStore := store.NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 10000},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 0},
+		)
+		transferStore := store.NewTransferStore(app.StartingID(0))
+		return NewServer(accountStore, transferStore), accountStore, transferStore
+	}
+
+	post := func(server *Server, remoteAddr, key, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(body))
+		request.RemoteAddr = remoteAddr
+		if key != "" {
+			request.Header.Set(IdempotencyKeyHeader, key)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+	const transfer = `{"account_origin_id":1,"account_destination_id":2,"amount":100}`
+
+	t.Run("should replay the response to a retried request", func(t *testing.T) {
+		server, accountStore, transferStore := newServer()
+
+		first := post(server, "10.0.0.7:51000", "chave-1", transfer)
+		retry := post(server, "10.0.0.7:51000", "chave-1", transfer)
+
+		app.AssertHTTPStatus(t, first.Code, http.StatusCreated)
+		app.AssertHTTPStatus(t, retry.Code, http.StatusCreated)
+		app.AssertString(t, retry.Body.String(), first.Body.String())
+		app.AssertString(t, retry.Header().Get("Location"), "/transfers/1")
+		app.AssertString(t, retry.Header().Get(ReplayedHeader), "true")
+		app.AssertString(t, first.Header().Get(ReplayedHeader), "")
+		transfers, _ := transferStore.ListAllTransfers()
+		app.AssertUint64(t, uint64(len(transfers)), 1)
+		balance, _ := accountStore.GetBalance(2)
+		app.AssertUint64(t, balance, 100)
+	})
+
+	t.Run("should replay errors too", func(t *testing.T) {
+		server, _, _ := newServer()
+		body := `{"account_origin_id":1,"account_destination_id":2,"amount":20000}`
+
+		first := post(server, "10.0.0.7:51000", "chave-1", body)
+		retry := post(server, "10.0.0.7:51000", "chave-1", body)
+
+		app.AssertHTTPStatus(t, first.Code, http.StatusUnprocessableEntity)
+		app.AssertHTTPStatus(t, retry.Code, http.StatusUnprocessableEntity)
+		app.AssertString(t, retry.Header().Get(ReplayedHeader), "true")
+	})
+
+	t.Run("should refuse a key reused for a different request", func(t *testing.T) {
+		server, _, _ := newServer()
+		post(server, "10.0.0.7:51000", "chave-1", transfer)
+
+		response := post(server, "10.0.0.7:51000", "chave-1", `{"account_origin_id":1,"account_destination_id":2,"amount":200}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnprocessableEntity)
+		var got ErrorResponse
+		json.NewDecoder(response.Body).Decode(&got)
+		app.AssertString(t, got.Code, "idempotency_key_reused")
+		app.AssertString(t, got.Field, IdempotencyKeyHeader)
+	})
+
+	t.Run("should keep the keys of each client apart", func(t *testing.T) {
+		server, _, transferStore := newServer()
+
+		post(server, "10.0.0.7:51000", "chave-1", transfer)
+		response := post(server, "10.0.0.8:51000", "chave-1", transfer)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusConflict)
+		transfers, _ := transferStore.ListAllTransfers()
+		app.AssertUint64(t, uint64(len(transfers)), 2)
+	})
+
+	t.Run("should run requests without a key every time", func(t *testing.T) {
+		server, _, _ := newServer()
+
+		post(server, "10.0.0.7:51000", "", transfer)
+		response := post(server, "10.0.0.7:51000", "", transfer)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusConflict)
+	})
+
+	t.Run("should refuse keys that are too long", func(t *testing.T) {
+		server, _, _ := newServer()
+
+		response := post(server, "10.0.0.7:51000", strings.Repeat("a", MaxIdempotencyKeyLength+1), transfer)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("should make concurrent requests with the same key once", func(t *testing.T) {
+		server, _, transferStore := newServer()
+
+		var wg sync.WaitGroup
+		statuses := make([]int, 10)
+		for i := range statuses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				statuses[i] = post(server, "10.0.0.7:51000", "chave-1", transfer).Code
+			}(i)
+		}
+		wg.Wait()
+
+		for _, status := range statuses {
+			app.AssertHTTPStatus(t, status, http.StatusCreated)
+		}
+		transfers, _ := transferStore.ListAllTransfers()
+		app.AssertUint64(t, uint64(len(transfers)), 1)
+	})
+
+	t.Run("should forget keys after a while", func(t *testing.T) {
+		server, _, _ := newServer()
+		now := time.Now()
+		server.idempotency.now = func() time.Time { return now }
+		post(server, "10.0.0.7:51000", "chave-1", transfer)
+
+		now = now.Add(IdempotencyKeyTTL + time.Second)
+		response := post(server, "10.0.0.7:51000", "chave-1", transfer)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusConflict)
+		app.AssertString(t, response.Header().Get(ReplayedHeader), "")
+	})
+
+	t.Run("should not keep responses worth retrying", func(t *testing.T) {
+		cache := newIdempotencyCache()
+		var fingerprint [32]byte
+		for _, status := range []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+			response, _ := cache.claim("chave-1", fingerprint)
+			cache.finish("chave-1", response, &responseRecorder{ResponseWriter: httptest.NewRecorder(), status: status})
+
+			_, isNew := cache.claim("chave-1", fingerprint)
+			if !isNew {
+				t.Errorf("got the response with status %d kept; want it forgotten", status)
+			}
+			delete(cache.responses, "chave-1")
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithLogger logs one line per request on l, along with whatever is logged
+// while serving it, all tagged with the request ID. Without it, the default
+// logger is used.
+func WithLogger(l *logging.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// requestLog collects what the access log line and the audit entry of a
+// request tell beyond what the request itself does: the route it matched,
+// the accounts involved and who made it.
+type requestLog struct {
+	mu       sync.Mutex
+	route    string
+	accounts []uint64
+	actor    string
+}
+
+type requestLogKey struct{}
+
+// accessLog adds a logger tagged with the request ID to the request context
+// and logs the request once it is served.
+func (s *Server) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &requestLog{accounts: []uint64{}}
+		logger := s.logger.With("request_id", r.Header.Get(RequestIDHeader))
+		ctx := logging.NewContext(r.Context(), logger)
+		ctx = context.WithValue(ctx, requestLogKey{}, entry)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		latency := time.Since(start)
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		logger.Info("request",
+			"method", r.Method,
+			"route", entry.route,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"latency_ms", float64(latency.Microseconds())/1000,
+			"accounts", entry.accounts,
+		)
+		s.observeRequest(r.Method, entry.route, recorder.status, latency.Seconds())
+	})
+}
+
+// matchedRoute notes the path template of the route a request matched, so
+// that requests to the same route are logged alike.
+func matchedRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if entry, ok := r.Context().Value(requestLogKey{}).(*requestLog); ok {
+			if route := mux.CurrentRoute(r); route != nil {
+				template, _ := route.GetPathTemplate()
+				entry.mu.Lock()
+				entry.route = template
+				entry.mu.Unlock()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// noteAccounts adds the IDs of accounts a request involves to its access
+// log line.
+func noteAccounts(r *http.Request, IDs ...uint64) {
+	entry, ok := r.Context().Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	for _, ID := range IDs {
+		if !containsID(entry.accounts, ID) {
+			entry.accounts = append(entry.accounts, ID)
+		}
+	}
+}
+
+// noteActor records who made a request, once its credentials are checked.
+func noteActor(r *http.Request, actor string) {
+	entry, ok := r.Context().Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	entry.actor = actor
+}
+
+func containsID(IDs []uint64, ID uint64) bool {
+	for _, id := range IDs {
+		if id == ID {
+			return true
+		}
+	}
+	return false
+}
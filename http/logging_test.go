@@ -0,0 +1,100 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	newServer := func(level logging.Level) (*Server, *bytes.Buffer) {
+		var out bytes.Buffer
+		accountStore := store.NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 1000},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 0},
+		)
+		server := NewServer(accountStore, store.NewTransferStore(app.StartingID(0)), WithLogger(logging.New(&out, level)))
+		return server, &out
+	}
+
+	lines := func(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+		t.Helper()
+		var got []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var fields map[string]interface{}
+			err := json.Unmarshal([]byte(line), &fields)
+			if err != nil {
+				t.Fatalf("log line %q is not JSON: %v", line, err)
+			}
+			got = append(got, fields)
+		}
+		return got
+	}
+
+	t.Run("should log one line per request with route, status and accounts", func(t *testing.T) {
+		server, out := newServer(logging.LevelInfo)
+
+		request, _ := http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(`{"account_origin_id":1,"account_destination_id":2,"amount":300}`))
+		request.Header.Set(RequestIDHeader, "req-1")
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		got := lines(t, out)
+		if len(got) != 1 {
+			t.Fatalf("got %d log lines; want 1: %s", len(got), out)
+		}
+		line := got[0]
+		app.AssertString(t, line["msg"].(string), "request")
+		app.AssertString(t, line["request_id"].(string), "req-1")
+		app.AssertString(t, line["method"].(string), http.MethodPost)
+		app.AssertString(t, line["route"].(string), "/transfers")
+		if line["status"] != float64(http.StatusCreated) {
+			t.Errorf("got status %v; want %d", line["status"], http.StatusCreated)
+		}
+		if _, ok := line["latency_ms"].(float64); !ok {
+			t.Errorf("got latency_ms %v; want a number", line["latency_ms"])
+		}
+		accounts, _ := json.Marshal(line["accounts"])
+		app.AssertString(t, string(accounts), "[1,2]")
+	})
+
+	t.Run("should log the path template rather than the path", func(t *testing.T) {
+		server, out := newServer(logging.LevelInfo)
+
+		request, _ := http.NewRequest(http.MethodGet, "/accounts/2/balance", nil)
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		got := lines(t, out)
+		app.AssertString(t, got[len(got)-1]["route"].(string), "/accounts/{account_id}/balance")
+	})
+
+	t.Run("should tag errors and store changes with the request ID", func(t *testing.T) {
+		server, out := newServer(logging.LevelDebug)
+
+		request, _ := http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(`{"account_origin_id":2,"account_destination_id":1,"amount":300}`))
+		request.Header.Set(RequestIDHeader, "req-2")
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		got := lines(t, out)
+		var sawStoreChange, sawError bool
+		for _, line := range got {
+			if line["request_id"] != "req-2" {
+				t.Errorf("got line without the request ID: %v", line)
+			}
+			if line["action"] == "transfer.status" {
+				sawStoreChange = true
+			}
+			if line["code"] == "insufficient_balance" {
+				sawError = true
+			}
+		}
+		if !sawStoreChange || !sawError {
+			t.Errorf("got lines %v; want store changes and the error response", got)
+		}
+	})
+}
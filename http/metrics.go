@@ -0,0 +1,82 @@
+package http
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/metrics"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WithMetrics counts requests and their latencies per route on registry and
+// serves everything registered on it under /metrics, in the Prometheus text
+// format.
+func WithMetrics(registry *metrics.Registry) Option {
+	return func(s *Server) {
+		s.metrics = registry
+		s.requests = registry.NewCounter("http_requests_total", "HTTP requests served, by method, route and status.", "method", "route", "status")
+		s.latencies = registry.NewHistogram("http_request_duration_seconds", "Time taken to serve HTTP requests, by method and route.", metrics.DefaultBuckets, "method", "route")
+	}
+}
+
+// WithMetricsToken lets GET /metrics be called with the header
+// Authorization: Bearer <token>, which is how Prometheus authenticates the
+// scrapes of a job with an authorization setting. API keys are still
+// accepted.
+func WithMetricsToken(token string) Option {
+	return func(s *Server) {
+		s.metricsToken = token
+	}
+}
+
+// metricsAuth allows requests to /metrics that carry the metrics token and
+// leaves the others to keyOnly. Without API keys, the token is required.
+func (s *Server) metricsAuth(handler http.HandlerFunc) http.HandlerFunc {
+	keyed := s.keyOnly(handler, auth.RoleReadOnly)
+	if s.metricsToken == "" {
+		return keyed
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.hasMetricsToken(r) {
+			handler(w, r)
+			return
+		}
+		if s.keys != nil {
+			keyed(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		writeError(w, r, http.StatusUnauthorized, ErrUnauthenticated, "", fmt.Sprintf("%s requires the metrics token", r.URL.Path))
+	}
+}
+
+// hasMetricsToken tells whether the request carries the metrics token as a
+// bearer token.
+func (s *Server) hasMetricsToken(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(header, "Bearer ")
+	return s.metricsToken != "" && token != header && subtle.ConstantTimeCompare([]byte(token), []byte(s.metricsToken)) == 1
+}
+
+// observeRequest counts a served request. Requests that matched no route are
+// counted together, so that unknown paths cannot grow the number of series.
+func (s *Server) observeRequest(method, route string, status int, seconds float64) {
+	if route == "" {
+		route = "unmatched"
+	}
+	s.requests.Inc(method, route, strconv.Itoa(status))
+	s.latencies.Observe(seconds, method, route)
+}
+
+// metricsHandler writes all metrics on GET /metrics.
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	w.Header().Set("content-type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	s.metrics.Write(w)
+}
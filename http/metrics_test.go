@@ -0,0 +1,126 @@
+package http
+
+import (
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/metrics"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	newServer := func() *Server {
+		registry := metrics.NewRegistry()
+		accountStore := store.NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 1000, Type: store.AccountTypeChecking},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 500, Type: store.AccountTypeSavings},
+		)
+		transferStore := store.NewTransferStore(app.StartingID(0))
+		accountStore.SetMetrics(registry)
+		transferStore.SetMetrics(registry)
+		return NewServer(accountStore, transferStore, WithMetrics(registry))
+	}
+
+	transfer := func(server *Server, body string) {
+		request, _ := http.NewRequest(http.MethodPost, "/transfers", strings.NewReader(body))
+		server.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	t.Run("should expose requests, transfers and account gauges", func(t *testing.T) {
+		server := newServer()
+		transfer(server, `{"account_origin_id":1,"account_destination_id":2,"amount":300}`)
+		transfer(server, `{"account_origin_id":1,"account_destination_id":2,"amount":300}`)
+		transfer(server, `{"account_origin_id":2,"account_destination_id":1,"amount":5000}`)
+
+		request, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		app.AssertString(t, response.Header().Get("content-type"), metrics.ContentType)
+		body := response.Body.String()
+		for _, want := range []string{
+			`http_requests_total{method="POST",route="/transfers",status="201"} 1`,
+			`http_requests_total{method="POST",route="/transfers",status="409"} 1`,
+			`http_requests_total{method="POST",route="/transfers",status="422"} 1`,
+			`http_request_duration_seconds_count{method="POST",route="/transfers"} 3`,
+			`bank_transfers_total{kind="transfer",status="Confirmed",reason=""} 1`,
+			`bank_transfers_total{kind="transfer",status="Not Authorized",reason="duplicate_transfer"} 1`,
+			`bank_transfers_total{kind="transfer",status="Not Authorized",reason="insufficient_balance"} 1`,
+			`bank_duplicate_transfers_detected_total 1`,
+			`bank_accounts{type="checking"} 1`,
+			`bank_balance_cents{type="checking"} 700`,
+			`bank_balance_cents{type="savings"} 800`,
+		} {
+			if !strings.Contains(body, want+"\n") {
+				t.Errorf("got metrics without %q:\n%s", want, body)
+			}
+		}
+	})
+
+	t.Run("should count requests to unknown paths together", func(t *testing.T) {
+		server := newServer()
+
+		request, _ := http.NewRequest(http.MethodGet, "/nothing/here", nil)
+		server.ServeHTTP(httptest.NewRecorder(), request)
+		request, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		want := `http_requests_total{method="GET",route="unmatched",status="404"} 1`
+		if !strings.Contains(response.Body.String(), want) {
+			t.Errorf("got metrics without %q:\n%s", want, response.Body)
+		}
+	})
+
+	t.Run("should require an API key when there are keys", func(t *testing.T) {
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_monitoring", Role: auth.RoleReadOnly}, "segredo")
+		server := NewServer(store.NewAccountStore(app.StartingID(0)), store.NewTransferStore(app.StartingID(0)), WithMetrics(metrics.NewRegistry()), WithAPIKeys(keys))
+
+		request, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertErrorCode(t, response, http.StatusUnauthorized, "api_key_required", "")
+
+		request.Header.Set(APIKeyHeader, "key_monitoring.segredo")
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("should accept the metrics token as a bearer token", func(t *testing.T) {
+		keys := auth.NewKeyStore()
+		server := NewServer(store.NewAccountStore(app.StartingID(0)), store.NewTransferStore(app.StartingID(0)),
+			WithMetrics(metrics.NewRegistry()),
+			WithMetricsToken("token-do-prometheus"),
+			WithAPIKeys(keys),
+			WithAuth(auth.NewIssuer([]byte("chave-de-teste"), time.Hour)),
+		)
+
+		request, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+		request.Header.Set("Authorization", "Bearer token-do-prometheus")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+
+		request.Header.Set("Authorization", "Bearer outro-token")
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("should require the metrics token when there are no keys", func(t *testing.T) {
+		server := NewServer(store.NewAccountStore(app.StartingID(0)), store.NewTransferStore(app.StartingID(0)), WithMetrics(metrics.NewRegistry()), WithMetricsToken("token-do-prometheus"))
+
+		request, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertErrorCode(t, response, http.StatusUnauthorized, "unauthenticated", "")
+		app.AssertString(t, response.Header().Get("WWW-Authenticate"), `Bearer realm="metrics"`)
+	})
+}
@@ -0,0 +1,3329 @@
+package http
+
+import (
+	"net/http"
+)
+
+// openAPISpec describes every route of the API. The tests check the
+// responses of the handlers and the request and response types against it,
+// so it must change along with them.
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Stone Challenge Bank API",
+    "version": "1.0.0",
+    "description": "Accounts and transfers between them. Amounts are in cents. Every error response is an ErrorResponse."
+  },
+  "servers": [
+    {
+      "url": "http://localhost:3000"
+    }
+  ],
+  "security": [
+    {
+      "bearerAuth": []
+    },
+    {
+      "apiKey": []
+    },
+    {}
+  ],
+  "paths": {
+    "/accounts": {
+      "get": {
+        "summary": "List accounts",
+        "tags": [
+          "accounts"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/Account"
+                  }
+                }
+              }
+            },
+            "description": "Accounts sorted by ID; customers only get their own",
+            "headers": {
+              "Link": {
+                "description": "Link to the next page, with rel=\"next\", when there are more items",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "limit",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "minimum": 1,
+              "maximum": 1000
+            },
+            "description": "Largest number of items to return; every item is returned when it is not sent"
+          },
+          {
+            "name": "after",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Only return items whose ID is greater than this one"
+          }
+        ]
+      },
+      "post": {
+        "summary": "Open an account",
+        "tags": [
+          "accounts"
+        ],
+        "responses": {
+          "201": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/CreateAccountResponse"
+                }
+              }
+            },
+            "description": "The account was opened"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "422": {
+            "$ref": "#/components/responses/Unprocessable"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "maxLength": 255
+            },
+            "description": "Requests sent again with the same key get the response of the first one, with the Idempotent-Replayed header, instead of running again"
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/CreateAccountRequest"
+              }
+            }
+          }
+        },
+        "security": []
+      }
+    },
+    "/accounts/{account_id}/balance": {
+      "get": {
+        "summary": "Get the balance of an account",
+        "tags": [
+          "accounts"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/GetBalanceResponse"
+                }
+              }
+            },
+            "description": "Balance of the account"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "account_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Account ID"
+          }
+        ]
+      }
+    },
+    "/accounts/{account_id}/statement": {
+      "get": {
+        "summary": "Get the statement of an account",
+        "tags": [
+          "accounts"
+        ],
+        "responses": {
+          "200": {
+            "description": "The balance changes of the account in the period. CSV has a header, a row with the opening balance, one row per change and a row with the closing balance; OFX is a 1.0.2 bank statement whose ledger balance is the closing balance",
+            "content": {
+              "text/csv": {
+                "schema": {
+                  "type": "string"
+                }
+              },
+              "application/x-ofx": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "account_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Account ID"
+          },
+          {
+            "name": "format",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "enum": [
+                "csv",
+                "ofx"
+              ],
+              "default": "csv"
+            },
+            "description": "csv for spreadsheets; ofx for personal finance software"
+          },
+          {
+            "name": "from",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "format": "date"
+            },
+            "description": "First day of the period, in UTC; the first day of the current month by default"
+          },
+          {
+            "name": "to",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "format": "date"
+            },
+            "description": "Last day of the period, in UTC; today by default"
+          },
+          {
+            "name": "delimiter",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "minLength": 1,
+              "maxLength": 1,
+              "default": ";"
+            },
+            "description": "Character separating CSV fields"
+          },
+          {
+            "name": "decimal",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "enum": [
+                ",",
+                "."
+              ],
+              "default": ","
+            },
+            "description": "Character separating reais from cents in CSV amounts"
+          }
+        ]
+      }
+    },
+    "/accounts/{account_id}/keys": {
+      "get": {
+        "summary": "List the addressing keys of an account",
+        "tags": [
+          "keys"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/AddressingKey"
+                  }
+                }
+              }
+            },
+            "description": "Keys of the account"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "account_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Account ID"
+          }
+        ]
+      },
+      "post": {
+        "summary": "Register an addressing key for an account",
+        "tags": [
+          "keys"
+        ],
+        "responses": {
+          "201": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/AddressingKey"
+                }
+              }
+            },
+            "description": "The key was registered",
+            "headers": {
+              "Location": {
+                "description": "Path of the key",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "422": {
+            "$ref": "#/components/responses/Unprocessable"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "account_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Account ID"
+          },
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "maxLength": 255
+            },
+            "description": "Requests sent again with the same key get the response of the first one, with the Idempotent-Replayed header, instead of running again"
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/RegisterKeyRequest"
+              }
+            }
+          }
+        }
+      }
+    },
+    "/accounts/{account_id}/keys/{key}": {
+      "delete": {
+        "summary": "Remove an addressing key of an account",
+        "tags": [
+          "keys"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/AddressingKey"
+                }
+              }
+            },
+            "description": "The key was removed"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "account_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Account ID"
+          },
+          {
+            "name": "key",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            },
+            "description": "Addressing key; CPFs and CNPJs may have punctuation and emails and random keys any case"
+          }
+        ]
+      }
+    },
+    "/keys/{key}": {
+      "get": {
+        "summary": "Look up who an addressing key belongs to",
+        "tags": [
+          "keys"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/KeyLookupResponse"
+                }
+              }
+            },
+            "description": "The holder of the key, masked"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "key",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            },
+            "description": "Addressing key; CPFs and CNPJs may have punctuation and emails and random keys any case"
+          }
+        ]
+      }
+    },
+    "/accounts/{account_id}/charges": {
+      "get": {
+        "summary": "List the dynamic charges of an account",
+        "tags": [
+          "charges"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/Charge"
+                  }
+                }
+              }
+            },
+            "description": "Dynamic charges issued by the account, oldest first"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "account_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Account ID"
+          }
+        ]
+      },
+      "post": {
+        "summary": "Issue a BR Code charge to an addressing key of an account",
+        "tags": [
+          "charges"
+        ],
+        "responses": {
+          "201": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ChargeResponse"
+                }
+              }
+            },
+            "description": "The charge and its BR Code"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "422": {
+            "$ref": "#/components/responses/Unprocessable"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "account_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Account ID"
+          },
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "maxLength": 255
+            },
+            "description": "Requests sent again with the same key get the response of the first one, with the Idempotent-Replayed header, instead of running again"
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/CreateChargeRequest"
+              }
+            }
+          }
+        }
+      }
+    },
+    "/accounts/{account_id}/totp": {
+      "post": {
+        "summary": "Enroll a TOTP secret for an account",
+        "tags": [
+          "step-up"
+        ],
+        "responses": {
+          "201": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/EnrollTOTPResponse"
+                }
+              }
+            },
+            "description": "The secret to be activated"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "account_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Account ID"
+          }
+        ]
+      }
+    },
+    "/accounts/{account_id}/totp/activate": {
+      "post": {
+        "summary": "Activate the TOTP secret of an account",
+        "tags": [
+          "step-up"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/TOTPStatusResponse"
+                }
+              }
+            },
+            "description": "TOTP is enabled"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "account_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Account ID"
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/TOTPCodeRequest"
+              }
+            }
+          }
+        }
+      }
+    },
+    "/transfers": {
+      "get": {
+        "summary": "List transfers",
+        "tags": [
+          "transfers"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/Transfer"
+                  }
+                }
+              }
+            },
+            "description": "Transfers sorted by ID; customers only get the ones to or from their accounts",
+            "headers": {
+              "Link": {
+                "description": "Link to the next page, with rel=\"next\", when there are more items",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "limit",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "minimum": 1,
+              "maximum": 1000
+            },
+            "description": "Largest number of items to return; every item is returned when it is not sent"
+          },
+          {
+            "name": "after",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Only return items whose ID is greater than this one"
+          }
+        ]
+      },
+      "post": {
+        "summary": "Transfer between accounts",
+        "tags": [
+          "transfers"
+        ],
+        "responses": {
+          "201": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/CreateTransferResponse"
+                }
+              }
+            },
+            "description": "The transfer was confirmed"
+          },
+          "202": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/CreateTransferResponse"
+                }
+              }
+            },
+            "description": "The transfer waits for a TOTP confirmation"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "422": {
+            "$ref": "#/components/responses/Unprocessable"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "maxLength": 255
+            },
+            "description": "Requests sent again with the same key get the response of the first one, with the Idempotent-Replayed header, instead of running again"
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/CreateTransferRequest"
+              }
+            }
+          }
+        }
+      }
+    },
+    "/transfers/split": {
+      "post": {
+        "summary": "Split an amount among accounts",
+        "tags": [
+          "transfers"
+        ],
+        "responses": {
+          "201": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/CreateSplitTransferResponse"
+                }
+              }
+            },
+            "description": "Every leg of the split was confirmed"
+          },
+          "202": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/CreateSplitTransferResponse"
+                }
+              }
+            },
+            "description": "The split waits for a TOTP confirmation"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "422": {
+            "$ref": "#/components/responses/Unprocessable"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "maxLength": 255
+            },
+            "description": "Requests sent again with the same key get the response of the first one, with the Idempotent-Replayed header, instead of running again"
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/CreateSplitTransferRequest"
+              }
+            }
+          }
+        }
+      }
+    },
+    "/transfers/brcode": {
+      "post": {
+        "summary": "Pay a BR Code",
+        "tags": [
+          "charges"
+        ],
+        "responses": {
+          "201": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/CreateTransferResponse"
+                }
+              }
+            },
+            "description": "The transfer was confirmed"
+          },
+          "202": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/CreateTransferResponse"
+                }
+              }
+            },
+            "description": "The transfer waits for a TOTP confirmation"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "422": {
+            "$ref": "#/components/responses/Unprocessable"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "maxLength": 255
+            },
+            "description": "Requests sent again with the same key get the response of the first one, with the Idempotent-Replayed header, instead of running again"
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/PayBRCodeRequest"
+              }
+            }
+          }
+        }
+      }
+    },
+    "/transfers/{transfer_id}": {
+      "get": {
+        "summary": "Get a transfer",
+        "tags": [
+          "transfers"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Transfer"
+                }
+              }
+            },
+            "description": "The transfer"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "transfer_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Transfer ID"
+          }
+        ]
+      }
+    },
+    "/transfers/{transfer_id}/confirm": {
+      "post": {
+        "summary": "Confirm a transfer with a TOTP code",
+        "tags": [
+          "step-up"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Transfer"
+                }
+              }
+            },
+            "description": "The transfer, confirmed or refused by the bank rules"
+          },
+          "410": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            },
+            "description": "The confirmation expired"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "422": {
+            "$ref": "#/components/responses/Unprocessable"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "transfer_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Transfer ID"
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/TOTPCodeRequest"
+              }
+            }
+          }
+        }
+      }
+    },
+    "/login": {
+      "post": {
+        "summary": "Get a token for a customer",
+        "tags": [
+          "auth"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/LoginResponse"
+                }
+              }
+            },
+            "description": "A bearer token"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/LoginRequest"
+              }
+            }
+          }
+        },
+        "security": []
+      }
+    },
+    "/admin/keys": {
+      "get": {
+        "summary": "List API keys",
+        "tags": [
+          "admin"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/APIKey"
+                  }
+                }
+              }
+            },
+            "description": "Every API key, without secrets"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      },
+      "post": {
+        "summary": "Create an API key",
+        "tags": [
+          "admin"
+        ],
+        "responses": {
+          "201": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/APIKey"
+                }
+              }
+            },
+            "description": "The key, with its secret"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/CreateAPIKeyRequest"
+              }
+            }
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      }
+    },
+    "/admin/keys/{key_id}": {
+      "delete": {
+        "summary": "Revoke an API key",
+        "tags": [
+          "admin"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/APIKey"
+                }
+              }
+            },
+            "description": "The revoked key"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "key_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            },
+            "description": "API key ID"
+          }
+        ],
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      }
+    },
+    "/admin/keys/{key_id}/rotate": {
+      "post": {
+        "summary": "Give an API key a new secret",
+        "tags": [
+          "admin"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/APIKey"
+                }
+              }
+            },
+            "description": "The key, with its new secret"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "key_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            },
+            "description": "API key ID"
+          }
+        ],
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      }
+    },
+    "/admin/export": {
+      "get": {
+        "summary": "Export every account and transfer",
+        "tags": [
+          "admin"
+        ],
+        "responses": {
+          "200": {
+            "description": "NDJSON: a header line with the format version, the last IDs given and how many accounts and transfers follow, then one line per account, with its password hash and TOTP secret, and per transfer, and last the SHA-256 of every line before it",
+            "content": {
+              "application/x-ndjson": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      }
+    },
+    "/admin/import": {
+      "post": {
+        "summary": "Import an export",
+        "tags": [
+          "admin"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ImportResponse"
+                }
+              }
+            },
+            "description": "The accounts and transfers were imported"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "mode",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "enum": [
+                "merge",
+                "replace"
+              ],
+              "default": "merge"
+            },
+            "description": "merge refuses an export with IDs already in use; replace drops every account and transfer first, but the export must keep the bank-owned accounts under the same IDs and names"
+          }
+        ],
+        "security": [
+          {
+            "apiKey": []
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-ndjson": {
+              "schema": {
+                "type": "string"
+              }
+            }
+          },
+          "description": "An export from GET /admin/export"
+        }
+      }
+    },
+    "/batches/cnab240": {
+      "post": {
+        "summary": "Pay a CNAB 240 remessa",
+        "tags": [
+          "transfers"
+        ],
+        "responses": {
+          "200": {
+            "description": "The retorno: the lines of the remessa with the occurrence codes of each batch and payment, and the transfer ID and payment date of each payment",
+            "headers": {
+              "Content-Disposition": {
+                "description": "Suggested file name, retorno-NSA.ret",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            },
+            "content": {
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "maxLength": 255
+            },
+            "description": "Requests sent again with the same key get the response of the first one, with the Idempotent-Replayed header, instead of running again"
+          }
+        ],
+        "security": [
+          {
+            "apiKey": []
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "text/plain": {
+              "schema": {
+                "type": "string"
+              }
+            }
+          },
+          "description": "A FEBRABAN CNAB 240 remessa of credits to accounts, with 240-character lines"
+        }
+      }
+    },
+    "/webhooks": {
+      "get": {
+        "summary": "List webhooks",
+        "tags": [
+          "webhooks"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/Webhook"
+                  }
+                }
+              }
+            },
+            "description": "Every webhook, without secrets"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      },
+      "post": {
+        "summary": "Subscribe a URL to events",
+        "tags": [
+          "webhooks"
+        ],
+        "responses": {
+          "201": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Webhook"
+                }
+              }
+            },
+            "description": "The webhook, with its secret"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/CreateWebhookRequest"
+              }
+            }
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      }
+    },
+    "/webhooks/{webhook_id}": {
+      "get": {
+        "summary": "Get a webhook",
+        "tags": [
+          "webhooks"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Webhook"
+                }
+              }
+            },
+            "description": "The webhook, without its secret"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "webhook_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            },
+            "description": "Webhook ID"
+          }
+        ],
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      },
+      "delete": {
+        "summary": "Remove a webhook and its deliveries",
+        "tags": [
+          "webhooks"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Webhook"
+                }
+              }
+            },
+            "description": "The removed webhook"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "webhook_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            },
+            "description": "Webhook ID"
+          }
+        ],
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      }
+    },
+    "/webhooks/dead-letters": {
+      "get": {
+        "summary": "List the deliveries that ran out of attempts",
+        "tags": [
+          "webhooks"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/WebhookDelivery"
+                  }
+                }
+              }
+            },
+            "description": "Dead letters, oldest first"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      }
+    },
+    "/webhooks/dead-letters/{delivery_id}/redeliver": {
+      "post": {
+        "summary": "Send a dead letter again",
+        "tags": [
+          "webhooks"
+        ],
+        "responses": {
+          "202": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/WebhookDelivery"
+                }
+              }
+            },
+            "description": "The delivery is pending again, with its attempts reset"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "delivery_id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            },
+            "description": "Delivery ID"
+          }
+        ],
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      }
+    },
+    "/events": {
+      "get": {
+        "summary": "Stream bank events as Server-Sent Events",
+        "tags": [
+          "events"
+        ],
+        "responses": {
+          "200": {
+            "description": "An event stream: each message is named after the event type and carries the Event as data; events.lost tells that events could not be resumed",
+            "content": {
+              "text/event-stream": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "503": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            },
+            "description": "Too many event streams are open; see Retry-After"
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "parameters": [
+          {
+            "name": "account_id",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "array",
+              "items": {
+                "type": "integer",
+                "format": "int64",
+                "minimum": 0
+              }
+            },
+            "explode": true,
+            "description": "Only stream events about these accounts"
+          },
+          {
+            "name": "type",
+            "in": "query",
+            "required": false,
+            "schema": {
+              "type": "array",
+              "items": {
+                "type": "string"
+              }
+            },
+            "explode": true,
+            "description": "Only stream events of these types, which may end in * to match a prefix"
+          },
+          {
+            "name": "Last-Event-ID",
+            "in": "header",
+            "required": false,
+            "schema": {
+              "type": "string"
+            },
+            "description": "Resume after the event with this ID"
+          }
+        ]
+      }
+    },
+    "/audit": {
+      "get": {
+        "summary": "List the audit log",
+        "tags": [
+          "audit"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/AuditEntry"
+                  }
+                }
+              }
+            },
+            "description": "Every audit entry, oldest first"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      }
+    },
+    "/audit/verify": {
+      "get": {
+        "summary": "Check the audit log hash chain",
+        "tags": [
+          "audit"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/AuditVerificationResponse"
+                }
+              }
+            },
+            "description": "The log is valid"
+          },
+          "409": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/AuditVerificationResponse"
+                }
+              }
+            },
+            "description": "An entry was edited or removed"
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          }
+        ]
+      }
+    },
+    "/healthz": {
+      "get": {
+        "summary": "Tell whether the server is up",
+        "tags": [
+          "operations"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/HealthResponse"
+                }
+              }
+            },
+            "description": "The server is up"
+          }
+        },
+        "security": []
+      }
+    },
+    "/readyz": {
+      "get": {
+        "summary": "Tell whether the server can serve requests",
+        "tags": [
+          "operations"
+        ],
+        "responses": {
+          "200": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/HealthResponse"
+                }
+              }
+            },
+            "description": "The server is ready"
+          },
+          "503": {
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/HealthResponse"
+                }
+              }
+            },
+            "description": "The server is shutting down or a check failed"
+          }
+        },
+        "security": []
+      }
+    },
+    "/metrics": {
+      "get": {
+        "summary": "Get metrics in the Prometheus text format",
+        "tags": [
+          "operations"
+        ],
+        "responses": {
+          "200": {
+            "description": "Metrics",
+            "content": {
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "429": {
+            "$ref": "#/components/responses/TooManyRequests"
+          }
+        },
+        "security": [
+          {
+            "apiKey": []
+          },
+          {
+            "metricsToken": []
+          }
+        ],
+        "description": "Takes an API key of any role or, for Prometheus, the token of the -metrics-token flag as a bearer token, set as the credentials of the authorization setting of the scrape config"
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "summary": "Get this document",
+        "tags": [
+          "operations"
+        ],
+        "responses": {
+          "200": {
+            "description": "OpenAPI document",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object"
+                }
+              }
+            }
+          }
+        },
+        "security": []
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Account": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "name": {
+            "type": "string"
+          },
+          "cpf": {
+            "type": "string"
+          },
+          "balance": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Balance in cents"
+          },
+          "created_at": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "type": {
+            "type": "string",
+            "enum": [
+              "checking",
+              "business",
+              "savings",
+              "bank"
+            ]
+          },
+          "accrued_interest": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Interest accrued and not paid out yet, in cents"
+          },
+          "totp_enabled": {
+            "type": "boolean"
+          }
+        },
+        "required": [
+          "id",
+          "name",
+          "cpf",
+          "balance",
+          "created_at"
+        ],
+        "additionalProperties": false
+      },
+      "Transfer": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "account_origin_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "account_destination_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "amount": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Amount in cents"
+          },
+          "fee": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Fee charged to the origin account in cents, on top of the amount"
+          },
+          "created_at": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "status": {
+            "type": "string",
+            "enum": [
+              "Created",
+              "Authorizing",
+              "Not Authorized",
+              "Authorized",
+              "Cancelled",
+              "Confirmed",
+              "Pending Confirmation",
+              "Expired"
+            ]
+          },
+          "kind": {
+            "type": "string",
+            "enum": [
+              "transfer",
+              "split",
+              "interest"
+            ]
+          },
+          "split_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "ID of the first transfer of a split, shared by all of its legs"
+          },
+          "expires_at": {
+            "type": "string",
+            "format": "date-time",
+            "description": "When a transfer pending confirmation expires"
+          },
+          "confirmed_at": {
+            "type": "string",
+            "format": "date-time",
+            "description": "When the amount was exchanged; statements date the transfer by it"
+          }
+        },
+        "required": [
+          "id",
+          "account_origin_id",
+          "account_destination_id",
+          "amount",
+          "created_at",
+          "status"
+        ],
+        "additionalProperties": false
+      },
+      "CreateAccountRequest": {
+        "type": "object",
+        "properties": {
+          "name": {
+            "type": "string",
+            "minLength": 1
+          },
+          "cpf": {
+            "type": "string",
+            "pattern": "^\\d{11}$"
+          },
+          "balance": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Initial balance in cents"
+          },
+          "type": {
+            "type": "string",
+            "enum": [
+              "checking",
+              "business",
+              "savings"
+            ],
+            "default": "checking"
+          },
+          "password": {
+            "type": "string",
+            "minLength": 6,
+            "description": "Required when authentication is enabled"
+          }
+        },
+        "required": [
+          "name",
+          "cpf"
+        ],
+        "additionalProperties": false
+      },
+      "CreateAccountResponse": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          }
+        },
+        "required": [
+          "id"
+        ],
+        "additionalProperties": false
+      },
+      "GetBalanceResponse": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "balance": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Balance in cents"
+          },
+          "accrued_interest": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Interest accrued and not paid out yet, in cents"
+          }
+        },
+        "required": [
+          "id",
+          "balance"
+        ],
+        "additionalProperties": false
+      },
+      "CreateTransferRequest": {
+        "type": "object",
+        "properties": {
+          "account_origin_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "account_destination_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "destination_key": {
+            "type": "string",
+            "description": "Addressing key of the destination account, sent instead of account_destination_id"
+          },
+          "amount": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Amount in cents"
+          }
+        },
+        "required": [
+          "account_origin_id",
+          "amount"
+        ],
+        "additionalProperties": false
+      },
+      "CreateTransferResponse": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "status": {
+            "type": "string",
+            "enum": [
+              "Pending Confirmation"
+            ],
+            "description": "Only sent for transfers pending confirmation"
+          },
+          "expires_at": {
+            "type": "string",
+            "format": "date-time",
+            "description": "When the confirmation expires"
+          }
+        },
+        "required": [
+          "id"
+        ],
+        "additionalProperties": false
+      },
+      "SplitShareRequest": {
+        "type": "object",
+        "properties": {
+          "account_destination_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "amount": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Fixed share in cents"
+          },
+          "percentage": {
+            "type": "number",
+            "minimum": 0,
+            "maximum": 100,
+            "description": "Share as a percentage of the total amount, with up to two decimal places"
+          }
+        },
+        "required": [
+          "account_destination_id"
+        ],
+        "additionalProperties": false
+      },
+      "CreateSplitTransferRequest": {
+        "type": "object",
+        "properties": {
+          "account_origin_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "amount": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Total amount in cents"
+          },
+          "shares": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/SplitShareRequest"
+            },
+            "minItems": 1
+          }
+        },
+        "required": [
+          "account_origin_id",
+          "amount",
+          "shares"
+        ],
+        "additionalProperties": false
+      },
+      "CreateSplitTransferResponse": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Split ID, which is also the ID of its first transfer"
+          },
+          "transfers": {
+            "type": "array",
+            "items": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Transfer IDs in the same order as the shares"
+          },
+          "status": {
+            "type": "string",
+            "enum": [
+              "Pending Confirmation"
+            ],
+            "description": "Only sent for splits pending confirmation"
+          },
+          "expires_at": {
+            "type": "string",
+            "format": "date-time",
+            "description": "When the confirmation expires"
+          }
+        },
+        "required": [
+          "id",
+          "transfers"
+        ],
+        "additionalProperties": false
+      },
+      "AddressingKey": {
+        "type": "object",
+        "properties": {
+          "type": {
+            "type": "string",
+            "enum": [
+              "cpf",
+              "cnpj",
+              "email",
+              "phone",
+              "random"
+            ]
+          },
+          "key": {
+            "type": "string",
+            "description": "The key as stored: documents without punctuation, emails and random keys in lower case and phones in E.164"
+          },
+          "created_at": {
+            "type": "string",
+            "format": "date-time"
+          }
+        },
+        "required": [
+          "type",
+          "key",
+          "created_at"
+        ],
+        "additionalProperties": false
+      },
+      "RegisterKeyRequest": {
+        "type": "object",
+        "properties": {
+          "type": {
+            "type": "string",
+            "enum": [
+              "cpf",
+              "cnpj",
+              "email",
+              "phone",
+              "random"
+            ]
+          },
+          "value": {
+            "type": "string",
+            "description": "The key; left out for random keys, which the bank generates"
+          }
+        },
+        "required": [
+          "type"
+        ],
+        "additionalProperties": false
+      },
+      "KeyLookupResponse": {
+        "type": "object",
+        "properties": {
+          "type": {
+            "type": "string",
+            "enum": [
+              "cpf",
+              "cnpj",
+              "email",
+              "phone",
+              "random"
+            ]
+          },
+          "key": {
+            "type": "string"
+          },
+          "name": {
+            "type": "string",
+            "description": "First name of the holder, with only the initials of the other names"
+          },
+          "cpf": {
+            "type": "string",
+            "description": "CPF of the holder with only its middle six digits, such as ***.265.810-**"
+          },
+          "account_type": {
+            "type": "string",
+            "enum": [
+              "checking",
+              "business",
+              "savings",
+              "bank"
+            ]
+          }
+        },
+        "required": [
+          "type",
+          "key",
+          "name"
+        ],
+        "additionalProperties": false
+      },
+      "CreateChargeRequest": {
+        "type": "object",
+        "properties": {
+          "key": {
+            "type": "string",
+            "description": "Addressing key of the account the charge is paid to"
+          },
+          "amount": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Amount in cents; required for dynamic charges, and left for the payer to choose in static charges without it"
+          },
+          "description": {
+            "type": "string",
+            "description": "Shown to the payer"
+          },
+          "city": {
+            "type": "string",
+            "maxLength": 15,
+            "default": "SAO PAULO",
+            "description": "Merchant city written in the BR Code"
+          },
+          "dynamic": {
+            "type": "boolean",
+            "default": false,
+            "description": "Dynamic charges are paid once; static ones any number of times"
+          }
+        },
+        "required": [
+          "key"
+        ],
+        "additionalProperties": false
+      },
+      "ChargeResponse": {
+        "type": "object",
+        "properties": {
+          "payload": {
+            "type": "string",
+            "description": "BR Code, to be shown as a QR code or copied and pasted"
+          },
+          "dynamic": {
+            "type": "boolean"
+          },
+          "txid": {
+            "type": "string",
+            "description": "Only sent for dynamic charges"
+          },
+          "key": {
+            "type": "string"
+          },
+          "amount": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Amount in cents"
+          },
+          "description": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "payload",
+          "dynamic",
+          "key"
+        ],
+        "additionalProperties": false
+      },
+      "Charge": {
+        "type": "object",
+        "properties": {
+          "txid": {
+            "type": "string",
+            "pattern": "^[A-Za-z0-9]{25}$"
+          },
+          "key": {
+            "type": "string",
+            "description": "Addressing key the charge is paid to"
+          },
+          "amount": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Amount in cents"
+          },
+          "description": {
+            "type": "string"
+          },
+          "created_at": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "transfer_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Last transfer made to pay the charge; the charge is paid unless it was refused, cancelled or expired"
+          }
+        },
+        "required": [
+          "txid",
+          "key",
+          "amount",
+          "created_at"
+        ],
+        "additionalProperties": false
+      },
+      "PayBRCodeRequest": {
+        "type": "object",
+        "properties": {
+          "account_origin_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "payload": {
+            "type": "string",
+            "description": "BR Code of the charge"
+          },
+          "amount": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Amount in cents; only required when the BR Code has none"
+          }
+        },
+        "required": [
+          "account_origin_id",
+          "payload"
+        ],
+        "additionalProperties": false
+      },
+      "LoginRequest": {
+        "type": "object",
+        "properties": {
+          "cpf": {
+            "type": "string"
+          },
+          "password": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "cpf",
+          "password"
+        ],
+        "additionalProperties": false
+      },
+      "LoginResponse": {
+        "type": "object",
+        "properties": {
+          "token": {
+            "type": "string"
+          },
+          "token_type": {
+            "type": "string",
+            "enum": [
+              "Bearer"
+            ]
+          },
+          "expires_at": {
+            "type": "string",
+            "format": "date-time"
+          }
+        },
+        "required": [
+          "token",
+          "token_type",
+          "expires_at"
+        ],
+        "additionalProperties": false
+      },
+      "EnrollTOTPResponse": {
+        "type": "object",
+        "properties": {
+          "secret": {
+            "type": "string",
+            "description": "Base32 secret, for apps that cannot read the URI"
+          },
+          "provisioning_uri": {
+            "type": "string",
+            "description": "otpauth URI, usually shown as a QR code"
+          }
+        },
+        "required": [
+          "secret",
+          "provisioning_uri"
+        ],
+        "additionalProperties": false
+      },
+      "TOTPCodeRequest": {
+        "type": "object",
+        "properties": {
+          "code": {
+            "type": "string",
+            "pattern": "^\\d{6}$"
+          }
+        },
+        "required": [
+          "code"
+        ],
+        "additionalProperties": false
+      },
+      "TOTPStatusResponse": {
+        "type": "object",
+        "properties": {
+          "account_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "totp_enabled": {
+            "type": "boolean"
+          }
+        },
+        "required": [
+          "account_id",
+          "totp_enabled"
+        ],
+        "additionalProperties": false
+      },
+      "CreateAPIKeyRequest": {
+        "type": "object",
+        "properties": {
+          "name": {
+            "type": "string"
+          },
+          "role": {
+            "type": "string",
+            "enum": [
+              "read-only",
+              "operator",
+              "admin"
+            ]
+          }
+        },
+        "required": [
+          "name",
+          "role"
+        ],
+        "additionalProperties": false
+      },
+      "APIKey": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "string"
+          },
+          "name": {
+            "type": "string"
+          },
+          "role": {
+            "type": "string",
+            "enum": [
+              "read-only",
+              "operator",
+              "admin"
+            ]
+          },
+          "created_at": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "rotated_at": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "revoked_at": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "secret": {
+            "type": "string",
+            "description": "Only sent when the key is created or rotated"
+          }
+        },
+        "required": [
+          "id",
+          "name",
+          "role",
+          "created_at"
+        ],
+        "additionalProperties": false
+      },
+      "CreateWebhookRequest": {
+        "type": "object",
+        "properties": {
+          "url": {
+            "type": "string",
+            "format": "uri",
+            "description": "Absolute http or https URL the events are posted to"
+          },
+          "events": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            },
+            "description": "Event types to deliver, or prefixes ending in *, such as transfer.*; every type when empty"
+          }
+        },
+        "required": [
+          "url"
+        ],
+        "additionalProperties": false
+      },
+      "Webhook": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "string"
+          },
+          "url": {
+            "type": "string"
+          },
+          "events": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            },
+            "description": "Event types delivered; every type when empty"
+          },
+          "created_at": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "secret": {
+            "type": "string",
+            "description": "Only sent when the webhook is created. Deliveries carry X-Webhook-Signature: t=<unix time>,v1=<hex HMAC-SHA256 of \"<unix time>.<body>\" under this secret>"
+          }
+        },
+        "required": [
+          "id",
+          "url",
+          "created_at"
+        ],
+        "additionalProperties": false
+      },
+      "Event": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Increasing in the order events happen"
+          },
+          "type": {
+            "type": "string",
+            "enum": [
+              "account.created",
+              "account.balance_changed",
+              "transfer.created",
+              "transfer.authorizing",
+              "transfer.authorized",
+              "transfer.rejected",
+              "transfer.confirmed",
+              "transfer.cancelled",
+              "transfer.expired",
+              "transfer.pending_confirmation",
+              "transfer.released"
+            ]
+          },
+          "time": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "account_ids": {
+            "type": "array",
+            "items": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            },
+            "description": "Accounts the event is about"
+          },
+          "data": {
+            "description": "The account for account.created, the balance change for account.balance_changed and the transfer, after the change, for transfer events"
+          }
+        },
+        "required": [
+          "id",
+          "type",
+          "time",
+          "account_ids",
+          "data"
+        ],
+        "additionalProperties": false
+      },
+      "WebhookDelivery": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "string"
+          },
+          "subscription_id": {
+            "type": "string"
+          },
+          "event": {
+            "$ref": "#/components/schemas/Event"
+          },
+          "status": {
+            "type": "string",
+            "enum": [
+              "pending",
+              "failed"
+            ]
+          },
+          "attempts": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Failed attempts so far"
+          },
+          "last_error": {
+            "type": "string",
+            "description": "Why the last attempt failed"
+          },
+          "next_attempt_at": {
+            "type": "string",
+            "format": "date-time",
+            "description": "Only set while pending"
+          }
+        },
+        "required": [
+          "id",
+          "subscription_id",
+          "event",
+          "status",
+          "attempts"
+        ],
+        "additionalProperties": false
+      },
+      "AuditEntry": {
+        "type": "object",
+        "properties": {
+          "seq": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "time": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "actor": {
+            "type": "string",
+            "description": "Who made the change: key:<id> for API keys, customer:<cpf> for customers, anonymous for calls without valid credentials and store for the changes API calls make"
+          },
+          "remote_addr": {
+            "type": "string",
+            "description": "Network address of API calls"
+          },
+          "action": {
+            "type": "string"
+          },
+          "payload": {
+            "description": "JSON payload of the action"
+          },
+          "outcome": {
+            "type": "string"
+          },
+          "prev_hash": {
+            "type": "string"
+          },
+          "hash": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "seq",
+          "time",
+          "actor",
+          "action",
+          "outcome",
+          "prev_hash",
+          "hash"
+        ],
+        "additionalProperties": false
+      },
+      "AuditVerificationResponse": {
+        "type": "object",
+        "properties": {
+          "valid": {
+            "type": "boolean"
+          },
+          "entries": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0
+          },
+          "head": {
+            "type": "string",
+            "description": "Hash of the last entry"
+          },
+          "error": {
+            "type": "string",
+            "description": "Why the log is not valid"
+          }
+        },
+        "required": [
+          "valid",
+          "entries"
+        ],
+        "additionalProperties": false
+      },
+      "ImportResponse": {
+        "type": "object",
+        "properties": {
+          "mode": {
+            "type": "string",
+            "enum": [
+              "merge",
+              "replace"
+            ]
+          },
+          "accounts": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Accounts imported"
+          },
+          "transfers": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Transfers imported"
+          },
+          "account_max_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Last account ID given; new accounts get the ones after it"
+          },
+          "transfer_max_id": {
+            "type": "integer",
+            "format": "int64",
+            "minimum": 0,
+            "description": "Last transfer ID given; new transfers get the ones after it"
+          }
+        },
+        "required": [
+          "mode",
+          "accounts",
+          "transfers",
+          "account_max_id",
+          "transfer_max_id"
+        ],
+        "additionalProperties": false
+      },
+      "HealthResponse": {
+        "type": "object",
+        "properties": {
+          "status": {
+            "type": "string",
+            "enum": [
+              "ok",
+              "unavailable"
+            ]
+          },
+          "checks": {
+            "type": "object",
+            "additionalProperties": {
+              "type": "string"
+            },
+            "description": "Outcome of each readiness check: ok or the error"
+          }
+        },
+        "required": [
+          "status"
+        ],
+        "additionalProperties": false
+      },
+      "ErrorResponse": {
+        "type": "object",
+        "properties": {
+          "code": {
+            "type": "string",
+            "enum": [
+              "invalid_request",
+              "invalid_id",
+              "method_not_allowed",
+              "route_not_found",
+              "unsupported_media_type",
+              "body_too_large",
+              "invalid_cpf",
+              "invalid_name",
+              "invalid_type",
+              "invalid_percentage",
+              "invalid_password",
+              "invalid_credentials",
+              "unauthenticated",
+              "invalid_token",
+              "expired_token",
+              "account_not_owned",
+              "password_not_set",
+              "api_key_required",
+              "insufficient_role",
+              "invalid_role",
+              "api_key_not_found",
+              "invalid_api_key",
+              "api_key_revoked",
+              "invalid_signature",
+              "stale_request",
+              "replayed_request",
+              "totp_required",
+              "invalid_totp_code",
+              "totp_not_enrolled",
+              "totp_already_enabled",
+              "totp_replayed",
+              "totp_locked",
+              "transfer_not_pending",
+              "confirmation_expired",
+              "rate_limited",
+              "overloaded",
+              "account_not_found",
+              "transfer_not_found",
+              "insufficient_balance",
+              "duplicate_transfer",
+              "idempotency_key_reused",
+              "same_account",
+              "invalid_amount",
+              "invalid_shares",
+              "invalid_period",
+              "invalid_cnab",
+              "remessa_already_processed",
+              "invalid_key",
+              "key_not_owned",
+              "key_in_use",
+              "key_limit_reached",
+              "key_not_found",
+              "invalid_brcode",
+              "charge_not_found",
+              "charge_already_paid",
+              "invalid_export",
+              "import_conflict",
+              "invalid_webhook_url",
+              "invalid_event_type",
+              "webhook_not_found",
+              "delivery_not_found",
+              "delivery_not_failed",
+              "internal_error"
+            ],
+            "description": "Stable identifier of the error"
+          },
+          "message": {
+            "type": "string",
+            "description": "Human readable description, which may change"
+          },
+          "field": {
+            "type": "string",
+            "description": "Request field that caused the error, if any"
+          },
+          "request_id": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "code",
+          "message",
+          "request_id"
+        ],
+        "additionalProperties": false
+      }
+    },
+    "responses": {
+      "BadRequest": {
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        },
+        "description": "The request is malformed or a field is invalid"
+      },
+      "Unauthorized": {
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        },
+        "description": "Credentials are missing or invalid"
+      },
+      "Forbidden": {
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        },
+        "description": "The credentials do not allow this request"
+      },
+      "NotFound": {
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        },
+        "description": "The account, transfer, key or webhook does not exist"
+      },
+      "Conflict": {
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        },
+        "description": "The request conflicts with the current state"
+      },
+      "Unprocessable": {
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        },
+        "description": "The bank rules refuse the operation"
+      },
+      "TooManyRequests": {
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        },
+        "description": "The rate limit was exceeded; see Retry-After"
+      }
+    },
+    "securitySchemes": {
+      "bearerAuth": {
+        "type": "http",
+        "scheme": "bearer",
+        "bearerFormat": "JWT",
+        "description": "Customer token from POST /login"
+      },
+      "metricsToken": {
+        "type": "http",
+        "scheme": "bearer",
+        "description": "Token of the -metrics-token flag, only accepted by GET /metrics"
+      },
+      "apiKey": {
+        "type": "apiKey",
+        "in": "header",
+        "name": "X-Api-Key",
+        "description": "<id>.<secret>, or the key ID along with X-Timestamp, X-Nonce and X-Signature for signed requests"
+      }
+    }
+  }
+}
+`
+
+// openAPIHandler serves the OpenAPI 3 description of the API on GET
+// /openapi.json.
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	w.Header().Set("content-type", JsonContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(openAPISpec))
+}
@@ -0,0 +1,528 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/audit"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"github.com/erikacarvalho/stone-challenge/metrics"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"github.com/erikacarvalho/stone-challenge/webhook"
+	"github.com/gorilla/mux"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openAPI checks JSON documents against the schemas of openAPISpec. It
+// understands the parts of JSON Schema the spec uses.
+type openAPI struct {
+	doc map[string]interface{}
+}
+
+func loadOpenAPI(t *testing.T) openAPI {
+	t.Helper()
+	var doc map[string]interface{}
+	err := json.Unmarshal([]byte(openAPISpec), &doc)
+	if err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+	return openAPI{doc}
+}
+
+func (o openAPI) paths() map[string]interface{} {
+	return o.doc["paths"].(map[string]interface{})
+}
+
+// resolve follows a $ref, such as #/components/schemas/Account.
+func (o openAPI) resolve(node map[string]interface{}) map[string]interface{} {
+	for {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		var target interface{} = o.doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			target = target.(map[string]interface{})[part]
+		}
+		node = target.(map[string]interface{})
+	}
+}
+
+func (o openAPI) schema(name string) map[string]interface{} {
+	return o.resolve(map[string]interface{}{"$ref": "#/components/schemas/" + name})
+}
+
+// operation returns the path template and the operation that serve method
+// and path. Templates with fewer parameters win, as /transfers/split wins
+// over /transfers/{transfer_id}.
+func (o openAPI) operation(method, path string) (string, map[string]interface{}, bool) {
+	segments := strings.Split(strings.SplitN(path, "?", 2)[0], "/")
+	found, best, fewest := "", map[string]interface{}(nil), len(segments)+1
+	for template, item := range o.paths() {
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		matches, params := true, 0
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") {
+				params++
+			} else if part != segments[i] {
+				matches = false
+			}
+		}
+		if !matches || params >= fewest {
+			continue
+		}
+		operation, ok := item.(map[string]interface{})[strings.ToLower(method)].(map[string]interface{})
+		if ok {
+			found, best, fewest = template, operation, params
+		}
+	}
+	return found, best, best != nil
+}
+
+// validate returns what is wrong with value according to schema.
+func (o openAPI) validate(schema map[string]interface{}, value interface{}, at string) []string {
+	schema = o.resolve(schema)
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+			}
+		}
+		if !found {
+			fail("%v is not one of %v", value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("got %T; want an object", value)
+			break
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		for name, propertyValue := range object {
+			if property, ok := properties[name]; ok {
+				problems = append(problems, o.validate(property.(map[string]interface{}), propertyValue, at+"."+name)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("property %q is not in the spec", name)
+				}
+			case map[string]interface{}:
+				problems = append(problems, o.validate(additional, propertyValue, at+"."+name)...)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			fail("got %T; want an array", value)
+			break
+		}
+		if minItems, ok := schema["minItems"].(float64); ok && float64(len(array)) < minItems {
+			fail("got %d items; want at least %v", len(array), minItems)
+		}
+		for i, item := range array {
+			problems = append(problems, o.validate(schema["items"].(map[string]interface{}), item, at+"["+strconv.Itoa(i)+"]")...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			fail("got %T; want a string", value)
+			break
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(s) {
+			fail("%q does not match %s", s, pattern)
+		}
+		if minLength, ok := schema["minLength"].(float64); ok && float64(len(s)) < minLength {
+			fail("%q is shorter than %v", s, minLength)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				fail("%q is not a date-time", s)
+			}
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			fail("got %T; want a number", value)
+			break
+		}
+		if schema["type"] == "integer" && n != math.Trunc(n) {
+			fail("%v is not an integer", n)
+		}
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			fail("%v is less than %v", n, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && n > maximum {
+			fail("%v is more than %v", n, maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("got %T; want a boolean", value)
+		}
+	}
+	return problems
+}
+
+// jsonFields returns the JSON names of the fields of a struct type, telling
+// which ones are omitted when empty.
+func jsonFields(typ reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			for name, omitEmpty := range jsonFields(field.Type) {
+				fields[name] = omitEmpty
+			}
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = len(parts) > 1 && parts[1] == "omitempty"
+	}
+	return fields
+}
+
+func TestOpenAPI(t *testing.T) {
+	spec := loadOpenAPI(t)
+
+	t.Run("should serve the spec on GET /openapi.json", func(t *testing.T) {
+		server := NewServer(store.NewAccountStore(app.StartingID(0)), store.NewTransferStore(app.StartingID(0)))
+		request, _ := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		var doc map[string]interface{}
+		err := json.Unmarshal(response.Body.Bytes(), &doc)
+		if err != nil || doc["openapi"] != "3.0.3" {
+			t.Errorf("got %v, %v; want an OpenAPI 3 document", doc["openapi"], err)
+		}
+	})
+
+	t.Run("should describe every route and only them", func(t *testing.T) {
+		server := NewServer(store.NewAccountStore(app.StartingID(0)), store.NewTransferStore(app.StartingID(0)),
+			WithAuditLog(audit.NewLog()),
+			WithAuth(auth.NewIssuer([]byte("chave-de-teste"), time.Hour)),
+			WithAPIKeys(auth.NewKeyStore()),
+			WithStepUp(100000, time.Minute),
+			WithMetrics(metrics.NewRegistry()),
+			WithWebhooks(webhook.NewDispatcher(nil)),
+			WithEventStream(events.NewHub(10), 0),
+		)
+		var routes []string
+		server.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			template, _ := route.GetPathTemplate()
+			routes = append(routes, template)
+			return nil
+		})
+		var documented []string
+		for path := range spec.paths() {
+			documented = append(documented, path)
+		}
+		sort.Strings(routes)
+		sort.Strings(documented)
+
+		app.AssertString(t, strings.Join(documented, " "), strings.Join(routes, " "))
+	})
+
+	t.Run("should match the fields of the request and response types", func(t *testing.T) {
+		types := []struct {
+			schema   string
+			value    interface{}
+			response bool
+		}{
+			{"CreateAccountRequest", CreateAccountRequest{}, false},
+			{"CreateTransferRequest", CreateTransferRequest{}, false},
+			{"CreateSplitTransferRequest", CreateSplitTransferRequest{}, false},
+			{"SplitShareRequest", SplitShareRequest{}, false},
+			{"LoginRequest", LoginRequest{}, false},
+			{"TOTPCodeRequest", TOTPCodeRequest{}, false},
+			{"CreateAPIKeyRequest", CreateAPIKeyRequest{}, false},
+			{"CreateWebhookRequest", CreateWebhookRequest{}, false},
+			{"RegisterKeyRequest", RegisterKeyRequest{}, false},
+			{"CreateChargeRequest", CreateChargeRequest{}, false},
+			{"PayBRCodeRequest", PayBRCodeRequest{}, false},
+			{"Account", app.Account{}, true},
+			{"Transfer", app.Transfer{}, true},
+			{"AddressingKey", app.AddressingKey{}, true},
+			{"KeyLookupResponse", KeyLookupResponse{}, true},
+			{"Charge", app.Charge{}, true},
+			{"ChargeResponse", ChargeResponse{}, true},
+			{"CreateAccountResponse", CreateAccountResponse{}, true},
+			{"GetBalanceResponse", GetBalanceResponse{}, true},
+			{"CreateTransferResponse", CreateTransferResponse{}, true},
+			{"CreateSplitTransferResponse", CreateSplitTransferResponse{}, true},
+			{"LoginResponse", LoginResponse{}, true},
+			{"EnrollTOTPResponse", EnrollTOTPResponse{}, true},
+			{"TOTPStatusResponse", TOTPStatusResponse{}, true},
+			{"APIKey", APIKeyResponse{}, true},
+			{"Webhook", WebhookResponse{}, true},
+			{"Event", events.Event{}, true},
+			{"WebhookDelivery", webhook.Delivery{}, true},
+			{"AuditEntry", audit.Entry{}, true},
+			{"AuditVerificationResponse", AuditVerificationResponse{}, true},
+			{"ImportResponse", ImportResponse{}, true},
+			{"HealthResponse", HealthResponse{}, true},
+			{"ErrorResponse", ErrorResponse{}, true},
+		}
+		for _, tt := range types {
+			schema := spec.schema(tt.schema)
+			properties := schema["properties"].(map[string]interface{})
+			required := make(map[string]bool)
+			names, _ := schema["required"].([]interface{})
+			for _, name := range names {
+				required[name.(string)] = true
+			}
+
+			fields := jsonFields(reflect.TypeOf(tt.value))
+			for name, omitEmpty := range fields {
+				if _, ok := properties[name]; !ok {
+					t.Errorf("%s has field %q, which is not in the spec", tt.schema, name)
+				}
+				if tt.response && omitEmpty == required[name] {
+					t.Errorf("%s.%s: omitempty is %v but required is %v", tt.schema, name, omitEmpty, required[name])
+				}
+			}
+			for name := range properties {
+				if _, ok := fields[name]; !ok {
+					t.Errorf("%s has property %q, which is not a field of %T", tt.schema, name, tt.value)
+				}
+			}
+		}
+	})
+
+	t.Run("should list every error code", func(t *testing.T) {
+		var codes []string
+		seen := map[string]bool{"internal_error": true}
+		codes = append(codes, "internal_error")
+		for _, e := range errorCodes {
+			if !seen[e.code] {
+				seen[e.code] = true
+				codes = append(codes, e.code)
+			}
+		}
+		var documented []string
+		for _, code := range spec.schema("ErrorResponse")["properties"].(map[string]interface{})["code"].(map[string]interface{})["enum"].([]interface{}) {
+			documented = append(documented, code.(string))
+		}
+		sort.Strings(codes)
+		sort.Strings(documented)
+
+		app.AssertString(t, strings.Join(documented, " "), strings.Join(codes, " "))
+	})
+
+	t.Run("should answer as the spec says", func(t *testing.T) {
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_admin", Name: "admin", Role: auth.RoleAdmin}, "segredo")
+		registry := metrics.NewRegistry()
+		server := NewServer(store.NewAccountStore(app.StartingID(0)), store.NewTransferStore(app.StartingID(0)),
+			WithAuditLog(audit.NewLog()),
+			WithAuth(auth.NewIssuer([]byte("chave-de-teste"), time.Hour)),
+			WithAPIKeys(keys),
+			WithStepUp(100000, time.Minute),
+			WithMetrics(registry),
+			WithWebhooks(webhook.NewDispatcher(nil)),
+			WithEventStream(events.NewHub(10), 0),
+		)
+
+		// do sends a request, checks its body against the request schema of
+		// the operation and its response against the response schema for
+		// the status, and returns the decoded response.
+		do := func(t *testing.T, method, path, credential, body string, wantStatus int) map[string]interface{} {
+			t.Helper()
+			template, operation, ok := spec.operation(method, path)
+			if !ok {
+				t.Fatalf("%s %s is not in the spec", method, path)
+			}
+			if body != "" && wantStatus < http.StatusBadRequest {
+				var value interface{}
+				json.Unmarshal([]byte(body), &value)
+				requestBody := operation["requestBody"].(map[string]interface{})
+				if media, ok := requestBody["content"].(map[string]interface{})[JsonContentType].(map[string]interface{}); ok {
+					for _, problem := range spec.validate(media["schema"].(map[string]interface{}), value, "request") {
+						t.Errorf("%s %s: %s", method, template, problem)
+					}
+				}
+			}
+
+			request, _ := http.NewRequest(method, path, strings.NewReader(body))
+			switch {
+			case strings.HasPrefix(credential, "key_"):
+				request.Header.Set(APIKeyHeader, credential)
+			case credential != "":
+				request.Header.Set("Authorization", "Bearer "+credential)
+			}
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			app.AssertHTTPStatus(t, response.Code, wantStatus)
+
+			documented, ok := operation["responses"].(map[string]interface{})[strconv.Itoa(response.Code)]
+			if !ok {
+				t.Fatalf("%s %s: status %d is not in the spec", method, template, response.Code)
+			}
+			content := spec.resolve(documented.(map[string]interface{}))["content"].(map[string]interface{})
+			media, ok := content[JsonContentType].(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			var value interface{}
+			err := json.Unmarshal(response.Body.Bytes(), &value)
+			if err != nil {
+				t.Fatalf("%s %s: response is not JSON: %v", method, template, err)
+			}
+			for _, problem := range spec.validate(media["schema"].(map[string]interface{}), value, "response") {
+				t.Errorf("%s %s %d: %s", method, template, response.Code, problem)
+			}
+			object, _ := value.(map[string]interface{})
+			return object
+		}
+		const admin = "key_admin.segredo"
+
+		do(t, http.MethodPost, "/accounts", "", `{"name":"Roberta Pinheiro Sá","cpf":"48226581020","balance":1000000,"password":"123456"}`, http.StatusCreated)
+		do(t, http.MethodPost, "/accounts", "", `{"name":"Caio Barros Antunes","cpf":"71530184077","type":"savings","password":"654321"}`, http.StatusCreated)
+		do(t, http.MethodPost, "/accounts", "", `{"name":"Ana Lima","cpf":"123","password":"123456"}`, http.StatusBadRequest)
+		token := do(t, http.MethodPost, "/login", "", `{"cpf":"48226581020","password":"123456"}`, http.StatusOK)["token"].(string)
+		do(t, http.MethodPost, "/login", "", `{"cpf":"48226581020","password":"errada"}`, http.StatusUnauthorized)
+
+		do(t, http.MethodGet, "/accounts", token, "", http.StatusOK)
+		do(t, http.MethodGet, "/accounts", "", "", http.StatusUnauthorized)
+		do(t, http.MethodGet, "/accounts/1/balance", token, "", http.StatusOK)
+		do(t, http.MethodGet, "/accounts/2/balance", token, "", http.StatusForbidden)
+		do(t, http.MethodGet, "/accounts/9/balance", admin, "", http.StatusNotFound)
+		do(t, http.MethodGet, "/accounts/x/balance", token, "", http.StatusBadRequest)
+
+		do(t, http.MethodPost, "/transfers", token, `{"account_origin_id":1,"account_destination_id":2,"amount":1500}`, http.StatusCreated)
+		do(t, http.MethodPost, "/transfers", token, `{"account_origin_id":1,"account_destination_id":2,"amount":1500}`, http.StatusConflict)
+		do(t, http.MethodPost, "/transfers", token, `{"account_origin_id":1,"account_destination_id":1,"amount":1500}`, http.StatusUnprocessableEntity)
+		do(t, http.MethodPost, "/transfers", token, `{"account_origin_id":2,"account_destination_id":1,"amount":1500}`, http.StatusForbidden)
+		do(t, http.MethodPost, "/transfers", "", `{"account_origin_id":1,"account_destination_id":2,"amount":1500}`, http.StatusUnauthorized)
+		do(t, http.MethodPost, "/transfers/split", token, `{"account_origin_id":1,"amount":1000,"shares":[{"account_destination_id":2,"percentage":100}]}`, http.StatusCreated)
+
+		do(t, http.MethodPost, "/accounts/1/keys", token, `{"type":"email","value":"roberta@exemplo.com"}`, http.StatusCreated)
+		do(t, http.MethodPost, "/accounts/1/keys", token, `{"type":"cpf","value":"71530184077"}`, http.StatusUnprocessableEntity)
+		do(t, http.MethodPost, "/accounts/1/keys", token, `{"type":"phone","value":"11987654321"}`, http.StatusBadRequest)
+		do(t, http.MethodPost, "/accounts/2/keys", token, `{"type":"random"}`, http.StatusForbidden)
+		do(t, http.MethodPost, "/accounts/2/keys", admin, `{"type":"email","value":"roberta@exemplo.com"}`, http.StatusConflict)
+		do(t, http.MethodPost, "/accounts/2/keys", admin, `{"type":"cpf","value":"715.301.840-77"}`, http.StatusCreated)
+		do(t, http.MethodGet, "/accounts/1/keys", token, "", http.StatusOK)
+		do(t, http.MethodGet, "/accounts/9/keys", admin, "", http.StatusNotFound)
+		do(t, http.MethodGet, "/keys/715.301.840-77", token, "", http.StatusOK)
+		do(t, http.MethodGet, "/keys/caio@exemplo.com", token, "", http.StatusNotFound)
+		do(t, http.MethodGet, "/keys/71530184077", "", "", http.StatusUnauthorized)
+		do(t, http.MethodPost, "/transfers", token, `{"account_origin_id":1,"destination_key":"71530184077","amount":1200}`, http.StatusCreated)
+		do(t, http.MethodPost, "/transfers", token, `{"account_origin_id":1,"destination_key":"caio@exemplo.com","amount":1200}`, http.StatusNotFound)
+		charge := do(t, http.MethodPost, "/accounts/2/charges", admin, `{"key":"71530184077","amount":1100,"dynamic":true}`, http.StatusCreated)
+		do(t, http.MethodPost, "/accounts/2/charges", admin, `{"key":"71530184077","description":"Pedido 42"}`, http.StatusCreated)
+		do(t, http.MethodPost, "/accounts/2/charges", admin, `{"key":"71530184077","dynamic":true}`, http.StatusUnprocessableEntity)
+		do(t, http.MethodPost, "/accounts/2/charges", admin, `{"key":"71530184077","city":"SAO JOSE DOS CAMPOS"}`, http.StatusBadRequest)
+		do(t, http.MethodPost, "/accounts/2/charges", token, `{"key":"71530184077"}`, http.StatusForbidden)
+		do(t, http.MethodPost, "/accounts/1/charges", token, `{"key":"71530184077"}`, http.StatusNotFound)
+		do(t, http.MethodGet, "/accounts/2/charges", admin, "", http.StatusOK)
+		brCode, _ := json.Marshal(charge["payload"])
+		do(t, http.MethodPost, "/transfers/brcode", token, `{"account_origin_id":1,"payload":`+string(brCode)+`}`, http.StatusCreated)
+		do(t, http.MethodPost, "/transfers/brcode", token, `{"account_origin_id":1,"payload":`+string(brCode)+`}`, http.StatusConflict)
+		do(t, http.MethodPost, "/transfers/brcode", token, `{"account_origin_id":1,"payload":`+string(brCode)+`,"amount":5}`, http.StatusUnprocessableEntity)
+		do(t, http.MethodPost, "/transfers/brcode", token, `{"account_origin_id":1,"payload":"000201"}`, http.StatusBadRequest)
+		do(t, http.MethodPost, "/transfers/brcode", "", `{"account_origin_id":1,"payload":`+string(brCode)+`}`, http.StatusUnauthorized)
+		do(t, http.MethodDelete, "/accounts/1/keys/roberta@exemplo.com", token, "", http.StatusOK)
+		do(t, http.MethodDelete, "/accounts/1/keys/roberta@exemplo.com", token, "", http.StatusNotFound)
+
+		enrollment := do(t, http.MethodPost, "/accounts/1/totp", token, "", http.StatusCreated)
+		secret := enrollment["secret"].(string)
+		previous, _ := auth.TOTPCode(secret, time.Now().Add(-auth.TOTPPeriod*time.Second))
+		do(t, http.MethodPost, "/accounts/1/totp/activate", token, `{"code":"`+previous+`"}`, http.StatusOK)
+		do(t, http.MethodPost, "/accounts/1/totp/activate", token, `{"code":"`+previous+`"}`, http.StatusForbidden)
+		pending := do(t, http.MethodPost, "/transfers", token, `{"account_origin_id":1,"account_destination_id":2,"amount":200000}`, http.StatusAccepted)
+		ID := strconv.FormatFloat(pending["id"].(float64), 'f', 0, 64)
+		current, _ := auth.TOTPCode(secret, time.Now())
+		do(t, http.MethodPost, "/transfers/"+ID+"/confirm", token, `{"code":"`+current+`"}`, http.StatusOK)
+		do(t, http.MethodPost, "/transfers/split", token, `{"account_origin_id":1,"amount":200000,"shares":[{"account_destination_id":2,"amount":200000}]}`, http.StatusAccepted)
+
+		do(t, http.MethodGet, "/transfers", token, "", http.StatusOK)
+		do(t, http.MethodGet, "/transfers", "", "", http.StatusUnauthorized)
+		do(t, http.MethodGet, "/transfers/1", token, "", http.StatusOK)
+		do(t, http.MethodGet, "/transfers/99", admin, "", http.StatusNotFound)
+		do(t, http.MethodGet, "/accounts/1/statement", token, "", http.StatusOK)
+		do(t, http.MethodGet, "/accounts/1/statement?format=ofx", admin, "", http.StatusOK)
+		do(t, http.MethodGet, "/accounts/1/statement?from=2026-10-02&to=2026-10-01", token, "", http.StatusBadRequest)
+		do(t, http.MethodGet, "/accounts/1/statement", "", "", http.StatusUnauthorized)
+		do(t, http.MethodGet, "/accounts/2/statement", token, "", http.StatusForbidden)
+		do(t, http.MethodGet, "/accounts/9/statement", admin, "", http.StatusNotFound)
+
+		created := do(t, http.MethodPost, "/admin/keys", admin, `{"name":"conciliação","role":"read-only"}`, http.StatusCreated)
+		keyID := created["id"].(string)
+		do(t, http.MethodPost, "/admin/keys", admin, `{"name":"conciliação","role":"root"}`, http.StatusBadRequest)
+		do(t, http.MethodGet, "/admin/keys", admin, "", http.StatusOK)
+		do(t, http.MethodGet, "/admin/keys", "", "", http.StatusUnauthorized)
+		do(t, http.MethodPost, "/admin/keys/"+keyID+"/rotate", admin, "", http.StatusOK)
+		do(t, http.MethodDelete, "/admin/keys/"+keyID, admin, "", http.StatusOK)
+		do(t, http.MethodPost, "/admin/keys/"+keyID+"/rotate", admin, "", http.StatusConflict)
+		do(t, http.MethodDelete, "/admin/keys/key_nenhuma", admin, "", http.StatusNotFound)
+		do(t, http.MethodGet, "/admin/export", admin, "", http.StatusOK)
+		do(t, http.MethodPost, "/admin/import", admin, `{"kind":"account"}`, http.StatusBadRequest)
+		do(t, http.MethodPost, "/admin/import?mode=append", admin, "", http.StatusBadRequest)
+		remessa := cnabRemessa("48226581020", 1, cnabCredit{account: 2, amount: 1500, date: time.Now().UTC()})
+		do(t, http.MethodPost, "/batches/cnab240", admin, remessa, http.StatusOK)
+		do(t, http.MethodPost, "/batches/cnab240", admin, remessa, http.StatusConflict)
+		do(t, http.MethodPost, "/batches/cnab240", admin, remessa[:240], http.StatusBadRequest)
+		do(t, http.MethodPost, "/batches/cnab240", token, remessa, http.StatusUnauthorized)
+
+		hook := do(t, http.MethodPost, "/webhooks", admin, `{"url":"https://example.com/hooks","events":["transfer.*"]}`, http.StatusCreated)
+		hookID := hook["id"].(string)
+		do(t, http.MethodPost, "/webhooks", admin, `{"url":"example.com"}`, http.StatusBadRequest)
+		do(t, http.MethodGet, "/webhooks", admin, "", http.StatusOK)
+		do(t, http.MethodGet, "/webhooks/"+hookID, admin, "", http.StatusOK)
+		do(t, http.MethodGet, "/webhooks/dead-letters", admin, "", http.StatusOK)
+		do(t, http.MethodPost, "/webhooks/dead-letters/dlv_nenhuma/redeliver", admin, "", http.StatusNotFound)
+		do(t, http.MethodDelete, "/webhooks/"+hookID, admin, "", http.StatusOK)
+		do(t, http.MethodDelete, "/webhooks/"+hookID, admin, "", http.StatusNotFound)
+
+		do(t, http.MethodGet, "/events", "", "", http.StatusUnauthorized)
+		do(t, http.MethodGet, "/events?account_id=2", token, "", http.StatusForbidden)
+		do(t, http.MethodGet, "/events?type=conta.*", token, "", http.StatusBadRequest)
+
+		do(t, http.MethodGet, "/audit", admin, "", http.StatusOK)
+		do(t, http.MethodGet, "/audit/verify", admin, "", http.StatusOK)
+		do(t, http.MethodGet, "/healthz", "", "", http.StatusOK)
+		do(t, http.MethodGet, "/readyz", "", "", http.StatusOK)
+		do(t, http.MethodGet, "/metrics", "", "", http.StatusUnauthorized)
+		do(t, http.MethodGet, "/metrics", admin, "", http.StatusOK)
+		do(t, http.MethodGet, "/openapi.json", "", "", http.StatusOK)
+	})
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// MaxPageSize is the largest limit accepted by the list endpoints.
+const MaxPageSize = 1000
+
+var ErrInvalidPage = errors.New("invalid page: limit must be between 1 and 1000 and after must be an ID")
+
+// page selects part of a list sorted by ID: the first limit items whose ID
+// is greater than after. A zero limit selects every item.
+type page struct {
+	limit int
+	after uint64
+}
+
+// pageParams reads the limit and after query parameters of r. If they are
+// invalid, it responds with the reason and returns false.
+func pageParams(w http.ResponseWriter, r *http.Request) (page, bool) {
+	var p page
+	query := r.URL.Query()
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			writeError(w, r, http.StatusBadRequest, ErrInvalidPage, "limit", fmt.Sprintf("limit must be between 1 and %d. Limit given: %v", MaxPageSize, s))
+			return p, false
+		}
+		p.limit = limit
+	}
+	if s := query.Get("after"); s != "" {
+		after, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrInvalidPage, "after", fmt.Sprintf("after must be an ID. After given: %v", s))
+			return p, false
+		}
+		p.after = after
+	}
+	return p, true
+}
+
+// bounds returns the range of the n items, sorted by the IDs returned by id,
+// that fall in the page, and whether there are items after it.
+func (p page) bounds(n int, id func(i int) uint64) (start, end int, more bool) {
+	start = sort.Search(n, func(i int) bool { return id(i) > p.after })
+	end = n
+	if p.limit > 0 && start+p.limit < n {
+		end = start + p.limit
+	}
+	return start, end, end < n
+}
+
+// setNextLink points the Link header of a response at the page that follows
+// the one ending with the item lastID.
+func (p page) setNextLink(w http.ResponseWriter, r *http.Request, lastID uint64) {
+	query := url.Values{}
+	query.Set("after", strconv.FormatUint(lastID, 10))
+	query.Set("limit", strconv.Itoa(p.limit))
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, query.Encode()))
+}
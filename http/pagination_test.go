@@ -0,0 +1,98 @@
+package http
+
+import (
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPagination(t *testing.T) {
+	var accounts []app.Account
+	for ID := uint64(1); ID <= 5; ID++ {
+		accounts = append(accounts, app.Account{ID: ID, Name: "Roberta Pinheiro Sá", CPF: "48226581020"})
+	}
+	server := NewServer(store.NewAccountStore(app.StartingID(5), accounts...), store.NewTransferStore(app.StartingID(0)))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, path, nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	ids := func(t *testing.T, response *httptest.ResponseRecorder) []uint64 {
+		t.Helper()
+		var got []app.Account
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("error decoding accounts: %v", err)
+		}
+		IDs := []uint64{}
+		for _, account := range got {
+			IDs = append(IDs, account.ID)
+		}
+		return IDs
+	}
+
+	cases := []struct {
+		name string
+		path string
+		want []uint64
+		link string
+	}{
+		{"every account without parameters", "/accounts", []uint64{1, 2, 3, 4, 5}, ""},
+		{"first page", "/accounts?limit=2", []uint64{1, 2}, `</accounts?after=2&limit=2>; rel="next"`},
+		{"middle page", "/accounts?limit=2&after=2", []uint64{3, 4}, `</accounts?after=4&limit=2>; rel="next"`},
+		{"last page", "/accounts?limit=2&after=4", []uint64{5}, ""},
+		{"full last page", "/accounts?limit=5", []uint64{1, 2, 3, 4, 5}, ""},
+		{"after the last account", "/accounts?limit=2&after=5", []uint64{}, ""},
+		{"after without limit", "/accounts?after=3", []uint64{4, 5}, ""},
+	}
+	for _, tt := range cases {
+		t.Run("should return "+tt.name, func(t *testing.T) {
+			response := get(tt.path)
+
+			app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+			app.AssertString(t, response.Header().Get("Link"), tt.link)
+			got := ids(t, response)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got accounts %v; want %v", got, tt.want)
+			}
+			for i := range got {
+				app.AssertUint64(t, got[i], tt.want[i])
+			}
+		})
+	}
+
+	for _, path := range []string{"/accounts?limit=0", "/accounts?limit=1001", "/accounts?limit=two", "/accounts?after=-1", "/transfers?limit=0"} {
+		t.Run("should refuse "+path, func(t *testing.T) {
+			response := get(path)
+
+			app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+			var got ErrorResponse
+			json.NewDecoder(response.Body).Decode(&got)
+			app.AssertString(t, got.Code, "invalid_request")
+		})
+	}
+
+	t.Run("should page transfers", func(t *testing.T) {
+		transferStore := store.NewTransferStore(app.StartingID(3),
+			app.Transfer{ID: 1}, app.Transfer{ID: 2}, app.Transfer{ID: 3},
+		)
+		server := NewServer(store.NewAccountStore(app.StartingID(0)), transferStore)
+		request, _ := http.NewRequest(http.MethodGet, "/transfers?limit=2&after=1", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		var got []app.Transfer
+		json.NewDecoder(response.Body).Decode(&got)
+		if len(got) != 2 || got[0].ID != 2 || got[1].ID != 3 {
+			t.Errorf("got transfers %v; want 2 and 3", got)
+		}
+		app.AssertString(t, response.Header().Get("Link"), "")
+	})
+}
@@ -0,0 +1,125 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/ratelimit"
+	"github.com/gorilla/mux"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+var (
+	ErrRateLimited = errors.New("too many requests")
+	ErrOverloaded  = errors.New("server is overloaded")
+)
+
+// RateLimits configures how much clients may call the API. Reads and writes
+// have separate budgets, each applied both per client and per account.
+type RateLimits struct {
+	Read        ratelimit.Rate
+	Write       ratelimit.Rate
+	MaxInFlight int // Requests served at once; 0 means no limit
+}
+
+// WithRateLimits refuses requests over limits with 429 Too Many Requests,
+// and requests over the in-flight cap with 503 Service Unavailable.
+func WithRateLimits(limits RateLimits) Option {
+	return func(s *Server) {
+		s.reads = ratelimit.NewLimiter(limits.Read)
+		s.writes = ratelimit.NewLimiter(limits.Write)
+		if limits.MaxInFlight > 0 {
+			s.inFlight = make(chan struct{}, limits.MaxInFlight)
+		}
+	}
+}
+
+// rateLimitMiddleware takes a token from the bucket of the client and, if
+// the request names one, from the bucket of the account it acts on. Neither
+// is spent unless both have one.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter, budget := s.reads, "read"
+		if changesState(r.Method) {
+			limiter, budget = s.writes, "write"
+		}
+
+		keys := []string{clientID(r)}
+		if account := requestAccount(r); account != "" {
+			keys = append(keys, "account:"+account)
+		}
+		if limited, retryAfter := limiter.AllowAll(keys...); limited != "" {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeError(w, r, http.StatusTooManyRequests, ErrRateLimited, "", fmt.Sprintf("%s limit exceeded for %s, retry in %ds", budget, limited, seconds))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitInFlight sheds requests beyond the in-flight cap instead of queueing
+// them.
+func (s *Server) limitInFlight(next http.Handler) http.Handler {
+	if s.inFlight == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Event streams stay open for long, so they are limited by the
+		// hub instead.
+		if s.eventHub != nil && r.URL.Path == "/events" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case s.inFlight <- struct{}{}:
+			defer func() { <-s.inFlight }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, http.StatusServiceUnavailable, ErrOverloaded, "", fmt.Sprintf("server is serving %d requests, retry later", cap(s.inFlight)))
+		}
+	})
+}
+
+// clientID identifies who made a request: the API key, the customer or, for
+// anonymous requests, the IP address.
+func clientID(r *http.Request) string {
+	if key, ok := auth.KeyFromContext(r.Context()); ok {
+		return "key:" + key.ID
+	}
+	if claims, ok := auth.FromContext(r.Context()); ok {
+		return "customer:" + claims.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// requestAccount returns the ID of the account a request acts on, taken
+// from the path or from the origin account of a transfer.
+func requestAccount(r *http.Request) string {
+	if ID, ok := mux.Vars(r)["account_id"]; ok {
+		return ID
+	}
+	if !changesState(r.Method) {
+		return ""
+	}
+	body, err := peekBody(r)
+	if err != nil || len(body) == 0 {
+		return ""
+	}
+	var origin struct {
+		AccountOriginID *uint64 `json:"account_origin_id"`
+	}
+	if json.Unmarshal(body, &origin) != nil || origin.AccountOriginID == nil {
+		return ""
+	}
+	return strconv.FormatUint(*origin.AccountOriginID, 10)
+}
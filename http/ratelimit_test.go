@@ -0,0 +1,115 @@
+package http
+
+import (
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/ratelimit"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimits(t *testing.T) {
+	newServer := func(limits RateLimits) *Server {
+		accountStore := store.NewAccountStore(app.StartingID(3),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 1000000},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 1000000},
+			app.Account{ID: 3, Name: "Ana Lima", CPF: "38145671004", Balance: 0},
+		)
+		return NewServer(accountStore, store.NewTransferStore(app.StartingID(0)), WithRateLimits(limits))
+	}
+
+	do := func(server http.Handler, method, path, remoteAddr, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.RemoteAddr = remoteAddr
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	slow := ratelimit.Rate{PerSecond: 0.5, Burst: 2}
+
+	t.Run("should answer 429 with Retry-After once a client spends its budget", func(t *testing.T) {
+		server := newServer(RateLimits{Read: slow})
+
+		do(server, http.MethodGet, "/accounts", "10.0.0.1:5000", "")
+		do(server, http.MethodGet, "/accounts", "10.0.0.1:5001", "")
+		response := do(server, http.MethodGet, "/accounts", "10.0.0.1:5002", "")
+
+		assertErrorCode(t, response, http.StatusTooManyRequests, "rate_limited", "")
+		app.AssertString(t, response.Header().Get("Retry-After"), "2")
+
+		response = do(server, http.MethodGet, "/accounts", "10.0.0.2:5000", "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("should keep separate budgets for reads and writes", func(t *testing.T) {
+		server := newServer(RateLimits{Read: slow, Write: slow})
+
+		do(server, http.MethodGet, "/accounts", "10.0.0.1:5000", "")
+		do(server, http.MethodGet, "/accounts", "10.0.0.1:5000", "")
+		response := do(server, http.MethodPost, "/transfers", "10.0.0.1:5000", `{"account_origin_id":1,"account_destination_id":3,"amount":100}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+	})
+
+	t.Run("should limit writes from the same origin account across clients", func(t *testing.T) {
+		server := newServer(RateLimits{Write: slow})
+
+		do(server, http.MethodPost, "/transfers", "10.0.0.1:5000", `{"account_origin_id":1,"account_destination_id":3,"amount":100}`)
+		do(server, http.MethodPost, "/transfers", "10.0.0.2:5000", `{"account_origin_id":1,"account_destination_id":3,"amount":200}`)
+		response := do(server, http.MethodPost, "/transfers", "10.0.0.3:5000", `{"account_origin_id":1,"account_destination_id":3,"amount":300}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusTooManyRequests)
+
+		response = do(server, http.MethodPost, "/transfers", "10.0.0.3:5000", `{"account_origin_id":2,"account_destination_id":3,"amount":300}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+	})
+
+	t.Run("should not spend the client budget on requests the account budget refuses", func(t *testing.T) {
+		server := newServer(RateLimits{Write: slow})
+		do(server, http.MethodPost, "/transfers", "10.0.0.1:5000", `{"account_origin_id":1,"account_destination_id":3,"amount":100}`)
+		do(server, http.MethodPost, "/transfers", "10.0.0.1:5000", `{"account_origin_id":1,"account_destination_id":3,"amount":200}`)
+
+		for i := 0; i < 2; i++ {
+			response := do(server, http.MethodPost, "/transfers", "10.0.0.2:5000", `{"account_origin_id":1,"account_destination_id":3,"amount":300}`)
+			app.AssertHTTPStatus(t, response.Code, http.StatusTooManyRequests)
+		}
+		response := do(server, http.MethodPost, "/transfers", "10.0.0.2:5000", `{"account_origin_id":2,"account_destination_id":3,"amount":300}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+	})
+
+	t.Run("should limit balance lookups per account", func(t *testing.T) {
+		server := newServer(RateLimits{Read: slow})
+
+		do(server, http.MethodGet, "/accounts/1/balance", "10.0.0.1:5000", "")
+		do(server, http.MethodGet, "/accounts/1/balance", "10.0.0.2:5000", "")
+		response := do(server, http.MethodGet, "/accounts/1/balance", "10.0.0.3:5000", "")
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusTooManyRequests)
+	})
+
+	t.Run("should shed requests over the in-flight cap", func(t *testing.T) {
+		server := newServer(RateLimits{MaxInFlight: 1})
+		release := make(chan struct{})
+		started := make(chan struct{})
+		blocking := server.limitInFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}))
+
+		go do(blocking, http.MethodGet, "/accounts", "10.0.0.1:5000", "")
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("first request did not start")
+		}
+		response := do(blocking, http.MethodGet, "/accounts", "10.0.0.2:5000", "")
+		close(release)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusServiceUnavailable)
+		app.AssertString(t, response.Header().Get("Retry-After"), "1")
+	})
+}
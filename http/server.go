@@ -1,34 +1,53 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/audit"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"github.com/erikacarvalho/stone-challenge/metrics"
+	"github.com/erikacarvalho/stone-challenge/ratelimit"
 	"github.com/erikacarvalho/stone-challenge/store"
+	"github.com/erikacarvalho/stone-challenge/webhook"
 	"github.com/gorilla/mux"
-	"log"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"reflect"
 	"regexp"
 	"strconv"
+	"sync"
+	"time"
 )
 
 const JsonContentType = "application/json"
 
+// MaxBodySize is the largest request body accepted, in bytes.
+const MaxBodySize = 1 << 20
+
 var (
-	CPFPattern = regexp.MustCompile(`^\d{11}$`)
+	CPFPattern  = regexp.MustCompile(`^\d{11}$`)
 	NamePattern = regexp.MustCompile(`^\w+`)
 )
 
 var (
-	ErrInvalidCPF = errors.New("invalid cpf: it must have 11 numbers")
+	ErrInvalidCPF  = errors.New("invalid cpf: it must have 11 numbers")
 	ErrInvalidName = errors.New("invalid name: it cannot be empty")
+	ErrInvalidType = errors.New("invalid type: it must be checking, savings or business")
 )
 
 type CreateAccountRequest struct {
-	Name    string `json:"name"`
-	CPF     string `json:"cpf"`
-	Balance uint64 `json:"balance"`
+	Name     string `json:"name"`
+	CPF      string `json:"cpf"`
+	Balance  uint64 `json:"balance"`
+	Type     string `json:"type,omitempty"`     // Defaults to checking
+	Password string `json:"password,omitempty"` // Required when auth is enabled
 }
 
 type CreateAccountResponse struct {
@@ -38,66 +57,136 @@ type CreateAccountResponse struct {
 type CreateTransferRequest struct {
 	AccountOriginID      uint64 `json:"account_origin_id"`
 	AccountDestinationID uint64 `json:"account_destination_id"`
+	DestinationKey       string `json:"destination_key,omitempty"` // Addressing key of the destination, in place of its ID
 	Amount               uint64 `json:"amount"`
 }
 
 type CreateTransferResponse struct {
-	ID uint64 `json:"id"`
+	ID        uint64     `json:"id"`
+	Status    string     `json:"status,omitempty"`     // Only sent for transfers pending confirmation
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // When the confirmation expires
 }
 
 type GetBalanceResponse struct {
-	ID      uint64 `json:"id"`
-	Balance uint64 `json:"balance"`
+	ID              uint64 `json:"id"`
+	Balance         uint64 `json:"balance"`
+	AccruedInterest uint64 `json:"accrued_interest,omitempty"`
 }
 
 type Server struct {
 	accountStore  *store.AccountStore
 	transferStore *store.TransferStore
+	auditLog      *audit.Log
+	tokens        *auth.Issuer
+	keys          *auth.KeyStore
+	logger        *logging.Logger
+	webhooks      *webhook.Dispatcher
+
+	eventHub       *events.Hub
+	streamDuration time.Duration
+
+	checks    []readinessCheck
+	draining  int32
+	drained   chan struct{} // Closed on Drain, to end event streams
+	drainOnce sync.Once
+
+	metrics      *metrics.Registry
+	metricsToken string // Bearer token GET /metrics may be called with; empty only allows API keys
+	requests     *metrics.Counter
+	latencies    *metrics.Histogram
+
+	stepUpThreshold uint64
+	confirmationTTL time.Duration
+
+	reads       *ratelimit.Limiter
+	writes      *ratelimit.Limiter
+	inFlight    chan struct{}
+	idempotency *idempotencyCache
+	charges     chargeLocks // Held for each dynamic charge being paid, so that it is paid once
+	decoySecret string
+	router      *mux.Router // Kept so that tests can walk the routes
 	http.Handler
 }
 
+// Option configures optional features of a Server.
+type Option func(*Server)
+
+// WithAuditLog records every state-changing API call on l and serves the
+// log under /audit.
+func WithAuditLog(l *audit.Log) Option {
+	return func(s *Server) {
+		s.auditLog = l
+	}
+}
 
 // addAccount creates a new account based on a CreateAccountRequest
 // and returns its ID.
 func (s *Server) addAccount(w http.ResponseWriter, r *http.Request) {
-	if r.Body == nil {
-		log.Println("request body is empty")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("invalid request"))
+	creationRequest := CreateAccountRequest{}
+
+	if !decodeBody(w, r, &creationRequest) {
 		return
 	}
 
-	creationRequest := CreateAccountRequest{}
-
-	err := json.NewDecoder(r.Body).Decode(&creationRequest)
+	err := checkCPF(creationRequest.CPF)
 	if err != nil {
-		log.Printf("error decoding body to CreateAccountRequest: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("invalid request"))
+		writeError(w, r, http.StatusBadRequest, err, "cpf", err.Error())
 		return
 	}
 
-	err = checkCPF(creationRequest.CPF)
+	err = checkName(creationRequest.Name)
 	if err != nil {
-		log.Printf("error validating CreateAccountRequest: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error()))
+		writeError(w, r, http.StatusBadRequest, err, "name", err.Error())
 		return
 	}
 
-	err = checkName(creationRequest.Name)
+	if creationRequest.Type == "" {
+		creationRequest.Type = store.AccountTypeChecking
+	}
+	err = checkType(creationRequest.Type)
 	if err != nil {
-		log.Printf("error validating CreateAccountRequest: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error()))
+		writeError(w, r, http.StatusBadRequest, err, "type", err.Error())
 		return
 	}
 
-	newAccID, _ := s.accountStore.CreateAccount(creationRequest.Name, creationRequest.CPF, creationRequest.Balance)
+	var secret string
+	if s.tokens != nil || creationRequest.Password != "" {
+		err = checkPassword(creationRequest.Password)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err, "password", err.Error())
+			return
+		}
+		secret, err = s.secretFor(r, creationRequest.CPF, creationRequest.Password)
+		if err == ErrInvalidCredentials {
+			writeError(w, r, http.StatusUnauthorized, err, "password", "cpf already has accounts with a different password")
+			return
+		}
+		if err == ErrPasswordNotSet {
+			writeError(w, r, http.StatusForbidden, err, "password", err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error hashing password: %v", err))
+			return
+		}
+	}
+
+	newAccID, err := s.accountStore.OpenAccount(r.Context(), creationRequest.Type, creationRequest.Name, creationRequest.CPF, creationRequest.Balance)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error opening account: %v", err))
+		return
+	}
+	noteAccounts(r, newAccID)
+	if secret != "" {
+		err = s.accountStore.SetSecret(r.Context(), newAccID, secret)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error setting account password: %v", err))
+			return
+		}
+	}
 	jsonBytes, err := json.Marshal(CreateAccountResponse{ID: newAccID})
 	if err != nil {
-		log.Printf("error marshaling new account ID: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling new account ID: %v", err))
 		return
 	}
 	w.Header().Set("content-type", JsonContentType)
@@ -105,80 +194,128 @@ func (s *Server) addAccount(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonBytes)
 }
 
-// listAccounts returns the list of all accounts.
-func (s *Server) listAccounts(w http.ResponseWriter) {
+// listAccounts returns the list of all accounts, or a page of it when the
+// request has the limit or after parameters. Customers only get their own
+// accounts.
+func (s *Server) listAccounts(w http.ResponseWriter, r *http.Request) {
+	p, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
 	getList, err := s.accountStore.ListAllAccounts()
+	if owned, limited := s.ownedAccounts(r); limited {
+		var ownList []app.Account
+		for _, account := range getList {
+			if owned[account.ID] {
+				ownList = append(ownList, account)
+			}
+		}
+		getList = ownList
+	}
 
-	if err == store.ErrNoRecords {
+	if len(getList) == 0 {
 		w.Header().Set("content-type", JsonContentType)
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("[]"))
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(getList)
+	start, end, more := p.bounds(len(getList), func(i int) uint64 { return getList[i].ID })
+	getList = getList[start:end]
+	if more {
+		p.setNextLink(w, r, getList[len(getList)-1].ID)
+	}
+	jsonBytes, err := json.Marshal(getList)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling accounts: %v", err))
 		return
 	}
 	w.Header().Set("content-type", JsonContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonBytes)
 }
+
 // transferAmount is responsible for the whole process of transferring
 // an amount based on a request for creating transfer generated by method
 // POST on /transfers endpoint. It wraps the methods for creating,
 // authorizing and performing a transfer.
 func (s *Server) transferAmount(w http.ResponseWriter, r *http.Request) {
-	if r.Body == nil {
-		log.Println("request body is empty")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("invalid request"))
-		return
-	}
-
 	creationRequest := CreateTransferRequest{}
 
-	err := json.NewDecoder(r.Body).Decode(&creationRequest)
-	if err != nil {
-		log.Printf("error decoding body to CreateTransferRequest: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("invalid request"))
+	if !decodeBody(w, r, &creationRequest) {
 		return
 	}
 
+	if creationRequest.DestinationKey != "" {
+		if creationRequest.AccountDestinationID != 0 {
+			writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "destination_key", "send either account_destination_id or destination_key, not both")
+			return
+		}
+		destination, _, err := s.accountStore.FindKey(creationRequest.DestinationKey)
+		if err != nil {
+			writeError(w, r, errorStatus(err), err, "destination_key", err.Error())
+			return
+		}
+		creationRequest.AccountDestinationID = destination.ID
+	}
+	s.sendTransfer(w, r, creationRequest)
+}
+
+// sendTransfer makes the transfer asked for by a request with its
+// destination ID and responds with it, holding it for a TOTP confirmation
+// when it needs one. It returns the ID of the transfer, or 0 if it was not
+// made.
+func (s *Server) sendTransfer(w http.ResponseWriter, r *http.Request, creationRequest CreateTransferRequest) uint64 {
+	noteAccounts(r, creationRequest.AccountOriginID, creationRequest.AccountDestinationID)
 	origAccount, err := s.accountStore.GetAccount(creationRequest.AccountOriginID)
 	if err != nil {
-		errMsg := fmt.Sprintf("account %d not found. error: %q", creationRequest.AccountOriginID, err)
-		log.Println(errMsg)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(errMsg))
-		return
+		writeError(w, r, errorStatus(err), err, "account_origin_id", fmt.Sprintf("account %d not found", creationRequest.AccountOriginID))
+		return 0
+	}
+	if !s.checkOwner(w, r, origAccount, "account_origin_id") {
+		return 0
 	}
 	destAccount, err := s.accountStore.GetAccount(creationRequest.AccountDestinationID)
 	if err != nil {
-		errMsg := fmt.Sprintf("account %d not found. error: %q", creationRequest.AccountDestinationID, err)
-		log.Println(errMsg)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(errMsg))
-		return
-	}
-
-	newTransferID, err := s.addTransfer(&origAccount, &destAccount, creationRequest.Amount)
+		writeError(w, r, errorStatus(err), err, "account_destination_id", fmt.Sprintf("account %d not found", creationRequest.AccountDestinationID))
+		return 0
+	}
+
+	if s.needsStepUp(r, creationRequest.Amount) {
+		if !checkTOTPEnabled(w, r, origAccount, s.stepUpThreshold) {
+			return 0
+		}
+		newTransferID, err := s.transferStore.CreateTransfer(r.Context(), creationRequest.AccountOriginID, creationRequest.AccountDestinationID, creationRequest.Amount)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error creating transfer: %v", err))
+			return 0
+		}
+		expiresAt := s.holdTransfers(r.Context(), newTransferID)
+		w.Header().Set("Location", fmt.Sprintf("/transfers/%d", newTransferID))
+		writeJSON(w, r, http.StatusAccepted, CreateTransferResponse{
+			ID:        newTransferID,
+			Status:    store.ToStatusMsg(store.StatusPendingConfirmation),
+			ExpiresAt: &expiresAt,
+		})
+		return newTransferID
+	}
+
+	newTransferID, err := s.addTransfer(r.Context(), &origAccount, &destAccount, creationRequest.Amount)
 	if err != nil {
 		errMsg := fmt.Sprintf("error transferring from account [%d] to account [%d]: %s", creationRequest.AccountOriginID, creationRequest.AccountDestinationID, err)
-		log.Println(errMsg)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(errMsg))
-		return
+		writeError(w, r, errorStatus(err), err, transferErrorField(err), errMsg)
+		return 0
 	}
 	jsonBytes, err := json.Marshal(CreateTransferResponse{ID: newTransferID})
 	if err != nil {
-		log.Printf("error marshaling new transfer ID: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling new transfer ID: %v", err))
+		return newTransferID
 	}
 	w.Header().Set("content-type", JsonContentType)
+	w.Header().Set("Location", fmt.Sprintf("/transfers/%d", newTransferID))
 	w.WriteHeader(http.StatusCreated)
 	w.Write(jsonBytes)
+	return newTransferID
 }
 
 // addTransfer takes in the creation transfer request and transforms into
@@ -187,65 +324,97 @@ func (s *Server) transferAmount(w http.ResponseWriter, r *http.Request) {
 // if it has been not authorized) and an error message. If an error occurs
 // specifically when trying to create the transfer in the store, it will return
 // id 0 along with the error.
-func (s *Server) addTransfer(origin, destination *app.Account, amount uint64) (id uint64, err error) {
-	transferID, err := s.transferStore.CreateTransfer(origin.ID, destination.ID, amount)
+func (s *Server) addTransfer(ctx context.Context, origin, destination *app.Account, amount uint64) (id uint64, err error) {
+	transferID, err := s.transferStore.CreateTransfer(ctx, origin.ID, destination.ID, amount)
 	if err != nil {
 		return 0, err
 	}
 
-	err = s.transferStore.AuthorizeTransfer(origin, destination, amount, transferID)
+	return transferID, s.completeTransfer(ctx, origin, destination, amount, transferID)
+}
+
+// completeTransfer authorizes a created transfer and, if it is authorized,
+// exchanges the amount and confirms it.
+func (s *Server) completeTransfer(ctx context.Context, origin, destination *app.Account, amount, transferID uint64) error {
+	err := s.transferStore.AuthorizeTransfer(ctx, origin, destination, amount, transferID)
 
 	if err != nil {
-		return transferID, err
+		return err
 	}
 
-	err = s.exchangeAmount(origin.ID, destination.ID, amount)
+	err = s.exchangeAmount(ctx, transferID)
 	if err != nil {
-		s.transferStore.Cancel(transferID)
+		s.transferStore.Cancel(ctx, transferID)
+		return err
 	}
-	s.transferStore.Confirm(transferID)
+	s.transferStore.Confirm(ctx, transferID)
 
-	return transferID, nil
+	return nil
 }
 
 // exchangeAmount is responsible for perfoming the actual exchange of the
-// amount between two accounts.
-func (s *Server) exchangeAmount(originAcc, destinationAcc, amount uint64) error {
-	//retrieving accounts
-	origin, err := s.accountStore.GetAccount(originAcc)
-	if err != nil {
-		return fmt.Errorf("impossible to retrieve origin account: %w", err)
-	}
-	destination, err := s.accountStore.GetAccount(destinationAcc)
+// amount of one or more transfers from the same origin account, crediting
+// their fees to the bank fee account. All balances change in a single step.
+func (s *Server) exchangeAmount(ctx context.Context, transferIDs ...uint64) error {
+	var origin uint64
+	var credits []store.Credit
+	for _, id := range transferIDs {
+		transfer, err := s.transferStore.GetTransfer(id)
+		if err != nil {
+			return fmt.Errorf("impossible to retrieve transfer: %w", err)
+		}
+		origin = transfer.AccountOriginID
+		credits = append(credits, store.Credit{AccountID: transfer.AccountDestinationID, Amount: transfer.Amount})
+		if transfer.Fee > 0 {
+			credits = append(credits, store.Credit{AccountID: s.transferStore.FeeAccountID(), Amount: transfer.Fee})
+		}
+	}
+	err := s.accountStore.MoveFunds(ctx, origin, credits...)
 	if err != nil {
-		return fmt.Errorf("impossible to retrieve destination account: %w", err)
+		return fmt.Errorf("impossible to exchange amount: %w", err)
 	}
-	//modifying balances
-	origin.Balance, destination.Balance = origin.Balance-amount, destination.Balance+amount
-	//persisting new data
-	s.accountStore.SetAccount(origin)
-	s.accountStore.SetAccount(destination)
-
 	return nil
 }
 
-// listTransfer returns the list of all transfers.
-func (s *Server) listTransfer(w http.ResponseWriter) {
+// listTransfer returns the list of all transfers, or a page of it when the
+// request has the limit or after parameters. Customers only get the ones to
+// or from their accounts.
+func (s *Server) listTransfer(w http.ResponseWriter, r *http.Request) {
+	p, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
 	transfers, err := s.transferStore.ListAllTransfers()
+	if owned, limited := s.ownedAccounts(r); limited {
+		var ownTransfers []app.Transfer
+		for _, transfer := range transfers {
+			if owned[transfer.AccountOriginID] || owned[transfer.AccountDestinationID] {
+				ownTransfers = append(ownTransfers, transfer)
+			}
+		}
+		transfers = ownTransfers
+	}
 
-	if err == store.ErrNoTransfers {
+	if len(transfers) == 0 {
 		w.Header().Set("content-type", JsonContentType)
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("[]"))
 		return
 	}
 
-	w.Header().Set("content-type", JsonContentType)
-	err = json.NewEncoder(w).Encode(transfers)
+	start, end, more := p.bounds(len(transfers), func(i int) uint64 { return transfers[i].ID })
+	transfers = transfers[start:end]
+	if more {
+		p.setNextLink(w, r, transfers[len(transfers)-1].ID)
+	}
+	jsonBytes, err := json.Marshal(transfers)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling transfers: %v", err))
 		return
 	}
+	w.Header().Set("content-type", JsonContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonBytes)
 }
 
 // accountsHandler redirects '/accounts' endpoint requests to their
@@ -253,52 +422,49 @@ func (s *Server) listTransfer(w http.ResponseWriter) {
 func (s *Server) accountsHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		s.listAccounts(w)
+		s.listAccounts(w, r)
 	case http.MethodPost:
 		s.addAccount(w, r)
 	default:
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
 	}
 }
 
 // balanceHandler responds with balance to a given account ID.
 func (s *Server) balanceHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 	varsMap := mux.Vars(r)
 	idStr, ok := varsMap["account_id"]
 	if !ok {
-		log.Println("it was impossible to obtain the ID from the path")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, ErrInternal, "", "it was impossible to obtain the ID from the path")
 		return
 	}
 
 	ID, err := strconv.ParseUint(idStr, 10, 64)
 	if err != nil {
-		errMsg := fmt.Sprintf("account ID is invalid. ID given: %v", idStr)
-		log.Println(errMsg)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(errMsg))
+		writeError(w, r, http.StatusBadRequest, ErrInvalidID, "account_id", fmt.Sprintf("account ID is invalid. ID given: %v", idStr))
 		return
 	}
 
-	balance, err := s.accountStore.GetBalance(ID)
+	noteAccounts(r, ID)
+	account, err := s.accountStore.GetAccount(ID)
 	if err == store.ErrAccountNotFound {
-		errMsg := fmt.Sprintf("account %v not found", ID)
-		log.Println(errMsg)
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(errMsg))
+		writeError(w, r, http.StatusNotFound, err, "account_id", fmt.Sprintf("account %v not found", ID))
+		return
+	}
+	if !s.checkOwner(w, r, account, "account_id") {
 		return
 	}
 	jsonBytes, err := json.Marshal(GetBalanceResponse{
-		ID:      ID,
-		Balance: balance,
+		ID:              ID,
+		Balance:         account.Balance,
+		AccruedInterest: account.AccruedInterest,
 	})
 	if err != nil {
-		log.Printf("error marshaling balance: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling balance: %v", err))
 		return
 	}
 
@@ -312,49 +478,46 @@ func (s *Server) balanceHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) transfersHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		s.listTransfer(w)
+		s.listTransfer(w, r)
 	case http.MethodPost:
 		s.transferAmount(w, r)
 	default:
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
 	}
 }
 
 // transferIDHandler returns all fields of a given transfer ID.
 func (s *Server) transferIDHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 	varsMap := mux.Vars(r)
 	idStr, ok := varsMap["transfer_id"]
 	if !ok {
-		log.Println("it was impossible to obtain the ID from the path")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, ErrInternal, "", "it was impossible to obtain the ID from the path")
 		return
 	}
 
 	ID, err := strconv.ParseUint(idStr, 10, 64)
 	if err != nil {
-		errMsg := fmt.Sprintf("transfer ID is invalid. ID given: %v", idStr)
-		log.Println(errMsg)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(errMsg))
+		writeError(w, r, http.StatusBadRequest, ErrInvalidID, "transfer_id", fmt.Sprintf("transfer ID is invalid. ID given: %v", idStr))
 		return
 	}
 
 	transfer, err := s.transferStore.GetTransfer(ID)
 	if err == store.ErrTransferNotFound {
-		errMsg := fmt.Sprintf("transfer %v not found", ID)
-		log.Println(errMsg)
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(errMsg))
+		writeError(w, r, http.StatusNotFound, err, "transfer_id", fmt.Sprintf("transfer %v not found", ID))
+		return
+	}
+	noteAccounts(r, transfer.AccountOriginID, transfer.AccountDestinationID)
+	if owned, limited := s.ownedAccounts(r); limited && !owned[transfer.AccountOriginID] && !owned[transfer.AccountDestinationID] {
+		writeError(w, r, http.StatusForbidden, ErrAccountNotOwned, "transfer_id", fmt.Sprintf("transfer %d is not to or from an account of the authenticated customer", ID))
 		return
 	}
 	jsonBytes, err := json.Marshal(transfer)
 	if err != nil {
-		log.Printf("error marshaling transfer: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling transfer: %v", err))
 		return
 	}
 
@@ -364,22 +527,130 @@ func (s *Server) transferIDHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // NewServer returns a new server with an account store, a transfer
-// store and its routes.
-func NewServer(as *store.AccountStore, ts *store.TransferStore) *Server {
-	p := &Server{accountStore: as, transferStore: ts}
+// store, its routes and the optional features set by options.
+func NewServer(as *store.AccountStore, ts *store.TransferStore, options ...Option) *Server {
+	p := &Server{accountStore: as, transferStore: ts, logger: logging.Default(), idempotency: newIdempotencyCache(), drained: make(chan struct{})}
+	for _, option := range options {
+		option(p)
+	}
 
 	router := mux.NewRouter()
+	router.Use(matchedRoute)
+
+	readOnly := permissions{http.MethodGet: auth.RoleReadOnly}
+	readWrite := permissions{http.MethodGet: auth.RoleReadOnly, http.MethodPost: auth.RoleOperator}
+
+	router.HandleFunc("/accounts", p.guard(p.accountsHandler, readWrite))
+	router.HandleFunc("/accounts/{account_id}/balance", p.guard(p.balanceHandler, readOnly))
+	router.HandleFunc("/accounts/{account_id}/statement", p.guard(p.statementHandler, readOnly))
+	router.HandleFunc("/accounts/{account_id}/keys", p.guard(p.accountKeysHandler, readWrite))
+	router.HandleFunc("/accounts/{account_id}/keys/{key}", p.guard(p.accountKeyHandler, permissions{http.MethodDelete: auth.RoleOperator}))
+	router.HandleFunc("/keys/{key}", p.guard(p.lookupKeyHandler, readOnly))
+	router.HandleFunc("/accounts/{account_id}/charges", p.guard(p.chargesHandler, readWrite))
+	router.HandleFunc("/transfers", p.guard(p.transfersHandler, readWrite))
+	router.HandleFunc("/transfers/split", p.guard(p.splitTransfer, readWrite))
+	router.HandleFunc("/transfers/brcode", p.guard(p.payBRCodeHandler, readWrite))
+	router.HandleFunc("/transfers/{transfer_id}", p.guard(p.transferIDHandler, readOnly))
+	router.HandleFunc("/healthz", p.healthHandler)
+	router.HandleFunc("/readyz", p.readyHandler)
+	router.HandleFunc("/openapi.json", p.openAPIHandler)
+
+	if p.auditLog != nil {
+		router.HandleFunc("/audit", p.adminOnly(p.auditHandler))
+		router.HandleFunc("/audit/verify", p.adminOnly(p.auditVerifyHandler))
+		router.Use(p.auditMiddleware)
+	}
+
+	if p.metrics != nil {
+		router.HandleFunc("/metrics", p.metricsAuth(p.metricsHandler))
+	}
+
+	if p.confirmationTTL > 0 {
+		router.HandleFunc("/accounts/{account_id}/totp", p.guard(p.enrollTOTPHandler, readWrite))
+		router.HandleFunc("/accounts/{account_id}/totp/activate", p.guard(p.activateTOTPHandler, readWrite))
+		router.HandleFunc("/transfers/{transfer_id}/confirm", p.guard(p.confirmTransferHandler, readWrite))
+	}
+
+	if p.keys != nil {
+		router.HandleFunc("/admin/keys", p.adminOnly(p.keysHandler))
+		router.HandleFunc("/admin/keys/{key_id}", p.adminOnly(p.keyHandler))
+		router.HandleFunc("/admin/keys/{key_id}/rotate", p.adminOnly(p.rotateKeyHandler))
+		router.HandleFunc("/admin/export", p.adminOnly(p.exportHandler))
+		router.HandleFunc("/admin/import", p.adminOnly(p.importHandler))
+		router.HandleFunc("/batches/cnab240", p.keyOnly(p.cnabHandler, auth.RoleOperator))
+		router.Use(p.apiKeyMiddleware)
+	}
+
+	if p.eventHub != nil {
+		router.HandleFunc("/events", p.guard(p.eventsHandler, readOnly))
+	}
+
+	if p.webhooks != nil {
+		router.HandleFunc("/webhooks", p.adminOnly(p.webhooksHandler))
+		router.HandleFunc("/webhooks/dead-letters", p.adminOnly(p.deadLettersHandler))
+		router.HandleFunc("/webhooks/dead-letters/{delivery_id}/redeliver", p.adminOnly(p.redeliverHandler))
+		router.HandleFunc("/webhooks/{webhook_id}", p.adminOnly(p.webhookHandler))
+	}
+
+	if p.tokens != nil {
+		router.HandleFunc("/login", p.login)
+		router.Use(p.authMiddleware)
+	}
+
+	if p.reads != nil {
+		router.Use(p.rateLimitMiddleware)
+	}
+
+	router.Use(p.idempotencyMiddleware)
 
-	router.HandleFunc("/accounts", p.accountsHandler)
-	router.HandleFunc("/accounts/{account_id}/balance", p.balanceHandler)
-	router.HandleFunc("/transfers", p.transfersHandler)
-	router.HandleFunc("/transfers/{transfer_id}", p.transferIDHandler)
+	router.NotFoundHandler = http.HandlerFunc(routeNotFound)
 
-	p.Handler = router
+	p.router = router
+	p.Handler = withRequestID(p.accessLog(p.limitInFlight(router)))
 
 	return p
 }
 
+// decodeBody decodes the JSON body of r into v. If it cannot, it responds
+// with the reason and returns false. Requests without a content type are
+// taken as JSON.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Body == nil {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "", "request body is empty")
+		return false
+	}
+
+	if contentType := r.Header.Get("content-type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != JsonContentType {
+			writeError(w, r, http.StatusUnsupportedMediaType, ErrUnsupportedMedia, "", fmt.Sprintf("content type %q is not supported: it must be %s", contentType, JsonContentType))
+			return false
+		}
+	}
+
+	tooLarge := fmt.Sprintf("request body must have at most %d bytes", MaxBodySize)
+	if r.ContentLength > MaxBodySize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, ErrBodyTooLarge, "", tooLarge)
+		return false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "", fmt.Sprintf("error reading body: %v", err))
+		return false
+	}
+	if len(body) > MaxBodySize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, ErrBodyTooLarge, "", tooLarge)
+		return false
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "", fmt.Sprintf("error decoding body to %s: %v", reflect.TypeOf(v).Elem().Name(), err))
+		return false
+	}
+	return true
+}
+
 func checkCPF(cpf string) error {
 	if !CPFPattern.MatchString(cpf) {
 		return ErrInvalidCPF
@@ -387,9 +658,29 @@ func checkCPF(cpf string) error {
 	return nil
 }
 
+func checkType(accountType string) error {
+	switch accountType {
+	case store.AccountTypeChecking, store.AccountTypeSavings, store.AccountTypeBusiness:
+		return nil
+	}
+	return ErrInvalidType
+}
+
+// transferErrorField returns the request field to blame for an error
+// authorizing a transfer.
+func transferErrorField(err error) string {
+	switch {
+	case errors.Is(err, store.ErrSameID):
+		return "account_destination_id"
+	case errors.Is(err, store.ErrInvalidAmount), errors.Is(err, store.ErrInsufficientBalance):
+		return "amount"
+	}
+	return ""
+}
+
 func checkName(name string) error {
 	if !NamePattern.MatchString(name) {
 		return ErrInvalidName
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -6,8 +6,12 @@ import (
 	"fmt"
 	app "github.com/erikacarvalho/stone-challenge"
 	"github.com/erikacarvalho/stone-challenge/store"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -57,7 +61,7 @@ func TestAccounts(t *testing.T) {
 		want := []app.Account{account1, account2, account3}
 
 		for i := range want {
-			if want[i] != got[i] {
+			if !reflect.DeepEqual(want[i], got[i]) {
 				t.Errorf("got %v; want %v", got[i], want[i])
 				t.FailNow()
 			}
@@ -125,6 +129,28 @@ func TestAccounts(t *testing.T) {
 		}
 	})
 
+	t.Run("should return 500 when the account cannot be opened", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "accounts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		accountStore, transferStore, journal, err := store.OpenEventStore(filepath.Join(dir, "journal"), filepath.Join(dir, "snapshot.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		journal.Close()
+		server := NewServer(accountStore, transferStore)
+
+		jsonAcc, _ := json.Marshal(CreateAccountRequest{Name: "Arlene Araújo Nogueira", CPF: "08312653457", Balance: 2578265})
+		request, _ := http.NewRequest(http.MethodPost, "/accounts", bytes.NewBuffer(jsonAcc))
+		request.Header.Set("content-type", JsonContentType)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusInternalServerError)
+	})
+
 	t.Run("should return error if cpf is invalid", func(t *testing.T) {
 		server := NewServer(nil, nil)
 
@@ -141,10 +167,11 @@ func TestAccounts(t *testing.T) {
 		response := httptest.NewRecorder()
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := `invalid cpf: it must have 11 numbers`
-
-		app.AssertResponseBody(t, got, want)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_cpf",
+			Message: "invalid cpf: it must have 11 numbers",
+			Field:   "cpf",
+		})
 		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
 	})
 
@@ -164,10 +191,36 @@ func TestAccounts(t *testing.T) {
 		response := httptest.NewRecorder()
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := `invalid name: it cannot be empty`
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_name",
+			Message: "invalid name: it cannot be empty",
+			Field:   "name",
+		})
+		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+	})
 
-		app.AssertResponseBody(t, got, want)
+	t.Run("should return error if type is invalid", func(t *testing.T) {
+		server := NewServer(nil, nil)
+
+		accountRequest := CreateAccountRequest{
+			Name:    "Maria das Neves",
+			CPF:     "08389076580",
+			Balance: 1000,
+			Type:    store.AccountTypeBank,
+		}
+
+		jsonAcc, _ := json.Marshal(accountRequest)
+
+		request, _ := http.NewRequest(http.MethodPost, "/accounts", bytes.NewBuffer(jsonAcc))
+		request.Header.Set("content-type", JsonContentType)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_type",
+			Message: "invalid type: it must be checking, savings or business",
+			Field:   "type",
+		})
 		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
 	})
 
@@ -224,10 +277,11 @@ func TestAccountsBalance(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := fmt.Sprintf(`account %v not found`, inexistentID)
-
-		app.AssertResponseBody(t, got, want)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "account_not_found",
+			Message: fmt.Sprintf("account %v not found", inexistentID),
+			Field:   "account_id",
+		})
 		app.AssertHTTPStatus(t, response.Code, http.StatusNotFound)
 	})
 
@@ -242,10 +296,11 @@ func TestAccountsBalance(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := fmt.Sprintf(`account ID is invalid. ID given: %v`, invalidID)
-
-		app.AssertResponseBody(t, got, want)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_id",
+			Message: fmt.Sprintf("account ID is invalid. ID given: %v", invalidID),
+			Field:   "account_id",
+		})
 		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
 	})
 }
@@ -349,7 +404,10 @@ func TestTransfers(t *testing.T) {
 		server.ServeHTTP(response, request)
 
 		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
-		app.AssertResponseBody(t, response.Body.String(), "invalid request")
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_request",
+			Message: "request body is empty",
+		})
 	})
 
 	t.Run("should successfully transfer amount from origin account to destination account on POST", func(t *testing.T) {
@@ -418,6 +476,61 @@ func TestTransfers(t *testing.T) {
 		app.AssertString(t, response.Result().Header.Get("content-type"), JsonContentType)
 	})
 
+	t.Run("should charge fee and credit it to the bank fee account on POST", func(t *testing.T) {
+		account1 := app.Account{
+			ID:        207,
+			Name:      "Juliana da Cruz Clemente",
+			CPF:       "63000399003",
+			Balance:   70000,
+			CreatedAt: time.Date(2020, time.January, 3, 0, 0, 0, 0, time.UTC),
+			Type:      store.AccountTypeChecking,
+		}
+		account2 := app.Account{
+			ID:        986,
+			Name:      "Marlene de Souza Dalponte",
+			CPF:       "08312653457",
+			Balance:   51000,
+			CreatedAt: time.Date(2020, time.February, 9, 15, 0, 0, 0, time.UTC),
+		}
+		feeAccount := app.Account{ID: 1, Name: "Fee Revenue", Type: store.AccountTypeBank}
+
+		accountStore := store.NewAccountStore(
+			app.StartingID(3),
+			account1, account2, feeAccount,
+		)
+
+		transferStore := store.NewTransferStore(app.StartingID(0))
+		transferStore.SetFeeEngine(&store.FeeEngine{
+			AccountID: 1,
+			Rules:     []store.FeeRule{{AccountType: store.AccountTypeChecking, Flat: 200}},
+		})
+
+		server := NewServer(accountStore, transferStore)
+
+		jsonTransfer, _ := json.Marshal(CreateTransferRequest{
+			AccountOriginID:      207,
+			AccountDestinationID: 986,
+			Amount:               4000,
+		})
+
+		request, _ := http.NewRequest(http.MethodPost, "/transfers", bytes.NewBuffer(jsonTransfer))
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+
+		acc, _ := accountStore.GetAccount(207)
+		app.AssertUint64(t, acc.Balance, 65800)
+		acc, _ = accountStore.GetAccount(986)
+		app.AssertUint64(t, acc.Balance, 55000)
+		acc, _ = accountStore.GetAccount(1)
+		app.AssertUint64(t, acc.Balance, 200)
+
+		transfer, _ := transferStore.GetTransfer(1)
+		app.AssertUint64(t, transfer.Fee, 200)
+	})
+
 	t.Run("should return error if origin account ID is not found on POST", func(t *testing.T) {
 		accountStore := store.NewAccountStore(app.StartingID(90))
 		transferStore := store.NewTransferStore(app.StartingID(0))
@@ -440,11 +553,12 @@ func TestTransfers(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := `account 307 not found. error: "there is no account with this ID"`
-
-		app.AssertResponseBody(t, got, want)
-		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "account_not_found",
+			Message: "account 307 not found",
+			Field:   "account_origin_id",
+		})
+		app.AssertHTTPStatus(t, response.Code, http.StatusNotFound)
 	})
 
 	t.Run("should return error if destination account ID is not found", func(t *testing.T) {
@@ -480,11 +594,12 @@ func TestTransfers(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := `account 900 not found. error: "there is no account with this ID"`
-
-		app.AssertResponseBody(t, got, want)
-		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "account_not_found",
+			Message: "account 900 not found",
+			Field:   "account_destination_id",
+		})
+		app.AssertHTTPStatus(t, response.Code, http.StatusNotFound)
 	})
 
 	t.Run("should return error if origin and destination account are the same", func(t *testing.T) {
@@ -520,11 +635,12 @@ func TestTransfers(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := `error transferring from account [307] to account [307]: origin and destination account ids are the same`
-
-		app.AssertResponseBody(t, got, want)
-		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "same_account",
+			Message: "error transferring from account [307] to account [307]: origin and destination account ids are the same",
+			Field:   "account_destination_id",
+		})
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnprocessableEntity)
 	})
 
 	t.Run("should return error if amount is invalid", func(t *testing.T) {
@@ -567,11 +683,12 @@ func TestTransfers(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := `error transferring from account [307] to account [405]: the amount entered is invalid`
-
-		app.AssertResponseBody(t, got, want)
-		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_amount",
+			Message: "error transferring from account [307] to account [405]: the amount entered is invalid",
+			Field:   "amount",
+		})
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnprocessableEntity)
 	})
 
 	t.Run("should return error if origin account balance is smaller than amount to be transferred", func(t *testing.T) {
@@ -614,11 +731,12 @@ func TestTransfers(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := `error transferring from account [307] to account [405]: origin account balance is too low to allow this transfer`
-
-		app.AssertResponseBody(t, got, want)
-		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "insufficient_balance",
+			Message: "error transferring from account [307] to account [405]: origin account balance is too low to allow this transfer",
+			Field:   "amount",
+		})
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnprocessableEntity)
 	})
 
 	t.Run("should return error if transfer seems to be duplicated", func(t *testing.T) {
@@ -671,11 +789,11 @@ func TestTransfers(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := `error transferring from account [307] to account [405]: this transfer seems to be duplicated`
-
-		app.AssertResponseBody(t, got, want)
-		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "duplicate_transfer",
+			Message: "error transferring from account [307] to account [405]: this transfer seems to be duplicated",
+		})
+		app.AssertHTTPStatus(t, response.Code, http.StatusConflict)
 	})
 
 	t.Run("should return method not allowed to methods other than GET and POST", func(t *testing.T) {
@@ -729,10 +847,11 @@ func TestTransfersID(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := fmt.Sprintf(`transfer %v not found`, inexistentID)
-
-		app.AssertResponseBody(t, got, want)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "transfer_not_found",
+			Message: fmt.Sprintf("transfer %v not found", inexistentID),
+			Field:   "transfer_id",
+		})
 		app.AssertHTTPStatus(t, response.Code, http.StatusNotFound)
 	})
 
@@ -747,10 +866,11 @@ func TestTransfersID(t *testing.T) {
 
 		server.ServeHTTP(response, request)
 
-		got := response.Body.String()
-		want := fmt.Sprintf(`transfer ID is invalid. ID given: %v`, invalidID)
-
-		app.AssertResponseBody(t, got, want)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_id",
+			Message: fmt.Sprintf("transfer ID is invalid. ID given: %v", invalidID),
+			Field:   "transfer_id",
+		})
 		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
 	})
 
@@ -0,0 +1,196 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"math"
+	"net/http"
+	"time"
+)
+
+var ErrInvalidPercentage = errors.New("invalid percentage: it must be between 0 and 100 with at most two decimal places")
+
+type SplitShareRequest struct {
+	AccountDestinationID uint64  `json:"account_destination_id"`
+	Amount               uint64  `json:"amount,omitempty"`     // Fixed share in cents
+	Percentage           float64 `json:"percentage,omitempty"` // Share as a percentage of the total amount
+}
+
+type CreateSplitTransferRequest struct {
+	AccountOriginID uint64              `json:"account_origin_id"`
+	Amount          uint64              `json:"amount"` // Total amount in cents
+	Shares          []SplitShareRequest `json:"shares"`
+}
+
+type CreateSplitTransferResponse struct {
+	ID        uint64     `json:"id"`                   // Split ID, which is also the ID of its first transfer
+	Transfers []uint64   `json:"transfers"`            // Transfer IDs in the same order as the shares
+	Status    string     `json:"status,omitempty"`     // Only sent for splits pending confirmation
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // When the confirmation expires
+}
+
+// splitTransfer pays several destination accounts from one origin account
+// in a single operation, based on a request generated by method POST on
+// /transfers/split endpoint. Every share becomes a transfer linked to the
+// others by the split ID.
+func (s *Server) splitTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	splitRequest := CreateSplitTransferRequest{}
+
+	if !decodeBody(w, r, &splitRequest) {
+		return
+	}
+
+	shares := make([]store.Share, len(splitRequest.Shares))
+	for i, share := range splitRequest.Shares {
+		percentage, err := toBasisPoints(share.Percentage)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err, fmt.Sprintf("shares[%d].percentage", i), err.Error())
+			return
+		}
+		shares[i] = store.Share{
+			AccountDestinationID: share.AccountDestinationID,
+			Amount:               share.Amount,
+			Percentage:           percentage,
+		}
+	}
+
+	amounts, err := store.SplitAmount(splitRequest.Amount, shares)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "shares", fmt.Sprintf("error splitting amount %d: %s", splitRequest.Amount, err))
+		return
+	}
+
+	noteAccounts(r, splitRequest.AccountOriginID)
+	for _, share := range shares {
+		noteAccounts(r, share.AccountDestinationID)
+	}
+	origAccount, err := s.accountStore.GetAccount(splitRequest.AccountOriginID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "account_origin_id", fmt.Sprintf("account %d not found", splitRequest.AccountOriginID))
+		return
+	}
+
+	if !s.checkOwner(w, r, origAccount, "account_origin_id") {
+		return
+	}
+
+	destAccounts := make([]*app.Account, len(shares))
+	for i, share := range shares {
+		destAccount, err := s.accountStore.GetAccount(share.AccountDestinationID)
+		if err != nil {
+			writeError(w, r, errorStatus(err), err, fmt.Sprintf("shares[%d].account_destination_id", i), fmt.Sprintf("account %d not found", share.AccountDestinationID))
+			return
+		}
+		destAccounts[i] = &destAccount
+	}
+
+	if s.needsStepUp(r, splitRequest.Amount) {
+		if !checkTOTPEnabled(w, r, origAccount, s.stepUpThreshold) {
+			return
+		}
+		destinationIDs := make([]uint64, len(destAccounts))
+		for i, destination := range destAccounts {
+			destinationIDs[i] = destination.ID
+		}
+		splitID, transferIDs, err := s.transferStore.CreateSplitTransfer(r.Context(), origAccount.ID, destinationIDs, amounts)
+		if err != nil {
+			writeError(w, r, errorStatus(err), err, splitErrorField(err), fmt.Sprintf("error splitting transfer from account [%d]: %s", splitRequest.AccountOriginID, err))
+			return
+		}
+		expiresAt := s.holdTransfers(r.Context(), transferIDs...)
+		w.Header().Set("Location", fmt.Sprintf("/transfers/%d", splitID))
+		writeJSON(w, r, http.StatusAccepted, CreateSplitTransferResponse{
+			ID:        splitID,
+			Transfers: transferIDs,
+			Status:    store.ToStatusMsg(store.StatusPendingConfirmation),
+			ExpiresAt: &expiresAt,
+		})
+		return
+	}
+
+	splitID, transferIDs, err := s.addSplitTransfer(r.Context(), &origAccount, destAccounts, amounts)
+	if err != nil {
+		errMsg := fmt.Sprintf("error splitting transfer from account [%d]: %s", splitRequest.AccountOriginID, err)
+		writeError(w, r, errorStatus(err), err, splitErrorField(err), errMsg)
+		return
+	}
+	jsonBytes, err := json.Marshal(CreateSplitTransferResponse{ID: splitID, Transfers: transferIDs})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error marshaling new split transfer: %v", err))
+		return
+	}
+	w.Header().Set("content-type", JsonContentType)
+	w.Header().Set("Location", fmt.Sprintf("/transfers/%d", splitID))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonBytes)
+}
+
+// addSplitTransfer creates one transfer per destination, authorizes all of
+// them against the total amount and moves the funds in a single step, so the
+// legs are either all confirmed or all cancelled.
+func (s *Server) addSplitTransfer(ctx context.Context, origin *app.Account, destinations []*app.Account, amounts []uint64) (splitID uint64, ids []uint64, err error) {
+	destinationIDs := make([]uint64, len(destinations))
+	for i, destination := range destinations {
+		destinationIDs[i] = destination.ID
+	}
+
+	splitID, ids, err = s.transferStore.CreateSplitTransfer(ctx, origin.ID, destinationIDs, amounts)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return splitID, ids, s.completeSplitTransfer(ctx, origin, destinations, ids)
+}
+
+// completeSplitTransfer authorizes the created legs of a split and, if they
+// are authorized, moves the funds and confirms all of them.
+func (s *Server) completeSplitTransfer(ctx context.Context, origin *app.Account, destinations []*app.Account, ids []uint64) error {
+	err := s.transferStore.AuthorizeSplitTransfer(ctx, origin, destinations, ids)
+	if err != nil {
+		return err
+	}
+
+	err = s.exchangeAmount(ctx, ids...)
+	if err != nil {
+		for _, id := range ids {
+			s.transferStore.Cancel(ctx, id)
+		}
+		return err
+	}
+	for _, id := range ids {
+		s.transferStore.Confirm(ctx, id)
+	}
+
+	return nil
+}
+
+// splitErrorField returns the request field to blame for an error
+// authorizing a split transfer.
+func splitErrorField(err error) string {
+	switch {
+	case errors.Is(err, store.ErrSameID):
+		return "shares"
+	case errors.Is(err, store.ErrInsufficientBalance):
+		return "amount"
+	}
+	return ""
+}
+
+// toBasisPoints converts a percentage such as 33.33 into basis points,
+// refusing values that would need rounding.
+func toBasisPoints(percentage float64) (uint64, error) {
+	basisPoints := math.Round(percentage * 100)
+	if percentage < 0 || basisPoints > store.PercentageBase || math.Abs(percentage*100-basisPoints) > 1e-6 {
+		return 0, ErrInvalidPercentage
+	}
+	return uint64(basisPoints), nil
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSplitTransfers(t *testing.T) {
+	buyer := app.Account{
+		ID:        10,
+		Name:      "Juliana da Cruz Clemente",
+		CPF:       "63000399003",
+		Balance:   50000,
+		CreatedAt: time.Date(2020, time.January, 3, 0, 0, 0, 0, time.UTC),
+	}
+	seller1 := app.Account{
+		ID:        20,
+		Name:      "Marlene de Souza Dalponte",
+		CPF:       "08312653457",
+		Balance:   0,
+		CreatedAt: time.Date(2020, time.February, 9, 15, 0, 0, 0, time.UTC),
+	}
+	seller2 := app.Account{
+		ID:        30,
+		Name:      "Bruna Carvalho Lemos",
+		CPF:       "21715382609",
+		Balance:   0,
+		CreatedAt: time.Date(2020, time.February, 15, 8, 0, 0, 0, time.UTC),
+	}
+
+	postSplit := func(server *Server, splitRequest CreateSplitTransferRequest) *httptest.ResponseRecorder {
+		jsonSplit, err := json.Marshal(splitRequest)
+		if err != nil {
+			t.Fatalf("could not marshal given split transfer. error: %q", err)
+		}
+		request, _ := http.NewRequest(http.MethodPost, "/transfers/split", bytes.NewBuffer(jsonSplit))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("should pay every seller and confirm linked transfers on POST", func(t *testing.T) {
+		accountStore := store.NewAccountStore(app.StartingID(3), buyer, seller1, seller2)
+		transferStore := store.NewTransferStore(app.StartingID(100))
+		server := NewServer(accountStore, transferStore)
+
+		response := postSplit(server, CreateSplitTransferRequest{
+			AccountOriginID: 10,
+			Amount:          10001,
+			Shares: []SplitShareRequest{
+				{AccountDestinationID: 20, Percentage: 50},
+				{AccountDestinationID: 30, Percentage: 50},
+			},
+		})
+
+		app.AssertResponseBody(t, response.Body.String(), `{"id":101,"transfers":[101,102]}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		app.AssertString(t, response.Result().Header.Get("content-type"), JsonContentType)
+
+		acc, _ := accountStore.GetAccount(10)
+		app.AssertUint64(t, acc.Balance, 39999)
+		acc, _ = accountStore.GetAccount(20)
+		app.AssertUint64(t, acc.Balance, 5001)
+		acc, _ = accountStore.GetAccount(30)
+		app.AssertUint64(t, acc.Balance, 5000)
+
+		for _, id := range []uint64{101, 102} {
+			transfer, _ := transferStore.GetTransfer(id)
+			app.AssertString(t, transfer.Status, store.ToStatusMsg(store.StatusConfirmed))
+			app.AssertUint64(t, transfer.SplitID, 101)
+		}
+	})
+
+	t.Run("should return error if shares do not add up to the total", func(t *testing.T) {
+		accountStore := store.NewAccountStore(app.StartingID(3), buyer, seller1, seller2)
+		transferStore := store.NewTransferStore(app.StartingID(0))
+		server := NewServer(accountStore, transferStore)
+
+		response := postSplit(server, CreateSplitTransferRequest{
+			AccountOriginID: 10,
+			Amount:          10000,
+			Shares: []SplitShareRequest{
+				{AccountDestinationID: 20, Amount: 6000},
+				{AccountDestinationID: 30, Percentage: 30},
+			},
+		})
+
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_shares",
+			Message: "error splitting amount 10000: the shares do not add up to the total amount",
+			Field:   "shares",
+		})
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("should not authorize any leg if origin balance does not cover the total", func(t *testing.T) {
+		accountStore := store.NewAccountStore(app.StartingID(3), buyer, seller1, seller2)
+		transferStore := store.NewTransferStore(app.StartingID(0))
+		server := NewServer(accountStore, transferStore)
+
+		response := postSplit(server, CreateSplitTransferRequest{
+			AccountOriginID: 10,
+			Amount:          60000,
+			Shares: []SplitShareRequest{
+				{AccountDestinationID: 20, Amount: 30000},
+				{AccountDestinationID: 30, Amount: 30000},
+			},
+		})
+
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "insufficient_balance",
+			Message: "error splitting transfer from account [10]: origin account balance is too low to allow this transfer",
+			Field:   "amount",
+		})
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnprocessableEntity)
+
+		for _, id := range []uint64{1, 2} {
+			transfer, _ := transferStore.GetTransfer(id)
+			app.AssertString(t, transfer.Status, store.ToStatusMsg(store.StatusNotAuthorized))
+		}
+		acc, _ := accountStore.GetAccount(10)
+		app.AssertUint64(t, acc.Balance, 50000)
+	})
+
+	t.Run("should return error if percentage has more than two decimal places", func(t *testing.T) {
+		server := NewServer(nil, nil)
+
+		response := postSplit(server, CreateSplitTransferRequest{
+			AccountOriginID: 10,
+			Amount:          10000,
+			Shares: []SplitShareRequest{
+				{AccountDestinationID: 20, Percentage: 33.333},
+			},
+		})
+
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_percentage",
+			Message: ErrInvalidPercentage.Error(),
+			Field:   "shares[0].percentage",
+		})
+		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+	})
+}
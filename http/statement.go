@@ -0,0 +1,115 @@
+package http
+
+import (
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+// Statement formats and their media types.
+const (
+	StatementCSV = "csv"
+	StatementOFX = "ofx"
+
+	CSVContentType = "text/csv; charset=utf-8"
+	OFXContentType = "application/x-ofx"
+)
+
+// statementDate is the layout of the from and to parameters of statements.
+const statementDate = "2006-01-02"
+
+// statementHandler responds with the statement of an account on GET
+// /accounts/{account_id}/statement, as CSV or OFX. The period runs from the
+// from date to the to date, both included and in UTC, and is the current
+// month up to today by default.
+func (s *Server) statementHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	account, ok := s.pathAccount(w, r)
+	if !ok || !s.checkOwner(w, r, account, "account_id") {
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = StatementCSV
+	}
+	if format != StatementCSV && format != StatementOFX {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "format", fmt.Sprintf("format must be %s or %s, not %q", StatementCSV, StatementOFX, format))
+		return
+	}
+	options := store.CSVOptions{Delimiter: ';', Decimal: ','}
+	if value := query.Get("delimiter"); value != "" {
+		delimiter, size := utf8.DecodeRuneInString(value)
+		if size != len(value) || delimiter == '"' || delimiter == '\r' || delimiter == '\n' || delimiter == utf8.RuneError {
+			writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "delimiter", fmt.Sprintf("delimiter must be a single character other than a quote or a line break, not %q", value))
+			return
+		}
+		options.Delimiter = delimiter
+	}
+	switch decimal := query.Get("decimal"); decimal {
+	case "", ",":
+	case ".":
+		options.Decimal = '.'
+	default:
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, "decimal", fmt.Sprintf(`decimal must be "," or ".", not %q`, decimal))
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, ok := statementParam(w, r, "from", today.AddDate(0, 0, 1-today.Day()))
+	if !ok {
+		return
+	}
+	to, ok := statementParam(w, r, "to", today)
+	if !ok {
+		return
+	}
+
+	statement, err := store.NewStatement(s.accountStore, s.transferStore, account.ID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		field := ""
+		if err == store.ErrInvalidPeriod {
+			field = "to"
+		}
+		writeError(w, r, errorStatus(err), err, field, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%d-%s-%s.%s", account.ID, from.Format("20060102"), to.Format("20060102"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if format == StatementOFX {
+		w.Header().Set("content-type", OFXContentType)
+		w.WriteHeader(http.StatusOK)
+		err = statement.WriteOFX(w)
+	} else {
+		w.Header().Set("content-type", CSVContentType)
+		w.WriteHeader(http.StatusOK)
+		err = statement.WriteCSV(w, options)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("error writing statement", "error", err)
+	}
+}
+
+// statementParam returns the date in the query parameter name, or
+// otherwise if it is missing. It responds with an error and returns false
+// if the date is invalid.
+func statementParam(w http.ResponseWriter, r *http.Request, name string, otherwise time.Time) (time.Time, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return otherwise, true
+	}
+	date, err := time.Parse(statementDate, value)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidRequest, name, fmt.Sprintf("%s must be a date such as 2006-01-02, not %q", name, value))
+		return time.Time{}, false
+	}
+	return date, true
+}
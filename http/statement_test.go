@@ -0,0 +1,87 @@
+package http
+
+import (
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatements(t *testing.T) {
+	confirmed := store.ToStatusMsg(store.StatusConfirmed)
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2026, month, day, 12, 0, 0, 0, time.UTC)
+	}
+	accountStore := store.NewAccountStore(app.StartingID(2),
+		app.Account{ID: 1, Name: "Juliana da Cruz Clemente", CPF: "63000399003", Balance: 123456},
+		app.Account{ID: 2, Name: "Marlene de Souza Dalponte", CPF: "08312653457", Balance: 0},
+	)
+	transferStore := store.NewTransferStore(app.StartingID(3),
+		app.Transfer{ID: 1, AccountOriginID: 2, AccountDestinationID: 1, Amount: 100000, CreatedAt: day(time.September, 30), Status: confirmed, Kind: store.KindTransfer},
+		app.Transfer{ID: 2, AccountOriginID: 2, AccountDestinationID: 1, Amount: 2500, CreatedAt: day(time.October, 31), Status: confirmed, Kind: store.KindTransfer},
+		app.Transfer{ID: 3, AccountOriginID: 1, AccountDestinationID: 2, Amount: 1044, CreatedAt: day(time.November, 1), Status: confirmed, Kind: store.KindTransfer},
+	)
+	server := NewServer(accountStore, transferStore)
+	get := func(path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, path, nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("should send CSV in pt-BR by default", func(t *testing.T) {
+		response := get("/accounts/1/statement?from=2026-10-01&to=2026-10-31")
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		app.AssertString(t, response.Header().Get("content-type"), CSVContentType)
+		app.AssertString(t, response.Header().Get("Content-Disposition"), `attachment; filename="statement-1-20261001-20261031.csv"`)
+		app.AssertString(t, response.Body.String(), `date;transfer_id;kind;counterparty_account_id;amount;balance
+2026-10-01T00:00:00Z;;opening_balance;;;1220,00
+2026-10-31T12:00:00Z;2;transfer;2;25,00;1245,00
+2026-11-01T00:00:00Z;;closing_balance;;;1245,00
+`)
+	})
+
+	t.Run("should use the delimiter and decimal separator asked for", func(t *testing.T) {
+		response := get("/accounts/1/statement?from=2026-11-01&to=2026-11-01&delimiter=,&decimal=.")
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		app.AssertString(t, strings.Split(response.Body.String(), "\n")[2], "2026-11-01T12:00:00Z,3,transfer,2,-10.44,1234.56")
+	})
+
+	t.Run("should send OFX", func(t *testing.T) {
+		response := get("/accounts/1/statement?format=ofx&from=2026-10-01&to=2026-10-31")
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		app.AssertString(t, response.Header().Get("content-type"), OFXContentType)
+		if !strings.Contains(response.Body.String(), "<BALAMT>1245.00\r\n") {
+			t.Errorf("got OFX %s; want a closing balance of 1245.00", response.Body.String())
+		}
+	})
+
+	t.Run("should refuse invalid parameters", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			path   string
+			status int
+			code   string
+			field  string
+		}{
+			{"unknown format", "/accounts/1/statement?format=pdf", http.StatusBadRequest, "invalid_request", "format"},
+			{"long delimiter", "/accounts/1/statement?delimiter=%3B%3B", http.StatusBadRequest, "invalid_request", "delimiter"},
+			{"quote delimiter", `/accounts/1/statement?delimiter="`, http.StatusBadRequest, "invalid_request", "delimiter"},
+			{"unknown decimal separator", "/accounts/1/statement?decimal=%3B", http.StatusBadRequest, "invalid_request", "decimal"},
+			{"invalid date", "/accounts/1/statement?from=01/10/2026", http.StatusBadRequest, "invalid_request", "from"},
+			{"period ending before it starts", "/accounts/1/statement?from=2026-10-02&to=2026-10-01", http.StatusBadRequest, "invalid_period", "to"},
+			{"unknown account", "/accounts/9/statement", http.StatusNotFound, "account_not_found", "account_id"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assertErrorCode(t, get(tt.path), tt.status, tt.code, tt.field)
+			})
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TOTPIssuer names the bank in authenticator apps.
+const TOTPIssuer = "Stone Challenge"
+
+var (
+	ErrTOTPRequired    = errors.New("TOTP is required for transfers above the step-up threshold")
+	ErrInvalidTOTPCode = errors.New("TOTP code is invalid")
+)
+
+type EnrollTOTPResponse struct {
+	Secret          string `json:"secret"`           // Base32 secret, for apps that cannot read the URI
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth URI, usually shown as a QR code
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TOTPStatusResponse struct {
+	AccountID   uint64 `json:"account_id"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+}
+
+// WithStepUp holds customer transfers above threshold, in cents, pending
+// confirmation with a TOTP code for up to ttl, and serves the endpoints to
+// enroll in TOTP and confirm transfers.
+func WithStepUp(threshold uint64, ttl time.Duration) Option {
+	return func(s *Server) {
+		s.stepUpThreshold = threshold
+		s.confirmationTTL = ttl
+	}
+}
+
+// needsStepUp tells whether a customer transfer of amount must be confirmed
+// with a TOTP code. Calls made with API keys never are.
+func (s *Server) needsStepUp(r *http.Request, amount uint64) bool {
+	if s.confirmationTTL == 0 || amount <= s.stepUpThreshold {
+		return false
+	}
+	_, byKey := auth.KeyFromContext(r.Context())
+	return !byKey
+}
+
+// holdTransfers sets transfers as pending confirmation and returns when
+// they expire.
+func (s *Server) holdTransfers(ctx context.Context, ids ...uint64) time.Time {
+	expiresAt := time.Now().Add(s.confirmationTTL).UTC()
+	s.transferStore.HoldTransfers(ctx, expiresAt, ids...)
+	return expiresAt
+}
+
+// enrollTOTPHandler creates a TOTP secret for an account on POST
+// /accounts/{account_id}/totp. The secret is only used after it is activated.
+func (s *Server) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	account, ok := s.pathAccount(w, r)
+	if !ok || !s.checkOwner(w, r, account, "account_id") {
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", err.Error())
+		return
+	}
+	err = s.accountStore.EnrollTOTP(r.Context(), account.ID, secret)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "account_id", fmt.Sprintf("error enrolling account %d in TOTP: %s", account.ID, err))
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, EnrollTOTPResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.ProvisioningURI(TOTPIssuer, fmt.Sprintf("account %d", account.ID), secret),
+	})
+}
+
+// activateTOTPHandler enables the TOTP secret of an account on POST
+// /accounts/{account_id}/totp/activate, once given a valid code for it.
+func (s *Server) activateTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	account, ok := s.pathAccount(w, r)
+	if !ok || !s.checkOwner(w, r, account, "account_id") {
+		return
+	}
+	codeRequest := TOTPCodeRequest{}
+	if !decodeBody(w, r, &codeRequest) {
+		return
+	}
+	if account.TOTPSecret == "" {
+		writeError(w, r, http.StatusConflict, store.ErrTOTPNotEnrolled, "account_id", fmt.Sprintf("account %d has not enrolled in TOTP", account.ID))
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(account.TOTPSecret, codeRequest.Code, time.Now())
+	if !valid {
+		writeError(w, r, http.StatusForbidden, ErrInvalidTOTPCode, "code", ErrInvalidTOTPCode.Error())
+		return
+	}
+	err := s.accountStore.ActivateTOTP(r.Context(), account.ID, step)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "code", err.Error())
+		return
+	}
+	writeJSON(w, r, http.StatusOK, TOTPStatusResponse{AccountID: account.ID, TOTPEnabled: true})
+}
+
+// confirmTransferHandler confirms a transfer pending confirmation, or all
+// legs of a split, with a TOTP code on POST /transfers/{transfer_id}/confirm.
+// Only then is the transfer authorized and the amount exchanged.
+func (s *Server) confirmTransferHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	idStr := mux.Vars(r)["transfer_id"]
+	ID, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidID, "transfer_id", fmt.Sprintf("transfer ID is invalid. ID given: %v", idStr))
+		return
+	}
+	transfer, err := s.transferStore.GetTransfer(ID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "transfer_id", fmt.Sprintf("transfer %v not found", ID))
+		return
+	}
+	noteAccounts(r, transfer.AccountOriginID, transfer.AccountDestinationID)
+	origin, err := s.accountStore.GetAccount(transfer.AccountOriginID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "transfer_id", fmt.Sprintf("account %d not found", transfer.AccountOriginID))
+		return
+	}
+	if !s.checkOwner(w, r, origin, "transfer_id") {
+		return
+	}
+	if transfer.Status != store.ToStatusMsg(store.StatusPendingConfirmation) {
+		writeError(w, r, http.StatusConflict, store.ErrNotPending, "transfer_id", fmt.Sprintf("transfer %d is %s, not pending confirmation", ID, transfer.Status))
+		return
+	}
+
+	codeRequest := TOTPCodeRequest{}
+	if !decodeBody(w, r, &codeRequest) {
+		return
+	}
+
+	ids := []uint64{ID}
+	if transfer.SplitID != 0 {
+		ids = s.transferStore.SplitLegs(transfer.SplitID)
+	}
+
+	now := time.Now()
+	if until, err := s.accountStore.CheckStepUpLock(origin.ID, now); err != nil {
+		writeError(w, r, errorStatus(err), err, "transfer_id", fmt.Sprintf("%s until %s", err, until.UTC().Format(time.RFC3339)))
+		return
+	}
+	step, valid := auth.ValidateTOTP(origin.TOTPSecret, codeRequest.Code, now)
+	if !valid {
+		left := s.transferStore.FailConfirmation(r.Context(), ids...)
+		message := fmt.Sprintf("%s: %d attempts left", ErrInvalidTOTPCode, left)
+		if left == 0 {
+			message = fmt.Sprintf("%s: transfer %d was cancelled", ErrInvalidTOTPCode, ID)
+		}
+		if s.accountStore.FailTOTPCode(r.Context(), origin.ID, now) {
+			message = fmt.Sprintf("%s; confirmations are locked for account %d for %s", message, origin.ID, store.StepUpLockout)
+		}
+		writeError(w, r, http.StatusForbidden, ErrInvalidTOTPCode, "code", message)
+		return
+	}
+	err = s.accountStore.UseTOTPStep(r.Context(), origin.ID, step)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "code", err.Error())
+		return
+	}
+	err = s.transferStore.ReleaseTransfers(r.Context(), now, ids...)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "transfer_id", fmt.Sprintf("error confirming transfer %d: %s", ID, err))
+		return
+	}
+
+	err = s.completeHeldTransfers(r.Context(), transfer, ids)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, transferErrorField(err), fmt.Sprintf("error confirming transfer %d: %s", ID, err))
+		return
+	}
+	transfer, _ = s.transferStore.GetTransfer(ID)
+	writeJSON(w, r, http.StatusOK, transfer)
+}
+
+// completeHeldTransfers authorizes and performs released transfers, using
+// the balances at the time of the confirmation.
+func (s *Server) completeHeldTransfers(ctx context.Context, transfer app.Transfer, ids []uint64) error {
+	origin, err := s.accountStore.GetAccount(transfer.AccountOriginID)
+	if err != nil {
+		return err
+	}
+	if transfer.SplitID == 0 {
+		destination, err := s.accountStore.GetAccount(transfer.AccountDestinationID)
+		if err != nil {
+			s.transferStore.Cancel(ctx, transfer.ID)
+			return err
+		}
+		return s.completeTransfer(ctx, &origin, &destination, transfer.Amount, transfer.ID)
+	}
+
+	destinations := make([]*app.Account, len(ids))
+	for i, id := range ids {
+		leg, _ := s.transferStore.GetTransfer(id)
+		destination, err := s.accountStore.GetAccount(leg.AccountDestinationID)
+		if err != nil {
+			for _, id := range ids {
+				s.transferStore.Cancel(ctx, id)
+			}
+			return err
+		}
+		destinations[i] = &destination
+	}
+	return s.completeSplitTransfer(ctx, &origin, destinations, ids)
+}
+
+// pathAccount returns the account whose ID is in the path, responding with
+// an error and returning false if there is none.
+func (s *Server) pathAccount(w http.ResponseWriter, r *http.Request) (app.Account, bool) {
+	idStr := mux.Vars(r)["account_id"]
+	ID, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrInvalidID, "account_id", fmt.Sprintf("account ID is invalid. ID given: %v", idStr))
+		return app.Account{}, false
+	}
+	noteAccounts(r, ID)
+	account, err := s.accountStore.GetAccount(ID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), err, "account_id", fmt.Sprintf("account %v not found", ID))
+		return app.Account{}, false
+	}
+	return account, true
+}
+
+// checkTOTPEnabled responds with an error and returns false if account has
+// not enabled TOTP, which transfers above threshold need.
+func checkTOTPEnabled(w http.ResponseWriter, r *http.Request, account app.Account, threshold uint64) bool {
+	if account.TOTPEnabled {
+		return true
+	}
+	writeError(w, r, http.StatusForbidden, ErrTOTPRequired, "account_origin_id", fmt.Sprintf("account %d must enable TOTP to transfer more than %d", account.ID, threshold))
+	return false
+}
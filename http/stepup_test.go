@@ -0,0 +1,173 @@
+package http
+
+import (
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStepUp(t *testing.T) {
+	newServer := func(ttl time.Duration) (*Server, *store.AccountStore, *store.TransferStore) {
+		accountStore := store.NewAccountStore(app.StartingID(3),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 1000000},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 0},
+			app.Account{ID: 3, Name: "Ana Lima", CPF: "38145671004", Balance: 0},
+		)
+		transferStore := store.NewTransferStore(app.StartingID(0))
+		server := NewServer(accountStore, transferStore, WithStepUp(100000, ttl))
+		return server, accountStore, transferStore
+	}
+
+	post := func(server *Server, path, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	// enroll enables TOTP on account 1 with a code from the previous period,
+	// leaving the current one free for a confirmation.
+	enroll := func(t *testing.T, server *Server) string {
+		t.Helper()
+		response := post(server, "/accounts/1/totp", "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		var enrollment EnrollTOTPResponse
+		json.NewDecoder(response.Body).Decode(&enrollment)
+		if !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/") {
+			t.Errorf("got provisioning URI %q", enrollment.ProvisioningURI)
+		}
+
+		code, _ := auth.TOTPCode(enrollment.Secret, time.Now().Add(-auth.TOTPPeriod*time.Second))
+		response = post(server, "/accounts/1/totp/activate", `{"code":"`+code+`"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		return enrollment.Secret
+	}
+
+	t.Run("should transfer amounts up to the threshold at once", func(t *testing.T) {
+		server, _, _ := newServer(time.Minute)
+
+		response := post(server, "/transfers", `{"account_origin_id":1,"account_destination_id":2,"amount":100000}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+	})
+
+	t.Run("should require TOTP for amounts above the threshold", func(t *testing.T) {
+		server, _, _ := newServer(time.Minute)
+
+		response := post(server, "/transfers", `{"account_origin_id":1,"account_destination_id":2,"amount":100001}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "totp_required",
+			Message: "account 1 must enable TOTP to transfer more than 100000",
+			Field:   "account_origin_id",
+		})
+	})
+
+	t.Run("should hold transfers above the threshold until confirmed", func(t *testing.T) {
+		server, accountStore, transferStore := newServer(time.Minute)
+		secret := enroll(t, server)
+
+		response := post(server, "/transfers", `{"account_origin_id":1,"account_destination_id":2,"amount":500000}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusAccepted)
+		app.AssertString(t, response.Header().Get("Location"), "/transfers/1")
+		var pending CreateTransferResponse
+		json.NewDecoder(response.Body).Decode(&pending)
+		app.AssertString(t, pending.Status, store.ToStatusMsg(store.StatusPendingConfirmation))
+		balance, _ := accountStore.GetBalance(2)
+		app.AssertUint64(t, balance, 0)
+
+		code, _ := auth.TOTPCode(secret, time.Now())
+		response = post(server, "/transfers/1/confirm", `{"code":"`+code+`"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+
+		transfer, _ := transferStore.GetTransfer(1)
+		app.AssertString(t, transfer.Status, store.ToStatusMsg(store.StatusConfirmed))
+		balance, _ = accountStore.GetBalance(2)
+		app.AssertUint64(t, balance, 500000)
+
+		response = post(server, "/transfers/1/confirm", `{"code":"`+code+`"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusConflict)
+	})
+
+	t.Run("should confirm every leg of a split at once", func(t *testing.T) {
+		server, accountStore, _ := newServer(time.Minute)
+		secret := enroll(t, server)
+
+		response := post(server, "/transfers/split", `{"account_origin_id":1,"amount":300000,"shares":[{"account_destination_id":2,"percentage":50},{"account_destination_id":3,"percentage":50}]}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusAccepted)
+
+		code, _ := auth.TOTPCode(secret, time.Now())
+		response = post(server, "/transfers/1/confirm", `{"code":"`+code+`"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+
+		for _, ID := range []uint64{2, 3} {
+			balance, _ := accountStore.GetBalance(ID)
+			app.AssertUint64(t, balance, 150000)
+		}
+	})
+
+	t.Run("should cancel the transfer after too many wrong codes", func(t *testing.T) {
+		server, _, transferStore := newServer(time.Minute)
+		enroll(t, server)
+		post(server, "/transfers", `{"account_origin_id":1,"account_destination_id":2,"amount":500000}`)
+
+		var response *httptest.ResponseRecorder
+		for i := 0; i < store.MaxConfirmationAttempts; i++ {
+			response = post(server, "/transfers/1/confirm", `{"code":"000000"}`)
+			app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+		}
+
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "invalid_totp_code",
+			Message: "TOTP code is invalid: transfer 1 was cancelled",
+			Field:   "code",
+		})
+		transfer, _ := transferStore.GetTransfer(1)
+		app.AssertString(t, transfer.Status, store.ToStatusMsg(store.StatusCancelled))
+	})
+
+	t.Run("should lock confirmations after too many wrong codes over several transfers", func(t *testing.T) {
+		server, _, _ := newServer(time.Minute)
+		secret := enroll(t, server)
+
+		var response *httptest.ResponseRecorder
+		for i := 0; i < store.MaxAccountCodeFailures; i++ {
+			if i%store.MaxConfirmationAttempts == 0 {
+				post(server, "/transfers", `{"account_origin_id":1,"account_destination_id":2,"amount":500000}`)
+			}
+			ID := strconv.Itoa(i/store.MaxConfirmationAttempts + 1)
+			response = post(server, "/transfers/"+ID+"/confirm", `{"code":"000000"}`)
+			app.AssertHTTPStatus(t, response.Code, http.StatusForbidden)
+		}
+		if !strings.Contains(response.Body.String(), "confirmations are locked for account 1") {
+			t.Errorf("got response %s; want it to tell the account is locked", response.Body)
+		}
+
+		code, _ := auth.TOTPCode(secret, time.Now())
+		response = post(server, "/transfers/4/confirm", `{"code":"`+code+`"}`)
+		assertErrorCode(t, response, http.StatusForbidden, "totp_locked", "transfer_id")
+	})
+
+	t.Run("should refuse confirmations after the transfer expires", func(t *testing.T) {
+		server, accountStore, transferStore := newServer(time.Nanosecond)
+		secret := enroll(t, server)
+		post(server, "/transfers", `{"account_origin_id":1,"account_destination_id":2,"amount":500000}`)
+
+		code, _ := auth.TOTPCode(secret, time.Now())
+		response := post(server, "/transfers/1/confirm", `{"code":"`+code+`"}`)
+
+		app.AssertHTTPStatus(t, response.Code, http.StatusGone)
+		transfer, _ := transferStore.GetTransfer(1)
+		app.AssertString(t, transfer.Status, store.ToStatusMsg(store.StatusExpired))
+		balance, _ := accountStore.GetBalance(1)
+		app.AssertUint64(t, balance, 1000000)
+	})
+}
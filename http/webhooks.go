@@ -0,0 +1,119 @@
+package http
+
+import (
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/webhook"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"` // Event types to deliver, such as transfer.*; every type when empty
+}
+
+type WebhookResponse struct {
+	webhook.Subscription
+	Secret string `json:"secret,omitempty"` // Only sent when the webhook is created
+}
+
+// WithWebhooks serves the admin endpoints that manage the webhook
+// subscriptions of d and its dead letters under /webhooks. Delivering the
+// events is up to d.
+func WithWebhooks(d *webhook.Dispatcher) Option {
+	return func(s *Server) {
+		s.webhooks = d
+	}
+}
+
+// webhooksHandler lists webhooks on GET and creates one, based on a
+// CreateWebhookRequest, on POST /webhooks.
+func (s *Server) webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, r, http.StatusOK, s.webhooks.Subscriptions())
+	case http.MethodPost:
+		creationRequest := CreateWebhookRequest{}
+		if !decodeBody(w, r, &creationRequest) {
+			return
+		}
+		subscription, secret, err := s.webhooks.Subscribe(creationRequest.URL, creationRequest.Events)
+		if err == webhook.ErrInvalidURL {
+			writeError(w, r, http.StatusBadRequest, err, "url", err.Error())
+			return
+		}
+		if err == webhook.ErrInvalidEventType {
+			writeError(w, r, http.StatusBadRequest, err, "events", err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error creating webhook: %v", err))
+			return
+		}
+		w.Header().Set("Location", "/webhooks/"+subscription.ID)
+		writeJSON(w, r, http.StatusCreated, WebhookResponse{Subscription: subscription, Secret: secret})
+	default:
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// webhookHandler returns a webhook on GET and removes it, along with its
+// pending deliveries and dead letters, on DELETE /webhooks/{webhook_id}.
+func (s *Server) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	ID := mux.Vars(r)["webhook_id"]
+	var subscription webhook.Subscription
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		subscription, err = s.webhooks.Subscription(ID)
+	case http.MethodDelete:
+		subscription, err = s.webhooks.Unsubscribe(ID)
+	default:
+		methodNotAllowed(w, r, http.MethodGet, http.MethodDelete)
+		return
+	}
+	if err == webhook.ErrSubscriptionNotFound {
+		writeError(w, r, http.StatusNotFound, err, "webhook_id", fmt.Sprintf("webhook %s not found", ID))
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error removing webhook: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusOK, WebhookResponse{Subscription: subscription})
+}
+
+// deadLettersHandler lists the deliveries that ran out of attempts on GET
+// /webhooks/dead-letters.
+func (s *Server) deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, s.webhooks.DeadLetters())
+}
+
+// redeliverHandler sends a dead letter again on POST
+// /webhooks/dead-letters/{delivery_id}/redeliver. The delivery is retried
+// as a new one, and stays a dead letter only if it fails again.
+func (s *Server) redeliverHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	ID := mux.Vars(r)["delivery_id"]
+	delivery, err := s.webhooks.Redeliver(ID)
+	if err == webhook.ErrDeliveryNotFound {
+		writeError(w, r, http.StatusNotFound, err, "delivery_id", fmt.Sprintf("delivery %s not found", ID))
+		return
+	}
+	if err == webhook.ErrDeliveryNotFailed {
+		writeError(w, r, http.StatusConflict, err, "delivery_id", fmt.Sprintf("delivery %s is still being retried", ID))
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, "", fmt.Sprintf("error redelivering: %v", err))
+		return
+	}
+	writeJSON(w, r, http.StatusAccepted, delivery)
+}
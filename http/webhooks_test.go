@@ -0,0 +1,212 @@
+package http
+
+import (
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/auth"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"github.com/erikacarvalho/stone-challenge/store"
+	"github.com/erikacarvalho/stone-challenge/webhook"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	const admin = "key_admin.segredo"
+
+	// newServer returns a server whose stores publish to a running
+	// dispatcher, which retries every millisecond up to twice.
+	newServer := func() (*Server, func()) {
+		accountStore := store.NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Balance: 1000},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077", Balance: 1000},
+		)
+		transferStore := store.NewTransferStore(app.StartingID(0))
+		dispatcher := webhook.NewDispatcher(nil)
+		dispatcher.MaxAttempts = 2
+		dispatcher.Backoff = time.Millisecond
+		bus := events.NewBus()
+		bus.Subscribe(dispatcher.Handle)
+		accountStore.SetPublisher(bus)
+		transferStore.SetPublisher(bus)
+		keys := auth.NewKeyStore()
+		keys.Import(auth.APIKey{ID: "key_admin", Role: auth.RoleAdmin}, "segredo")
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			dispatcher.Run(stop)
+			close(done)
+		}()
+		server := NewServer(accountStore, transferStore, WithAPIKeys(keys), WithWebhooks(dispatcher))
+		return server, func() {
+			close(stop)
+			<-done
+		}
+	}
+
+	do := func(server *Server, method, path, key, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			request.Header.Set(APIKeyHeader, key)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+
+	// receiver answers with status, which can be changed, and keeps the
+	// events it accepts after checking their signature with secret.
+	type receiver struct {
+		mu       sync.Mutex
+		status   int
+		secret   string
+		accepted []events.Event
+	}
+	newReceiver := func(t *testing.T, status int) (*receiver, *httptest.Server) {
+		rec := &receiver{status: status}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			if err := webhook.Verify(rec.secret, r.Header.Get(webhook.SignatureHeader), body, time.Now()); err != nil {
+				t.Errorf("got delivery with invalid signature: %v", err)
+			}
+			if rec.status == http.StatusOK {
+				var e events.Event
+				json.Unmarshal(body, &e)
+				rec.accepted = append(rec.accepted, e)
+			}
+			w.WriteHeader(rec.status)
+		}))
+		return rec, server
+	}
+	subscribe := func(t *testing.T, server *Server, rec *receiver, body string) WebhookResponse {
+		t.Helper()
+		response := do(server, http.MethodPost, "/webhooks", admin, body)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+		var created WebhookResponse
+		json.NewDecoder(response.Body).Decode(&created)
+		app.AssertString(t, response.Header().Get("Location"), "/webhooks/"+created.ID)
+		rec.mu.Lock()
+		rec.secret = created.Secret
+		rec.mu.Unlock()
+		return created
+	}
+	waitFor := func(t *testing.T, what string, done func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("gave up waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("should deliver signed transfer events to subscribers", func(t *testing.T) {
+		server, stop := newServer()
+		defer stop()
+		rec, receiverServer := newReceiver(t, http.StatusOK)
+		defer receiverServer.Close()
+		subscribe(t, server, rec, `{"url":"`+receiverServer.URL+`","events":["transfer.*"]}`)
+
+		response := do(server, http.MethodPost, "/transfers", admin, `{"account_origin_id":1,"account_destination_id":2,"amount":300}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+
+		waitFor(t, "the transfer events", func() bool {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			return len(rec.accepted) == 4
+		})
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		statuses := map[string]bool{}
+		for _, e := range rec.accepted {
+			if !strings.HasPrefix(e.Type, "transfer.") {
+				t.Errorf("got event %s; want only transfer events", e.Type)
+			}
+			var transfer app.Transfer
+			json.Unmarshal(e.Data, &transfer)
+			statuses[transfer.Status] = true
+		}
+		if !statuses["Confirmed"] {
+			t.Errorf("got statuses %v; want the transfer confirmed", statuses)
+		}
+	})
+
+	t.Run("should keep dead letters until they are redelivered", func(t *testing.T) {
+		server, stop := newServer()
+		defer stop()
+		rec, receiverServer := newReceiver(t, http.StatusInternalServerError)
+		defer receiverServer.Close()
+		subscribe(t, server, rec, `{"url":"`+receiverServer.URL+`","events":["account.created"]}`)
+
+		response := do(server, http.MethodPost, "/accounts", admin, `{"name":"Ana Lima","cpf":"10000000001"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusCreated)
+
+		var deadLetters []webhook.Delivery
+		waitFor(t, "the dead letter", func() bool {
+			response = do(server, http.MethodGet, "/webhooks/dead-letters", admin, "")
+			json.NewDecoder(response.Body).Decode(&deadLetters)
+			return len(deadLetters) == 1
+		})
+		app.AssertUint64(t, uint64(deadLetters[0].Attempts), 2)
+		app.AssertString(t, deadLetters[0].LastError, "subscriber answered 500 Internal Server Error")
+
+		rec.mu.Lock()
+		rec.status = http.StatusOK
+		rec.mu.Unlock()
+		response = do(server, http.MethodPost, "/webhooks/dead-letters/"+deadLetters[0].ID+"/redeliver", admin, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusAccepted)
+		waitFor(t, "the redelivery", func() bool {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			return len(rec.accepted) == 1
+		})
+		app.AssertString(t, rec.accepted[0].Type, events.AccountCreated)
+
+		response = do(server, http.MethodPost, "/webhooks/dead-letters/"+deadLetters[0].ID+"/redeliver", admin, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusNotFound)
+		assertErrorResponse(t, response, ErrorResponse{
+			Code:    "delivery_not_found",
+			Message: "delivery " + deadLetters[0].ID + " not found",
+			Field:   "delivery_id",
+		})
+	})
+
+	t.Run("should manage subscriptions", func(t *testing.T) {
+		server, stop := newServer()
+		defer stop()
+
+		response := do(server, http.MethodPost, "/webhooks", admin, `{"url":"ftp://example.com"}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+		assertErrorResponse(t, response, ErrorResponse{Code: "invalid_webhook_url", Message: webhook.ErrInvalidURL.Error(), Field: "url"})
+		response = do(server, http.MethodPost, "/webhooks", admin, `{"url":"https://example.com","events":["transfer.deleted"]}`)
+		app.AssertHTTPStatus(t, response.Code, http.StatusBadRequest)
+		assertErrorResponse(t, response, ErrorResponse{Code: "invalid_event_type", Message: webhook.ErrInvalidEventType.Error(), Field: "events"})
+
+		created := subscribe(t, server, &receiver{}, `{"url":"https://example.com/hooks"}`)
+		if created.Secret == "" {
+			t.Fatal("got no secret for the new webhook")
+		}
+		response = do(server, http.MethodGet, "/webhooks/"+created.ID, admin, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		if strings.Contains(response.Body.String(), created.Secret) {
+			t.Error("got the secret of an existing webhook")
+		}
+		response = do(server, http.MethodGet, "/webhooks", "", "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusUnauthorized)
+
+		response = do(server, http.MethodDelete, "/webhooks/"+created.ID, admin, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusOK)
+		response = do(server, http.MethodDelete, "/webhooks/"+created.ID, admin, "")
+		app.AssertHTTPStatus(t, response.Code, http.StatusNotFound)
+		assertErrorResponse(t, response, ErrorResponse{Code: "webhook_not_found", Message: "webhook " + created.ID + " not found", Field: "webhook_id"})
+	})
+}
@@ -0,0 +1,170 @@
+// Package logging writes leveled, structured logs, one JSON object per line.
+// Loggers travel in a context.Context, so that everything logged while
+// serving a request carries its ID.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level named s: debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q: it must be debug, info, warn or error", s)
+}
+
+// output is shared by a logger and all loggers derived from it, so their
+// lines are never interleaved.
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Logger writes lines at or above its level, each with the time, level,
+// message, the fields of the logger and the fields given with the message.
+type Logger struct {
+	out    *output
+	level  Level
+	fields []interface{}
+	now    func() time.Time
+}
+
+// New returns a logger writing to w the lines at or above level.
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w}, level: level, now: time.Now}
+}
+
+var defaultLogger = New(os.Stderr, LevelInfo)
+
+// Default returns the logger used when a context carries none.
+func Default() *Logger {
+	return defaultLogger
+}
+
+// SetDefault replaces the logger returned by Default.
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+// With returns a logger that adds keyvals, given as alternating keys and
+// values, to every line.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	return &Logger{out: l.out, level: l.level, fields: fields, now: l.now}
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.log(LevelDebug, msg, keyvals) }
+func (l *Logger) Info(msg string, keyvals ...interface{})  { l.log(LevelInfo, msg, keyvals) }
+func (l *Logger) Warn(msg string, keyvals ...interface{})  { l.log(LevelWarn, msg, keyvals) }
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.log(LevelError, msg, keyvals) }
+
+// Enabled tells whether lines at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var line bytes.Buffer
+	line.WriteString(`{"time":`)
+	writeValue(&line, l.now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeValue(&line, level.String())
+	line.WriteString(`,"msg":`)
+	writeValue(&line, msg)
+	writeFields(&line, l.fields)
+	writeFields(&line, keyvals)
+	line.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(line.Bytes())
+}
+
+// writeFields writes keyvals in the order given. A key without a value gets
+// null, and keys that are not strings are formatted with fmt.
+func writeFields(line *bytes.Buffer, keyvals []interface{}) {
+	for i := 0; i < len(keyvals); i += 2 {
+		line.WriteByte(',')
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		writeValue(line, key)
+		line.WriteByte(':')
+		if i+1 < len(keyvals) {
+			writeValue(line, keyvals[i+1])
+		} else {
+			line.WriteString("null")
+		}
+	}
+}
+
+func writeValue(line *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	line.Write(data)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return defaultLogger
+}
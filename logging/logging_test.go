@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	app "github.com/erikacarvalho/stone-challenge"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	newLogger := func(level Level) (*Logger, *bytes.Buffer) {
+		var out bytes.Buffer
+		logger := New(&out, level)
+		logger.now = func() time.Time { return time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC) }
+		return logger, &out
+	}
+
+	t.Run("should write JSON lines with fields in order", func(t *testing.T) {
+		logger, out := newLogger(LevelInfo)
+
+		logger.With("request_id", "abc").Warn("transfer failed", "account_id", 7, "error", errors.New("balance is too low"), "latency", 1500*time.Millisecond)
+
+		want := `{"time":"2020-03-02T10:00:00Z","level":"warn","msg":"transfer failed","request_id":"abc","account_id":7,"error":"balance is too low","latency":"1.5s"}` + "\n"
+		app.AssertString(t, out.String(), want)
+	})
+
+	t.Run("should skip lines below its level", func(t *testing.T) {
+		logger, out := newLogger(LevelInfo)
+
+		logger.Debug("noise")
+
+		app.AssertString(t, out.String(), "")
+	})
+
+	t.Run("should not share fields between derived loggers", func(t *testing.T) {
+		logger, out := newLogger(LevelInfo)
+		base := logger.With("a", 1)
+		base.With("b", 2)
+
+		base.Info("x", "odd")
+
+		app.AssertString(t, out.String(), `{"time":"2020-03-02T10:00:00Z","level":"info","msg":"x","a":1,"odd":null}`+"\n")
+	})
+
+	t.Run("should travel in a context", func(t *testing.T) {
+		logger, _ := newLogger(LevelInfo)
+
+		if FromContext(NewContext(context.Background(), logger)) != logger {
+			t.Error("got another logger from the context")
+		}
+		if FromContext(context.Background()) != Default() {
+			t.Error("context without logger did not return the default one")
+		}
+	})
+
+	t.Run("should parse level names", func(t *testing.T) {
+		level, err := ParseLevel("WARN")
+
+		app.AssertError(t, err, nil)
+		app.AssertString(t, level.String(), "warn")
+
+		_, err = ParseLevel("verbose")
+		if err == nil {
+			t.Error("unknown level was accepted")
+		}
+	})
+}
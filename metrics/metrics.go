@@ -0,0 +1,298 @@
+// Package metrics keeps counters, histograms and gauges and writes them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text format written by Registry.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds of histogram buckets for request
+// latencies, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family that can write itself.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families and writes all of them at once.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic("metrics: " + c.name() + " is already registered")
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes every metric family, sorted by name, to w.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+	buffer := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buffer)
+	}
+	return buffer.Flush()
+}
+
+// family is what every metric type shares: a name, a help text and the names
+// of its labels.
+type family struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+}
+
+func (f family) name() string {
+	return f.metricName
+}
+
+func (f family) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, strings.Replace(f.help, "\n", " ", -1))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.kind)
+}
+
+// key joins label values into a map key.
+func (f family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f family) writeSample(w *bufio.Writer, suffix string, values []string, extraName, extraValue string, value float64) {
+	w.WriteString(f.metricName + suffix)
+	pairs := make([]string, 0, len(values)+1)
+	for i, v := range values {
+		pairs = append(pairs, f.labels[i]+`="`+escape(v)+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of a series map in order, so that output is
+// stable between scrapes.
+func sortedKeys(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+func splitKey(key string, labels int) []string {
+	if labels == 0 {
+		return nil
+	}
+	return strings.Split(key, "\xff")
+}
+
+// Counter is a value that only goes up, kept apart for each combination of
+// label values. A nil *Counter counts nothing, so that instrumented code
+// works without a registry.
+type Counter struct {
+	family
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+// NewCounter registers a counter with the given label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: family{name, help, "counter", labels}, series: make(map[string]float64)}
+	r.register(c)
+	return c
+}
+
+// Inc adds 1 to the series with the given label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta, which must not be negative, to the series with the given
+// label values.
+func (c *Counter) Add(delta float64, values ...string) {
+	if c == nil {
+		return
+	}
+	if delta < 0 {
+		panic("metrics: counters cannot go down")
+	}
+	key := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series[key] += delta
+}
+
+// Value returns the series with the given label values.
+func (c *Counter) Value(values ...string) float64 {
+	if c == nil {
+		return 0
+	}
+	key := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.series[key]
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w)
+	keys := make([]string, 0, len(c.series))
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedKeys(keys) {
+		c.writeSample(w, "", splitKey(key, len(c.labels)), "", "", c.series[key])
+	}
+}
+
+// Histogram counts observations in buckets, kept apart for each combination
+// of label values. A nil *Histogram observes nothing.
+type Histogram struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // Observations in each bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds,
+// which must be sorted, and label names.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		family:  family{name, help, "histogram", labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds v to the series with the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	if h == nil {
+		return
+	}
+	key := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedKeys(keys) {
+		s := h.series[key]
+		values := splitKey(key, len(h.labels))
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			h.writeSample(w, "_bucket", values, "le", formatFloat(bound), float64(cumulative))
+		}
+		h.writeSample(w, "_bucket", values, "le", "+Inf", float64(s.count))
+		h.writeSample(w, "_sum", values, "", "", s.sum)
+		h.writeSample(w, "_count", values, "", "", float64(s.count))
+	}
+}
+
+// Sample is one series of a gauge, read when metrics are written.
+type Sample struct {
+	Labels []string // Values of the gauge labels, in order
+	Value  float64
+}
+
+// GaugeFunc is a value read from elsewhere whenever metrics are written,
+// such as the size of a store.
+type GaugeFunc struct {
+	family
+	collect func() []Sample
+}
+
+// NewGaugeFunc registers a gauge whose series are returned by collect.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func() []Sample) *GaugeFunc {
+	g := &GaugeFunc{family: family{name, help, "gauge", labels}, collect: collect}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	samples := g.collect()
+	sort.SliceStable(samples, func(i, j int) bool {
+		return strings.Join(samples[i].Labels, "\xff") < strings.Join(samples[j].Labels, "\xff")
+	})
+	for _, s := range samples {
+		g.key(s.Labels)
+		g.writeSample(w, "", s.Labels, "", "", s.Value)
+	}
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"bytes"
+	app "github.com/erikacarvalho/stone-challenge"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Run("should write counters in the text format, sorted", func(t *testing.T) {
+		registry := NewRegistry()
+		requests := registry.NewCounter("requests_total", "Requests served.", "route", "status")
+		requests.Inc("/b", "200")
+		requests.Add(2, "/a", "404")
+		requests.Inc("/a", "404")
+
+		var out bytes.Buffer
+		registry.Write(&out)
+
+		want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/a",status="404"} 3
+requests_total{route="/b",status="200"} 1
+`
+		app.AssertString(t, out.String(), want)
+	})
+
+	t.Run("should write cumulative histogram buckets", func(t *testing.T) {
+		registry := NewRegistry()
+		latency := registry.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+		latency.Observe(0.05)
+		latency.Observe(0.1)
+		latency.Observe(0.5)
+		latency.Observe(3)
+
+		var out bytes.Buffer
+		registry.Write(&out)
+
+		want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 3
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 3.65
+latency_seconds_count 4
+`
+		app.AssertString(t, out.String(), want)
+	})
+
+	t.Run("should read gauges when writing and escape label values", func(t *testing.T) {
+		registry := NewRegistry()
+		accounts := 1
+		registry.NewGaugeFunc("accounts", "Accounts open.", []string{"name"}, func() []Sample {
+			return []Sample{{Labels: []string{`say "hi"\`}, Value: float64(accounts)}}
+		})
+		accounts = 2
+
+		var out bytes.Buffer
+		registry.Write(&out)
+
+		want := `# HELP accounts Accounts open.
+# TYPE accounts gauge
+accounts{name="say \"hi\"\\"} 2
+`
+		app.AssertString(t, out.String(), want)
+	})
+
+	t.Run("should ignore a nil counter", func(t *testing.T) {
+		var counter *Counter
+		counter.Inc("x")
+
+		if counter.Value("x") != 0 {
+			t.Error("nil counter counted")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+// Package ratelimit limits how often clients may call the API with token
+// buckets, one per key.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Rate is a budget of requests: up to Burst at once, refilled at PerSecond.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Enabled tells whether the rate limits anything.
+func (r Rate) Enabled() bool {
+	return r.PerSecond > 0 && r.Burst > 0
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket for every key it is asked about. Buckets that
+// have been full for a while are dropped, so keys only take memory while
+// they are in use.
+type Limiter struct {
+	mu        sync.Mutex
+	rate      Rate
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLimiter(rate Rate) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key. If there is none, it returns
+// false and how long until there is one.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	limited, retryAfter := l.AllowAll(key)
+	return limited == "", retryAfter
+}
+
+// AllowAll takes a token from the bucket of every key, but only if each of
+// them has one, so that a request refused by one bucket does not spend the
+// others. Otherwise it returns the first key whose bucket is empty and how
+// long until it has a token.
+func (l *Limiter) AllowAll(keys ...string) (limited string, retryAfter time.Duration) {
+	if !l.rate.Enabled() {
+		return "", 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	buckets := make([]*bucket, len(keys))
+	for i, key := range keys {
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{tokens: float64(l.rate.Burst), last: now}
+			l.buckets[key] = b
+		}
+		b.tokens = math.Min(float64(l.rate.Burst), b.tokens+now.Sub(b.last).Seconds()*l.rate.PerSecond)
+		b.last = now
+
+		if b.tokens < 1 {
+			missing := (1 - b.tokens) / l.rate.PerSecond
+			return key, time.Duration(math.Ceil(missing * float64(time.Second)))
+		}
+		buckets[i] = b
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return "", 0
+}
+
+// sweep drops, at most once per refill time, the buckets that would be full
+// by now.
+func (l *Limiter) sweep(now time.Time) {
+	refill := time.Duration(float64(l.rate.Burst) / l.rate.PerSecond * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	app "github.com/erikacarvalho/stone-challenge"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	newLimiter := func() *Limiter {
+		limiter := NewLimiter(Rate{PerSecond: 2, Burst: 3})
+		limiter.now = func() time.Time { return now }
+		return limiter
+	}
+
+	t.Run("should allow a burst and then ask to retry later", func(t *testing.T) {
+		limiter := newLimiter()
+
+		for i := 0; i < 3; i++ {
+			if ok, _ := limiter.Allow("client:a"); !ok {
+				t.Fatalf("request %d of the burst was refused", i+1)
+			}
+		}
+		ok, retryAfter := limiter.Allow("client:a")
+
+		if ok {
+			t.Error("request over the burst was allowed")
+		}
+		app.AssertUint64(t, uint64(retryAfter), uint64(500*time.Millisecond))
+	})
+
+	t.Run("should refill tokens over time", func(t *testing.T) {
+		limiter := newLimiter()
+		for i := 0; i < 3; i++ {
+			limiter.Allow("client:a")
+		}
+
+		limiter.now = func() time.Time { return now.Add(time.Second) }
+
+		for i := 0; i < 2; i++ {
+			if ok, _ := limiter.Allow("client:a"); !ok {
+				t.Fatalf("refilled request %d was refused", i+1)
+			}
+		}
+		if ok, _ := limiter.Allow("client:a"); ok {
+			t.Error("got more tokens than were refilled")
+		}
+	})
+
+	t.Run("should keep a bucket per key", func(t *testing.T) {
+		limiter := newLimiter()
+		for i := 0; i < 3; i++ {
+			limiter.Allow("client:a")
+		}
+
+		if ok, _ := limiter.Allow("client:b"); !ok {
+			t.Error("another key was limited")
+		}
+	})
+
+	t.Run("should take from every bucket only if each has a token", func(t *testing.T) {
+		limiter := newLimiter()
+		for i := 0; i < 3; i++ {
+			limiter.Allow("account:1")
+		}
+
+		limited, retryAfter := limiter.AllowAll("client:a", "account:1")
+
+		app.AssertString(t, limited, "account:1")
+		app.AssertUint64(t, uint64(retryAfter), uint64(500*time.Millisecond))
+		for i := 0; i < 3; i++ {
+			if ok, _ := limiter.Allow("client:a"); !ok {
+				t.Fatalf("request %d of client:a was refused; its bucket was spent by a refused request", i+1)
+			}
+		}
+	})
+
+	t.Run("should drop buckets that are full again", func(t *testing.T) {
+		limiter := newLimiter()
+		limiter.Allow("client:a")
+		limiter.Allow("client:b")
+
+		limiter.now = func() time.Time { return now.Add(time.Minute) }
+		limiter.Allow("client:c")
+
+		app.AssertUint64(t, uint64(len(limiter.buckets)), 1)
+	})
+
+	t.Run("should allow everything when disabled", func(t *testing.T) {
+		limiter := NewLimiter(Rate{})
+
+		if ok, _ := limiter.Allow("client:a"); !ok {
+			t.Error("disabled limiter refused a request")
+		}
+	})
+}
@@ -1,9 +1,11 @@
 package store
 
 import (
+	"context"
 	"errors"
 	app "github.com/erikacarvalho/stone-challenge"
 	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -13,9 +15,23 @@ var (
 	ErrAccountNotFound = errors.New("there is no account with this ID")
 )
 
+// Account types. Bank-owned accounts, such as the one credited with fees,
+// cannot be opened through the API.
+const (
+	AccountTypeChecking = "checking"
+	AccountTypeBusiness = "business"
+	AccountTypeSavings  = "savings"
+	AccountTypeBank     = "bank"
+)
+
 type AccountStore struct {
+	mu          sync.RWMutex
 	maxID       *uint64
 	dataStorage map[uint64]app.Account // The map key is the account identifier
+	auditor     Auditor
+	publisher   Publisher
+	journal     *Journal
+	failures    map[uint64]*codeFailures // Wrong TOTP codes by account, kept in memory only
 }
 
 func NewAccountStore(startingID *uint64, accounts ...app.Account) *AccountStore {
@@ -31,24 +47,41 @@ func NewAccountStore(startingID *uint64, accounts ...app.Account) *AccountStore
 }
 
 func (a *AccountStore) GetMaxID() uint64 {
-	return *a.maxID
+	return atomic.LoadUint64(a.maxID)
+}
+
+// CreateAccount is a method that creates a checking account and returns its ID.
+func (a *AccountStore) CreateAccount(ctx context.Context, name, CPF string, balance uint64) (ID uint64, err error) {
+	return a.OpenAccount(ctx, AccountTypeChecking, name, CPF, balance)
 }
 
-// CreateAccount is a method that creates an account and returns its ID.
-func (a *AccountStore) CreateAccount(name, CPF string, balance uint64) (ID uint64, err error) {
+// OpenAccount creates an account of the given type and returns its ID.
+func (a *AccountStore) OpenAccount(ctx context.Context, accountType, name, CPF string, balance uint64) (ID uint64, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	newID := atomic.AddUint64(a.maxID, 1)
-	a.dataStorage[newID] = app.Account{
+	account := app.Account{
 		ID:        newID,
 		Name:      name,
 		CPF:       CPF,
 		Balance:   balance,
 		CreatedAt: time.Now(),
+		Type:      accountType,
+	}
+	err = a.commit(ChangeAccountOpened, newSnapshotAccount(account))
+	record(ctx, a.auditor, "account.open", account, err)
+	if err != nil {
+		return 0, err
 	}
 	return newID, nil
 }
 
 // ListAllAccounts returns all accounts from the account store sorted.
 func (a *AccountStore) ListAllAccounts() ([]app.Account, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
 	var accs []app.Account
 	for _, v := range a.dataStorage {
 		accs = append(accs, v)
@@ -68,6 +101,9 @@ func (a *AccountStore) ListAllAccounts() ([]app.Account, error) {
 // GetBalance returns balance for account with given ID
 // and an error if there is no such account.
 func (a *AccountStore) GetBalance(ID uint64) (balance uint64, err error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
 	acc, ok := a.dataStorage[ID]
 	if !ok {
 		return 0, ErrAccountNotFound
@@ -76,6 +112,9 @@ func (a *AccountStore) GetBalance(ID uint64) (balance uint64, err error) {
 }
 
 func (a *AccountStore) GetAccount(ID uint64) (app.Account, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
 	acc, ok := a.dataStorage[ID]
 	if !ok {
 		return app.Account{}, ErrAccountNotFound
@@ -83,6 +122,126 @@ func (a *AccountStore) GetAccount(ID uint64) (app.Account, error) {
 	return acc, nil
 }
 
-func (a *AccountStore) SetAccount(account app.Account) {
-	a.dataStorage[account.ID] = account
+// ListAccountsByCPF returns the accounts of a customer sorted by ID.
+func (a *AccountStore) ListAccountsByCPF(CPF string) []app.Account {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var accs []app.Account
+	for _, v := range a.dataStorage {
+		if v.CPF == CPF {
+			accs = append(accs, v)
+		}
+	}
+	sort.Slice(accs, func(i, j int) bool {
+		return accs[i].ID < accs[j].ID
+	})
+	return accs
+}
+
+// SetSecret stores the password hash of the customer owning an account.
+func (a *AccountStore) SetSecret(ctx context.Context, ID uint64, secret string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := ErrAccountNotFound
+	if _, ok := a.dataStorage[ID]; ok {
+		err = a.commit(ChangeSecretSet, accountSecret{AccountID: ID, Secret: secret})
+	}
+	record(ctx, a.auditor, "account.secret", struct {
+		AccountID uint64 `json:"account_id"`
+	}{ID}, err)
+	return err
+}
+
+func (a *AccountStore) SetAccount(ctx context.Context, account app.Account) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := a.commit(ChangeAccountSet, newSnapshotAccount(account))
+	record(ctx, a.auditor, "account.set", account, err)
+}
+
+// Credit is an amount to be added to the balance of an account.
+type Credit struct {
+	AccountID uint64 `json:"account_id"`
+	Amount    uint64 `json:"amount"`
+}
+
+// MoveFunds debits the sum of all credits from the origin account and adds
+// each credit to its account. Nothing is changed if any of the accounts does
+// not exist or if the origin balance is too low.
+func (a *AccountStore) MoveFunds(ctx context.Context, originID uint64, credits ...Credit) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := a.checkFunds(originID, credits)
+	if err == nil {
+		err = a.commit(ChangeFundsMoved, fundsMove{AccountOriginID: originID, Credits: credits})
+	}
+	record(ctx, a.auditor, "funds.move", fundsMove{originID, credits}, err)
+	return err
+}
+
+// checkFunds tells whether the accounts of a move of funds exist and the
+// origin balance covers it.
+func (a *AccountStore) checkFunds(originID uint64, credits []Credit) error {
+	origin, ok := a.dataStorage[originID]
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	var total uint64
+	for _, credit := range credits {
+		if _, ok := a.dataStorage[credit.AccountID]; !ok {
+			return ErrAccountNotFound
+		}
+		total += credit.Amount
+	}
+	if origin.Balance < total {
+		return ErrInsufficientBalance
+	}
+	return nil
+}
+
+func (a *AccountStore) moveFunds(at time.Time, originID uint64, credits []Credit) error {
+	err := a.checkFunds(originID, credits)
+	if err != nil {
+		return err
+	}
+
+	origin := a.dataStorage[originID]
+	balanceChanging(&origin, at)
+	for _, credit := range credits {
+		origin.Balance -= credit.Amount
+	}
+	a.dataStorage[originID] = origin
+	for _, credit := range credits {
+		destination := a.dataStorage[credit.AccountID]
+		balanceChanging(&destination, at)
+		destination.Balance += credit.Amount
+		a.dataStorage[credit.AccountID] = destination
+	}
+	return nil
+}
+
+// balanceChanging notes that the balance of account is about to change at
+// the given time, keeping the balance it had before the first change of
+// that day, which is the one the interest engine accrues on.
+func balanceChanging(account *app.Account, at time.Time) {
+	if !startOfDay(account.BalanceChangedAt).Equal(startOfDay(at)) {
+		account.OpeningBalance = account.Balance
+	}
+	account.BalanceChangedAt = at
+}
+
+func (a *AccountStore) setAccruedInterest(ctx context.Context, accrued accrual) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.dataStorage[accrued.AccountID]; !ok {
+		return
+	}
+	err := a.commit(ChangeInterestAccrued, []accrual{accrued})
+	record(ctx, a.auditor, "interest.accrued", accrued, err)
 }
@@ -1,7 +1,9 @@
 package store
 
 import (
+	"context"
 	app "github.com/erikacarvalho/stone-challenge"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -11,7 +13,7 @@ func TestCreateAccount(t *testing.T) {
 		store := NewAccountStore(app.StartingID(0))
 
 		want := uint64(1)
-		got, _ := store.CreateAccount("", "", 0)
+		got, _ := store.CreateAccount(context.Background(), "", "", 0)
 
 		app.AssertUint64(t, got, want)
 	})
@@ -20,7 +22,7 @@ func TestCreateAccount(t *testing.T) {
 		store := NewAccountStore(app.StartingID(90))
 
 		want := uint64(91)
-		got, _ := store.CreateAccount("", "", 0)
+		got, _ := store.CreateAccount(context.Background(), "", "", 0)
 
 		app.AssertUint64(t, got, want)
 	})
@@ -30,7 +32,7 @@ func TestGetBalance(t *testing.T) {
 	t.Run("should return account balance", func(t *testing.T) {
 		store := NewAccountStore(app.StartingID(7690))
 
-		newAccountID, _ := store.CreateAccount("", "", 10)
+		newAccountID, _ := store.CreateAccount(context.Background(), "", "", 10)
 		accountBalance, _ := store.GetBalance(newAccountID)
 
 		want := uint64(10)
@@ -85,8 +87,8 @@ func TestListAllAccounts(t *testing.T) {
 		for i, account := range accountsList {
 			want := accounts[uint64(i+1)]
 			got := account
-			if got != want {
-				t.Errorf("got %q; want %q", got, want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v; want %+v", got, want)
 			}
 		}
 	})
@@ -112,3 +114,43 @@ func TestListAllAccounts(t *testing.T) {
 		app.AssertError(t, got, want)
 	})
 }
+
+func TestMoveFunds(t *testing.T) {
+	newStore := func() *AccountStore {
+		return NewAccountStore(app.StartingID(3),
+			app.Account{ID: 1, Balance: 10000},
+			app.Account{ID: 2, Balance: 500},
+			app.Account{ID: 3, Balance: 0},
+		)
+	}
+
+	t.Run("should debit origin and credit every destination", func(t *testing.T) {
+		store := newStore()
+
+		err := store.MoveFunds(context.Background(), 1, Credit{AccountID: 2, Amount: 4000}, Credit{AccountID: 3, Amount: 1000})
+
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, store.dataStorage[1].Balance, 5000)
+		app.AssertUint64(t, store.dataStorage[2].Balance, 4500)
+		app.AssertUint64(t, store.dataStorage[3].Balance, 1000)
+	})
+
+	t.Run("should not change balances when origin balance is too low", func(t *testing.T) {
+		store := newStore()
+
+		err := store.MoveFunds(context.Background(), 2, Credit{AccountID: 1, Amount: 400}, Credit{AccountID: 3, Amount: 200})
+
+		app.AssertError(t, err, ErrInsufficientBalance)
+		app.AssertUint64(t, store.dataStorage[2].Balance, 500)
+		app.AssertUint64(t, store.dataStorage[1].Balance, 10000)
+	})
+
+	t.Run("should return ErrAccountNotFound when a destination does not exist", func(t *testing.T) {
+		store := newStore()
+
+		err := store.MoveFunds(context.Background(), 1, Credit{AccountID: 99, Amount: 100})
+
+		app.AssertError(t, err, ErrAccountNotFound)
+		app.AssertUint64(t, store.dataStorage[1].Balance, 10000)
+	})
+}
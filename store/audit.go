@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"github.com/erikacarvalho/stone-challenge/logging"
+)
+
+// Auditor records every change made to the stores, such as *audit.Log.
+type Auditor interface {
+	Record(actor, action string, payload interface{}, outcome string)
+}
+
+// storeActor is the actor of the audit entries recorded by the stores, which
+// complement the ones recorded for the API calls that caused them.
+const storeActor = "store"
+
+// SetAuditor sets where changes to the account store are recorded.
+func (a *AccountStore) SetAuditor(auditor Auditor) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.auditor = auditor
+}
+
+// SetAuditor sets where changes to the transfer store are recorded.
+func (t *TransferStore) SetAuditor(auditor Auditor) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.auditor = auditor
+}
+
+// record logs a change made to the stores with the logger in ctx and records
+// it with auditor, if there is one.
+func record(ctx context.Context, auditor Auditor, action string, payload interface{}, err error) {
+	logger := logging.FromContext(ctx)
+	if err != nil {
+		logger.Warn("store change failed", "action", action, "error", err)
+	} else {
+		logger.Debug("store change", "action", action, "payload", payload)
+	}
+	if auditor == nil {
+		return
+	}
+	outcome := "ok"
+	if err != nil {
+		outcome = err.Error()
+	}
+	auditor.Record(storeActor, action, payload, outcome)
+}
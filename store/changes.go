@@ -0,0 +1,410 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"sync/atomic"
+	"time"
+)
+
+// Types of the changes made to the stores. Every change is applied the same
+// way when it is made and when a journal is replayed, so the accounts and
+// transfers are a projection of the changes made to them.
+const (
+	ChangeAccountOpened   = "AccountOpened"
+	ChangeAccountSet      = "AccountSet"
+	ChangeSecretSet       = "SecretSet"
+	ChangeTOTPEnrolled    = "TOTPEnrolled"
+	ChangeTOTPActivated   = "TOTPActivated"
+	ChangeTOTPStepUsed    = "TOTPStepUsed"
+	ChangeFundsMoved      = "FundsMoved"
+	ChangeInterestAccrued = "InterestAccrued"
+	ChangeKeyRegistered   = "KeyRegistered"
+	ChangeKeyRemoved      = "KeyRemoved"
+	ChangeChargeCreated   = "ChargeCreated"
+	ChangeChargePaying    = "ChargePaying"
+
+	ChangeTransferRequested           = "TransferRequested"
+	ChangeTransferFeeSet              = "TransferFeeSet"
+	ChangeTransferExpirySet           = "TransferExpirySet"
+	ChangeTransferAuthorizing         = "TransferAuthorizing"
+	ChangeTransferAuthorized          = "TransferAuthorized"
+	ChangeTransferRejected            = "TransferRejected"
+	ChangeTransferConfirmed           = "TransferConfirmed"
+	ChangeTransferCancelled           = "TransferCancelled"
+	ChangeTransferPendingConfirmation = "TransferPendingConfirmation"
+	ChangeTransferReleased            = "TransferReleased"
+	ChangeTransferExpired             = "TransferExpired"
+	ChangeRemessaClaimed              = "RemessaClaimed"
+
+	// ChangeStateImported is applied to both stores.
+	ChangeStateImported = "StateImported"
+)
+
+// statusChanges maps each status to the change that sets a transfer to it.
+var statusChanges = map[int]string{
+	StatusCreated:       ChangeTransferReleased,
+	StatusAuthorizing:   ChangeTransferAuthorizing,
+	StatusNotAuthorized: ChangeTransferRejected,
+	StatusAuthorized:    ChangeTransferAuthorized,
+	StatusCancelled:     ChangeTransferCancelled,
+	StatusConfirmed:     ChangeTransferConfirmed,
+
+	StatusPendingConfirmation: ChangeTransferPendingConfirmation,
+	StatusExpired:             ChangeTransferExpired,
+}
+
+// Change is a change made to the accounts or transfers.
+type Change struct {
+	Seq  uint64          `json:"seq"` // Position in the journal, from 1; 0 when there is no journal
+	Time time.Time       `json:"time"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Data of the changes.
+type (
+	accountSecret struct {
+		AccountID uint64 `json:"account_id"`
+		Secret    string `json:"secret"`
+	}
+	accountKey struct {
+		AccountID uint64            `json:"account_id"`
+		Key       app.AddressingKey `json:"key"`
+	}
+	accountCharge struct {
+		AccountID uint64     `json:"account_id"`
+		Charge    app.Charge `json:"charge"`
+	}
+	chargeTransfer struct {
+		AccountID  uint64 `json:"account_id"`
+		TxID       string `json:"txid"`
+		TransferID uint64 `json:"transfer_id"`
+	}
+	totpStep struct {
+		AccountID uint64 `json:"account_id"`
+		Step      int64  `json:"step"`
+	}
+	fundsMove struct {
+		AccountOriginID uint64   `json:"account_origin_id"`
+		Credits         []Credit `json:"credits"`
+	}
+	accrual struct {
+		AccountID       uint64 `json:"account_id"`
+		AccruedInterest uint64 `json:"accrued_interest"`
+		Fraction        string `json:"fraction,omitempty"` // Fraction of a cent on top of AccruedInterest
+		Day             string `json:"day,omitempty"`      // Day accrued, left empty on payouts
+	}
+	transferFee struct {
+		ID  uint64 `json:"id"`
+		Fee uint64 `json:"fee"`
+	}
+	transferExpiry struct {
+		ID        uint64    `json:"id"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	transferStatus struct {
+		ID     uint64 `json:"id"`
+		Status string `json:"status"`
+	}
+)
+
+// commitChange makes a change of the given type: it is kept in journal, if
+// there is one, and then applied with apply. The lock of the store being
+// changed must be held; the journal is locked until the change is applied,
+// so its order is the order events are published in.
+func commitChange(journal *Journal, changeType string, data interface{}, apply func(Change) error) error {
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	c := Change{Time: time.Now(), Type: changeType, Data: rawData}
+	if journal == nil {
+		return apply(c)
+	}
+
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	err = journal.write(&c)
+	if err != nil {
+		return err
+	}
+	return apply(c)
+}
+
+// commit makes a change to the accounts. The lock must be held.
+func (a *AccountStore) commit(changeType string, data interface{}) error {
+	return commitChange(a.journal, changeType, data, a.apply)
+}
+
+// commit makes a change to the transfers. The lock must be held.
+func (t *TransferStore) commit(changeType string, data interface{}) error {
+	return commitChange(t.journal, changeType, data, t.apply)
+}
+
+// decode unmarshals the data of c into v.
+func decode(c Change, v interface{}) error {
+	err := json.Unmarshal(c.Data, v)
+	if err != nil {
+		return fmt.Errorf("error decoding change %d (%s): %w", c.Seq, c.Type, err)
+	}
+	return nil
+}
+
+// apply applies a change to the accounts and publishes the events about it.
+// The lock must be held.
+func (a *AccountStore) apply(c Change) error {
+	switch c.Type {
+	case ChangeAccountOpened, ChangeAccountSet:
+		var data snapshotAccount
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		account := data.account()
+		a.dataStorage[account.ID] = account
+		if account.ID > atomic.LoadUint64(a.maxID) {
+			atomic.StoreUint64(a.maxID, account.ID)
+		}
+		if c.Type == ChangeAccountOpened {
+			publish(a.publisher, c.Time, events.AccountCreated, account, account.ID)
+		}
+		return nil
+
+	case ChangeFundsMoved:
+		var data fundsMove
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		err := a.moveFunds(c.Time, data.AccountOriginID, data.Credits)
+		if err != nil {
+			return err
+		}
+		a.publishBalances(c.Time, data.AccountOriginID, data.Credits)
+		return nil
+
+	case ChangeInterestAccrued:
+		var data []accrual
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		for _, accrual := range data {
+			account, ok := a.dataStorage[accrual.AccountID]
+			if !ok {
+				return ErrAccountNotFound
+			}
+			account.AccruedInterest = accrual.AccruedInterest
+			account.InterestFraction = accrual.Fraction
+			if accrual.Day != "" {
+				account.InterestDay = accrual.Day
+			}
+			a.dataStorage[accrual.AccountID] = account
+		}
+		return nil
+
+	case ChangeSecretSet, ChangeTOTPEnrolled:
+		var data accountSecret
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		account, ok := a.dataStorage[data.AccountID]
+		if !ok {
+			return ErrAccountNotFound
+		}
+		if c.Type == ChangeSecretSet {
+			account.Secret = data.Secret
+		} else {
+			account.TOTPSecret = data.Secret
+			account.TOTPLastStep = 0
+		}
+		a.dataStorage[data.AccountID] = account
+		return nil
+
+	case ChangeTOTPActivated, ChangeTOTPStepUsed:
+		var data totpStep
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		account, ok := a.dataStorage[data.AccountID]
+		if !ok {
+			return ErrAccountNotFound
+		}
+		account.TOTPLastStep = data.Step
+		if c.Type == ChangeTOTPActivated {
+			account.TOTPEnabled = true
+		}
+		a.dataStorage[data.AccountID] = account
+		return nil
+
+	case ChangeKeyRegistered, ChangeKeyRemoved:
+		var data accountKey
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		account, ok := a.dataStorage[data.AccountID]
+		if !ok {
+			return ErrAccountNotFound
+		}
+		// The keys are copied, as accounts handed out share them.
+		keys := make([]app.AddressingKey, 0, len(account.Keys)+1)
+		for _, key := range account.Keys {
+			if key.Key != data.Key.Key {
+				keys = append(keys, key)
+			}
+		}
+		if c.Type == ChangeKeyRegistered {
+			keys = append(keys, data.Key)
+		}
+		account.Keys = keys
+		a.dataStorage[data.AccountID] = account
+		return nil
+
+	case ChangeChargeCreated:
+		var data accountCharge
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		account, ok := a.dataStorage[data.AccountID]
+		if !ok {
+			return ErrAccountNotFound
+		}
+		// The charges are copied, as accounts handed out share them.
+		charges := make([]app.Charge, len(account.Charges), len(account.Charges)+1)
+		copy(charges, account.Charges)
+		account.Charges = append(charges, data.Charge)
+		a.dataStorage[data.AccountID] = account
+		return nil
+
+	case ChangeChargePaying:
+		var data chargeTransfer
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		account, ok := a.dataStorage[data.AccountID]
+		if !ok {
+			return ErrAccountNotFound
+		}
+		charges := make([]app.Charge, len(account.Charges))
+		copy(charges, account.Charges)
+		for i := range charges {
+			if charges[i].TxID == data.TxID {
+				charges[i].TransferID = data.TransferID
+			}
+		}
+		account.Charges = charges
+		a.dataStorage[data.AccountID] = account
+		return nil
+
+	case ChangeStateImported:
+		var data stateImport
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		a.applyImport(data)
+		return nil
+	}
+	return fmt.Errorf("change %d has unknown type %q", c.Seq, c.Type)
+}
+
+// apply applies a change to the transfers and publishes the events about
+// it. The lock must be held.
+func (t *TransferStore) apply(c Change) error {
+	switch c.Type {
+	case ChangeTransferRequested:
+		var transfer app.Transfer
+		if err := decode(c, &transfer); err != nil {
+			return err
+		}
+		t.dataStorage[transfer.ID] = transfer
+		if transfer.ID > atomic.LoadUint64(t.maxID) {
+			atomic.StoreUint64(t.maxID, transfer.ID)
+		}
+		t.publishTransfer(c.Time, events.TransferCreated, transfer.ID)
+		return nil
+
+	case ChangeRemessaClaimed:
+		var data remessaClaim
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		t.claimRemessa(data.Remessa)
+		for _, transfer := range data.Transfers {
+			t.dataStorage[transfer.ID] = transfer
+			if transfer.ID > atomic.LoadUint64(t.maxID) {
+				atomic.StoreUint64(t.maxID, transfer.ID)
+			}
+			t.publishTransfer(c.Time, events.TransferCreated, transfer.ID)
+		}
+		return nil
+
+	case ChangeTransferFeeSet:
+		var data transferFee
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		transfer, ok := t.dataStorage[data.ID]
+		if !ok {
+			return ErrTransferNotFound
+		}
+		transfer.Fee = data.Fee
+		t.dataStorage[data.ID] = transfer
+		return nil
+
+	case ChangeTransferExpirySet:
+		var data transferExpiry
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		transfer, ok := t.dataStorage[data.ID]
+		if !ok {
+			return ErrTransferNotFound
+		}
+		transfer.ExpiresAt = &data.ExpiresAt
+		t.dataStorage[data.ID] = transfer
+		return nil
+
+	case ChangeStateImported:
+		var data stateImport
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		t.applyImport(data)
+		return nil
+	}
+
+	for statusCode, changeType := range statusChanges {
+		if c.Type != changeType {
+			continue
+		}
+		var data transferStatus
+		if err := decode(c, &data); err != nil {
+			return err
+		}
+		transfer, ok := t.dataStorage[data.ID]
+		if !ok {
+			return ErrTransferNotFound
+		}
+		transfer.Status = ToStatusMsg(statusCode)
+		if statusCode == StatusConfirmed {
+			confirmedAt := c.Time
+			transfer.ConfirmedAt = &confirmedAt
+		}
+		t.dataStorage[data.ID] = transfer
+		t.publishTransfer(c.Time, statusEvents[statusCode], data.ID)
+		return nil
+	}
+	return fmt.Errorf("change %d has unknown type %q", c.Seq, c.Type)
+}
+
+// isAccountChange tells whether changes of the given type are applied to the
+// accounts rather than to the transfers.
+func isAccountChange(changeType string) bool {
+	switch changeType {
+	case ChangeAccountOpened, ChangeAccountSet, ChangeSecretSet, ChangeTOTPEnrolled,
+		ChangeTOTPActivated, ChangeTOTPStepUsed, ChangeFundsMoved, ChangeInterestAccrued,
+		ChangeKeyRegistered, ChangeKeyRemoved, ChangeChargeCreated, ChangeChargePaying:
+		return true
+	}
+	return false
+}
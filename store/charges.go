@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"time"
+)
+
+// txIDLength is the length of the TxIDs of charges, the longest a BR Code
+// takes.
+const txIDLength = 25
+
+// txIDAlphabet holds the characters TxIDs are made of.
+const txIDAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+var (
+	ErrChargeNotFound = errors.New("the account has no charge with this txid")
+	ErrChargePaid     = errors.New("the charge has already been paid")
+)
+
+// CreateCharge issues a dynamic charge of amount to one of the keys of an
+// account and returns it, with the TxID it is known by.
+func (a *AccountStore) CreateCharge(ctx context.Context, ID uint64, key string, amount uint64, description string) (app.Charge, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	charge, err := a.newCharge(ID, key, amount, description)
+	if err == nil {
+		err = a.commit(ChangeChargeCreated, accountCharge{AccountID: ID, Charge: charge})
+	}
+	record(ctx, a.auditor, "account.charge.create", struct {
+		AccountID uint64 `json:"account_id"`
+		TxID      string `json:"txid,omitempty"`
+		Amount    uint64 `json:"amount"`
+	}{ID, charge.TxID, amount}, err)
+	if err != nil {
+		return app.Charge{}, err
+	}
+	return charge, nil
+}
+
+// newCharge checks whether an account can issue a charge and returns it.
+// The lock must be held.
+func (a *AccountStore) newCharge(ID uint64, key string, amount uint64, description string) (app.Charge, error) {
+	account, ok := a.dataStorage[ID]
+	if !ok {
+		return app.Charge{}, ErrAccountNotFound
+	}
+	if amount == 0 {
+		return app.Charge{}, ErrInvalidAmount
+	}
+	holder, addressingKey, ok := a.findKey(lookupKey(key))
+	if !ok || holder.ID != account.ID {
+		return app.Charge{}, ErrKeyNotFound
+	}
+	txID, err := newTxID()
+	if err != nil {
+		return app.Charge{}, err
+	}
+	return app.Charge{TxID: txID, Key: addressingKey.Key, Amount: amount, Description: description, CreatedAt: time.Now().UTC()}, nil
+}
+
+// GetCharge returns a charge issued by an account.
+func (a *AccountStore) GetCharge(ID uint64, txID string) (app.Charge, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	account, ok := a.dataStorage[ID]
+	if !ok {
+		return app.Charge{}, ErrAccountNotFound
+	}
+	for _, charge := range account.Charges {
+		if charge.TxID == txID {
+			return charge, nil
+		}
+	}
+	return app.Charge{}, ErrChargeNotFound
+}
+
+// SetChargeTransfer records the transfer made to pay a charge. Whether the
+// charge is paid depends on how that transfer goes: if it is refused or
+// expires, another one may be made.
+func (a *AccountStore) SetChargeTransfer(ctx context.Context, ID uint64, txID string, transferID uint64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var err error
+	account, ok := a.dataStorage[ID]
+	switch {
+	case !ok:
+		err = ErrAccountNotFound
+	case !hasCharge(account, txID):
+		err = ErrChargeNotFound
+	default:
+		err = a.commit(ChangeChargePaying, chargeTransfer{AccountID: ID, TxID: txID, TransferID: transferID})
+	}
+	record(ctx, a.auditor, "account.charge.pay", chargeTransfer{AccountID: ID, TxID: txID, TransferID: transferID}, err)
+	return err
+}
+
+func hasCharge(account app.Account, txID string) bool {
+	for _, charge := range account.Charges {
+		if charge.TxID == txID {
+			return true
+		}
+	}
+	return false
+}
+
+// newTxID returns a random TxID of letters and digits. Bytes past the last
+// multiple of the alphabet length are skipped, so that every character is
+// as likely.
+func newTxID() (string, error) {
+	const limit = 256 - 256%len(txIDAlphabet)
+	txID := make([]byte, 0, txIDLength)
+	b := make([]byte, txIDLength)
+	for len(txID) < txIDLength {
+		_, err := rand.Read(b)
+		if err != nil {
+			return "", fmt.Errorf("error generating txid: %w", err)
+		}
+		for _, c := range b {
+			if int(c) < limit && len(txID) < txIDLength {
+				txID = append(txID, txIDAlphabet[int(c)%len(txIDAlphabet)])
+			}
+		}
+	}
+	return string(txID), nil
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	app "github.com/erikacarvalho/stone-challenge"
+	"regexp"
+	"testing"
+)
+
+func TestCharges(t *testing.T) {
+	ctx := context.Background()
+	newStore := func() *AccountStore {
+		accounts := NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Papelaria Dunder Mifflin", CPF: "48226581020", Type: AccountTypeBusiness},
+			app.Account{ID: 2, Name: "Caio Barros Antunes", CPF: "71530184077"},
+		)
+		accounts.RegisterKey(ctx, 1, KeyTypeEmail, "vendas@dunder.com")
+		accounts.RegisterKey(ctx, 2, KeyTypeEmail, "caio@exemplo.com")
+		return accounts
+	}
+
+	t.Run("should issue charges to keys of the account", func(t *testing.T) {
+		accounts := newStore()
+
+		charge, err := accounts.CreateCharge(ctx, 1, "Vendas@Dunder.com", 1050, "Pedido 42")
+
+		app.AssertError(t, err, nil)
+		if !regexp.MustCompile(`^[A-Za-z0-9]{25}$`).MatchString(charge.TxID) {
+			t.Errorf("got txid %q; want 25 letters and digits", charge.TxID)
+		}
+		app.AssertString(t, charge.Key, "vendas@dunder.com")
+		got, err := accounts.GetCharge(1, charge.TxID)
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, got.Amount, 1050)
+		_, err = accounts.GetCharge(2, charge.TxID)
+		app.AssertError(t, err, ErrChargeNotFound)
+	})
+
+	t.Run("should refuse charges the account cannot issue", func(t *testing.T) {
+		accounts := newStore()
+
+		_, err := accounts.CreateCharge(ctx, 1, "caio@exemplo.com", 1050, "")
+		app.AssertError(t, err, ErrKeyNotFound)
+		_, err = accounts.CreateCharge(ctx, 1, "vendas@dunder.com", 0, "")
+		app.AssertError(t, err, ErrInvalidAmount)
+		_, err = accounts.CreateCharge(ctx, 3, "vendas@dunder.com", 1050, "")
+		app.AssertError(t, err, ErrAccountNotFound)
+	})
+
+	t.Run("should record the transfer paying a charge", func(t *testing.T) {
+		accounts := newStore()
+		charge, _ := accounts.CreateCharge(ctx, 1, "vendas@dunder.com", 1050, "")
+		issued, _ := accounts.GetAccount(1)
+
+		err := accounts.SetChargeTransfer(ctx, 1, charge.TxID, 7)
+
+		app.AssertError(t, err, nil)
+		got, _ := accounts.GetCharge(1, charge.TxID)
+		app.AssertUint64(t, got.TransferID, 7)
+		app.AssertUint64(t, issued.Charges[0].TransferID, 0)
+		err = accounts.SetChargeTransfer(ctx, 2, charge.TxID, 7)
+		app.AssertError(t, err, ErrChargeNotFound)
+	})
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"time"
+)
+
+// Publisher is told about what happens to accounts and transfers, such as
+// *events.Bus. It is called with the store locked.
+type Publisher interface {
+	Publish(e events.Event)
+}
+
+// SetPublisher sets where events about the accounts in the store are
+// published.
+func (a *AccountStore) SetPublisher(publisher Publisher) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.publisher = publisher
+}
+
+// SetPublisher sets where events about the transfers in the store are
+// published.
+func (t *TransferStore) SetPublisher(publisher Publisher) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.publisher = publisher
+}
+
+// Outbox returns the outbox events about the accounts are published to, or
+// nil if they are not published to one. Stores restored from a snapshot
+// always are.
+func (a *AccountStore) Outbox() *events.Outbox {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	outbox, _ := a.publisher.(*events.Outbox)
+	return outbox
+}
+
+// publish publishes an event of the given type about the accounts with
+// accountIDs, which happened at t, if there is a publisher.
+func publish(publisher Publisher, t time.Time, eventType string, data interface{}, accountIDs ...uint64) {
+	if publisher == nil {
+		return
+	}
+	jsonBytes, _ := json.Marshal(data)
+	publisher.Publish(events.Event{
+		Type:       eventType,
+		Time:       t,
+		AccountIDs: accountIDs,
+		Data:       jsonBytes,
+	})
+}
+
+// publishTransfer publishes an event of the given type about the transfer
+// with ID, which happened at when. The lock must be held.
+func (t *TransferStore) publishTransfer(when time.Time, eventType string, ID uint64) {
+	transfer := t.dataStorage[ID]
+	publish(t.publisher, when, eventType, transfer, transfer.AccountOriginID, transfer.AccountDestinationID)
+}
+
+// BalanceChange is the data of account.balance_changed events.
+type BalanceChange struct {
+	AccountID uint64 `json:"account_id"`
+	Balance   uint64 `json:"balance"` // Balance after the change, in cents
+	Delta     int64  `json:"delta"`   // Amount added to the balance, negative when taken from it, in cents
+}
+
+// publishBalances publishes a balance change for the origin account and for
+// each credited account of a move of funds made at t. The lock must be held.
+func (a *AccountStore) publishBalances(t time.Time, originID uint64, credits []Credit) {
+	deltas := map[uint64]int64{}
+	order := []uint64{originID}
+	for _, credit := range credits {
+		if _, ok := deltas[credit.AccountID]; !ok && credit.AccountID != originID {
+			order = append(order, credit.AccountID)
+		}
+		deltas[credit.AccountID] += int64(credit.Amount)
+		deltas[originID] -= int64(credit.Amount)
+	}
+	for _, ID := range order {
+		change := BalanceChange{AccountID: ID, Balance: a.dataStorage[ID].Balance, Delta: deltas[ID]}
+		publish(a.publisher, t, events.AccountBalanceChanged, change, ID)
+	}
+}
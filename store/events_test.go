@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"testing"
+)
+
+// eventLog keeps the events published to it.
+type eventLog []events.Event
+
+func (l *eventLog) Publish(e events.Event) {
+	*l = append(*l, e)
+}
+
+func (l eventLog) types() []string {
+	var types []string
+	for _, e := range l {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should publish account creations and balance changes", func(t *testing.T) {
+		var published eventLog
+		accounts := NewAccountStore(app.StartingID(0))
+		accounts.SetPublisher(&published)
+
+		origin, _ := accounts.CreateAccount(ctx, "Pam Beesly", "10000000001", 1000)
+		destination, _ := accounts.CreateAccount(ctx, "Jim Halpert", "10000000002", 0)
+		accounts.MoveFunds(ctx, origin, Credit{AccountID: destination, Amount: 300})
+		accounts.MoveFunds(ctx, origin, Credit{AccountID: destination, Amount: 5000})
+
+		assertTypes(t, published.types(), events.AccountCreated, events.AccountCreated, events.AccountBalanceChanged, events.AccountBalanceChanged)
+		var change BalanceChange
+		json.Unmarshal(published[2].Data, &change)
+		app.AssertUint64(t, change.AccountID, origin)
+		app.AssertUint64(t, change.Balance, 700)
+		if change.Delta != -300 {
+			t.Errorf("got delta %d; want -300", change.Delta)
+		}
+		if !published[3].Involves(destination) {
+			t.Errorf("got accounts %v; want %d", published[3].AccountIDs, destination)
+		}
+	})
+
+	t.Run("should publish transfer creations and every status change", func(t *testing.T) {
+		var published eventLog
+		transfers := NewTransferStore(app.StartingID(0))
+		transfers.SetPublisher(&published)
+		origin := app.Account{ID: 1, Balance: 1000}
+		destination := app.Account{ID: 2}
+
+		ID, _ := transfers.CreateTransfer(ctx, origin.ID, destination.ID, 300)
+		transfers.AuthorizeTransfer(ctx, &origin, &destination, 300, ID)
+		transfers.Confirm(ctx, ID)
+
+		assertTypes(t, published.types(), events.TransferCreated, events.TransferAuthorizing, events.TransferAuthorized, events.TransferConfirmed)
+		var transfer app.Transfer
+		json.Unmarshal(published[3].Data, &transfer)
+		app.AssertString(t, transfer.Status, ToStatusMsg(StatusConfirmed))
+		if !published[3].Involves(origin.ID) || !published[3].Involves(destination.ID) {
+			t.Errorf("got accounts %v; want %d and %d", published[3].AccountIDs, origin.ID, destination.ID)
+		}
+	})
+}
+
+func assertTypes(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got events %v; want %v", got, want)
+	}
+	for i := range want {
+		app.AssertString(t, got[i], want[i])
+	}
+}
@@ -0,0 +1,365 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ExportVersion is the version of the export format written by Export, and
+// the only one ReadExport reads.
+const ExportVersion = 1
+
+// Import modes. Merge adds the exported accounts and transfers to the
+// stores and refuses to overwrite any; replace drops what the stores hold
+// first.
+const (
+	ImportMerge   = "merge"
+	ImportReplace = "replace"
+)
+
+var (
+	ErrInvalidExport     = errors.New("invalid export")
+	ErrImportConflict    = errors.New("the export has IDs already in use")
+	ErrInvalidImportMode = errors.New("invalid import mode: it must be merge or replace")
+)
+
+// Kinds of the lines of an export.
+const (
+	exportHeader   = "header"
+	exportAccount  = "account"
+	exportTransfer = "transfer"
+	exportChecksum = "checksum"
+)
+
+// exportLine is a line of an export, which is NDJSON: a header with the
+// version, the IDs given last, the CNAB remessas paid and how many accounts
+// and transfers follow, then one line per account and per transfer, and last
+// the SHA-256 of every line before it.
+type exportLine struct {
+	Kind          string           `json:"kind"`
+	Version       int              `json:"version,omitempty"`
+	ExportedAt    *time.Time       `json:"exported_at,omitempty"`
+	AccountMaxID  uint64           `json:"account_max_id,omitempty"`
+	TransferMaxID uint64           `json:"transfer_max_id,omitempty"`
+	Accounts      *int             `json:"accounts,omitempty"`
+	Transfers     *int             `json:"transfers,omitempty"`
+	Remessas      []string         `json:"remessas,omitempty"`
+	Account       *snapshotAccount `json:"account,omitempty"`
+	Transfer      *app.Transfer    `json:"transfer,omitempty"`
+	SHA256        string           `json:"sha256,omitempty"`
+}
+
+// Export writes every account and transfer in the stores, and the IDs given
+// last, to w. Accounts are written with their password hash and TOTP
+// secret, so that customers can still log in where they are imported.
+func Export(w io.Writer, accounts *AccountStore, transfers *TransferStore) error {
+	return TakeSnapshot(accounts, transfers).Export(w)
+}
+
+// Export writes the accounts and transfers of the snapshot, and the IDs
+// given last, to w.
+func (s Snapshot) Export(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	hash := sha256.New()
+	encoder := json.NewEncoder(io.MultiWriter(buffered, hash))
+
+	now := time.Now()
+	accounts, transfers := len(s.Accounts), len(s.Transfers)
+	err := encoder.Encode(exportLine{
+		Kind:          exportHeader,
+		Version:       ExportVersion,
+		ExportedAt:    &now,
+		AccountMaxID:  s.AccountMaxID,
+		TransferMaxID: s.TransferMaxID,
+		Accounts:      &accounts,
+		Transfers:     &transfers,
+		Remessas:      s.Remessas,
+	})
+	for i := 0; i < len(s.Accounts) && err == nil; i++ {
+		err = encoder.Encode(exportLine{Kind: exportAccount, Account: &s.Accounts[i]})
+	}
+	for i := 0; i < len(s.Transfers) && err == nil; i++ {
+		err = encoder.Encode(exportLine{Kind: exportTransfer, Transfer: &s.Transfers[i]})
+	}
+	if err == nil {
+		err = json.NewEncoder(buffered).Encode(exportLine{Kind: exportChecksum, SHA256: hex.EncodeToString(hash.Sum(nil))})
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+	return nil
+}
+
+// ReadExport reads an export written by Export and returns its accounts,
+// transfers and IDs given last. The export is refused with
+// ErrInvalidExport if its checksum does not match, if it is cut short or if
+// any ID is repeated or greater than the last one given.
+func ReadExport(r io.Reader) (Snapshot, error) {
+	var snapshot Snapshot
+	invalid := func(line int, format string, args ...interface{}) error {
+		return fmt.Errorf("%w: line %d: %s", ErrInvalidExport, line, fmt.Sprintf(format, args...))
+	}
+
+	reader := bufio.NewReader(r)
+	hash := sha256.New()
+	var header *exportLine
+	accounts, transfers := map[uint64]bool{}, map[uint64]bool{}
+	for n := 1; ; n++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(bytes.TrimSpace(data)) == 0 {
+			return Snapshot{}, invalid(n, "the export ends before its checksum")
+		}
+		if err != nil && err != io.EOF {
+			return Snapshot{}, fmt.Errorf("error reading export: %w", err)
+		}
+		var line exportLine
+		if json.Unmarshal(data, &line) != nil {
+			return Snapshot{}, invalid(n, "it is not a JSON object")
+		}
+		if header == nil && line.Kind != exportHeader {
+			return Snapshot{}, invalid(n, "the export must start with a header")
+		}
+
+		switch line.Kind {
+		case exportHeader:
+			if header != nil {
+				return Snapshot{}, invalid(n, "the export has a second header")
+			}
+			if line.Version != ExportVersion {
+				return Snapshot{}, invalid(n, "version %d is not supported: it must be %d", line.Version, ExportVersion)
+			}
+			if line.Accounts == nil || line.Transfers == nil {
+				return Snapshot{}, invalid(n, "the header must have how many accounts and transfers follow")
+			}
+			header = &line
+			snapshot.AccountMaxID = line.AccountMaxID
+			snapshot.TransferMaxID = line.TransferMaxID
+			snapshot.Remessas = line.Remessas
+
+		case exportAccount:
+			if line.Account == nil || line.Account.ID == 0 {
+				return Snapshot{}, invalid(n, "the account has no ID")
+			}
+			if accounts[line.Account.ID] || line.Account.ID > header.AccountMaxID {
+				return Snapshot{}, invalid(n, "account ID %d is repeated or greater than the last one given, %d", line.Account.ID, header.AccountMaxID)
+			}
+			accounts[line.Account.ID] = true
+			snapshot.Accounts = append(snapshot.Accounts, *line.Account)
+
+		case exportTransfer:
+			if line.Transfer == nil || line.Transfer.ID == 0 {
+				return Snapshot{}, invalid(n, "the transfer has no ID")
+			}
+			if transfers[line.Transfer.ID] || line.Transfer.ID > header.TransferMaxID {
+				return Snapshot{}, invalid(n, "transfer ID %d is repeated or greater than the last one given, %d", line.Transfer.ID, header.TransferMaxID)
+			}
+			transfers[line.Transfer.ID] = true
+			snapshot.Transfers = append(snapshot.Transfers, *line.Transfer)
+
+		case exportChecksum:
+			if sum := hex.EncodeToString(hash.Sum(nil)); line.SHA256 != sum {
+				return Snapshot{}, invalid(n, "checksum %s does not match the content, %s", line.SHA256, sum)
+			}
+			if len(snapshot.Accounts) != *header.Accounts || len(snapshot.Transfers) != *header.Transfers {
+				return Snapshot{}, invalid(n, "the export has %d accounts and %d transfers, but the header says %d and %d",
+					len(snapshot.Accounts), len(snapshot.Transfers), *header.Accounts, *header.Transfers)
+			}
+			if rest, _ := reader.ReadString(0); len(bytes.TrimSpace([]byte(rest))) > 0 {
+				return Snapshot{}, invalid(n+1, "nothing may follow the checksum")
+			}
+			return snapshot, nil
+
+		default:
+			return Snapshot{}, invalid(n, "unknown kind %q", line.Kind)
+		}
+		hash.Write(data)
+	}
+}
+
+// ImportResult tells what an import added and the IDs given last after it.
+type ImportResult struct {
+	Accounts      int    `json:"accounts"`
+	Transfers     int    `json:"transfers"`
+	AccountMaxID  uint64 `json:"account_max_id"`
+	TransferMaxID uint64 `json:"transfer_max_id"`
+}
+
+// stateImport is the data of the change that imports an export.
+type stateImport struct {
+	Replace       bool              `json:"replace,omitempty"`
+	AccountMaxID  uint64            `json:"account_max_id"`
+	TransferMaxID uint64            `json:"transfer_max_id"`
+	Accounts      []snapshotAccount `json:"accounts"`
+	Transfers     []app.Transfer    `json:"transfers"`
+	Remessas      []string          `json:"remessas,omitempty"`
+}
+
+// Import adds the accounts, transfers and paid remessas of an export to the
+// stores, in a single change, and makes sure new IDs come after the ones it
+// has. In merge mode, it fails with ErrImportConflict if any of their IDs
+// is in use; in replace mode, everything the stores hold is dropped first,
+// but the export must bring back every bank-owned account with the same ID
+// and name, as the fee and interest engines keep paying to and from them.
+// Either way, every transfer must be between accounts the stores end up
+// with. No events are published.
+func Import(ctx context.Context, accounts *AccountStore, transfers *TransferStore, s Snapshot, mode string) (ImportResult, error) {
+	if mode != ImportMerge && mode != ImportReplace {
+		return ImportResult{}, ErrInvalidImportMode
+	}
+
+	accounts.mu.Lock()
+	defer accounts.mu.Unlock()
+	transfers.mu.Lock()
+	defer transfers.mu.Unlock()
+
+	data := stateImport{
+		Replace:       mode == ImportReplace,
+		AccountMaxID:  s.AccountMaxID,
+		TransferMaxID: s.TransferMaxID,
+		Accounts:      s.Accounts,
+		Transfers:     s.Transfers,
+		Remessas:      s.Remessas,
+	}
+	err := checkImport(accounts, transfers, data)
+	if err == nil {
+		err = commitChange(accounts.journal, ChangeStateImported, data, func(c Change) error {
+			if err := accounts.apply(c); err != nil {
+				return err
+			}
+			return transfers.apply(c)
+		})
+	}
+	result := ImportResult{Accounts: len(s.Accounts), Transfers: len(s.Transfers)}
+	record(ctx, accounts.auditor, "state.import", struct {
+		Mode string `json:"mode"`
+		ImportResult
+	}{mode, result}, err)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	result.AccountMaxID = atomic.LoadUint64(accounts.maxID)
+	result.TransferMaxID = atomic.LoadUint64(transfers.maxID)
+	return result, nil
+}
+
+// checkImport tells whether an import can be applied to the stores. Both
+// locks must be held.
+func checkImport(accounts *AccountStore, transfers *TransferStore, data stateImport) error {
+	known := map[uint64]bool{}
+	var conflicts []string
+	for _, account := range data.Accounts {
+		if _, ok := accounts.dataStorage[account.ID]; ok && !data.Replace {
+			conflicts = append(conflicts, fmt.Sprintf("account %d", account.ID))
+		}
+		known[account.ID] = true
+	}
+	for _, transfer := range data.Transfers {
+		if _, ok := transfers.dataStorage[transfer.ID]; ok && !data.Replace {
+			conflicts = append(conflicts, fmt.Sprintf("transfer %d", transfer.ID))
+		}
+	}
+	holders := map[string]uint64{}
+	if !data.Replace {
+		for _, account := range accounts.dataStorage {
+			for _, key := range account.Keys {
+				holders[key.Key] = account.ID
+			}
+		}
+	}
+	for _, account := range data.Accounts {
+		for _, key := range account.Keys {
+			if holder, ok := holders[key.Key]; ok && holder != account.ID {
+				conflicts = append(conflicts, fmt.Sprintf("key %s", key.Key))
+			}
+			holders[key.Key] = account.ID
+		}
+	}
+	if data.Replace {
+		imported := map[uint64]snapshotAccount{}
+		for _, account := range data.Accounts {
+			imported[account.ID] = account
+		}
+		var dropped []uint64
+		for ID, account := range accounts.dataStorage {
+			kept, ok := imported[ID]
+			if account.Type == AccountTypeBank && (!ok || kept.Type != AccountTypeBank || kept.Name != account.Name) {
+				dropped = append(dropped, ID)
+			}
+		}
+		sort.Slice(dropped, func(i, j int) bool { return dropped[i] < dropped[j] })
+		for _, ID := range dropped {
+			conflicts = append(conflicts, fmt.Sprintf("bank account %d (%s)", ID, accounts.dataStorage[ID].Name))
+		}
+	}
+	if len(conflicts) > 0 {
+		if len(conflicts) > 10 {
+			conflicts = append(conflicts[:10], fmt.Sprintf("%d more", len(conflicts)-10))
+		}
+		return fmt.Errorf("%w: %v", ErrImportConflict, conflicts)
+	}
+
+	for _, transfer := range data.Transfers {
+		for _, ID := range []uint64{transfer.AccountOriginID, transfer.AccountDestinationID} {
+			if _, ok := accounts.dataStorage[ID]; !known[ID] && (data.Replace || !ok) {
+				return fmt.Errorf("%w: transfer %d is from or to account %d, which there would not be", ErrInvalidExport, transfer.ID, ID)
+			}
+		}
+	}
+	return nil
+}
+
+// applyImport applies the accounts of an import. The lock must be held.
+func (a *AccountStore) applyImport(data stateImport) {
+	last := data.AccountMaxID
+	if !data.Replace && atomic.LoadUint64(a.maxID) > last {
+		last = atomic.LoadUint64(a.maxID)
+	}
+	if data.Replace {
+		a.dataStorage = make(map[uint64]app.Account)
+	}
+	for _, account := range data.Accounts {
+		a.dataStorage[account.ID] = account.account()
+		if account.ID > last {
+			last = account.ID
+		}
+	}
+	atomic.StoreUint64(a.maxID, last)
+}
+
+// applyImport applies the transfers and remessas of an import. The lock must
+// be held.
+func (t *TransferStore) applyImport(data stateImport) {
+	last := data.TransferMaxID
+	if !data.Replace && atomic.LoadUint64(t.maxID) > last {
+		last = atomic.LoadUint64(t.maxID)
+	}
+	if data.Replace {
+		t.dataStorage = make(map[uint64]app.Transfer)
+		t.attempts = nil
+		t.remessas = nil
+	}
+	for _, remessa := range data.Remessas {
+		t.claimRemessa(remessa)
+	}
+	for _, transfer := range data.Transfers {
+		t.dataStorage[transfer.ID] = transfer
+		if transfer.ID > last {
+			last = transfer.ID
+		}
+	}
+	atomic.StoreUint64(t.maxID, last)
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/audit"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	export := func(t *testing.T, accounts *AccountStore, transfers *TransferStore) []byte {
+		t.Helper()
+		var buffer bytes.Buffer
+		err := Export(&buffer, accounts, transfers)
+		app.AssertError(t, err, nil)
+		return buffer.Bytes()
+	}
+
+	t.Run("should import the whole state in another bank", func(t *testing.T) {
+		accounts, transfers := Snapshot{}.Restore()
+		bankDay(t, accounts, transfers)
+		data := export(t, accounts, transfers)
+
+		snapshot, err := ReadExport(bytes.NewReader(data))
+		app.AssertError(t, err, nil)
+		otherAccounts, otherTransfers := Snapshot{}.Restore()
+		result, err := Import(ctx, otherAccounts, otherTransfers, snapshot, ImportMerge)
+		app.AssertError(t, err, nil)
+
+		want := TakeSnapshot(accounts, transfers)
+		assertNoDiff(t, want.Diff(TakeSnapshot(otherAccounts, otherTransfers)))
+		app.AssertUint64(t, uint64(result.Accounts), uint64(len(want.Accounts)))
+		app.AssertUint64(t, result.TransferMaxID, want.TransferMaxID)
+		account, _ := otherAccounts.GetAccount(3)
+		app.AssertString(t, account.Secret, "hash")
+		ID, _ := otherAccounts.CreateAccount(ctx, "Dwight Schrute", "10000000003", 0)
+		app.AssertUint64(t, ID, want.AccountMaxID+1)
+		if len(otherAccounts.Outbox().State().Events) != 1 {
+			t.Errorf("got events %v; want only the one of the new account", otherAccounts.Outbox().State().Events)
+		}
+	})
+
+	t.Run("should keep the IDs given last even if their accounts are gone", func(t *testing.T) {
+		accounts := NewAccountStore(app.StartingID(7), app.Account{ID: 2, Name: "Pam Beesly"})
+		transfers := NewTransferStore(app.StartingID(4))
+		snapshot, err := ReadExport(bytes.NewReader(export(t, accounts, transfers)))
+		app.AssertError(t, err, nil)
+
+		otherAccounts, otherTransfers := Snapshot{}.Restore()
+		Import(ctx, otherAccounts, otherTransfers, snapshot, ImportMerge)
+		accountID, _ := otherAccounts.CreateAccount(ctx, "Jim Halpert", "10000000002", 0)
+		transferID, _ := otherTransfers.CreateTransfer(ctx, 2, accountID, 100)
+
+		app.AssertUint64(t, accountID, 8)
+		app.AssertUint64(t, transferID, 5)
+	})
+
+	t.Run("should refuse IDs in use unless replacing", func(t *testing.T) {
+		accounts, transfers := Snapshot{}.Restore()
+		bankDay(t, accounts, transfers)
+		snapshot, _ := ReadExport(bytes.NewReader(export(t, accounts, transfers)))
+		log := audit.NewLog()
+		accounts.SetAuditor(log)
+
+		_, err := Import(ctx, accounts, transfers, snapshot, ImportMerge)
+		if !errors.Is(err, ErrImportConflict) || !strings.Contains(err.Error(), "account 1") {
+			t.Errorf("got error %v; want %v", err, ErrImportConflict)
+		}
+
+		other, otherTransfers := Snapshot{}.Restore()
+		other.OpenAccount(ctx, AccountTypeBank, "Fee Revenue", "", 0)
+		other.OpenAccount(ctx, AccountTypeBank, "Interest Expense", "", 100000)
+		other.OpenAccount(ctx, AccountTypeChecking, "Dwight Schrute", "10000000003", 100)
+		other.OpenAccount(ctx, AccountTypeChecking, "Angela Martin", "10000000004", 100)
+		otherTransfers.CreateTransfer(ctx, 3, 4, 100)
+		only, _ := ReadExport(bytes.NewReader(export(t, other, otherTransfers)))
+		_, err = Import(ctx, accounts, transfers, only, ImportReplace)
+		app.AssertError(t, err, nil)
+
+		got := TakeSnapshot(accounts, transfers)
+		assertNoDiff(t, TakeSnapshot(other, otherTransfers).Diff(got))
+		entries := log.Entries()
+		app.AssertString(t, entries[len(entries)-1].Action, "state.import")
+		if strings.Contains(string(entries[len(entries)-1].Payload), "Dwight") {
+			t.Errorf("got the accounts in the audit log: %s", entries[len(entries)-1].Payload)
+		}
+	})
+
+	t.Run("should refuse replacing without the bank accounts", func(t *testing.T) {
+		accounts, transfers := Snapshot{}.Restore()
+		bankDay(t, accounts, transfers)
+		before := TakeSnapshot(accounts, transfers)
+
+		other, otherTransfers := Snapshot{}.Restore()
+		other.OpenAccount(ctx, AccountTypeBank, "Fee Revenue", "", 0)
+		other.OpenAccount(ctx, AccountTypeChecking, "Interest Expense", "10000000003", 100)
+		only, _ := ReadExport(bytes.NewReader(export(t, other, otherTransfers)))
+		_, err := Import(ctx, accounts, transfers, only, ImportReplace)
+		if !errors.Is(err, ErrImportConflict) || !strings.Contains(err.Error(), "bank account 2 (Interest Expense)") || strings.Contains(err.Error(), "bank account 1") {
+			t.Errorf("got error %v; want %v about bank account 2 only", err, ErrImportConflict)
+		}
+		assertNoDiff(t, before.Diff(TakeSnapshot(accounts, transfers)))
+	})
+
+	t.Run("should refuse transfers between accounts there would not be", func(t *testing.T) {
+		accounts, transfers := Snapshot{}.Restore()
+		accounts.CreateAccount(ctx, "Pam Beesly", "10000000001", 100)
+		snapshot := Snapshot{
+			AccountMaxID:  2,
+			TransferMaxID: 1,
+			Accounts:      []snapshotAccount{{Account: app.Account{ID: 2}}},
+			Transfers:     []app.Transfer{{ID: 1, AccountOriginID: 2, AccountDestinationID: 3}},
+		}
+
+		_, err := Import(ctx, accounts, transfers, snapshot, ImportMerge)
+		if !errors.Is(err, ErrInvalidExport) {
+			t.Errorf("got error %v; want %v", err, ErrInvalidExport)
+		}
+		snapshot.Transfers[0].AccountDestinationID = 1
+		_, err = Import(ctx, accounts, transfers, snapshot, ImportReplace)
+		if !errors.Is(err, ErrInvalidExport) {
+			t.Errorf("got error %v after replacing account 1; want %v", err, ErrInvalidExport)
+		}
+		_, err = Import(ctx, accounts, transfers, snapshot, ImportMerge)
+		app.AssertError(t, err, nil)
+		_, err = Import(ctx, accounts, transfers, snapshot, "append")
+		app.AssertError(t, err, ErrInvalidImportMode)
+	})
+
+	t.Run("should refuse exports changed or cut short", func(t *testing.T) {
+		accounts, transfers := Snapshot{}.Restore()
+		bankDay(t, accounts, transfers)
+		data := string(export(t, accounts, transfers))
+		lines := strings.SplitAfter(data, "\n")
+
+		tests := []struct {
+			name string
+			data string
+			want string
+		}{
+			{"changed", strings.Replace(data, `"amount":3000`, `"amount":3001`, 1), "does not match"},
+			{"cut short", strings.Join(lines[:len(lines)-2], ""), "ends before its checksum"},
+			{"without a line", strings.Join(lines[:2], "") + strings.Join(lines[3:], ""), "does not match"},
+			{"of another version", strings.Replace(data, `"version":1`, `"version":2`, 1), "version 2 is not supported"},
+			{"without a header", strings.Join(lines[1:], ""), "must start with a header"},
+			{"followed by more", data + lines[1], "nothing may follow"},
+			{"not NDJSON", "a,b,c\n", "not a JSON object"},
+		}
+		for _, tt := range tests {
+			_, err := ReadExport(strings.NewReader(tt.data))
+			if !errors.Is(err, ErrInvalidExport) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("%s: got error %v; want %q", tt.name, err, tt.want)
+			}
+		}
+	})
+
+	t.Run("should keep an import in the journal", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "export")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		accounts, transfers := Snapshot{}.Restore()
+		bankDay(t, accounts, transfers)
+		snapshot, _ := ReadExport(bytes.NewReader(export(t, accounts, transfers)))
+
+		journalPath, snapshotPath := filepath.Join(dir, "bank.journal"), filepath.Join(dir, "bank.json")
+		imported, importedTransfers, journal, _ := OpenEventStore(journalPath, snapshotPath)
+		imported.CreateAccount(ctx, "Dwight Schrute", "10000000003", 0)
+		_, err = Import(ctx, imported, importedTransfers, snapshot, ImportReplace)
+		app.AssertError(t, err, nil)
+		journal.Close()
+		reopened, reopenedTransfers, journal, err := OpenEventStore(journalPath, snapshotPath)
+		app.AssertError(t, err, nil)
+		defer journal.Close()
+
+		assertNoDiff(t, TakeSnapshot(accounts, transfers).Diff(TakeSnapshot(reopened, reopenedTransfers)))
+	})
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+)
+
+// Transfer kinds, used to tell apart the operations that create transfers.
+const (
+	KindTransfer = "transfer"
+	KindSplit    = "split"
+)
+
+// FeeRule describes the fee charged on transfers that match it. Empty
+// AccountType and Kind match anything, and a zero MaxAmount or MaxFee means
+// there is no upper bound. The fee is Flat plus Percentage (in basis points)
+// of the amount, rounded half up to the cent and then kept between MinFee
+// and MaxFee.
+type FeeRule struct {
+	AccountType string `json:"account_type,omitempty"`
+	Kind        string `json:"kind,omitempty"`
+	MinAmount   uint64 `json:"min_amount,omitempty"`
+	MaxAmount   uint64 `json:"max_amount,omitempty"`
+	Flat        uint64 `json:"flat,omitempty"`
+	Percentage  uint64 `json:"percentage,omitempty"`
+	MinFee      uint64 `json:"min_fee,omitempty"`
+	MaxFee      uint64 `json:"max_fee,omitempty"`
+}
+
+var ErrInvalidFeeRule = errors.New("invalid fee rule")
+
+// FeeEngine computes transfer fees from an ordered list of rules, where the
+// first matching rule wins. Fees are credited to the bank-owned account with
+// ID AccountID.
+type FeeEngine struct {
+	AccountID uint64    `json:"account_id"`
+	Rules     []FeeRule `json:"rules"`
+}
+
+// LoadFeeEngine reads a FeeEngine from a JSON file, refusing rules that
+// charge more than the whole amount or whose minimum fee is above their
+// maximum.
+func LoadFeeEngine(path string) (*FeeEngine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading fee rules: %w", err)
+	}
+	engine := &FeeEngine{}
+	err = json.Unmarshal(data, engine)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding fee rules: %w", err)
+	}
+	for i, rule := range engine.Rules {
+		if rule.Percentage > PercentageBase {
+			return nil, fmt.Errorf("%w: rule %d charges %d basis points, more than %d", ErrInvalidFeeRule, i+1, rule.Percentage, PercentageBase)
+		}
+		if rule.MaxFee != 0 && rule.MinFee > rule.MaxFee {
+			return nil, fmt.Errorf("%w: rule %d has a minimum fee of %d, above its maximum of %d", ErrInvalidFeeRule, i+1, rule.MinFee, rule.MaxFee)
+		}
+	}
+	return engine, nil
+}
+
+// Fee returns the fee for a transfer of amount cents of the given kind from
+// an account of the given type. A nil engine charges no fees. Amounts whose
+// fee does not fit in a uint64 are refused with ErrInvalidAmount.
+func (f *FeeEngine) Fee(accountType, kind string, amount uint64) (uint64, error) {
+	if f == nil {
+		return 0, nil
+	}
+	for _, rule := range f.Rules {
+		if rule.matches(accountType, kind, amount) {
+			fee, ok := rule.fee(amount)
+			if !ok {
+				return 0, fmt.Errorf("%w: the fee on %d overflows", ErrInvalidAmount, amount)
+			}
+			return fee, nil
+		}
+	}
+	return 0, nil
+}
+
+func (r FeeRule) matches(accountType, kind string, amount uint64) bool {
+	if r.AccountType != "" && r.AccountType != accountType {
+		return false
+	}
+	if r.Kind != "" && r.Kind != kind {
+		return false
+	}
+	if amount < r.MinAmount {
+		return false
+	}
+	if r.MaxAmount != 0 && amount > r.MaxAmount {
+		return false
+	}
+	return true
+}
+
+// fee returns the fee the rule charges on amount, or false if it does not fit
+// in a uint64. The product of amount and the percentage is worked out in 128
+// bits, as it overflows long before the fee does.
+func (r FeeRule) fee(amount uint64) (uint64, bool) {
+	hi, lo := bits.Mul64(amount, r.Percentage)
+	lo, carry := bits.Add64(lo, PercentageBase/2, 0)
+	hi += carry
+	if hi >= PercentageBase {
+		return 0, false
+	}
+	percentage, _ := bits.Div64(hi, lo, PercentageBase)
+	fee, carry := bits.Add64(r.Flat, percentage, 0)
+	if carry != 0 {
+		return 0, false
+	}
+	if fee < r.MinFee {
+		fee = r.MinFee
+	}
+	if r.MaxFee != 0 && fee > r.MaxFee {
+		fee = r.MaxFee
+	}
+	return fee, true
+}
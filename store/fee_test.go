@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"errors"
+	app "github.com/erikacarvalho/stone-challenge"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFee(t *testing.T) {
+	engine := &FeeEngine{
+		AccountID: 1,
+		Rules: []FeeRule{
+			{AccountType: AccountTypeBusiness, Kind: KindSplit, Percentage: 250, MinFee: 100, MaxFee: 5000},
+			{AccountType: AccountTypeBusiness, MinAmount: 100000, Flat: 300},
+			{Kind: KindTransfer, MaxAmount: 9999, Flat: 50, Percentage: 125},
+		},
+	}
+
+	cases := []struct {
+		name        string
+		accountType string
+		kind        string
+		amount      uint64
+		want        uint64
+	}{
+		{"percentage fee within caps", AccountTypeBusiness, KindSplit, 100000, 2500},
+		{"percentage fee raised to the minimum", AccountTypeBusiness, KindSplit, 1000, 100},
+		{"percentage fee lowered to the maximum", AccountTypeBusiness, KindSplit, 1000000, 5000},
+		{"flat fee on the upper bracket", AccountTypeBusiness, KindTransfer, 100000, 300},
+		{"flat plus percentage rounded half up", AccountTypeChecking, KindTransfer, 1000, 63},
+		{"no matching rule", AccountTypeChecking, KindTransfer, 10000, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := engine.Fee(c.accountType, c.kind, c.amount)
+			app.AssertError(t, err, nil)
+			app.AssertUint64(t, got, c.want)
+		})
+	}
+
+	t.Run("should charge nothing without an engine", func(t *testing.T) {
+		var noFees *FeeEngine
+		got, err := noFees.Fee(AccountTypeChecking, KindTransfer, 1000)
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, got, 0)
+	})
+
+	t.Run("should charge the percentage of amounts whose product overflows", func(t *testing.T) {
+		got, err := engine.Fee(AccountTypeBusiness, KindSplit, math.MaxUint64/100)
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, got, 5000)
+	})
+
+	t.Run("should refuse amounts whose fee overflows", func(t *testing.T) {
+		overflowing := &FeeEngine{Rules: []FeeRule{{Flat: 1, Percentage: PercentageBase}}}
+
+		_, err := overflowing.Fee(AccountTypeChecking, KindTransfer, math.MaxUint64)
+
+		if !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("got %v; want %v", err, ErrInvalidAmount)
+		}
+	})
+}
+
+func TestLoadFeeEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fees")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	load := func(t *testing.T, rules string) (*FeeEngine, error) {
+		t.Helper()
+		path := filepath.Join(dir, "fees.json")
+		if err := ioutil.WriteFile(path, []byte(rules), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return LoadFeeEngine(path)
+	}
+
+	t.Run("should load valid rules", func(t *testing.T) {
+		engine, err := load(t, `{"account_id":1,"rules":[{"percentage":250,"min_fee":100,"max_fee":5000},{"min_fee":100}]}`)
+
+		app.AssertError(t, err, nil)
+		if engine == nil || len(engine.Rules) != 2 {
+			t.Fatalf("got %+v; want 2 rules", engine)
+		}
+	})
+
+	cases := []struct {
+		name  string
+		rules string
+	}{
+		{"percentage above the whole amount", `{"account_id":1,"rules":[{"percentage":10001}]}`},
+		{"minimum fee above the maximum", `{"account_id":1,"rules":[{"min_fee":500,"max_fee":100}]}`},
+	}
+
+	for _, c := range cases {
+		t.Run("should refuse a "+c.name, func(t *testing.T) {
+			_, err := load(t, c.rules)
+
+			if !errors.Is(err, ErrInvalidFeeRule) {
+				t.Errorf("got %v; want %v", err, ErrInvalidFeeRule)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithFee(t *testing.T) {
+	newStore := func() *TransferStore {
+		transfers := map[uint64]app.Transfer{
+			1: {ID: 1, AccountOriginID: 10, AccountDestinationID: 20, Amount: 1000, CreatedAt: time.Now(), Status: ToStatusMsg(StatusCreated), Kind: KindTransfer},
+		}
+		store := &TransferStore{maxID: app.StartingID(len(transfers)), dataStorage: transfers}
+		store.SetFeeEngine(&FeeEngine{AccountID: 99, Rules: []FeeRule{{Flat: 150}}})
+		return store
+	}
+
+	t.Run("should record the fee on the transfer", func(t *testing.T) {
+		store := newStore()
+
+		got := store.AuthorizeTransfer(context.Background(), &app.Account{ID: 10, Balance: 1150}, &app.Account{ID: 20}, 1000, 1)
+
+		app.AssertError(t, got, nil)
+		app.AssertUint64(t, store.dataStorage[1].Fee, 150)
+	})
+
+	t.Run("should return ErrInsufficientBalance when balance covers the amount but not the fee", func(t *testing.T) {
+		store := newStore()
+
+		got := store.AuthorizeTransfer(context.Background(), &app.Account{ID: 10, Balance: 1149}, &app.Account{ID: 20}, 1000, 1)
+
+		app.AssertError(t, got, ErrInsufficientBalance)
+		app.AssertString(t, store.dataStorage[1].Status, ToStatusMsg(StatusNotAuthorized))
+	})
+}
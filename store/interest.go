@@ -0,0 +1,296 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Day-count conventions, which tell how many days an annual rate is spread
+// over.
+const (
+	DayCountActual365    = "ACT/365"
+	DayCountActual360    = "ACT/360"
+	DayCountActualActual = "ACT/ACT"
+)
+
+// dayFormat is the layout of the days interest was accrued for.
+const dayFormat = "2006-01-02"
+
+// KindInterest is the kind of the transfers that pay interest out of the
+// bank interest expense account.
+const KindInterest = "interest"
+
+var (
+	ErrInvalidRate     = errors.New("the annual interest rate must be a non-negative decimal number")
+	ErrInvalidDayCount = errors.New("the day-count convention must be ACT/365, ACT/360 or ACT/ACT")
+)
+
+// InterestEngine accrues daily interest on savings accounts and pays it out
+// monthly. The interest accrued so far is kept as an exact fraction of cents
+// for each account, so no precision is lost between days; only whole cents
+// are shown on the account and paid out, the fraction carrying over to the
+// next month. Both are stored on the account, along with the last day
+// accrued, so that a restarted engine goes on from them and catches up on
+// the days it missed.
+type InterestEngine struct {
+	mu               sync.Mutex
+	accounts         *AccountStore
+	transfers        *TransferStore
+	rate             *big.Rat
+	dayCount         string
+	expenseAccountID uint64
+	accrued          map[uint64]*big.Rat // The map key is the account identifier
+	next             time.Time           // First day that has not been accrued yet
+}
+
+// NewInterestEngine returns an engine that accrues interest at annualRate
+// (a decimal such as "0.065" for 6.5% a year) using the given day-count
+// convention. It starts on the day after the last one accrued on any
+// account, or on the day of start if none was. Interest is paid out of the
+// bank-owned account with ID expenseAccountID.
+func NewInterestEngine(accounts *AccountStore, transfers *TransferStore, annualRate, dayCount string, expenseAccountID uint64, start time.Time) (*InterestEngine, error) {
+	rate, ok := new(big.Rat).SetString(annualRate)
+	if !ok || rate.Sign() < 0 {
+		return nil, ErrInvalidRate
+	}
+	switch dayCount {
+	case DayCountActual365, DayCountActual360, DayCountActualActual:
+	default:
+		return nil, ErrInvalidDayCount
+	}
+	accrued, err := accounts.accruedInterest()
+	if err != nil {
+		return nil, err
+	}
+	next, err := accounts.nextInterestDay(start)
+	if err != nil {
+		return nil, err
+	}
+	return &InterestEngine{
+		accounts:         accounts,
+		transfers:        transfers,
+		rate:             rate,
+		dayCount:         dayCount,
+		expenseAccountID: expenseAccountID,
+		accrued:          accrued,
+		next:             next,
+	}, nil
+}
+
+// nextInterestDay returns the day after the last one interest was accrued
+// for on any account, in the location of start, or the day of start if
+// there is none.
+func (a *AccountStore) nextInterestDay(start time.Time) (time.Time, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	last := ""
+	for _, account := range a.dataStorage {
+		if account.InterestDay > last {
+			last = account.InterestDay
+		}
+	}
+	if last == "" {
+		return startOfDay(start), nil
+	}
+	day, err := time.ParseInLocation(dayFormat, last, start.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid interest day %q: %w", last, err)
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
+// accruedInterest returns the exact interest accrued and not paid out yet on
+// every account that has some.
+func (a *AccountStore) accruedInterest() (map[uint64]*big.Rat, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	accrued := make(map[uint64]*big.Rat)
+	for id, account := range a.dataStorage {
+		if account.AccruedInterest == 0 && account.InterestFraction == "" {
+			continue
+		}
+		total := cents(account.AccruedInterest)
+		if account.InterestFraction != "" {
+			fraction, ok := new(big.Rat).SetString(account.InterestFraction)
+			if !ok {
+				return nil, fmt.Errorf("invalid interest fraction %q on account %d", account.InterestFraction, id)
+			}
+			total.Add(total, fraction)
+		}
+		accrued[id] = total
+	}
+	return accrued, nil
+}
+
+// Run catches up on the days missed while stopped, then accrues interest
+// once a day and pays it out at the turn of each month until stop is closed.
+// Each day is accrued shortly after it ends, on the balance the account had
+// when it ended.
+func (e *InterestEngine) Run(stop <-chan struct{}) {
+	e.AccrueUntil(time.Now())
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			e.AccrueUntil(now)
+		}
+	}
+}
+
+// AccrueUntil accrues every whole day that ended before now and has not been
+// accrued yet, paying out the interest whenever a month is over.
+func (e *InterestEngine) AccrueUntil(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ctx := logging.NewContext(context.Background(), logging.Default().With("component", "interest"))
+	today := startOfDay(now)
+	for e.next.Before(today) {
+		day := e.next
+		e.accrueDay(ctx, day)
+		e.next = day.AddDate(0, 0, 1)
+		if e.next.Month() != day.Month() {
+			e.payOut(ctx)
+		}
+	}
+}
+
+// accrueDay adds one day of interest on the closing balance of that day to
+// every savings account that was open by its end and has not had it accrued
+// yet.
+func (e *InterestEngine) accrueDay(ctx context.Context, day time.Time) {
+	dailyRate := new(big.Rat).Quo(e.rate, big.NewRat(e.daysInYear(day), 1))
+	name := day.Format(dayFormat)
+	end := day.AddDate(0, 0, 1)
+
+	e.accounts.mu.Lock()
+	defer e.accounts.mu.Unlock()
+
+	var accrued []uint64
+	var accruals []accrual
+	for id, account := range e.accounts.dataStorage {
+		if account.Type != AccountTypeSavings || account.InterestDay >= name || !account.CreatedAt.Before(end) {
+			continue
+		}
+		accrued = append(accrued, id)
+		interest := new(big.Rat).Mul(cents(closingBalance(account, end)), dailyRate)
+		total, ok := e.accrued[id]
+		if !ok {
+			total = new(big.Rat)
+			e.accrued[id] = total
+		}
+		total.Add(total, interest)
+		accrual := newAccrual(id, total)
+		accrual.Day = name
+		accruals = append(accruals, accrual)
+	}
+
+	sort.Slice(accrued, func(i, j int) bool { return accrued[i] < accrued[j] })
+	sort.Slice(accruals, func(i, j int) bool { return accruals[i].AccountID < accruals[j].AccountID })
+	var err error
+	if len(accruals) > 0 {
+		err = e.accounts.commit(ChangeInterestAccrued, accruals)
+	}
+	record(ctx, e.accounts.auditor, "interest.accrue", struct {
+		Day      string   `json:"day"`
+		Accounts []uint64 `json:"accounts"`
+	}{name, accrued}, err)
+}
+
+// closingBalance returns the balance account had at end. Only the balance
+// before the first change of the day it last changed on is kept, which is
+// enough as days are accrued as soon as they end, and the balance does not
+// change while the engine is stopped.
+func closingBalance(account app.Account, end time.Time) uint64 {
+	if account.BalanceChangedAt.Before(end) {
+		return account.Balance
+	}
+	return account.OpeningBalance
+}
+
+// payOut pays the whole cents accrued on every savings account with a
+// system-originated transfer from the interest expense account.
+func (e *InterestEngine) payOut(ctx context.Context) {
+	var ids []uint64
+	for id := range e.accrued {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		accrued := e.accrued[id]
+		amount := wholeCents(accrued)
+		if amount == 0 {
+			continue
+		}
+
+		transferID, err := e.transfers.createSystemTransfer(ctx, KindInterest, e.expenseAccountID, id, amount)
+		if err != nil {
+			logging.FromContext(ctx).Error("error creating interest transfer", "account_id", id, "error", err)
+			continue
+		}
+		err = e.accounts.MoveFunds(ctx, e.expenseAccountID, Credit{AccountID: id, Amount: amount})
+		if err != nil {
+			logging.FromContext(ctx).Error("error paying interest", "account_id", id, "error", err)
+			e.transfers.Cancel(ctx, transferID)
+			continue
+		}
+		e.transfers.Confirm(ctx, transferID)
+
+		accrued.Sub(accrued, cents(amount))
+		e.accounts.setAccruedInterest(ctx, newAccrual(id, accrued))
+	}
+}
+
+// newAccrual splits the exact interest accrued on an account into whole
+// cents and the fraction of a cent left.
+func newAccrual(id uint64, total *big.Rat) accrual {
+	whole := wholeCents(total)
+	fraction := new(big.Rat).Sub(total, cents(whole))
+	a := accrual{AccountID: id, AccruedInterest: whole}
+	if fraction.Sign() != 0 {
+		a.Fraction = fraction.RatString()
+	}
+	return a
+}
+
+func (e *InterestEngine) daysInYear(day time.Time) int64 {
+	switch e.dayCount {
+	case DayCountActual360:
+		return 360
+	case DayCountActualActual:
+		return int64(time.Date(day.Year(), time.December, 31, 0, 0, 0, 0, day.Location()).YearDay())
+	default:
+		return 365
+	}
+}
+
+func cents(amount uint64) *big.Rat {
+	return new(big.Rat).SetFrac(new(big.Int).SetUint64(amount), big.NewInt(1))
+}
+
+func wholeCents(r *big.Rat) uint64 {
+	return new(big.Int).Quo(r.Num(), r.Denom()).Uint64()
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// String describes the engine settings, for logging.
+func (e *InterestEngine) String() string {
+	return fmt.Sprintf("%s a year (%s) paid from account %d", e.rate.FloatString(4), e.dayCount, e.expenseAccountID)
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	app "github.com/erikacarvalho/stone-challenge"
+	"testing"
+	"time"
+)
+
+func TestInterestEngine(t *testing.T) {
+	start := time.Date(2020, time.January, 30, 0, 0, 0, 0, time.UTC)
+
+	newEngine := func(rate, dayCount string, from time.Time) (*InterestEngine, *AccountStore, *TransferStore) {
+		accounts := NewAccountStore(app.StartingID(3),
+			app.Account{ID: 1, Name: "Interest Expense", Balance: 1000000, Type: AccountTypeBank},
+			app.Account{ID: 2, Name: "Talita Barreto Coelho", Balance: 1000000, Type: AccountTypeSavings},
+			app.Account{ID: 3, Name: "Maurício Ximenes Brito", Balance: 1000000, Type: AccountTypeChecking},
+		)
+		transfers := NewTransferStore(app.StartingID(0))
+		engine, err := NewInterestEngine(accounts, transfers, rate, dayCount, 1, from)
+		if err != nil {
+			t.Fatalf("error creating interest engine. error: %q", err)
+		}
+		return engine, accounts, transfers
+	}
+
+	t.Run("should accrue daily interest on savings accounts only", func(t *testing.T) {
+		engine, accounts, _ := newEngine("0.0365", DayCountActual365, start)
+
+		engine.AccrueUntil(start.AddDate(0, 0, 1))
+
+		savings, _ := accounts.GetAccount(2)
+		checking, _ := accounts.GetAccount(3)
+		app.AssertUint64(t, savings.AccruedInterest, 100)
+		app.AssertUint64(t, checking.AccruedInterest, 0)
+		app.AssertUint64(t, savings.Balance, 1000000)
+	})
+
+	t.Run("should keep fractions of cents between days", func(t *testing.T) {
+		midMonth := time.Date(2020, time.March, 10, 0, 0, 0, 0, time.UTC)
+		engine, accounts, _ := newEngine("0.0001", DayCountActual360, midMonth)
+
+		// 1000000 * 0.0001 / 360 is 5/18 of a cent a day
+		engine.AccrueUntil(midMonth.AddDate(0, 0, 3))
+		savings, _ := accounts.GetAccount(2)
+		app.AssertUint64(t, savings.AccruedInterest, 0)
+
+		engine.AccrueUntil(midMonth.AddDate(0, 0, 4))
+		savings, _ = accounts.GetAccount(2)
+		app.AssertUint64(t, savings.AccruedInterest, 1)
+	})
+
+	t.Run("should go on from the interest accrued before a restart", func(t *testing.T) {
+		midMonth := time.Date(2020, time.March, 10, 0, 0, 0, 0, time.UTC)
+		engine, accounts, transfers := newEngine("0.0001", DayCountActual360, midMonth)
+		engine.AccrueUntil(midMonth.AddDate(0, 0, 3))
+
+		accounts, transfers = TakeSnapshot(accounts, transfers).Restore()
+		restarted, err := NewInterestEngine(accounts, transfers, "0.0001", DayCountActual360, 1, midMonth.AddDate(0, 0, 3))
+		app.AssertError(t, err, nil)
+		restarted.AccrueUntil(midMonth.AddDate(0, 0, 4))
+
+		// 15/18 of a cent before the restart and 5/18 after it
+		savings, _ := accounts.GetAccount(2)
+		app.AssertUint64(t, savings.AccruedInterest, 1)
+		app.AssertString(t, savings.InterestFraction, "1/9")
+	})
+
+	t.Run("should catch up on the days missed while stopped", func(t *testing.T) {
+		midMonth := time.Date(2020, time.March, 10, 0, 0, 0, 0, time.UTC)
+		engine, accounts, transfers := newEngine("0.0001", DayCountActual360, midMonth)
+		engine.AccrueUntil(midMonth.AddDate(0, 0, 3))
+
+		accounts, transfers = TakeSnapshot(accounts, transfers).Restore()
+		restarted, err := NewInterestEngine(accounts, transfers, "0.0001", DayCountActual360, 1, midMonth.AddDate(0, 0, 5))
+		app.AssertError(t, err, nil)
+		restarted.AccrueUntil(midMonth.AddDate(0, 0, 5))
+
+		// 5/18 of a cent for each of the five days
+		savings, _ := accounts.GetAccount(2)
+		app.AssertUint64(t, savings.AccruedInterest, 1)
+		app.AssertString(t, savings.InterestFraction, "7/18")
+		app.AssertString(t, savings.InterestDay, "2020-03-14")
+	})
+
+	t.Run("should accrue on the balance each day closed with", func(t *testing.T) {
+		midMonth := time.Date(2020, time.March, 10, 0, 0, 0, 0, time.UTC)
+		accounts := NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Interest Expense", Balance: 1000000, Type: AccountTypeBank},
+			app.Account{ID: 2, Name: "Talita Barreto Coelho", Balance: 2000000, Type: AccountTypeSavings,
+				BalanceChangedAt: midMonth.Add(36 * time.Hour), OpeningBalance: 1000000},
+		)
+		engine, err := NewInterestEngine(accounts, NewTransferStore(app.StartingID(0)), "0.0365", DayCountActual365, 1, midMonth)
+		app.AssertError(t, err, nil)
+
+		engine.AccrueUntil(midMonth.AddDate(0, 0, 2))
+
+		// 100 cents on the day before the balance changed and 200 on the day it did
+		savings, _ := accounts.GetAccount(2)
+		app.AssertUint64(t, savings.AccruedInterest, 300)
+	})
+
+	t.Run("should pay out whole cents at the turn of the month", func(t *testing.T) {
+		engine, accounts, transfers := newEngine("0.0365", DayCountActual365, start)
+
+		engine.AccrueUntil(time.Date(2020, time.February, 1, 12, 0, 0, 0, time.UTC))
+
+		savings, _ := accounts.GetAccount(2)
+		expense, _ := accounts.GetAccount(1)
+		app.AssertUint64(t, savings.Balance, 1000200)
+		app.AssertUint64(t, savings.AccruedInterest, 0)
+		app.AssertUint64(t, expense.Balance, 999800)
+
+		transfer, err := transfers.GetTransfer(1)
+		app.AssertError(t, err, nil)
+		app.AssertString(t, transfer.Kind, KindInterest)
+		app.AssertString(t, transfer.Status, ToStatusMsg(StatusConfirmed))
+		app.AssertUint64(t, transfer.AccountOriginID, 1)
+		app.AssertUint64(t, transfer.Amount, 200)
+	})
+
+	t.Run("should use the actual number of days in leap years with ACT/ACT", func(t *testing.T) {
+		engine, _, _ := newEngine("0.0366", DayCountActualActual, start)
+
+		app.AssertUint64(t, uint64(engine.daysInYear(start)), 366)
+		app.AssertUint64(t, uint64(engine.daysInYear(start.AddDate(1, 0, 0))), 365)
+	})
+
+	t.Run("should return ErrInvalidDayCount for an unknown convention", func(t *testing.T) {
+		_, got := NewInterestEngine(nil, nil, "0.01", "30/360", 1, start)
+
+		app.AssertError(t, got, ErrInvalidDayCount)
+	})
+
+	t.Run("should return ErrInvalidRate for a rate that is not a number", func(t *testing.T) {
+		_, got := NewInterestEngine(nil, nil, "six percent", DayCountActual365, 1, start)
+
+		app.AssertError(t, got, ErrInvalidRate)
+	})
+}
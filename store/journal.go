@@ -0,0 +1,184 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// StorageEvents is the event-sourced storage backend: every change made to
+// the stores is kept in a journal before it is applied, and the stores are
+// rebuilt from it on start.
+const StorageEvents = "events"
+
+// Journal is a file the changes made to the stores are appended to, one
+// JSON change per line, and synced before they are applied. It is the
+// source of truth of the event-sourced backend.
+type Journal struct {
+	mu   sync.Mutex
+	seq  uint64
+	file *os.File
+	err  error // Set once a write fails; no change is made after that
+}
+
+// write gives c the next sequence number and appends it to the journal.
+// The lock must be held.
+func (j *Journal) write(c *Change) error {
+	if j.err != nil {
+		return j.err
+	}
+	c.Seq = j.seq + 1
+	line, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = j.file.Write(append(line, '\n'))
+	if err == nil {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		j.err = fmt.Errorf("error writing journal: %w", err)
+		return j.err
+	}
+	j.seq = c.Seq
+	return nil
+}
+
+// Seq returns the sequence number of the last change in the journal.
+func (j *Journal) Seq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// Err returns the error that made the journal stop taking changes, if any,
+// for the readiness probe.
+func (j *Journal) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// ReadJournal returns the changes in the journal at path, which must be
+// numbered from 1 with no gaps. A last line cut short by a crash while it
+// was written is left out, since that change was never applied.
+func ReadJournal(path string) ([]Change, error) {
+	changes, _, err := readJournal(path)
+	return changes, err
+}
+
+// readJournal also returns the size of the complete lines of the file.
+func readJournal(path string) ([]Change, int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	var changes []Change
+	for i, line := range bytes.Split(data[:complete], []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var c Change
+		err = json.Unmarshal(line, &c)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error reading journal %s line %d: %w", path, i+1, err)
+		}
+		if want := uint64(len(changes)) + 1; c.Seq != want {
+			return nil, 0, fmt.Errorf("error reading journal %s line %d: found change %d in place of %d", path, i+1, c.Seq, want)
+		}
+		changes = append(changes, c)
+	}
+	return changes, int64(complete), nil
+}
+
+// Replay returns stores holding the projection of changes, applied in order
+// to empty stores. No events are published.
+func Replay(changes []Change) (*AccountStore, *TransferStore, error) {
+	accounts := NewAccountStore(app.StartingID(0))
+	transfers := NewTransferStore(app.StartingID(0))
+	err := replay(accounts, transfers, changes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return accounts, transfers, nil
+}
+
+// replay applies changes to the stores, in order.
+func replay(accounts *AccountStore, transfers *TransferStore, changes []Change) error {
+	accounts.mu.Lock()
+	defer accounts.mu.Unlock()
+	transfers.mu.Lock()
+	defer transfers.mu.Unlock()
+
+	for _, c := range changes {
+		var err error
+		switch {
+		case c.Type == ChangeStateImported:
+			err = accounts.apply(c)
+			if err == nil {
+				err = transfers.apply(c)
+			}
+		case isAccountChange(c.Type):
+			err = accounts.apply(c)
+		default:
+			err = transfers.apply(c)
+		}
+		if err != nil {
+			return fmt.Errorf("error replaying change %d (%s): %w", c.Seq, c.Type, err)
+		}
+	}
+	return nil
+}
+
+// OpenEventStore returns the stores of the event-sourced backend. The
+// snapshot at snapshotPath, if there is one, is loaded and the changes in
+// the journal at journalPath made after it are replayed on it, which
+// publishes their events to the outbox again, with the same IDs. Every
+// change made to the stores from then on is kept in the journal first.
+func OpenEventStore(journalPath, snapshotPath string) (*AccountStore, *TransferStore, *Journal, error) {
+	snapshot, err := readSnapshot(snapshotPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	changes, size, err := readJournal(journalPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, nil, err
+	}
+	if uint64(len(changes)) < snapshot.JournalSeq {
+		return nil, nil, nil, fmt.Errorf("journal %s ends at change %d, before snapshot %s at change %d", journalPath, len(changes), snapshotPath, snapshot.JournalSeq)
+	}
+
+	accounts, transfers := snapshot.Restore()
+	err = replay(accounts, transfers, changes[snapshot.JournalSeq:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// A line cut short is removed, so that the next change starts a line.
+	file, err := os.OpenFile(journalPath, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error opening journal: %w", err)
+	}
+	err = file.Truncate(size)
+	if err == nil {
+		_, err = file.Seek(size, 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, fmt.Errorf("error opening journal: %w", err)
+	}
+	journal := &Journal{seq: uint64(len(changes)), file: file}
+	accounts.journal = journal
+	transfers.journal = journal
+	return accounts, transfers, journal, nil
+}
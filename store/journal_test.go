@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bankDay makes changes of every type to the stores, as the API and the
+// background jobs do.
+func bankDay(t *testing.T, accounts *AccountStore, transfers *TransferStore) {
+	t.Helper()
+	ctx := context.Background()
+	fees, _ := accounts.OpenAccount(ctx, AccountTypeBank, "Fee Revenue", "", 0)
+	expense, _ := accounts.OpenAccount(ctx, AccountTypeBank, "Interest Expense", "", 100000)
+	pam, _ := accounts.CreateAccount(ctx, "Pam Beesly", "10000000001", 100000)
+	jim, _ := accounts.OpenAccount(ctx, AccountTypeSavings, "Jim Halpert", "10000000002", 5000)
+	accounts.SetSecret(ctx, pam, "hash")
+	accounts.EnrollTOTP(ctx, pam, "JBSWY3DPEHPK3PXP")
+	accounts.ActivateTOTP(ctx, pam, 100)
+	accounts.UseTOTPStep(ctx, pam, 101)
+	accounts.RegisterKey(ctx, pam, KeyTypeCPF, "100.000.000-01")
+	accounts.RegisterKey(ctx, pam, KeyTypePhone, "+5511987654321")
+	accounts.RegisterKey(ctx, jim, KeyTypeEmail, "Jim@Dunder.com")
+	accounts.RemoveKey(ctx, pam, "+5511987654321")
+	charge, _ := accounts.CreateCharge(ctx, jim, "jim@dunder.com", 2500, "Pedido 42")
+	accounts.SetChargeTransfer(ctx, jim, charge.TxID, 1)
+	transfers.SetFeeEngine(&FeeEngine{AccountID: fees, Rules: []FeeRule{{Kind: KindTransfer, Flat: 50}}})
+
+	send := func(ID uint64) {
+		transfer, _ := transfers.GetTransfer(ID)
+		origin, _ := accounts.GetAccount(transfer.AccountOriginID)
+		destination, _ := accounts.GetAccount(transfer.AccountDestinationID)
+		if transfers.AuthorizeTransfer(ctx, &origin, &destination, transfer.Amount, ID) != nil {
+			return
+		}
+		transfer, _ = transfers.GetTransfer(ID)
+		err := accounts.MoveFunds(ctx, origin.ID,
+			Credit{AccountID: destination.ID, Amount: transfer.Amount},
+			Credit{AccountID: fees, Amount: transfer.Fee})
+		if err != nil {
+			transfers.Cancel(ctx, ID)
+			return
+		}
+		transfers.Confirm(ctx, ID)
+	}
+	confirmed, _ := transfers.CreateTransfer(ctx, pam, jim, 3000)
+	send(confirmed)
+	rejected, _ := transfers.CreateTransfer(ctx, jim, pam, 1000000)
+	send(rejected)
+
+	now := time.Now()
+	held, _ := transfers.CreateTransfer(ctx, pam, jim, 700)
+	transfers.HoldTransfers(ctx, now.Add(time.Minute), held)
+	transfers.ReleaseTransfers(ctx, now, held)
+	send(held)
+	expired, _ := transfers.CreateTransfer(ctx, pam, jim, 800)
+	transfers.HoldTransfers(ctx, now, expired)
+	transfers.ExpirePending(ctx, now)
+	remessa, _ := transfers.CreateRemessaTransfers(ctx, "10000000001", 42, []RemessaPayment{{AccountOriginID: pam, AccountDestinationID: jim, Amount: 400}})
+	for _, ID := range remessa {
+		send(ID)
+	}
+
+	_, legs, _ := transfers.CreateSplitTransfer(ctx, pam, []uint64{jim, fees}, []uint64{100, 200})
+	origin, _ := accounts.GetAccount(pam)
+	destinations := []*app.Account{{ID: jim}, {ID: fees}}
+	transfers.AuthorizeSplitTransfer(ctx, &origin, destinations, legs)
+	accounts.MoveFunds(ctx, pam, Credit{AccountID: jim, Amount: 100}, Credit{AccountID: fees, Amount: 200})
+	for _, ID := range legs {
+		transfers.Confirm(ctx, ID)
+	}
+
+	// Interest is accrued from today, when the accounts were opened, through
+	// the first day of next month, so that it is paid out once.
+	now = time.Now()
+	interest, _ := NewInterestEngine(accounts, transfers, "0.365", DayCountActual365, expense, now)
+	interest.AccrueUntil(time.Date(now.Year(), now.Month()+1, 2, 0, 0, 0, 0, now.Location()))
+
+	account, _ := accounts.GetAccount(pam)
+	account.Name = "Pam Halpert"
+	accounts.SetAccount(ctx, account)
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	t.Run("should rebuild the same stores as the state-based ones", func(t *testing.T) {
+		stateAccounts, stateTransfers := Snapshot{}.Restore()
+		bankDay(t, stateAccounts, stateTransfers)
+		accounts, transfers, journal, err := OpenEventStore(path("day.journal"), path("none.json"))
+		app.AssertError(t, err, nil)
+		bankDay(t, accounts, transfers)
+		journal.Close()
+
+		changes, err := ReadJournal(path("day.journal"))
+		app.AssertError(t, err, nil)
+		rebuiltAccounts, rebuiltTransfers, err := Replay(changes)
+		app.AssertError(t, err, nil)
+
+		want := TakeSnapshot(accounts, transfers)
+		assertNoDiff(t, want.Diff(TakeSnapshot(rebuiltAccounts, rebuiltTransfers)))
+		assertNoDiff(t, want.Diff(ignoreTimes(TakeSnapshot(stateAccounts, stateTransfers), want)))
+		app.AssertUint64(t, want.JournalSeq, uint64(len(changes)))
+		if len(want.Transfers) != 8 || len(want.Remessas) != 1 || want.Accounts[2].Name != "Pam Halpert" || want.Accounts[3].AccruedInterest == 0 || len(want.Accounts[2].Keys) != 1 || want.Accounts[3].Charges[0].TransferID != 1 {
+			t.Errorf("got a bank day that did not change everything: %+v", want)
+		}
+	})
+
+	t.Run("should resume from the last snapshot and its events", func(t *testing.T) {
+		accounts, transfers, journal, err := OpenEventStore(path("resume.journal"), path("resume.json"))
+		app.AssertError(t, err, nil)
+		ID, _ := accounts.CreateAccount(context.Background(), "Pam Beesly", "10000000001", 1000)
+		err = SaveSnapshot(path("resume.json"), accounts, transfers)
+		app.AssertError(t, err, nil)
+		bankDay(t, accounts, transfers)
+		want := TakeSnapshot(accounts, transfers)
+		journal.Close()
+
+		accounts, transfers, journal, err = OpenEventStore(path("resume.journal"), path("resume.json"))
+		app.AssertError(t, err, nil)
+		defer journal.Close()
+
+		assertNoDiff(t, want.Diff(TakeSnapshot(accounts, transfers)))
+		// The event in the snapshot comes back with it, and the others are
+		// published again by the replay.
+		replayed := accounts.Outbox().State().Events
+		if len(replayed) != len(want.Outbox.Events) {
+			t.Fatalf("got %d events in the outbox; want %d", len(replayed), len(want.Outbox.Events))
+		}
+		for i, e := range replayed {
+			original := want.Outbox.Events[i]
+			app.AssertUint64(t, e.ID, original.ID)
+			app.AssertString(t, e.Type, original.Type)
+		}
+		newID, _ := accounts.CreateAccount(context.Background(), "Jim Halpert", "10000000002", 0)
+		app.AssertUint64(t, newID, want.AccountMaxID+1)
+		if ID != 1 || want.Outbox.Events[0].Type != events.AccountCreated {
+			t.Errorf("got account %d and events %v before the snapshot", ID, want.Outbox.Events[:1])
+		}
+	})
+
+	t.Run("should leave out a change cut short by a crash", func(t *testing.T) {
+		accounts, _, journal, _ := OpenEventStore(path("torn.journal"), path("none.json"))
+		accounts.CreateAccount(context.Background(), "Pam Beesly", "10000000001", 1000)
+		journal.Close()
+		file, _ := os.OpenFile(path("torn.journal"), os.O_APPEND|os.O_WRONLY, 0600)
+		file.WriteString(`{"seq":2,"type":"AccountOpe`)
+		file.Close()
+
+		accounts, _, journal, err := OpenEventStore(path("torn.journal"), path("none.json"))
+		app.AssertError(t, err, nil)
+		ID, _ := accounts.CreateAccount(context.Background(), "Jim Halpert", "10000000002", 0)
+		journal.Close()
+
+		app.AssertUint64(t, ID, 2)
+		changes, err := ReadJournal(path("torn.journal"))
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, uint64(len(changes)), 2)
+	})
+
+	t.Run("should refuse a journal with missing changes", func(t *testing.T) {
+		ioutil.WriteFile(path("gap.journal"), []byte(`{"seq":1,"type":"AccountSet","data":{"id":1}}`+"\n"+`{"seq":3,"type":"AccountSet","data":{"id":1}}`+"\n"), 0600)
+
+		_, err := ReadJournal(path("gap.journal"))
+
+		if err == nil || !strings.Contains(err.Error(), "found change 3 in place of 2") {
+			t.Errorf("got error %v; want a missing change", err)
+		}
+	})
+
+	t.Run("should tell what differs between snapshots", func(t *testing.T) {
+		a := Snapshot{AccountMaxID: 2, Accounts: []snapshotAccount{{Account: app.Account{ID: 1, Balance: 10}}, {Account: app.Account{ID: 2}}}}
+		b := Snapshot{AccountMaxID: 2, Accounts: []snapshotAccount{{Account: app.Account{ID: 1, Balance: 20}}}}
+
+		diff := a.Diff(b)
+
+		if len(diff) != 2 || !strings.HasPrefix(diff[0], "account 1 is") || !strings.HasPrefix(diff[1], "account 2 is only in the first") {
+			t.Errorf("got diff %q", diff)
+		}
+	})
+}
+
+// ignoreTimes returns s with the times of the accounts and transfers of want,
+// and the TxIDs of its charges, so that stores changed at different times can
+// be compared.
+func ignoreTimes(s, want Snapshot) Snapshot {
+	for i := range s.Accounts {
+		s.Accounts[i].CreatedAt = want.Accounts[i].CreatedAt
+		s.Accounts[i].BalanceChangedAt = want.Accounts[i].BalanceChangedAt
+		s.Accounts[i].Account.BalanceChangedAt = want.Accounts[i].Account.BalanceChangedAt
+		keys := make([]app.AddressingKey, len(s.Accounts[i].Keys))
+		for j, key := range s.Accounts[i].Keys {
+			key.CreatedAt = want.Accounts[i].Keys[j].CreatedAt
+			keys[j] = key
+		}
+		s.Accounts[i].Keys = keys
+		charges := make([]app.Charge, len(s.Accounts[i].Charges))
+		for j, charge := range s.Accounts[i].Charges {
+			charge.TxID = want.Accounts[i].Charges[j].TxID
+			charge.CreatedAt = want.Accounts[i].Charges[j].CreatedAt
+			charges[j] = charge
+		}
+		s.Accounts[i].Charges = charges
+	}
+	for i := range s.Transfers {
+		s.Transfers[i].CreatedAt = want.Transfers[i].CreatedAt
+		s.Transfers[i].ExpiresAt = want.Transfers[i].ExpiresAt
+		s.Transfers[i].ConfirmedAt = want.Transfers[i].ConfirmedAt
+	}
+	return s
+}
+
+func assertNoDiff(t *testing.T, diff []string) {
+	t.Helper()
+	for _, line := range diff {
+		t.Error(line)
+	}
+}
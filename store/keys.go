@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Types of addressing keys.
+const (
+	KeyTypeCPF    = "cpf"
+	KeyTypeCNPJ   = "cnpj"
+	KeyTypeEmail  = "email"
+	KeyTypePhone  = "phone"
+	KeyTypeRandom = "random"
+)
+
+// Most keys an account may have, as in PIX: business accounts may have more.
+const (
+	MaxKeys         = 5
+	MaxBusinessKeys = 20
+)
+
+// maxEmailLength is the longest email key accepted, as in PIX.
+const maxEmailLength = 77
+
+var (
+	ErrInvalidKeyType = errors.New("invalid key type: it must be cpf, cnpj, email, phone or random")
+	ErrInvalidKey     = errors.New("invalid key")
+	ErrKeyNotOwned    = errors.New("the key does not belong to the account holder")
+	ErrKeyInUse       = errors.New("the key is already registered")
+	ErrKeyLimit       = errors.New("the account has as many keys as it may have")
+	ErrKeyNotFound    = errors.New("there is no account with this key")
+)
+
+var (
+	cpfKeyPattern    = regexp.MustCompile(`^\d{11}$`)
+	cnpjKeyPattern   = regexp.MustCompile(`^\d{14}$`)
+	phoneKeyPattern  = regexp.MustCompile(`^\+[1-9]\d{1,14}$`)
+	randomKeyPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// documentPunctuation is taken out of CPF and CNPJ keys.
+var documentPunctuation = strings.NewReplacer(".", "", "-", "", "/", "")
+
+// NormalizeKey returns the value of a key of keyType as it is stored: CPFs
+// and CNPJs without punctuation, emails and random keys in lower case and
+// phone numbers in E.164, such as +5511987654321. It fails with
+// ErrInvalidKey if the value is not a key of that type.
+func NormalizeKey(keyType, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch keyType {
+	case KeyTypeCPF:
+		value = documentPunctuation.Replace(value)
+		if !cpfKeyPattern.MatchString(value) {
+			return "", fmt.Errorf("%w: a cpf key must have 11 numbers", ErrInvalidKey)
+		}
+	case KeyTypeCNPJ:
+		value = documentPunctuation.Replace(value)
+		if !cnpjKeyPattern.MatchString(value) {
+			return "", fmt.Errorf("%w: a cnpj key must have 14 numbers", ErrInvalidKey)
+		}
+	case KeyTypeEmail:
+		value = strings.ToLower(value)
+		address, err := mail.ParseAddress(value)
+		if err != nil || address.Address != value || len(value) > maxEmailLength {
+			return "", fmt.Errorf("%w: an email key must be an address such as nome@exemplo.com, with at most %d characters", ErrInvalidKey, maxEmailLength)
+		}
+	case KeyTypePhone:
+		if !phoneKeyPattern.MatchString(value) {
+			return "", fmt.Errorf("%w: a phone key must be in E.164, such as +5511987654321", ErrInvalidKey)
+		}
+	case KeyTypeRandom:
+		value = strings.ToLower(value)
+		if !randomKeyPattern.MatchString(value) {
+			return "", fmt.Errorf("%w: a random key must be a UUID", ErrInvalidKey)
+		}
+	default:
+		return "", ErrInvalidKeyType
+	}
+	return value, nil
+}
+
+// lookupKey returns value as it would be stored, whatever its type: CPFs and
+// CNPJs may have punctuation and emails and random keys any case.
+func lookupKey(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "+") {
+		return value
+	}
+	if document := documentPunctuation.Replace(value); cpfKeyPattern.MatchString(document) || cnpjKeyPattern.MatchString(document) {
+		return document
+	}
+	return strings.ToLower(value)
+}
+
+// RegisterKey adds a key to an account. Random keys are generated by the
+// bank, so value must be empty for them. A CPF key must be the CPF of the
+// account holder, and only business accounts may have CNPJ keys. Each key
+// belongs to a single account.
+func (a *AccountStore) RegisterKey(ctx context.Context, ID uint64, keyType, value string) (app.AddressingKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key, err := a.newKey(ID, keyType, value)
+	if err == nil {
+		err = a.commit(ChangeKeyRegistered, accountKey{AccountID: ID, Key: key})
+	}
+	record(ctx, a.auditor, "account.key.register", struct {
+		AccountID uint64 `json:"account_id"`
+		Type      string `json:"type"`
+	}{ID, keyType}, err)
+	if err != nil {
+		return app.AddressingKey{}, err
+	}
+	return key, nil
+}
+
+// newKey checks whether a key can be added to an account and returns it. The
+// lock must be held.
+func (a *AccountStore) newKey(ID uint64, keyType, value string) (app.AddressingKey, error) {
+	account, ok := a.dataStorage[ID]
+	if !ok {
+		return app.AddressingKey{}, ErrAccountNotFound
+	}
+	if keyType == KeyTypeRandom {
+		if value != "" {
+			return app.AddressingKey{}, fmt.Errorf("%w: random keys are generated by the bank", ErrInvalidKey)
+		}
+		var err error
+		value, err = newRandomKey()
+		if err != nil {
+			return app.AddressingKey{}, err
+		}
+	}
+	value, err := NormalizeKey(keyType, value)
+	if err != nil {
+		return app.AddressingKey{}, err
+	}
+
+	switch {
+	case keyType == KeyTypeCPF && value != account.CPF:
+		return app.AddressingKey{}, fmt.Errorf("%w: a cpf key must be the cpf of the account holder", ErrKeyNotOwned)
+	case keyType == KeyTypeCNPJ && account.Type != AccountTypeBusiness:
+		return app.AddressingKey{}, fmt.Errorf("%w: only business accounts may have cnpj keys", ErrKeyNotOwned)
+	}
+	if _, _, ok := a.findKey(value); ok {
+		return app.AddressingKey{}, ErrKeyInUse
+	}
+	limit := MaxKeys
+	if account.Type == AccountTypeBusiness {
+		limit = MaxBusinessKeys
+	}
+	if len(account.Keys) >= limit {
+		return app.AddressingKey{}, fmt.Errorf("%w: %d", ErrKeyLimit, limit)
+	}
+	return app.AddressingKey{Type: keyType, Key: value, CreatedAt: time.Now().UTC()}, nil
+}
+
+// RemoveKey takes a key out of an account, so that it can be registered
+// again, by any account, and returns it.
+func (a *AccountStore) RemoveKey(ctx context.Context, ID uint64, value string) (app.AddressingKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, exists := a.dataStorage[ID]
+	holder, key, found := a.findKey(lookupKey(value))
+	var err error
+	switch {
+	case !exists:
+		err = ErrAccountNotFound
+	case !found || holder.ID != ID:
+		err = ErrKeyNotFound
+	default:
+		err = a.commit(ChangeKeyRemoved, accountKey{AccountID: ID, Key: key})
+	}
+	record(ctx, a.auditor, "account.key.remove", struct {
+		AccountID uint64 `json:"account_id"`
+		Type      string `json:"type,omitempty"`
+	}{ID, key.Type}, err)
+	if err != nil {
+		return app.AddressingKey{}, err
+	}
+	return key, nil
+}
+
+// FindKey returns the account a key belongs to and the key, as stored.
+// CPFs and CNPJs may be given with punctuation, and emails and random keys
+// in any case.
+func (a *AccountStore) FindKey(value string) (app.Account, app.AddressingKey, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	account, key, ok := a.findKey(lookupKey(value))
+	if !ok {
+		return app.Account{}, app.AddressingKey{}, ErrKeyNotFound
+	}
+	return account, key, nil
+}
+
+// findKey returns the account with a key of the normalized value. The lock
+// must be held.
+func (a *AccountStore) findKey(value string) (app.Account, app.AddressingKey, bool) {
+	for _, account := range a.dataStorage {
+		for _, key := range account.Keys {
+			if key.Key == value {
+				return account, key, true
+			}
+		}
+	}
+	return app.Account{}, app.AddressingKey{}, false
+}
+
+// newRandomKey returns a random UUID, of version 4.
+func newRandomKey() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("error generating random key: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"errors"
+	app "github.com/erikacarvalho/stone-challenge"
+	"strings"
+	"testing"
+)
+
+func TestKeys(t *testing.T) {
+	ctx := context.Background()
+	newStore := func() *AccountStore {
+		return NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Roberta Pinheiro Sá", CPF: "48226581020", Type: AccountTypeChecking},
+			app.Account{ID: 2, Name: "Papelaria Dunder Mifflin", CPF: "71530184077", Type: AccountTypeBusiness},
+		)
+	}
+
+	t.Run("should normalize keys of each type", func(t *testing.T) {
+		tests := []struct {
+			keyType string
+			value   string
+			want    string
+		}{
+			{KeyTypeCPF, "482.265.810-20", "48226581020"},
+			{KeyTypeCNPJ, "11.222.333/0001-81", "11222333000181"},
+			{KeyTypeEmail, " Roberta@Exemplo.com ", "roberta@exemplo.com"},
+			{KeyTypePhone, "+5511987654321", "+5511987654321"},
+			{KeyTypeRandom, "6F1C2A4E-9B3D-4C5E-8F7A-1B2C3D4E5F60", "6f1c2a4e-9b3d-4c5e-8f7a-1b2c3d4e5f60"},
+		}
+		for _, tt := range tests {
+			got, err := NormalizeKey(tt.keyType, tt.value)
+			app.AssertError(t, err, nil)
+			app.AssertString(t, got, tt.want)
+		}
+	})
+
+	t.Run("should refuse values that are not keys of their type", func(t *testing.T) {
+		tests := []struct {
+			keyType string
+			value   string
+		}{
+			{KeyTypeCPF, "4822658102"},
+			{KeyTypeCNPJ, "48226581020"},
+			{KeyTypeEmail, "Roberta <roberta@exemplo.com>"},
+			{KeyTypeEmail, strings.Repeat("r", 70) + "@exemplo.com"},
+			{KeyTypePhone, "11987654321"},
+			{KeyTypePhone, "+55 11 98765-4321"},
+			{KeyTypeRandom, "chave-aleatoria"},
+		}
+		for _, tt := range tests {
+			_, err := NormalizeKey(tt.keyType, tt.value)
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("got error %v for %s key %q; want %v", err, tt.keyType, tt.value, ErrInvalidKey)
+			}
+		}
+		_, err := NormalizeKey("apelido", "roberta")
+		app.AssertError(t, err, ErrInvalidKeyType)
+	})
+
+	t.Run("should find accounts by their keys", func(t *testing.T) {
+		accounts := newStore()
+		_, err := accounts.RegisterKey(ctx, 1, KeyTypeCPF, "48226581020")
+		app.AssertError(t, err, nil)
+		_, err = accounts.RegisterKey(ctx, 1, KeyTypeEmail, "roberta@exemplo.com")
+		app.AssertError(t, err, nil)
+		random, err := accounts.RegisterKey(ctx, 2, KeyTypeRandom, "")
+		app.AssertError(t, err, nil)
+
+		for value, want := range map[string]uint64{
+			"482.265.810-20":            1,
+			"Roberta@Exemplo.com":       1,
+			strings.ToUpper(random.Key): 2,
+		} {
+			account, _, err := accounts.FindKey(value)
+			app.AssertError(t, err, nil)
+			app.AssertUint64(t, account.ID, want)
+		}
+		_, _, err = accounts.FindKey("caio@exemplo.com")
+		app.AssertError(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("should keep each key with a single account", func(t *testing.T) {
+		accounts := newStore()
+		accounts.RegisterKey(ctx, 1, KeyTypePhone, "+5511987654321")
+
+		_, err := accounts.RegisterKey(ctx, 2, KeyTypePhone, "+5511987654321")
+		app.AssertError(t, err, ErrKeyInUse)
+
+		_, err = accounts.RemoveKey(ctx, 2, "+5511987654321")
+		app.AssertError(t, err, ErrKeyNotFound)
+		removed, err := accounts.RemoveKey(ctx, 1, "+5511987654321")
+		app.AssertError(t, err, nil)
+		app.AssertString(t, removed.Type, KeyTypePhone)
+		_, err = accounts.RegisterKey(ctx, 2, KeyTypePhone, "+5511987654321")
+		app.AssertError(t, err, nil)
+	})
+
+	t.Run("should only register documents of the account holder", func(t *testing.T) {
+		accounts := newStore()
+
+		_, err := accounts.RegisterKey(ctx, 1, KeyTypeCPF, "71530184077")
+		if !errors.Is(err, ErrKeyNotOwned) {
+			t.Errorf("got error %v; want %v", err, ErrKeyNotOwned)
+		}
+		_, err = accounts.RegisterKey(ctx, 1, KeyTypeCNPJ, "11222333000181")
+		if !errors.Is(err, ErrKeyNotOwned) {
+			t.Errorf("got error %v; want %v", err, ErrKeyNotOwned)
+		}
+		_, err = accounts.RegisterKey(ctx, 2, KeyTypeCNPJ, "11222333000181")
+		app.AssertError(t, err, nil)
+		_, err = accounts.RegisterKey(ctx, 1, KeyTypeRandom, "6f1c2a4e-9b3d-4c5e-8f7a-1b2c3d4e5f60")
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("got error %v; want %v", err, ErrInvalidKey)
+		}
+	})
+
+	t.Run("should limit the keys of each account", func(t *testing.T) {
+		accounts := newStore()
+		for i := 0; i < MaxKeys; i++ {
+			_, err := accounts.RegisterKey(ctx, 1, KeyTypeRandom, "")
+			app.AssertError(t, err, nil)
+		}
+
+		_, err := accounts.RegisterKey(ctx, 1, KeyTypeRandom, "")
+		if !errors.Is(err, ErrKeyLimit) {
+			t.Errorf("got error %v; want %v", err, ErrKeyLimit)
+		}
+		_, err = accounts.RegisterKey(ctx, 2, KeyTypeRandom, "")
+		app.AssertError(t, err, nil)
+		_, err = accounts.RegisterKey(ctx, 3, KeyTypeRandom, "")
+		app.AssertError(t, err, ErrAccountNotFound)
+	})
+
+	t.Run("should refuse imports with keys of other accounts", func(t *testing.T) {
+		source := newStore()
+		source.RegisterKey(ctx, 2, KeyTypeEmail, "contato@dunder.com")
+		export := TakeSnapshot(source, NewTransferStore(app.StartingID(0)))
+		export.Accounts = export.Accounts[1:]
+		export.Accounts[0].ID = 3
+		accounts := newStore()
+		accounts.RegisterKey(ctx, 1, KeyTypeEmail, "contato@dunder.com")
+
+		_, err := Import(ctx, accounts, NewTransferStore(app.StartingID(0)), export, ImportMerge)
+
+		if !errors.Is(err, ErrImportConflict) || !strings.Contains(err.Error(), "key contato@dunder.com") {
+			t.Errorf("got error %v; want a conflict on the key", err)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"github.com/erikacarvalho/stone-challenge/metrics"
+)
+
+// rejectionReasons names the reasons transfers are not authorized in the
+// transfer metrics.
+var rejectionReasons = map[error]string{
+	ErrSameID:              "same_account",
+	ErrInvalidAmount:       "invalid_amount",
+	ErrInsufficientBalance: "insufficient_balance",
+	ErrChargeBack:          "duplicate_transfer",
+}
+
+// SetMetrics registers gauges for the accounts in the store and the money
+// they hold, by account type, on registry.
+func (a *AccountStore) SetMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("bank_accounts", "Accounts open, by type.", []string{"type"}, func() []metrics.Sample {
+		counts, _ := a.totals()
+		return counts
+	})
+	registry.NewGaugeFunc("bank_balance_cents", "Money held in accounts, in cents, by account type.", []string{"type"}, func() []metrics.Sample {
+		_, balances := a.totals()
+		return balances
+	})
+}
+
+func (a *AccountStore) totals() (counts, balances []metrics.Sample) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	index := make(map[string]int)
+	for _, account := range a.dataStorage {
+		i, ok := index[account.Type]
+		if !ok {
+			i = len(counts)
+			index[account.Type] = i
+			counts = append(counts, metrics.Sample{Labels: []string{account.Type}})
+			balances = append(balances, metrics.Sample{Labels: []string{account.Type}})
+		}
+		counts[i].Value++
+		balances[i].Value += float64(account.Balance)
+	}
+	return counts, balances
+}
+
+// SetMetrics registers counters for the transfers that reach a final status
+// and for the duplicates detected, on registry.
+func (t *TransferStore) SetMetrics(registry *metrics.Registry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.outcomes = registry.NewCounter("bank_transfers_total", "Transfers that reached a final status, by kind, status and, for the ones not authorized, rejection reason.", "kind", "status", "reason")
+	t.duplicates = registry.NewCounter("bank_duplicate_transfers_detected_total", "Transfers refused because an identical one was confirmed moments before.")
+}
+
+// countOutcome counts a transfer that reached a final status. The lock must
+// be held.
+func (t *TransferStore) countOutcome(ID uint64, reason string) {
+	transfer := t.dataStorage[ID]
+	t.outcomes.Inc(transfer.Kind, transfer.Status, reason)
+}
+
+func isFinal(statusCode int) bool {
+	switch statusCode {
+	case StatusConfirmed, StatusCancelled, StatusExpired:
+		return true
+	}
+	return false
+}
+
+func rejectionReason(err error) string {
+	if reason, ok := rejectionReasons[err]; ok {
+		return reason
+	}
+	return "other"
+}
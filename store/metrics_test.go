@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/metrics"
+	"testing"
+	"time"
+)
+
+func TestTransferMetrics(t *testing.T) {
+	t.Run("should count every leg of a rejected split with its reason", func(t *testing.T) {
+		transfers := NewTransferStore(app.StartingID(0))
+		transfers.SetMetrics(metrics.NewRegistry())
+		origin := &app.Account{ID: 1, Balance: 100}
+		destinations := []*app.Account{{ID: 2}, {ID: 3}}
+
+		_, ids, _ := transfers.CreateSplitTransfer(context.Background(), 1, []uint64{2, 3}, []uint64{100, 50})
+		transfers.AuthorizeSplitTransfer(context.Background(), origin, destinations, ids)
+
+		got := transfers.outcomes.Value(KindSplit, ToStatusMsg(StatusNotAuthorized), "insufficient_balance")
+		if got != 2 {
+			t.Errorf("got %v rejected legs; want 2", got)
+		}
+	})
+
+	t.Run("should count expired transfers", func(t *testing.T) {
+		transfers := NewTransferStore(app.StartingID(0))
+		transfers.SetMetrics(metrics.NewRegistry())
+		now := time.Now()
+
+		transfers.CreateTransfer(context.Background(), 1, 2, 700000)
+		transfers.HoldTransfers(context.Background(), now, 1)
+		transfers.ExpirePending(context.Background(), now)
+
+		got := transfers.outcomes.Value(KindTransfer, ToStatusMsg(StatusExpired), "")
+		if got != 1 {
+			t.Errorf("got %v expired transfers; want 1", got)
+		}
+	})
+}
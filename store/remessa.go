@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var ErrRemessaProcessed = errors.New("remessa was already processed: a new remessa must have another sequence number")
+
+// RemessaPayment is a payment of a CNAB remessa, to be made with a transfer.
+type RemessaPayment struct {
+	AccountOriginID      uint64
+	AccountDestinationID uint64
+	Amount               uint64
+}
+
+// remessaClaim is the data of the change that claims a remessa and creates
+// the transfers paying it.
+type remessaClaim struct {
+	Remessa   string         `json:"remessa"`
+	Transfers []app.Transfer `json:"transfers"`
+}
+
+// remessaKey returns how a remessa is told apart from the others: by the
+// document of the company that sent it, without leading zeros, and its
+// sequence number.
+func remessaKey(companyDocument string, sequence int) string {
+	return fmt.Sprintf("%s/%d", strings.TrimLeft(companyDocument, "0"), sequence)
+}
+
+// CreateRemessaTransfers claims the remessa with the given company document
+// and sequence number and creates a transfer for each of its payments, in a
+// single change, returning their IDs in the same order. It returns
+// ErrRemessaProcessed if the remessa was claimed before, so that each one is
+// paid once. The transfers are created like the ones of CreateTransfer and
+// must still be authorized.
+func (t *TransferStore) CreateRemessaTransfers(ctx context.Context, companyDocument string, sequence int, payments []RemessaPayment) ([]uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	claim := remessaClaim{Remessa: remessaKey(companyDocument, sequence)}
+	var err error
+	if t.remessas[claim.Remessa] {
+		err = ErrRemessaProcessed
+	} else {
+		now := time.Now()
+		for _, payment := range payments {
+			claim.Transfers = append(claim.Transfers, app.Transfer{
+				ID:                   atomic.AddUint64(t.maxID, 1),
+				AccountOriginID:      payment.AccountOriginID,
+				AccountDestinationID: payment.AccountDestinationID,
+				Amount:               payment.Amount,
+				CreatedAt:            now,
+				Status:               ToStatusMsg(StatusCreated),
+				Kind:                 KindTransfer,
+			})
+		}
+		err = t.commit(ChangeRemessaClaimed, claim)
+	}
+	record(ctx, t.auditor, "transfer.remessa", claim, err)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, len(claim.Transfers))
+	for i, transfer := range claim.Transfers {
+		ids[i] = transfer.ID
+	}
+	return ids, nil
+}
+
+// claimRemessa records that a remessa was claimed. The lock must be held.
+func (t *TransferStore) claimRemessa(remessa string) {
+	if t.remessas == nil {
+		t.remessas = make(map[string]bool)
+	}
+	t.remessas[remessa] = true
+}
+
+// listRemessas returns the remessas claimed, sorted. The lock must be held.
+func (t *TransferStore) listRemessas() []string {
+	var remessas []string
+	for remessa := range t.remessas {
+		remessas = append(remessas, remessa)
+	}
+	sort.Strings(remessas)
+	return remessas
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	app "github.com/erikacarvalho/stone-challenge"
+	"testing"
+)
+
+func TestCreateRemessaTransfers(t *testing.T) {
+	ctx := context.Background()
+	payments := []RemessaPayment{
+		{AccountOriginID: 1, AccountDestinationID: 2, Amount: 1500},
+		{AccountOriginID: 1, AccountDestinationID: 3, Amount: 500},
+	}
+
+	t.Run("should create a transfer for each payment", func(t *testing.T) {
+		transfers := NewTransferStore(app.StartingID(4))
+
+		ids, err := transfers.CreateRemessaTransfers(ctx, "48226581020", 1, payments)
+
+		app.AssertError(t, err, nil)
+		if len(ids) != 2 || ids[0] != 5 || ids[1] != 6 {
+			t.Fatalf("got IDs %v; want [5 6]", ids)
+		}
+		transfer, _ := transfers.GetTransfer(6)
+		app.AssertUint64(t, transfer.AccountDestinationID, 3)
+		app.AssertUint64(t, transfer.Amount, 500)
+		app.AssertString(t, transfer.Status, ToStatusMsg(StatusCreated))
+	})
+
+	t.Run("should return ErrRemessaProcessed for a remessa claimed before", func(t *testing.T) {
+		transfers := NewTransferStore(app.StartingID(0))
+		transfers.CreateRemessaTransfers(ctx, "48226581020", 1, payments)
+
+		_, err := transfers.CreateRemessaTransfers(ctx, "00048226581020", 1, payments)
+
+		app.AssertError(t, err, ErrRemessaProcessed)
+		app.AssertUint64(t, *transfers.maxID, 2)
+		_, err = transfers.CreateRemessaTransfers(ctx, "48226581020", 2, nil)
+		app.AssertError(t, err, nil)
+	})
+
+	t.Run("should keep the remessas claimed in snapshots", func(t *testing.T) {
+		accounts := NewAccountStore(app.StartingID(0))
+		transfers := NewTransferStore(app.StartingID(0))
+		transfers.CreateRemessaTransfers(ctx, "48226581020", 1, payments)
+
+		_, restored := TakeSnapshot(accounts, transfers).Restore()
+		_, err := restored.CreateRemessaTransfers(ctx, "48226581020", 1, payments)
+
+		app.AssertError(t, err, ErrRemessaProcessed)
+	})
+}
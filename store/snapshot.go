@@ -0,0 +1,306 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Storage backends. The memory backend loses everything on restart; the file
+// backend keeps a snapshot of the stores in a JSON file.
+const (
+	StorageMemory = "memory"
+	StorageFile   = "file"
+)
+
+var ErrNotInitialized = errors.New("store is not initialized")
+
+// Snapshot is the content of the stores at one point in time.
+type Snapshot struct {
+	AccountMaxID  uint64            `json:"account_max_id"`
+	TransferMaxID uint64            `json:"transfer_max_id"`
+	Accounts      []snapshotAccount `json:"accounts"`
+	Transfers     []app.Transfer    `json:"transfers"`
+	// Remessas are the CNAB remessas paid, by company document and sequence
+	// number.
+	Remessas []string `json:"remessas,omitempty"`
+	// Outbox holds the events not yet relayed to every sink.
+	Outbox events.OutboxState `json:"outbox"`
+	// JournalSeq is the last change of the journal in the snapshot, with the
+	// event-sourced backend.
+	JournalSeq uint64 `json:"journal_seq,omitempty"`
+}
+
+// snapshotAccount keeps the account fields that are never sent to clients,
+// and so are left out when an account is marshaled.
+type snapshotAccount struct {
+	app.Account
+	Secret           string              `json:"secret,omitempty"`
+	TOTPSecret       string              `json:"totp_secret,omitempty"`
+	TOTPLastStep     int64               `json:"totp_last_step,omitempty"`
+	InterestFraction string              `json:"interest_fraction,omitempty"`
+	InterestDay      string              `json:"interest_day,omitempty"`
+	BalanceChangedAt *time.Time          `json:"balance_changed_at,omitempty"`
+	OpeningBalance   uint64              `json:"opening_balance,omitempty"`
+	Keys             []app.AddressingKey `json:"keys,omitempty"`
+	Charges          []app.Charge        `json:"charges,omitempty"`
+}
+
+func newSnapshotAccount(account app.Account) snapshotAccount {
+	s := snapshotAccount{
+		Account:          account,
+		Secret:           account.Secret,
+		TOTPSecret:       account.TOTPSecret,
+		TOTPLastStep:     account.TOTPLastStep,
+		InterestFraction: account.InterestFraction,
+		InterestDay:      account.InterestDay,
+		OpeningBalance:   account.OpeningBalance,
+		Keys:             account.Keys,
+		Charges:          account.Charges,
+	}
+	if !account.BalanceChangedAt.IsZero() {
+		s.BalanceChangedAt = &account.BalanceChangedAt
+	}
+	return s
+}
+
+// account returns the account with the fields left out when marshaling.
+func (s snapshotAccount) account() app.Account {
+	account := s.Account
+	account.Secret = s.Secret
+	account.TOTPSecret = s.TOTPSecret
+	account.TOTPLastStep = s.TOTPLastStep
+	account.InterestFraction = s.InterestFraction
+	account.InterestDay = s.InterestDay
+	if s.BalanceChangedAt != nil {
+		account.BalanceChangedAt = *s.BalanceChangedAt
+	}
+	account.OpeningBalance = s.OpeningBalance
+	account.Keys = s.Keys
+	account.Charges = s.Charges
+	return account
+}
+
+// TakeSnapshot copies the content of the stores and of their outbox, if
+// any. Both stores are locked while copying, so that the outbox holds the
+// events of every change copied and no other. Transfers being served at the
+// time may still be caught halfway, so a consistent snapshot is only taken
+// once no requests are in flight, as on shutdown.
+func TakeSnapshot(accounts *AccountStore, transfers *TransferStore) Snapshot {
+	accounts.mu.RLock()
+	defer accounts.mu.RUnlock()
+	transfers.mu.RLock()
+	defer transfers.mu.RUnlock()
+
+	snapshot := Snapshot{AccountMaxID: atomic.LoadUint64(accounts.maxID)}
+	for _, account := range accounts.dataStorage {
+		snapshot.Accounts = append(snapshot.Accounts, newSnapshotAccount(account))
+	}
+	snapshot.TransferMaxID = atomic.LoadUint64(transfers.maxID)
+	for _, transfer := range transfers.dataStorage {
+		snapshot.Transfers = append(snapshot.Transfers, transfer)
+	}
+	snapshot.Remessas = transfers.listRemessas()
+	if outbox, ok := accounts.publisher.(*events.Outbox); ok {
+		snapshot.Outbox = outbox.State()
+	}
+	if accounts.journal != nil {
+		snapshot.JournalSeq = accounts.journal.Seq()
+	}
+
+	sort.Slice(snapshot.Accounts, func(i, j int) bool {
+		return snapshot.Accounts[i].ID < snapshot.Accounts[j].ID
+	})
+	sort.Slice(snapshot.Transfers, func(i, j int) bool {
+		return snapshot.Transfers[i].ID < snapshot.Transfers[j].ID
+	})
+	return snapshot
+}
+
+// Restore returns stores holding the content of the snapshot, which publish
+// their events to an outbox holding the one of the snapshot.
+func (s Snapshot) Restore() (*AccountStore, *TransferStore) {
+	accounts := make([]app.Account, len(s.Accounts))
+	for i, account := range s.Accounts {
+		accounts[i] = account.account()
+	}
+	accountMaxID, transferMaxID := s.AccountMaxID, s.TransferMaxID
+	accountStore := NewAccountStore(&accountMaxID, accounts...)
+	transferStore := NewTransferStore(&transferMaxID, s.Transfers...)
+	for _, remessa := range s.Remessas {
+		transferStore.claimRemessa(remessa)
+	}
+	outbox := events.RestoreOutbox(s.Outbox)
+	accountStore.publisher = outbox
+	transferStore.publisher = outbox
+	return accountStore, transferStore
+}
+
+// SaveSnapshot writes a snapshot of the stores to path. The file is
+// replaced at once, so a crash while saving leaves the previous one intact.
+func SaveSnapshot(path string, accounts *AccountStore, transfers *TransferStore) error {
+	return TakeSnapshot(accounts, transfers).Save(path)
+}
+
+// Save writes the snapshot to path, replacing the file at once.
+func (s Snapshot) Save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("error marshaling snapshot: %w", err)
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error saving snapshot: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot returns stores holding the snapshot saved at path, or empty
+// stores if there is no file there yet.
+func LoadSnapshot(path string) (*AccountStore, *TransferStore, error) {
+	snapshot, err := readSnapshot(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	accounts, transfers := snapshot.Restore()
+	return accounts, transfers, nil
+}
+
+// readSnapshot returns the snapshot saved at path, or an empty one if there
+// is no file there yet.
+func readSnapshot(path string) (Snapshot, error) {
+	var snapshot Snapshot
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, fmt.Errorf("error loading snapshot: %w", err)
+	}
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return snapshot, fmt.Errorf("error loading snapshot %s: %w", path, err)
+	}
+	return snapshot, nil
+}
+
+// ReadSnapshot returns the snapshot saved at path.
+func ReadSnapshot(path string) (Snapshot, error) {
+	_, err := os.Stat(path)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error loading snapshot: %w", err)
+	}
+	return readSnapshot(path)
+}
+
+// Diff describes every account and transfer that differs between s and
+// other, including the ones only one of them has, the IDs given last and
+// the remessas paid.
+// The outbox and the journal position are not compared.
+func (s Snapshot) Diff(other Snapshot) []string {
+	var diff []string
+	if s.AccountMaxID != other.AccountMaxID {
+		diff = append(diff, fmt.Sprintf("last account ID is %d and %d", s.AccountMaxID, other.AccountMaxID))
+	}
+	if s.TransferMaxID != other.TransferMaxID {
+		diff = append(diff, fmt.Sprintf("last transfer ID is %d and %d", s.TransferMaxID, other.TransferMaxID))
+	}
+	if marshalString(s.Remessas) != marshalString(other.Remessas) {
+		diff = append(diff, fmt.Sprintf("remessas are %v and %v", s.Remessas, other.Remessas))
+	}
+	accounts, otherAccounts := map[uint64]string{}, map[uint64]string{}
+	for _, account := range s.Accounts {
+		accounts[account.ID] = marshalString(account)
+	}
+	for _, account := range other.Accounts {
+		otherAccounts[account.ID] = marshalString(account)
+	}
+	diff = append(diff, diffByID("account", accounts, otherAccounts)...)
+	transfers, otherTransfers := map[uint64]string{}, map[uint64]string{}
+	for _, transfer := range s.Transfers {
+		transfers[transfer.ID] = marshalString(transfer)
+	}
+	for _, transfer := range other.Transfers {
+		otherTransfers[transfer.ID] = marshalString(transfer)
+	}
+	return append(diff, diffByID("transfer", transfers, otherTransfers)...)
+}
+
+// diffByID describes the items, marshaled by ID, that differ between a and
+// b, sorted by ID.
+func diffByID(name string, a, b map[uint64]string) []string {
+	var IDs []uint64
+	for ID := range a {
+		IDs = append(IDs, ID)
+	}
+	for ID := range b {
+		if _, ok := a[ID]; !ok {
+			IDs = append(IDs, ID)
+		}
+	}
+	sort.Slice(IDs, func(i, j int) bool { return IDs[i] < IDs[j] })
+
+	var diff []string
+	for _, ID := range IDs {
+		itemA, inA := a[ID]
+		itemB, inB := b[ID]
+		switch {
+		case !inA:
+			diff = append(diff, fmt.Sprintf("%s %d is only in the second: %s", name, ID, itemB))
+		case !inB:
+			diff = append(diff, fmt.Sprintf("%s %d is only in the first: %s", name, ID, itemA))
+		case itemA != itemB:
+			diff = append(diff, fmt.Sprintf("%s %d is %s and %s", name, ID, itemA, itemB))
+		}
+	}
+	return diff
+}
+
+func marshalString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// Ping reports whether the account store can be read, waiting for its lock.
+func (a *AccountStore) Ping() error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.dataStorage == nil {
+		return ErrNotInitialized
+	}
+	return nil
+}
+
+// Ping reports whether the transfer store can be read, waiting for its lock.
+func (t *TransferStore) Ping() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.dataStorage == nil {
+		return ErrNotInitialized
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bank.json")
+
+	t.Run("should start empty stores when there is no snapshot", func(t *testing.T) {
+		accounts, transfers, err := LoadSnapshot(path)
+
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, accounts.GetMaxID(), 0)
+		_, err = transfers.ListAllTransfers()
+		app.AssertError(t, err, ErrNoTransfers)
+	})
+
+	t.Run("should restore accounts with their secrets, transfers and IDs", func(t *testing.T) {
+		accounts := NewAccountStore(app.StartingID(0))
+		transfers := NewTransferStore(app.StartingID(0))
+		ID, _ := accounts.CreateAccount(context.Background(), "Roberta Pinheiro Sá", "48226581020", 1000)
+		accounts.SetSecret(context.Background(), ID, "hash")
+		accounts.EnrollTOTP(context.Background(), ID, "JBSWY3DPEHPK3PXP")
+		transfers.CreateTransfer(context.Background(), ID, 2, 300)
+
+		err := SaveSnapshot(path, accounts, transfers)
+		app.AssertError(t, err, nil)
+		restoredAccounts, restoredTransfers, err := LoadSnapshot(path)
+		app.AssertError(t, err, nil)
+
+		account, _ := restoredAccounts.GetAccount(ID)
+		app.AssertString(t, account.Secret, "hash")
+		app.AssertString(t, account.TOTPSecret, "JBSWY3DPEHPK3PXP")
+		app.AssertUint64(t, account.Balance, 1000)
+		transfer, err := restoredTransfers.GetTransfer(1)
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, transfer.Amount, 300)
+
+		newID, _ := restoredAccounts.CreateAccount(context.Background(), "Caio Barros Antunes", "71530184077", 0)
+		app.AssertUint64(t, newID, ID+1)
+	})
+
+	t.Run("should keep the events not relayed yet with the state", func(t *testing.T) {
+		accounts, transfers := Snapshot{}.Restore()
+		ID, _ := accounts.CreateAccount(context.Background(), "Roberta Pinheiro Sá", "48226581020", 1000)
+		transfers.CreateTransfer(context.Background(), ID, 2, 300)
+
+		err := SaveSnapshot(path, accounts, transfers)
+		app.AssertError(t, err, nil)
+		restoredAccounts, restoredTransfers, err := LoadSnapshot(path)
+		app.AssertError(t, err, nil)
+		restoredTransfers.CreateTransfer(context.Background(), ID, 2, 400)
+
+		state := restoredAccounts.Outbox().State()
+		var types []string
+		for _, e := range state.Events {
+			types = append(types, e.Type)
+		}
+		assertTypes(t, types, events.AccountCreated, events.TransferCreated, events.TransferCreated)
+		app.AssertUint64(t, state.LastID, 3)
+	})
+
+	t.Run("should refuse a corrupt snapshot", func(t *testing.T) {
+		ioutil.WriteFile(path, []byte("{"), 0600)
+
+		_, _, err := LoadSnapshot(path)
+
+		if err == nil {
+			t.Error("corrupt snapshot was loaded")
+		}
+	})
+}
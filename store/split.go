@@ -0,0 +1,179 @@
+package store
+
+import (
+	"context"
+	"errors"
+	app "github.com/erikacarvalho/stone-challenge"
+	"math/big"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// PercentageBase is the value of a whole (100%) in basis points.
+const PercentageBase = 10000
+
+var (
+	ErrNoShares       = errors.New("a split transfer needs at least one destination share")
+	ErrInvalidShare   = errors.New("each share must have either a fixed amount or a percentage, not both")
+	ErrSharesMismatch = errors.New("the shares do not add up to the total amount")
+)
+
+// Share is the portion of a split transfer that goes to one destination
+// account. It is either a fixed Amount in cents or a Percentage of the total
+// amount, in basis points (1% = 100).
+type Share struct {
+	AccountDestinationID uint64
+	Amount               uint64
+	Percentage           uint64
+}
+
+// SplitAmount resolves the shares of a split transfer into amounts in cents,
+// returned in the same order as the shares. The fixed amounts plus the exact
+// percentages of total must add up to total. Percentage shares are rounded
+// down and the cents left over are handed out one by one to the shares with
+// the largest discarded fractions, ties going to the share that comes first.
+func SplitAmount(total uint64, shares []Share) ([]uint64, error) {
+	if len(shares) == 0 {
+		return nil, ErrNoShares
+	}
+
+	base := big.NewInt(PercentageBase)
+	bigTotal := new(big.Int).SetUint64(total)
+	sum := new(big.Int)
+
+	amounts := make([]uint64, len(shares))
+	remainders := make([]uint64, len(shares))
+	var percentageShares []int
+
+	for i, share := range shares {
+		if share.Amount != 0 && share.Percentage != 0 {
+			return nil, ErrInvalidShare
+		}
+		if share.Percentage == 0 {
+			amounts[i] = share.Amount
+			sum.Add(sum, new(big.Int).Mul(new(big.Int).SetUint64(share.Amount), base))
+			continue
+		}
+
+		exact := new(big.Int).Mul(bigTotal, new(big.Int).SetUint64(share.Percentage))
+		sum.Add(sum, exact)
+
+		quotient, remainder := new(big.Int).QuoRem(exact, base, new(big.Int))
+		amounts[i] = quotient.Uint64()
+		remainders[i] = remainder.Uint64()
+		percentageShares = append(percentageShares, i)
+	}
+
+	if sum.Cmp(new(big.Int).Mul(bigTotal, base)) != 0 {
+		return nil, ErrSharesMismatch
+	}
+
+	var allocated uint64
+	for _, amount := range amounts {
+		allocated += amount
+	}
+
+	sort.SliceStable(percentageShares, func(i, j int) bool {
+		return remainders[percentageShares[i]] > remainders[percentageShares[j]]
+	})
+	for i := uint64(0); i < total-allocated; i++ {
+		amounts[percentageShares[i]]++
+	}
+
+	return amounts, nil
+}
+
+// CreateSplitTransfer creates one transfer from origin for each destination
+// and amount pair. All of them are linked by the ID of the first one, which
+// is returned along with the IDs of every leg in the same order.
+func (t *TransferStore) CreateSplitTransfer(ctx context.Context, origin uint64, destinations, amounts []uint64) (splitID uint64, ids []uint64, err error) {
+	if len(destinations) == 0 || len(destinations) != len(amounts) {
+		return 0, nil, ErrNoShares
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for i := range destinations {
+		newID := atomic.AddUint64(t.maxID, 1)
+		if splitID == 0 {
+			splitID = newID
+		}
+		transfer := app.Transfer{
+			ID:                   newID,
+			AccountOriginID:      origin,
+			AccountDestinationID: destinations[i],
+			Amount:               amounts[i],
+			CreatedAt:            now,
+			Status:               ToStatusMsg(StatusCreated),
+			Kind:                 KindSplit,
+			SplitID:              splitID,
+		}
+		err = t.commit(ChangeTransferRequested, transfer)
+		record(ctx, t.auditor, "transfer.create", transfer, err)
+		if err != nil {
+			return 0, nil, err
+		}
+		ids = append(ids, newID)
+	}
+	return splitID, ids, nil
+}
+
+// AuthorizeSplitTransfer applies the business rules to all legs of a split
+// transfer at once: the origin balance is checked against the total amount
+// plus the fee and every leg is authorized, or none is. The fee is computed
+// on the total amount and recorded on the first leg only.
+func (t *TransferStore) AuthorizeSplitTransfer(ctx context.Context, origin *app.Account, destinations []*app.Account, ids []uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, id := range ids {
+		changeStatus(ctx, t, id, StatusAuthorizing)
+	}
+
+	err := t.checkSplit(ctx, origin, destinations, ids)
+	if err != nil {
+		for _, id := range ids {
+			reject(ctx, t, id, err)
+		}
+		return err
+	}
+
+	for _, id := range ids {
+		changeStatus(ctx, t, id, StatusAuthorized)
+	}
+	return nil
+}
+
+func (t *TransferStore) checkSplit(ctx context.Context, origin *app.Account, destinations []*app.Account, ids []uint64) error {
+	var total uint64
+	for i, id := range ids {
+		amount := t.dataStorage[id].Amount
+		if origin.ID == destinations[i].ID {
+			return ErrSameID
+		}
+		if amount == 0 {
+			return ErrInvalidAmount
+		}
+		total += amount
+	}
+
+	fee, err := t.fees.Fee(origin.Type, KindSplit, total)
+	if err != nil {
+		return err
+	}
+	setFee(ctx, t, ids[0], fee)
+
+	if !covers(origin.Balance, total, fee) {
+		return ErrInsufficientBalance
+	}
+
+	for i, id := range ids {
+		if t.isChargeBack(origin.ID, destinations[i].ID, t.dataStorage[id].Amount) {
+			return ErrChargeBack
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	app "github.com/erikacarvalho/stone-challenge"
+	"testing"
+	"time"
+)
+
+func TestSplitAmount(t *testing.T) {
+	t.Run("should keep fixed shares as they are", func(t *testing.T) {
+		got, err := SplitAmount(10000, []Share{
+			{AccountDestinationID: 1, Amount: 7000},
+			{AccountDestinationID: 2, Amount: 3000},
+		})
+
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, got[0], 7000)
+		app.AssertUint64(t, got[1], 3000)
+	})
+
+	t.Run("should hand out leftover cents to the largest fractions first", func(t *testing.T) {
+		got, err := SplitAmount(100, []Share{
+			{AccountDestinationID: 1, Percentage: 3333},
+			{AccountDestinationID: 2, Percentage: 3333},
+			{AccountDestinationID: 3, Percentage: 3334},
+		})
+
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, got[0], 33)
+		app.AssertUint64(t, got[1], 33)
+		app.AssertUint64(t, got[2], 34)
+	})
+
+	t.Run("should break ties in favour of the first share", func(t *testing.T) {
+		got, err := SplitAmount(1001, []Share{
+			{AccountDestinationID: 1, Percentage: 5000},
+			{AccountDestinationID: 2, Percentage: 5000},
+		})
+
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, got[0], 501)
+		app.AssertUint64(t, got[1], 500)
+	})
+
+	t.Run("should mix fixed and percentage shares", func(t *testing.T) {
+		got, err := SplitAmount(20000, []Share{
+			{AccountDestinationID: 1, Amount: 5000},
+			{AccountDestinationID: 2, Percentage: 7500},
+		})
+
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, got[0], 5000)
+		app.AssertUint64(t, got[1], 15000)
+	})
+
+	t.Run("should return ErrSharesMismatch when shares do not add up to total", func(t *testing.T) {
+		_, got := SplitAmount(10000, []Share{
+			{AccountDestinationID: 1, Amount: 7000},
+			{AccountDestinationID: 2, Percentage: 2000},
+		})
+
+		app.AssertError(t, got, ErrSharesMismatch)
+	})
+
+	t.Run("should return ErrInvalidShare when a share has both amount and percentage", func(t *testing.T) {
+		_, got := SplitAmount(10000, []Share{
+			{AccountDestinationID: 1, Amount: 5000, Percentage: 5000},
+		})
+
+		app.AssertError(t, got, ErrInvalidShare)
+	})
+
+	t.Run("should return ErrNoShares when there are no shares", func(t *testing.T) {
+		_, got := SplitAmount(10000, nil)
+
+		app.AssertError(t, got, ErrNoShares)
+	})
+}
+
+func TestCreateSplitTransfer(t *testing.T) {
+	store := NewTransferStore(app.StartingID(40))
+
+	splitID, ids, err := store.CreateSplitTransfer(context.Background(), 7, []uint64{8, 9}, []uint64{600, 400})
+	if err != nil {
+		t.Fatalf("error creating split transfer. error: %q", err)
+	}
+
+	t.Run("should link every leg by the ID of the first one", func(t *testing.T) {
+		app.AssertUint64(t, splitID, 41)
+		for _, id := range ids {
+			app.AssertUint64(t, store.dataStorage[id].SplitID, splitID)
+		}
+	})
+
+	t.Run("should create one transfer per destination", func(t *testing.T) {
+		app.AssertUint64(t, store.dataStorage[ids[0]].AccountDestinationID, 8)
+		app.AssertUint64(t, store.dataStorage[ids[0]].Amount, 600)
+		app.AssertUint64(t, store.dataStorage[ids[1]].AccountDestinationID, 9)
+		app.AssertUint64(t, store.dataStorage[ids[1]].Amount, 400)
+	})
+}
+
+func TestAuthorizeSplitTransfer(t *testing.T) {
+	newSplit := func() (*TransferStore, []uint64) {
+		transfers := map[uint64]app.Transfer{
+			1: {ID: 1, AccountOriginID: 10, AccountDestinationID: 20, Amount: 3000, CreatedAt: time.Now(), Status: ToStatusMsg(StatusCreated), SplitID: 1},
+			2: {ID: 2, AccountOriginID: 10, AccountDestinationID: 30, Amount: 2000, CreatedAt: time.Now(), Status: ToStatusMsg(StatusCreated), SplitID: 1},
+		}
+		return &TransferStore{maxID: app.StartingID(len(transfers)), dataStorage: transfers}, []uint64{1, 2}
+	}
+	destinations := []*app.Account{{ID: 20}, {ID: 30}}
+
+	t.Run("should authorize every leg when origin covers the total", func(t *testing.T) {
+		store, ids := newSplit()
+
+		got := store.AuthorizeSplitTransfer(context.Background(), &app.Account{ID: 10, Balance: 5000}, destinations, ids)
+
+		app.AssertError(t, got, nil)
+		for _, id := range ids {
+			app.AssertString(t, store.dataStorage[id].Status, ToStatusMsg(StatusAuthorized))
+		}
+	})
+
+	t.Run("should refuse every leg when origin does not cover the total", func(t *testing.T) {
+		store, ids := newSplit()
+
+		got := store.AuthorizeSplitTransfer(context.Background(), &app.Account{ID: 10, Balance: 4999}, destinations, ids)
+
+		app.AssertError(t, got, ErrInsufficientBalance)
+		for _, id := range ids {
+			app.AssertString(t, store.dataStorage[id].Status, ToStatusMsg(StatusNotAuthorized))
+		}
+	})
+
+	t.Run("should return ErrSameID when origin is one of the destinations", func(t *testing.T) {
+		store, ids := newSplit()
+
+		got := store.AuthorizeSplitTransfer(context.Background(), &app.Account{ID: 30, Balance: 5000}, destinations, ids)
+
+		app.AssertError(t, got, ErrSameID)
+	})
+}
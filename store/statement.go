@@ -0,0 +1,308 @@
+package store
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	app "github.com/erikacarvalho/stone-challenge"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KindFee is the kind of the statement entries of transfer fees, which are
+// kept on the transfers they are charged for.
+const KindFee = "fee"
+
+// Kinds of the CSV rows holding the balances around the entries of a
+// statement.
+const (
+	rowOpeningBalance = "opening_balance"
+	rowClosingBalance = "closing_balance"
+)
+
+// OFXBankID identifies the bank in OFX statements. The bank has no
+// clearing code, so a placeholder is used.
+const OFXBankID = "0000"
+
+var ErrInvalidPeriod = errors.New("the statement period must end after it starts")
+
+// Statement holds the balance changes of an account in a period, from From
+// up to but not including To, and its balance before and after them.
+type Statement struct {
+	Account        app.Account
+	From           time.Time
+	To             time.Time
+	OpeningBalance int64 // Balance at From in cents
+	ClosingBalance int64 // Balance at To in cents
+	Entries        []StatementEntry
+}
+
+// StatementEntry is a change to the balance of an account, made by a
+// confirmed transfer.
+type StatementEntry struct {
+	TransferID   uint64
+	Date         time.Time
+	Kind         string // The kind of the transfer, or KindFee for its fee
+	Counterparty uint64 // The account on the other side of the change
+	Amount       int64  // Change to the balance in cents, negative for debits
+	Balance      int64  // Balance right after the change in cents
+}
+
+// NewStatement returns the statement of the account with accountID for the
+// period from from up to but not including to. Only confirmed transfers
+// change balances, and only when they are confirmed, so entries are dated by
+// the confirmation; the closing balance is worked out from the current
+// balance by undoing the transfers confirmed after the period, and the
+// opening balance by undoing the ones in it.
+func NewStatement(accounts *AccountStore, transfers *TransferStore, accountID uint64, from, to time.Time) (Statement, error) {
+	if !to.After(from) {
+		return Statement{}, ErrInvalidPeriod
+	}
+	accounts.mu.RLock()
+	defer accounts.mu.RUnlock()
+	transfers.mu.RLock()
+	defer transfers.mu.RUnlock()
+
+	account, ok := accounts.dataStorage[accountID]
+	if !ok {
+		return Statement{}, ErrAccountNotFound
+	}
+	var list []app.Transfer
+	for _, transfer := range transfers.dataStorage {
+		if transfer.Status == ToStatusMsg(StatusConfirmed) {
+			list = append(list, transfer)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !confirmedAt(list[i]).Equal(confirmedAt(list[j])) {
+			return confirmedAt(list[i]).Before(confirmedAt(list[j]))
+		}
+		return list[i].ID < list[j].ID
+	})
+	var feeAccountID uint64
+	if transfers.fees != nil {
+		feeAccountID = transfers.fees.AccountID
+	}
+
+	statement := Statement{Account: account, From: from, To: to, ClosingBalance: int64(account.Balance)}
+	var inPeriod int64
+	for _, transfer := range list {
+		for _, entry := range statementEntries(transfer, accountID, feeAccountID) {
+			switch {
+			case !entry.Date.Before(to):
+				statement.ClosingBalance -= entry.Amount
+			case !entry.Date.Before(from):
+				inPeriod += entry.Amount
+				statement.Entries = append(statement.Entries, entry)
+			}
+		}
+	}
+
+	statement.OpeningBalance = statement.ClosingBalance - inPeriod
+	balance := statement.OpeningBalance
+	for i := range statement.Entries {
+		balance += statement.Entries[i].Amount
+		statement.Entries[i].Balance = balance
+	}
+	return statement, nil
+}
+
+// statementEntries returns the changes transfer made to the balance of the
+// account with accountID: the amount and the fee taken from the origin, the
+// amount given to the destination and the fee given to the fee account.
+func statementEntries(transfer app.Transfer, accountID, feeAccountID uint64) []StatementEntry {
+	var entries []StatementEntry
+	add := func(kind string, counterparty uint64, amount int64) {
+		entries = append(entries, StatementEntry{
+			TransferID:   transfer.ID,
+			Date:         confirmedAt(transfer),
+			Kind:         kind,
+			Counterparty: counterparty,
+			Amount:       amount,
+		})
+	}
+	if transfer.AccountOriginID == accountID {
+		add(transfer.Kind, transfer.AccountDestinationID, -int64(transfer.Amount))
+		if transfer.Fee > 0 {
+			add(KindFee, feeAccountID, -int64(transfer.Fee))
+		}
+	}
+	if transfer.AccountDestinationID == accountID {
+		add(transfer.Kind, transfer.AccountOriginID, int64(transfer.Amount))
+	}
+	if transfer.Fee > 0 && feeAccountID == accountID {
+		add(KindFee, transfer.AccountOriginID, int64(transfer.Fee))
+	}
+	return entries
+}
+
+// confirmedAt returns when transfer was confirmed. Transfers confirmed
+// before the time was kept are taken as confirmed when they were created.
+func confirmedAt(transfer app.Transfer) time.Time {
+	if transfer.ConfirmedAt != nil {
+		return *transfer.ConfirmedAt
+	}
+	return transfer.CreatedAt
+}
+
+// CSVOptions tells how WriteCSV formats a statement.
+type CSVOptions struct {
+	Delimiter rune // Separates the fields, such as ',' or ';'
+	Decimal   rune // Separates the cents of amounts, such as '.' or ',' in pt-BR
+}
+
+// WriteCSV writes the statement to w as CSV, with a header, a row with the
+// opening balance, one row per entry and a row with the closing balance.
+// Amounts are in reais, with the decimal separator of options and no
+// thousands separator, so that spreadsheets read them as numbers.
+func (s Statement) WriteCSV(w io.Writer, options CSVOptions) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = options.Delimiter
+	money := func(cents int64) string {
+		return formatCents(cents, options.Decimal)
+	}
+
+	writer.Write([]string{"date", "transfer_id", "kind", "counterparty_account_id", "amount", "balance"})
+	writer.Write([]string{csvDate(s.From), "", rowOpeningBalance, "", "", money(s.OpeningBalance)})
+	for _, entry := range s.Entries {
+		writer.Write([]string{
+			csvDate(entry.Date),
+			strconv.FormatUint(entry.TransferID, 10),
+			entry.Kind,
+			strconv.FormatUint(entry.Counterparty, 10),
+			money(entry.Amount),
+			money(entry.Balance),
+		})
+	}
+	writer.Write([]string{csvDate(s.To), "", rowClosingBalance, "", "", money(s.ClosingBalance)})
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvDate formats t for a CSV statement, in UTC.
+func csvDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatCents formats an amount in cents as reais, with decimal between
+// reais and cents.
+func formatCents(cents int64, decimal rune) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d%c%02d", sign, cents/100, decimal, cents%100)
+}
+
+// WriteOFX writes the statement to w as an OFX 1.0.2 bank statement in
+// reais, the format personal finance software imports. OFX has no opening
+// balance: the ledger balance is the closing one, at the end of the period,
+// and software works the opening one out from the transactions.
+func (s Statement) WriteOFX(w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	now := time.Now()
+	accountType := "CHECKING"
+	if s.Account.Type == AccountTypeSavings {
+		accountType = "SAVINGS"
+	}
+
+	fmt.Fprint(buffered, "OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\nENCODING:UTF-8\r\nCHARSET:NONE\r\nCOMPRESSION:NONE\r\nOLDFILEUID:NONE\r\nNEWFILEUID:NONE\r\n\r\n")
+	lines := []string{
+		"<OFX>",
+		"<SIGNONMSGSRSV1>", "<SONRS>",
+		"<STATUS>", "<CODE>0", "<SEVERITY>INFO", "</STATUS>",
+		"<DTSERVER>" + ofxTime(now),
+		"<LANGUAGE>POR",
+		"</SONRS>", "</SIGNONMSGSRSV1>",
+		"<BANKMSGSRSV1>", "<STMTTRNRS>",
+		"<TRNUID>" + strconv.FormatInt(now.UnixNano(), 10),
+		"<STATUS>", "<CODE>0", "<SEVERITY>INFO", "</STATUS>",
+		"<STMTRS>",
+		"<CURDEF>BRL",
+		"<BANKACCTFROM>",
+		"<BANKID>" + OFXBankID,
+		"<ACCTID>" + strconv.FormatUint(s.Account.ID, 10),
+		"<ACCTTYPE>" + accountType,
+		"</BANKACCTFROM>",
+		"<BANKTRANLIST>",
+		"<DTSTART>" + ofxTime(s.From),
+		"<DTEND>" + ofxTime(s.To),
+	}
+	for _, entry := range s.Entries {
+		lines = append(lines,
+			"<STMTTRN>",
+			"<TRNTYPE>"+ofxType(entry),
+			"<DTPOSTED>"+ofxTime(entry.Date),
+			"<TRNAMT>"+formatCents(entry.Amount, '.'),
+			"<FITID>"+ofxID(entry),
+			"<MEMO>"+ofxEscape(memo(entry)),
+			"</STMTTRN>",
+		)
+	}
+	lines = append(lines,
+		"</BANKTRANLIST>",
+		"<LEDGERBAL>",
+		"<BALAMT>"+formatCents(s.ClosingBalance, '.'),
+		"<DTASOF>"+ofxTime(s.To),
+		"</LEDGERBAL>",
+		"</STMTRS>", "</STMTTRNRS>", "</BANKMSGSRSV1>",
+		"</OFX>",
+	)
+	for _, line := range lines {
+		fmt.Fprint(buffered, line, "\r\n")
+	}
+	return buffered.Flush()
+}
+
+// ofxTime formats t as an OFX date and time, in UTC.
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405") + "[0:GMT]"
+}
+
+// ofxType returns the OFX transaction type of entry.
+func ofxType(entry StatementEntry) string {
+	switch {
+	case entry.Kind == KindFee && entry.Amount < 0:
+		return "FEE"
+	case entry.Kind == KindInterest:
+		return "INT"
+	case entry.Amount < 0:
+		return "DEBIT"
+	}
+	return "CREDIT"
+}
+
+// ofxID returns an ID for entry that stays the same across statements, so
+// that software importing overlapping periods skips the entries it has.
+// A transfer has a second entry for the account only for its fee.
+func ofxID(entry StatementEntry) string {
+	if entry.Kind == KindFee {
+		return fmt.Sprintf("%d-%s", entry.TransferID, KindFee)
+	}
+	return strconv.FormatUint(entry.TransferID, 10)
+}
+
+// memo describes entry for people reading an OFX statement.
+func memo(entry StatementEntry) string {
+	switch {
+	case entry.Kind == KindFee && entry.Amount < 0:
+		return fmt.Sprintf("Fee for transfer %d", entry.TransferID)
+	case entry.Kind == KindFee:
+		return fmt.Sprintf("Fee for transfer %d from account %d", entry.TransferID, entry.Counterparty)
+	case entry.Kind == KindInterest:
+		return "Interest"
+	case entry.Amount < 0:
+		return fmt.Sprintf("Transfer to account %d", entry.Counterparty)
+	}
+	return fmt.Sprintf("Transfer from account %d", entry.Counterparty)
+}
+
+// ofxEscape escapes the characters SGML gives a meaning to.
+func ofxEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
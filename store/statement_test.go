@@ -0,0 +1,164 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	app "github.com/erikacarvalho/stone-challenge"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatement(t *testing.T) {
+	day := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	confirmed := ToStatusMsg(StatusConfirmed)
+	accounts := NewAccountStore(app.StartingID(3),
+		app.Account{ID: 1, Name: "Fee Revenue", Type: AccountTypeBank, Balance: 100},
+		app.Account{ID: 2, Name: "Pam Beesly", Type: AccountTypeChecking, Balance: 10000},
+		app.Account{ID: 3, Name: "Jim Halpert", Type: AccountTypeSavings, Balance: 5000},
+	)
+	transfers := NewTransferStore(app.StartingID(6),
+		app.Transfer{ID: 1, AccountOriginID: 2, AccountDestinationID: 3, Amount: 1000, Fee: 50, CreatedAt: day(time.September, 20, 12), Status: confirmed, Kind: KindTransfer},
+		app.Transfer{ID: 2, AccountOriginID: 3, AccountDestinationID: 2, Amount: 3000, CreatedAt: day(time.October, 2, 12), Status: confirmed, Kind: KindTransfer},
+		app.Transfer{ID: 3, AccountOriginID: 2, AccountDestinationID: 3, Amount: 500, Fee: 50, CreatedAt: day(time.October, 10, 12), Status: confirmed, Kind: KindTransfer},
+		app.Transfer{ID: 4, AccountOriginID: 2, AccountDestinationID: 3, Amount: 999999, CreatedAt: day(time.October, 15, 12), Status: ToStatusMsg(StatusNotAuthorized), Kind: KindTransfer},
+		app.Transfer{ID: 5, AccountOriginID: 1, AccountDestinationID: 2, Amount: 25, CreatedAt: day(time.October, 31, 23), Status: confirmed, Kind: KindInterest},
+		app.Transfer{ID: 6, AccountOriginID: 2, AccountDestinationID: 3, Amount: 200, CreatedAt: day(time.November, 1, 0), Status: confirmed, Kind: KindTransfer},
+	)
+	transfers.SetFeeEngine(&FeeEngine{AccountID: 1})
+	from, to := day(time.October, 1, 0), day(time.November, 1, 0)
+
+	t.Run("should work the balances out from the transfers", func(t *testing.T) {
+		statement, err := NewStatement(accounts, transfers, 2, from, to)
+		app.AssertError(t, err, nil)
+
+		assertCents(t, "closing balance", statement.ClosingBalance, 10200)
+		assertCents(t, "opening balance", statement.OpeningBalance, 7725)
+		want := []StatementEntry{
+			{TransferID: 2, Date: day(time.October, 2, 12), Kind: KindTransfer, Counterparty: 3, Amount: 3000, Balance: 10725},
+			{TransferID: 3, Date: day(time.October, 10, 12), Kind: KindTransfer, Counterparty: 3, Amount: -500, Balance: 10225},
+			{TransferID: 3, Date: day(time.October, 10, 12), Kind: KindFee, Counterparty: 1, Amount: -50, Balance: 10175},
+			{TransferID: 5, Date: day(time.October, 31, 23), Kind: KindInterest, Counterparty: 1, Amount: 25, Balance: 10200},
+		}
+		if len(statement.Entries) != len(want) {
+			t.Fatalf("got entries %v; want %v", statement.Entries, want)
+		}
+		for i, entry := range statement.Entries {
+			if entry != want[i] {
+				t.Errorf("got entry %v; want %v", entry, want[i])
+			}
+		}
+	})
+
+	t.Run("should date transfers by their confirmation", func(t *testing.T) {
+		confirmedAt := day(time.November, 1, 9)
+		accounts := NewAccountStore(app.StartingID(2),
+			app.Account{ID: 1, Name: "Pam Beesly", Type: AccountTypeChecking, Balance: 9000},
+			app.Account{ID: 2, Name: "Jim Halpert", Type: AccountTypeSavings, Balance: 1000},
+		)
+		transfers := NewTransferStore(app.StartingID(1),
+			app.Transfer{ID: 1, AccountOriginID: 1, AccountDestinationID: 2, Amount: 1000, CreatedAt: day(time.October, 31, 23), ConfirmedAt: &confirmedAt, Status: confirmed, Kind: KindTransfer},
+		)
+
+		october, _ := NewStatement(accounts, transfers, 1, from, to)
+		november, _ := NewStatement(accounts, transfers, 1, to, day(time.December, 1, 0))
+
+		app.AssertUint64(t, uint64(len(october.Entries)), 0)
+		assertCents(t, "october closing balance", october.ClosingBalance, 10000)
+		app.AssertUint64(t, uint64(len(november.Entries)), 1)
+		app.AssertString(t, november.Entries[0].Date.String(), confirmedAt.String())
+		assertCents(t, "november closing balance", november.ClosingBalance, 9000)
+
+		ID, _ := transfers.CreateTransfer(context.Background(), 2, 1, 100)
+		transfers.Confirm(context.Background(), ID)
+		transfer, _ := transfers.GetTransfer(ID)
+		if transfer.ConfirmedAt == nil || transfer.ConfirmedAt.Before(transfer.CreatedAt) {
+			t.Errorf("got transfer confirmed at %v; want after its creation at %v", transfer.ConfirmedAt, transfer.CreatedAt)
+		}
+	})
+
+	t.Run("should credit fees to the fee account", func(t *testing.T) {
+		statement, _ := NewStatement(accounts, transfers, 1, from, to)
+
+		assertCents(t, "opening balance", statement.OpeningBalance, 75)
+		assertCents(t, "fee", statement.Entries[0].Amount, 50)
+		app.AssertUint64(t, statement.Entries[0].Counterparty, 2)
+		assertCents(t, "interest", statement.Entries[1].Amount, -25)
+	})
+
+	t.Run("should write CSV with the delimiter and decimal separator given", func(t *testing.T) {
+		statement, _ := NewStatement(accounts, transfers, 2, from, to)
+		var buffer bytes.Buffer
+
+		err := statement.WriteCSV(&buffer, CSVOptions{Delimiter: ';', Decimal: ','})
+
+		app.AssertError(t, err, nil)
+		app.AssertString(t, buffer.String(), `date;transfer_id;kind;counterparty_account_id;amount;balance
+2026-10-01T00:00:00Z;;opening_balance;;;77,25
+2026-10-02T12:00:00Z;2;transfer;3;30,00;107,25
+2026-10-10T12:00:00Z;3;transfer;3;-5,00;102,25
+2026-10-10T12:00:00Z;3;fee;1;-0,50;101,75
+2026-10-31T23:00:00Z;5;interest;1;0,25;102,00
+2026-11-01T00:00:00Z;;closing_balance;;;102,00
+`)
+	})
+
+	t.Run("should write OFX with the closing balance", func(t *testing.T) {
+		statement, _ := NewStatement(accounts, transfers, 2, from, to)
+		var buffer bytes.Buffer
+
+		err := statement.WriteOFX(&buffer)
+
+		app.AssertError(t, err, nil)
+		ofx := buffer.String()
+		if !strings.HasPrefix(ofx, "OFXHEADER:100\r\n") {
+			t.Errorf("got OFX starting with %q; want the OFX header", ofx[:20])
+		}
+		for _, want := range []string{
+			"<ACCTID>2\r\n<ACCTTYPE>CHECKING\r\n",
+			"<DTSTART>20261001000000[0:GMT]\r\n<DTEND>20261101000000[0:GMT]\r\n",
+			"<TRNTYPE>CREDIT\r\n<DTPOSTED>20261002120000[0:GMT]\r\n<TRNAMT>30.00\r\n<FITID>2\r\n<MEMO>Transfer from account 3\r\n",
+			"<TRNTYPE>FEE\r\n<DTPOSTED>20261010120000[0:GMT]\r\n<TRNAMT>-0.50\r\n<FITID>3-fee\r\n",
+			"<TRNTYPE>INT\r\n",
+			"<LEDGERBAL>\r\n<BALAMT>102.00\r\n<DTASOF>20261101000000[0:GMT]\r\n",
+		} {
+			if !strings.Contains(ofx, want) {
+				t.Errorf("got OFX %s; want it to have %q", ofx, want)
+			}
+		}
+		if got := strings.Count(ofx, "<STMTTRN>"); got != 4 {
+			t.Errorf("got %d transactions; want 4", got)
+		}
+	})
+
+	t.Run("should start from the balances accounts were opened with", func(t *testing.T) {
+		accounts, transfers := Snapshot{}.Restore()
+		bankDay(t, accounts, transfers)
+
+		for ID, want := range map[uint64]int64{1: 0, 2: 100000, 3: 100000, 4: 5000} {
+			statement, err := NewStatement(accounts, transfers, ID, time.Time{}, time.Now().Add(time.Hour))
+			app.AssertError(t, err, nil)
+			account, _ := accounts.GetAccount(ID)
+			assertCents(t, "opening balance", statement.OpeningBalance, want)
+			assertCents(t, "closing balance", statement.ClosingBalance, int64(account.Balance))
+		}
+	})
+
+	t.Run("should refuse empty periods and unknown accounts", func(t *testing.T) {
+		_, err := NewStatement(accounts, transfers, 2, to, from)
+		app.AssertError(t, err, ErrInvalidPeriod)
+		_, err = NewStatement(accounts, transfers, 2, from, from)
+		app.AssertError(t, err, ErrInvalidPeriod)
+		_, err = NewStatement(accounts, transfers, 9, from, to)
+		app.AssertError(t, err, ErrAccountNotFound)
+	})
+}
+
+func assertCents(t *testing.T, name string, got, want int64) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %s %d; want %d", name, got, want)
+	}
+}
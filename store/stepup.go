@@ -0,0 +1,274 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"sort"
+	"time"
+)
+
+// MaxConfirmationAttempts is how many wrong codes a transfer pending
+// confirmation takes before it is cancelled.
+const MaxConfirmationAttempts = 3
+
+// MaxAccountCodeFailures is how many wrong codes an account may send, over
+// all its transfers, within StepUpLockout. Once it is reached, confirmations
+// are locked for the account for StepUpLockout, so that opening new
+// transfers does not give more guesses at the code.
+const (
+	MaxAccountCodeFailures = 10
+	StepUpLockout          = 15 * time.Minute
+)
+
+var (
+	ErrTOTPNotEnrolled     = errors.New("account has no TOTP enrollment")
+	ErrTOTPAlreadyEnabled  = errors.New("account already has TOTP enabled")
+	ErrTOTPReplayed        = errors.New("TOTP code has already been used")
+	ErrNotPending          = errors.New("transfer is not pending confirmation")
+	ErrConfirmationExpired = errors.New("transfer confirmation has expired")
+	ErrStepUpLocked        = errors.New("too many wrong TOTP codes: confirmations are locked for the account")
+)
+
+// codeFailures are the wrong TOTP codes of an account.
+type codeFailures struct {
+	times       []time.Time // Within StepUpLockout of the last one
+	lockedUntil time.Time
+}
+
+// EnrollTOTP sets the TOTP secret of an account. It only takes effect once
+// ActivateTOTP is called, after the customer shows they can generate codes
+// for it.
+func (a *AccountStore) EnrollTOTP(ctx context.Context, ID uint64, secret string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	account, ok := a.dataStorage[ID]
+	var err error
+	switch {
+	case !ok:
+		err = ErrAccountNotFound
+	case account.TOTPEnabled:
+		err = ErrTOTPAlreadyEnabled
+	default:
+		err = a.commit(ChangeTOTPEnrolled, accountSecret{AccountID: ID, Secret: secret})
+	}
+	record(ctx, a.auditor, "account.totp.enroll", struct {
+		AccountID uint64 `json:"account_id"`
+	}{ID}, err)
+	return err
+}
+
+// ActivateTOTP enables the TOTP secret of an account, using up the time step
+// of the code that proved it works.
+func (a *AccountStore) ActivateTOTP(ctx context.Context, ID uint64, step int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := a.checkTOTPStep(ID, step)
+	if err == nil {
+		err = a.commit(ChangeTOTPActivated, totpStep{AccountID: ID, Step: step})
+	}
+	record(ctx, a.auditor, "account.totp.activate", struct {
+		AccountID uint64 `json:"account_id"`
+	}{ID}, err)
+	return err
+}
+
+// UseTOTPStep marks the time step of a valid code as used, so that the same
+// code cannot be used twice.
+func (a *AccountStore) UseTOTPStep(ctx context.Context, ID uint64, step int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := a.checkTOTPStep(ID, step)
+	if err != nil {
+		return err
+	}
+	return a.commit(ChangeTOTPStepUsed, totpStep{AccountID: ID, Step: step})
+}
+
+// checkTOTPStep tells whether a code of the given time step can still be
+// used for the account.
+func (a *AccountStore) checkTOTPStep(ID uint64, step int64) error {
+	account, ok := a.dataStorage[ID]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	if account.TOTPSecret == "" {
+		return ErrTOTPNotEnrolled
+	}
+	if step <= account.TOTPLastStep {
+		return ErrTOTPReplayed
+	}
+	return nil
+}
+
+// CheckStepUpLock returns ErrStepUpLocked if the account sent too many wrong
+// codes lately, and when the lock is lifted.
+func (a *AccountStore) CheckStepUpLock(ID uint64, now time.Time) (time.Time, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	failures, ok := a.failures[ID]
+	if ok && now.Before(failures.lockedUntil) {
+		return failures.lockedUntil, ErrStepUpLocked
+	}
+	return time.Time{}, nil
+}
+
+// FailTOTPCode counts a wrong code sent for an account and locks its
+// confirmations once MaxAccountCodeFailures is reached within
+// StepUpLockout. It tells whether the account is now locked.
+func (a *AccountStore) FailTOTPCode(ctx context.Context, ID uint64, now time.Time) (locked bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.failures == nil {
+		a.failures = make(map[uint64]*codeFailures)
+	}
+	failures, ok := a.failures[ID]
+	if !ok {
+		failures = &codeFailures{}
+		a.failures[ID] = failures
+	}
+	recent := failures.times[:0]
+	for _, t := range failures.times {
+		if now.Sub(t) < StepUpLockout {
+			recent = append(recent, t)
+		}
+	}
+	failures.times = append(recent, now)
+	if len(failures.times) < MaxAccountCodeFailures {
+		return false
+	}
+	failures.times = nil
+	failures.lockedUntil = now.Add(StepUpLockout)
+	record(ctx, a.auditor, "account.totp.lock", struct {
+		AccountID   uint64    `json:"account_id"`
+		LockedUntil time.Time `json:"locked_until"`
+	}{ID, failures.lockedUntil.UTC()}, nil)
+	return true
+}
+
+// HoldTransfers sets transfers as pending confirmation until expiresAt.
+func (t *TransferStore) HoldTransfers(ctx context.Context, expiresAt time.Time, ids ...uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, id := range ids {
+		expiry := transferExpiry{ID: id, ExpiresAt: expiresAt}
+		err := t.commit(ChangeTransferExpirySet, expiry)
+		record(ctx, t.auditor, "transfer.expiry", expiry, err)
+		changeStatus(ctx, t, id, StatusPendingConfirmation)
+	}
+}
+
+// ReleaseTransfers takes transfers out of pending confirmation, back to
+// created, so they can be authorized. Transfers past their expiry are set as
+// expired instead. Either all of them are released or none is.
+func (t *TransferStore) ReleaseTransfers(ctx context.Context, now time.Time, ids ...uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, id := range ids {
+		transfer, ok := t.dataStorage[id]
+		if !ok {
+			return ErrTransferNotFound
+		}
+		if transfer.Status != ToStatusMsg(StatusPendingConfirmation) {
+			return ErrNotPending
+		}
+		if transfer.ExpiresAt != nil && !now.Before(*transfer.ExpiresAt) {
+			for _, id := range ids {
+				changeStatus(ctx, t, id, StatusExpired)
+			}
+			return ErrConfirmationExpired
+		}
+	}
+	for _, id := range ids {
+		delete(t.attempts, id)
+		changeStatus(ctx, t, id, StatusCreated)
+	}
+	return nil
+}
+
+// FailConfirmation counts a wrong code for transfers pending confirmation
+// and cancels them once MaxConfirmationAttempts is reached. It returns how
+// many attempts are left.
+func (t *TransferStore) FailConfirmation(ctx context.Context, ids ...uint64) (left int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(ids) == 0 {
+		return 0
+	}
+	if t.attempts == nil {
+		t.attempts = make(map[uint64]int)
+	}
+	t.attempts[ids[0]]++
+	left = MaxConfirmationAttempts - t.attempts[ids[0]]
+	if left > 0 {
+		return left
+	}
+	delete(t.attempts, ids[0])
+	for _, id := range ids {
+		if t.dataStorage[id].Status == ToStatusMsg(StatusPendingConfirmation) {
+			changeStatus(ctx, t, id, StatusCancelled)
+		}
+	}
+	return 0
+}
+
+// ExpirePending sets every transfer pending confirmation past its expiry as
+// expired and returns how many there were.
+func (t *TransferStore) ExpirePending(ctx context.Context, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	expired := 0
+	for id, transfer := range t.dataStorage {
+		if transfer.Status == ToStatusMsg(StatusPendingConfirmation) &&
+			transfer.ExpiresAt != nil && !now.Before(*transfer.ExpiresAt) {
+			delete(t.attempts, id)
+			changeStatus(ctx, t, id, StatusExpired)
+			expired++
+		}
+	}
+	return expired
+}
+
+// RunExpiry expires pending confirmations every interval until stop is
+// closed.
+func (t *TransferStore) RunExpiry(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			ctx := logging.NewContext(context.Background(), logging.Default().With("component", "expiry"))
+			if expired := t.ExpirePending(ctx, now); expired > 0 {
+				logging.FromContext(ctx).Info("expired pending confirmations", "transfers", expired)
+			}
+		}
+	}
+}
+
+// SplitLegs returns the IDs of the transfers of a split, sorted.
+func (t *TransferStore) SplitLegs(splitID uint64) []uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var ids []uint64
+	for id, transfer := range t.dataStorage {
+		if transfer.SplitID == splitID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
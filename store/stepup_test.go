@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	app "github.com/erikacarvalho/stone-challenge"
+	"testing"
+	"time"
+)
+
+func TestStepUp(t *testing.T) {
+	now := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+
+	newTransferStore := func() *TransferStore {
+		transfers := NewTransferStore(app.StartingID(0))
+		transfers.CreateTransfer(context.Background(), 1, 2, 500000)
+		transfers.HoldTransfers(context.Background(), now.Add(5*time.Minute), 1)
+		return transfers
+	}
+
+	t.Run("should release pending transfers before they expire", func(t *testing.T) {
+		transfers := newTransferStore()
+
+		err := transfers.ReleaseTransfers(context.Background(), now, 1)
+
+		app.AssertError(t, err, nil)
+		transfer, _ := transfers.GetTransfer(1)
+		app.AssertString(t, transfer.Status, ToStatusMsg(StatusCreated))
+	})
+
+	t.Run("should expire pending transfers released too late", func(t *testing.T) {
+		transfers := newTransferStore()
+
+		err := transfers.ReleaseTransfers(context.Background(), now.Add(5*time.Minute), 1)
+
+		app.AssertError(t, err, ErrConfirmationExpired)
+		transfer, _ := transfers.GetTransfer(1)
+		app.AssertString(t, transfer.Status, ToStatusMsg(StatusExpired))
+	})
+
+	t.Run("should release a transfer only once", func(t *testing.T) {
+		transfers := newTransferStore()
+		transfers.ReleaseTransfers(context.Background(), now, 1)
+
+		err := transfers.ReleaseTransfers(context.Background(), now, 1)
+
+		app.AssertError(t, err, ErrNotPending)
+	})
+
+	t.Run("should expire every pending transfer past its expiry", func(t *testing.T) {
+		transfers := newTransferStore()
+		transfers.CreateTransfer(context.Background(), 1, 3, 700000)
+		transfers.HoldTransfers(context.Background(), now.Add(time.Hour), 2)
+
+		expired := transfers.ExpirePending(context.Background(), now.Add(10*time.Minute))
+
+		app.AssertUint64(t, uint64(expired), 1)
+		second, _ := transfers.GetTransfer(2)
+		app.AssertString(t, second.Status, ToStatusMsg(StatusPendingConfirmation))
+	})
+
+	t.Run("should cancel after too many wrong codes", func(t *testing.T) {
+		transfers := newTransferStore()
+
+		for i := 1; i < MaxConfirmationAttempts; i++ {
+			left := transfers.FailConfirmation(context.Background(), 1)
+			app.AssertUint64(t, uint64(left), uint64(MaxConfirmationAttempts-i))
+		}
+		left := transfers.FailConfirmation(context.Background(), 1)
+
+		app.AssertUint64(t, uint64(left), 0)
+		transfer, _ := transfers.GetTransfer(1)
+		app.AssertString(t, transfer.Status, ToStatusMsg(StatusCancelled))
+	})
+
+	t.Run("should lock confirmations after too many wrong codes for the account", func(t *testing.T) {
+		accounts := NewAccountStore(app.StartingID(1), app.Account{ID: 1, Name: "Roberta Pinheiro Sá"})
+
+		// Failures older than StepUpLockout are forgotten.
+		accounts.FailTOTPCode(context.Background(), 1, now.Add(-StepUpLockout))
+		for i := 1; i < MaxAccountCodeFailures; i++ {
+			if accounts.FailTOTPCode(context.Background(), 1, now) {
+				t.Fatalf("got account locked after %d wrong codes", i)
+			}
+		}
+		_, err := accounts.CheckStepUpLock(1, now)
+		app.AssertError(t, err, nil)
+
+		if !accounts.FailTOTPCode(context.Background(), 1, now) {
+			t.Fatalf("got account not locked after %d wrong codes", MaxAccountCodeFailures)
+		}
+		until, err := accounts.CheckStepUpLock(1, now.Add(time.Minute))
+		app.AssertError(t, err, ErrStepUpLocked)
+		if !until.Equal(now.Add(StepUpLockout)) {
+			t.Errorf("got lock until %s; want %s", until, now.Add(StepUpLockout))
+		}
+		_, err = accounts.CheckStepUpLock(1, now.Add(StepUpLockout))
+		app.AssertError(t, err, nil)
+	})
+
+	t.Run("should refuse TOTP steps already used", func(t *testing.T) {
+		accounts := NewAccountStore(app.StartingID(1), app.Account{ID: 1, Name: "Roberta Pinheiro Sá"})
+		accounts.EnrollTOTP(context.Background(), 1, "JBSWY3DPEHPK3PXP")
+
+		app.AssertError(t, accounts.ActivateTOTP(context.Background(), 1, 100), nil)
+		app.AssertError(t, accounts.UseTOTPStep(context.Background(), 1, 100), ErrTOTPReplayed)
+		app.AssertError(t, accounts.UseTOTPStep(context.Background(), 1, 101), nil)
+		app.AssertError(t, accounts.EnrollTOTP(context.Background(), 1, "KRSXG5CTMVRXEZLU"), ErrTOTPAlreadyEnabled)
+	})
+}
@@ -1,9 +1,13 @@
 package store
 
 import (
+	"context"
 	"errors"
 	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"github.com/erikacarvalho/stone-challenge/metrics"
 	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -15,6 +19,10 @@ const (
 	StatusAuthorized    = 4
 	StatusCancelled     = 5
 	StatusConfirmed     = 6
+	// StatusPendingConfirmation holds transfers that need a second factor
+	// before they are authorized.
+	StatusPendingConfirmation = 7
+	StatusExpired             = 8
 )
 
 var statusMessage = map[int]string{
@@ -24,6 +32,23 @@ var statusMessage = map[int]string{
 	StatusAuthorized:    "Authorized",
 	StatusCancelled:     "Cancelled",
 	StatusConfirmed:     "Confirmed",
+
+	StatusPendingConfirmation: "Pending Confirmation",
+	StatusExpired:             "Expired",
+}
+
+// statusEvents maps each status to the event published when a transfer gets
+// to it.
+var statusEvents = map[int]string{
+	StatusCreated:       events.TransferReleased,
+	StatusAuthorizing:   events.TransferAuthorizing,
+	StatusNotAuthorized: events.TransferRejected,
+	StatusAuthorized:    events.TransferAuthorized,
+	StatusCancelled:     events.TransferCancelled,
+	StatusConfirmed:     events.TransferConfirmed,
+
+	StatusPendingConfirmation: events.TransferPendingConfirmation,
+	StatusExpired:             events.TransferExpired,
 }
 
 var (
@@ -36,8 +61,17 @@ var (
 )
 
 type TransferStore struct {
+	mu          sync.RWMutex
 	maxID       *uint64
 	dataStorage map[uint64]app.Transfer // The map key is the transfer identifier
+	fees        *FeeEngine
+	auditor     Auditor
+	publisher   Publisher
+	journal     *Journal
+	attempts    map[uint64]int  // Wrong confirmation codes by transfer, or by split ID
+	remessas    map[string]bool // CNAB remessas paid, by company document and sequence number
+	outcomes    *metrics.Counter
+	duplicates  *metrics.Counter
 }
 
 // NewTransferStore generates a new TransferStore with a starting ID number and
@@ -57,45 +91,114 @@ func NewTransferStore(startingID *uint64, transfers ...app.Transfer) *TransferSt
 // CreateTransfer is a method that creates a transfer based on origin
 // and destination account ids and an amount, and returns an incrementally
 // generated ID. It also sets created time to Now and status to Created.
-func (t *TransferStore) CreateTransfer(origin, destination, amount uint64) (id uint64, err error) {
+func (t *TransferStore) CreateTransfer(ctx context.Context, origin, destination, amount uint64) (id uint64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	newID := atomic.AddUint64(t.maxID, 1)
-	t.dataStorage[newID] = app.Transfer{
+	transfer := app.Transfer{
 		ID:                   newID,
 		AccountOriginID:      origin,
 		AccountDestinationID: destination,
 		Amount:               amount,
 		CreatedAt:            time.Now(),
 		Status:               ToStatusMsg(StatusCreated),
+		Kind:                 KindTransfer,
+	}
+	err = t.commit(ChangeTransferRequested, transfer)
+	record(ctx, t.auditor, "transfer.create", transfer, err)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// createSystemTransfer creates a transfer originated by the bank itself,
+// which skips the authorization rules meant for customers.
+func (t *TransferStore) createSystemTransfer(ctx context.Context, kind string, origin, destination, amount uint64) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	newID := atomic.AddUint64(t.maxID, 1)
+	transfer := app.Transfer{
+		ID:                   newID,
+		AccountOriginID:      origin,
+		AccountDestinationID: destination,
+		Amount:               amount,
+		CreatedAt:            time.Now(),
+		Status:               ToStatusMsg(StatusAuthorized),
+		Kind:                 kind,
+	}
+	err := t.commit(ChangeTransferRequested, transfer)
+	record(ctx, t.auditor, "transfer.create", transfer, err)
+	if err != nil {
+		return 0, err
 	}
 	return newID, nil
 }
 
+// SetFeeEngine sets the engine used to compute fees when authorizing
+// transfers. Without one, no fees are charged.
+func (t *TransferStore) SetFeeEngine(fees *FeeEngine) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.fees = fees
+}
+
+// FeeAccountID returns the ID of the bank-owned account credited with the
+// fees, or 0 if no fee engine is set.
+func (t *TransferStore) FeeAccountID() uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.fees == nil {
+		return 0
+	}
+	return t.fees.AccountID
+}
+
 // AuthorizeTransfer checks if it is possible to perform the transfer
 // based on the business rules, and returns error message depending on
-// the outcome.
-func (t *TransferStore) AuthorizeTransfer(origin, destination *app.Account, amount, id uint64) error {
-	changeStatus(t, id, StatusAuthorizing)
+// the outcome. The fee for the transfer is computed here, recorded on the
+// transfer and taken into account when checking the origin balance.
+func (t *TransferStore) AuthorizeTransfer(ctx context.Context, origin, destination *app.Account, amount, id uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
+	changeStatus(ctx, t, id, StatusAuthorizing)
+
+	err := t.checkTransfer(ctx, origin, destination, amount, id)
+	if err != nil {
+		reject(ctx, t, id, err)
+		return err
+	}
+	changeStatus(ctx, t, id, StatusAuthorized)
+	return nil
+}
+
+func (t *TransferStore) checkTransfer(ctx context.Context, origin, destination *app.Account, amount, id uint64) error {
 	if origin.ID == destination.ID {
-		changeStatus(t, id, StatusNotAuthorized)
 		return ErrSameID
 	}
 
 	if amount == 0 {
-		changeStatus(t, id, StatusNotAuthorized)
 		return ErrInvalidAmount
 	}
 
-	if origin.Balance < amount {
-		changeStatus(t, id, StatusNotAuthorized)
+	fee, err := t.fees.Fee(origin.Type, t.dataStorage[id].Kind, amount)
+	if err != nil {
+		return err
+	}
+	setFee(ctx, t, id, fee)
+
+	if !covers(origin.Balance, amount, fee) {
 		return ErrInsufficientBalance
 	}
 
 	if t.isChargeBack(origin.ID, destination.ID, amount) {
-		changeStatus(t, id, StatusNotAuthorized)
 		return ErrChargeBack
 	}
-	changeStatus(t, id, StatusAuthorized)
 	return nil
 }
 
@@ -111,6 +214,7 @@ func (t *TransferStore) isChargeBack(origin, destination, amount uint64) bool {
 			transfer.Amount == amount &&
 			transfer.Status == ToStatusMsg(StatusConfirmed) &&
 			now.Before(treshold) {
+			t.duplicates.Inc()
 			return true
 		}
 	}
@@ -118,18 +222,27 @@ func (t *TransferStore) isChargeBack(origin, destination, amount uint64) bool {
 }
 
 // Confirm sets the transfer status to confirmed.
-func (t *TransferStore) Confirm(id uint64) {
-	changeStatus(t, id, StatusConfirmed)
+func (t *TransferStore) Confirm(ctx context.Context, id uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changeStatus(ctx, t, id, StatusConfirmed)
 }
 
 // Cancel sets the transfer status to cancelled.
-func (t *TransferStore) Cancel(id uint64) {
-	changeStatus(t, id, StatusCancelled)
+func (t *TransferStore) Cancel(ctx context.Context, id uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changeStatus(ctx, t, id, StatusCancelled)
 }
 
 // ListAllTransfers returns all transfers from the store sorted by ID,
 // and an error if there are no transfers to be listed.
 func (t *TransferStore) ListAllTransfers() ([]app.Transfer, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
 	var transfers []app.Transfer
 	for _, v := range t.dataStorage {
 		transfers = append(transfers, v)
@@ -149,6 +262,9 @@ func (t *TransferStore) ListAllTransfers() ([]app.Transfer, error) {
 // GetTransfer returns a Transfer based on a given ID, and an error if
 // no transfer with given ID is found.
 func (t *TransferStore) GetTransfer(ID uint64) (app.Transfer, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
 	transfer, ok := t.dataStorage[ID]
 	if !ok {
 		return app.Transfer{}, ErrTransferNotFound
@@ -156,10 +272,29 @@ func (t *TransferStore) GetTransfer(ID uint64) (app.Transfer, error) {
 	return transfer, nil
 }
 
-func changeStatus(a *TransferStore, ID uint64, statusCode int) {
-	transfer := a.dataStorage[ID]
-	transfer.Status = ToStatusMsg(statusCode)
-	a.dataStorage[ID] = transfer
+func changeStatus(ctx context.Context, a *TransferStore, ID uint64, statusCode int) {
+	status := transferStatus{ID: ID, Status: ToStatusMsg(statusCode)}
+	err := a.commit(statusChanges[statusCode], status)
+	record(ctx, a.auditor, "transfer.status", status, err)
+	if err == nil && isFinal(statusCode) {
+		a.countOutcome(ID, "")
+	}
+}
+
+// reject sets a transfer as not authorized because of err.
+func reject(ctx context.Context, a *TransferStore, ID uint64, err error) {
+	changeStatus(ctx, a, ID, StatusNotAuthorized)
+	a.countOutcome(ID, rejectionReason(err))
+}
+
+func setFee(ctx context.Context, a *TransferStore, ID uint64, fee uint64) {
+	err := a.commit(ChangeTransferFeeSet, transferFee{ID: ID, Fee: fee})
+	record(ctx, a.auditor, "transfer.fee", transferFee{ID, fee}, err)
+}
+
+// covers tells whether balance is enough to pay amount plus fee.
+func covers(balance, amount, fee uint64) bool {
+	return amount <= balance && fee <= balance-amount
 }
 
 func ToStatusMsg(code int) string {
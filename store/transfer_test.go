@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	app "github.com/erikacarvalho/stone-challenge"
 	"testing"
 	"time"
@@ -13,7 +14,7 @@ func TestCreateTransfer(t *testing.T) {
 	destination := uint64(30)
 	amount := uint64(1500)
 
-	newTransferID, err := store.CreateTransfer(origin, destination, amount)
+	newTransferID, err := store.CreateTransfer(context.Background(), origin, destination, amount)
 
 	if err != nil {
 		t.Errorf("error creating transfer. error: %q", err)
@@ -44,9 +45,9 @@ func TestConfirm(t *testing.T) {
 	t.Run("should change transfer status to Confirmed", func(t *testing.T) {
 		store := NewTransferStore(app.StartingID(93))
 
-		newID, _ := store.CreateTransfer(15, 21, 7800)
+		newID, _ := store.CreateTransfer(context.Background(), 15, 21, 7800)
 
-		store.Confirm(newID)
+		store.Confirm(context.Background(), newID)
 
 		want := ToStatusMsg(StatusConfirmed)
 		got := store.dataStorage[newID].Status
@@ -59,9 +60,9 @@ func TestCancel(t *testing.T) {
 	t.Run("should change transfer status to StatusCancelled", func(t *testing.T) {
 		store := NewTransferStore(app.StartingID(800))
 
-		newID, _ := store.CreateTransfer(90, 2, 19000)
+		newID, _ := store.CreateTransfer(context.Background(), 90, 2, 19000)
 
-		store.Cancel(newID)
+		store.Cancel(context.Background(), newID)
 
 		want := ToStatusMsg(StatusCancelled)
 		got := store.dataStorage[newID].Status
@@ -272,7 +273,7 @@ func TestAuthorize(t *testing.T) {
 			ID:      destinationID,
 			Balance: 9000,
 		}
-		got := store.AuthorizeTransfer(origin, destination, amount, 2)
+		got := store.AuthorizeTransfer(context.Background(), origin, destination, amount, 2)
 
 		gotStatus := store.dataStorage[2].Status
 		wantStatus := ToStatusMsg(StatusAuthorized)
@@ -309,7 +310,7 @@ func TestAuthorize(t *testing.T) {
 		}
 
 		want := ErrInvalidAmount
-		got := store.AuthorizeTransfer(origin, destination, amount, 1)
+		got := store.AuthorizeTransfer(context.Background(), origin, destination, amount, 1)
 
 		gotStatus := store.dataStorage[1].Status
 		wantStatus := ToStatusMsg(StatusNotAuthorized)
@@ -342,7 +343,7 @@ func TestAuthorize(t *testing.T) {
 		}
 
 		want := ErrSameID
-		got := store.AuthorizeTransfer(acc, acc, amount, 1)
+		got := store.AuthorizeTransfer(context.Background(), acc, acc, amount, 1)
 
 		gotStatus := store.dataStorage[1].Status
 		wantStatus := ToStatusMsg(StatusNotAuthorized)
@@ -379,7 +380,7 @@ func TestAuthorize(t *testing.T) {
 			Balance: 9000,
 		}
 		want := ErrInsufficientBalance
-		got := store.AuthorizeTransfer(origin, destination, amount, 1)
+		got := store.AuthorizeTransfer(context.Background(), origin, destination, amount, 1)
 
 		gotStatus := store.dataStorage[1].Status
 		wantStatus := ToStatusMsg(StatusNotAuthorized)
@@ -427,7 +428,7 @@ func TestAuthorize(t *testing.T) {
 		}
 
 		want := ErrChargeBack
-		got := store.AuthorizeTransfer(origin, destination, amount, 2)
+		got := store.AuthorizeTransfer(context.Background(), origin, destination, amount, 2)
 
 		gotStatus := store.dataStorage[2].Status
 		wantStatus := ToStatusMsg(StatusNotAuthorized)
@@ -0,0 +1,748 @@
+// Package webhook delivers the events published by the stores to the URLs
+// subscribed to them, as signed HTTP POST requests. Failed deliveries are
+// retried with exponential backoff and, once out of attempts, kept as dead
+// letters, up to a limit, until they are redelivered by hand. A Dispatcher
+// is an events.TrackedSink, so events still being delivered when the server
+// stops are relayed to it again after a restart.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"github.com/erikacarvalho/stone-challenge/logging"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of the requests that deliver events. SignatureHeader carries
+// t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>" under the
+// subscription secret>; see Verify.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Defaults of a new Dispatcher. With them a delivery is given up on after
+// about 45 minutes.
+const (
+	DefaultMaxAttempts    = 10
+	DefaultBackoff        = 5 * time.Second
+	DefaultMaxBackoff     = time.Hour
+	DefaultTimeout        = 10 * time.Second
+	DefaultConcurrency    = 8
+	DefaultMaxDeadLetters = 1000
+)
+
+// Delivery statuses.
+const (
+	StatusPending = "pending"
+	StatusFailed  = "failed"
+)
+
+// SignatureTolerance is how old the timestamp of a delivery may be for
+// Verify to accept it.
+const SignatureTolerance = 5 * time.Minute
+
+var (
+	ErrInvalidURL           = errors.New("invalid webhook url: it must be an absolute http or https URL")
+	ErrInvalidEventType     = events.ErrInvalidType
+	ErrSubscriptionNotFound = errors.New("there is no webhook with this ID")
+	ErrDeliveryNotFound     = errors.New("there is no delivery with this ID")
+	ErrDeliveryNotFailed    = errors.New("delivery has not failed: it is still being retried")
+	ErrInvalidSignature     = errors.New("webhook signature is invalid")
+	ErrStaleSignature       = errors.New("webhook signature timestamp is too old")
+)
+
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events,omitempty"` // Event types delivered, such as transfer.*; every type when empty
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants tells whether events of eventType are delivered to s.
+func (s Subscription) Wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, pattern := range s.Events {
+		if events.Match(pattern, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is an event on its way to a subscription. Deliveries are
+// forgotten once the subscriber accepts them.
+type Delivery struct {
+	ID             string       `json:"id"`
+	SubscriptionID string       `json:"subscription_id"`
+	Event          events.Event `json:"event"`
+	Status         string       `json:"status"` // pending or failed
+	Attempts       int          `json:"attempts"`
+	LastError      string       `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time   `json:"next_attempt_at,omitempty"` // Only set while pending
+
+	seq         uint64
+	inFlight    bool
+	redelivered bool // Taken back from the dead letters, so kept with them until delivered
+}
+
+// Dispatcher keeps the subscriptions and delivers events to them. Its
+// settings must not be changed once Run is called.
+type Dispatcher struct {
+	MaxAttempts    int           // Attempts before a delivery is a dead letter
+	Backoff        time.Duration // Wait after the first failed attempt, doubled after each one
+	MaxBackoff     time.Duration
+	Concurrency    int // Deliveries sent at once
+	MaxDeadLetters int // Dead letters kept, the oldest ones being dropped past it; 0 keeps every one
+
+	client *http.Client
+	now    func() time.Time
+	wake   chan struct{}
+	path   string // File the subscriptions are kept in, if any
+
+	mu            sync.Mutex
+	subscriptions map[string]Subscription
+	secrets       map[string]string
+	deliveries    map[string]*Delivery
+	seq           uint64
+	finished      chan struct{} // Closed when a delivery is finished with
+}
+
+// savedSubscription is a subscription as kept in the file of a dispatcher.
+type savedSubscription struct {
+	Subscription
+	Secret string `json:"secret"`
+}
+
+// NewDispatcher returns a dispatcher without subscriptions that sends
+// deliveries with client, or with a client that times out after
+// DefaultTimeout if client is nil.
+func NewDispatcher(client *http.Client) *Dispatcher {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Dispatcher{
+		MaxAttempts:    DefaultMaxAttempts,
+		Backoff:        DefaultBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		Concurrency:    DefaultConcurrency,
+		MaxDeadLetters: DefaultMaxDeadLetters,
+		client:         client,
+		now:            time.Now,
+		wake:           make(chan struct{}, 1),
+		subscriptions:  make(map[string]Subscription),
+		secrets:        make(map[string]string),
+		deliveries:     make(map[string]*Delivery),
+		finished:       make(chan struct{}),
+	}
+}
+
+// OpenDispatcher returns a dispatcher like NewDispatcher that keeps its
+// subscriptions, along with their secrets, in the file at path, starting
+// with the ones saved there. Dead letters, and the ones redelivered until
+// they are delivered, are kept in a file next to it, as DeadLettersPath
+// tells; other deliveries are not, as the relay sends the events that were
+// still being delivered again.
+func OpenDispatcher(client *http.Client, path string) (*Dispatcher, error) {
+	d := NewDispatcher(client)
+	d.path = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading webhooks: %w", err)
+	}
+	var saved []savedSubscription
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, fmt.Errorf("error loading webhooks %s: %w", path, err)
+	}
+	for _, subscription := range saved {
+		d.subscriptions[subscription.ID] = subscription.Subscription
+		d.secrets[subscription.ID] = subscription.Secret
+	}
+	return d, d.loadDeadLetters()
+}
+
+// DeadLettersPath returns the path of the file the dead letters of a
+// dispatcher opened with path are kept in: webhooks.json keeps them in
+// webhooks.dead-letters.json.
+func DeadLettersPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".dead-letters" + ext
+}
+
+// loadDeadLetters reads the dead letters saved by keepDeadLetters, leaving
+// out the ones of subscriptions removed meanwhile.
+func (d *Dispatcher) loadDeadLetters() error {
+	data, err := ioutil.ReadFile(DeadLettersPath(d.path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading webhook dead letters: %w", err)
+	}
+	var saved []Delivery
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return fmt.Errorf("error loading webhook dead letters %s: %w", DeadLettersPath(d.path), err)
+	}
+	for i := range saved {
+		delivery := &saved[i]
+		if _, ok := d.subscriptions[delivery.SubscriptionID]; !ok {
+			continue
+		}
+		d.seq++
+		delivery.seq = d.seq
+		delivery.redelivered = delivery.Status == StatusPending
+		if delivery.redelivered && delivery.NextAttemptAt == nil {
+			now := d.now().UTC()
+			delivery.NextAttemptAt = &now
+		}
+		d.deliveries[delivery.ID] = delivery
+	}
+	return nil
+}
+
+// Subscribe subscribes rawURL to the given event types, or to every one if
+// there are none, and returns the subscription along with the secret its
+// deliveries are signed with, which cannot be read again.
+func (d *Dispatcher) Subscribe(rawURL string, eventTypes []string) (Subscription, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Subscription{}, "", ErrInvalidURL
+	}
+	for _, pattern := range eventTypes {
+		if !events.ValidPattern(pattern) {
+			return Subscription{}, "", ErrInvalidEventType
+		}
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return Subscription{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return Subscription{}, "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	subscription := Subscription{ID: "wh_" + id, URL: rawURL, Events: eventTypes, CreatedAt: d.now().UTC()}
+	d.subscriptions[subscription.ID] = subscription
+	d.secrets[subscription.ID] = "whsec_" + secret
+	err = d.save()
+	if err != nil {
+		delete(d.subscriptions, subscription.ID)
+		delete(d.secrets, subscription.ID)
+		return Subscription{}, "", err
+	}
+	return subscription, d.secrets[subscription.ID], nil
+}
+
+// Unsubscribe removes a subscription along with its deliveries.
+func (d *Dispatcher) Unsubscribe(ID string) (Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	subscription, ok := d.subscriptions[ID]
+	if !ok {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	secret := d.secrets[ID]
+	delete(d.subscriptions, ID)
+	delete(d.secrets, ID)
+	err := d.save()
+	if err != nil {
+		d.subscriptions[ID] = subscription
+		d.secrets[ID] = secret
+		return Subscription{}, err
+	}
+	for deliveryID, delivery := range d.deliveries {
+		if delivery.SubscriptionID == ID {
+			delete(d.deliveries, deliveryID)
+		}
+	}
+	d.keepDeadLetters()
+	d.notifyFinished()
+	return subscription, nil
+}
+
+// save writes the subscriptions to the file of the dispatcher, if it has
+// one, replacing it at once. The lock must be held.
+func (d *Dispatcher) save() error {
+	if d.path == "" {
+		return nil
+	}
+	saved := make([]savedSubscription, 0, len(d.subscriptions))
+	for ID, subscription := range d.subscriptions {
+		saved = append(saved, savedSubscription{Subscription: subscription, Secret: d.secrets[ID]})
+	}
+	sort.Slice(saved, func(i, j int) bool {
+		return saved[i].ID < saved[j].ID
+	})
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("error marshaling webhooks: %w", err)
+	}
+	err = writeFile(d.path, data)
+	if err != nil {
+		return fmt.Errorf("error saving webhooks: %w", err)
+	}
+	return nil
+}
+
+// keepDeadLetters writes the dead letters, and the redelivered ones still
+// pending, to the dead letters file of the dispatcher, if it has one, oldest
+// first. A failure is only logged: the file keeps the previous ones, so at
+// worst a dead letter comes back or one dropped meanwhile is kept after a
+// restart. The lock must be held.
+func (d *Dispatcher) keepDeadLetters() {
+	if d.path == "" {
+		return
+	}
+	var kept []*Delivery
+	for _, delivery := range d.deliveries {
+		if delivery.Status == StatusFailed || delivery.redelivered {
+			kept = append(kept, delivery)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].seq < kept[j].seq
+	})
+	saved := make([]Delivery, 0, len(kept))
+	for _, delivery := range kept {
+		saved = append(saved, *delivery)
+	}
+	data, err := json.Marshal(saved)
+	if err == nil {
+		err = writeFile(DeadLettersPath(d.path), data)
+	}
+	if err != nil {
+		logging.Default().Error("error saving webhook dead letters", "component", "webhook", "path", DeadLettersPath(d.path), "error", err)
+	}
+}
+
+// writeFile replaces the file at path with data at once, through a
+// temporary file in the same directory.
+func writeFile(path string, data []byte) error {
+	// TempFile creates the file readable only by its owner, as the secrets
+	// and the events must be.
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	return err
+}
+
+// Subscription returns the subscription with ID.
+func (d *Dispatcher) Subscription(ID string) (Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	subscription, ok := d.subscriptions[ID]
+	if !ok {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return subscription, nil
+}
+
+// Subscriptions returns every subscription sorted by creation time.
+func (d *Dispatcher) Subscriptions() []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	subscriptions := make([]Subscription, 0, len(d.subscriptions))
+	for _, subscription := range d.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].ID < subscriptions[j].ID
+		}
+		return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+	})
+	return subscriptions
+}
+
+// Handle queues e for every subscription that wants it. It never blocks, so
+// it can be subscribed to an *events.Bus.
+func (d *Dispatcher) Handle(e events.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now().UTC()
+	queued := false
+	for _, subscription := range d.subscriptions {
+		if !subscription.Wants(e.Type) {
+			continue
+		}
+		id := fmt.Sprintf("dlv_%d_%s", e.ID, subscription.ID[len("wh_"):])
+		if _, ok := d.deliveries[id]; ok {
+			continue // Sent again by the relay after a restart, but kept as a dead letter
+		}
+		d.seq++
+		d.deliveries[id] = &Delivery{
+			ID:             id,
+			SubscriptionID: subscription.ID,
+			Event:          e,
+			Status:         StatusPending,
+			NextAttemptAt:  &now,
+			seq:            d.seq,
+		}
+		queued = true
+	}
+	if queued {
+		d.notify()
+	}
+}
+
+// Send queues e like Handle, so that a Dispatcher can be a sink of an
+// events.Relay.
+func (d *Dispatcher) Send(e events.Event) error {
+	d.Handle(e)
+	return nil
+}
+
+// Unfinished returns the ID of the oldest event with a delivery still
+// pending, or 0 if there is none, and a channel closed once a delivery is
+// finished with. Dead letters are finished with.
+func (d *Dispatcher) Unfinished() (uint64, <-chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var oldest uint64
+	for _, delivery := range d.deliveries {
+		if delivery.Status == StatusPending && (oldest == 0 || delivery.Event.ID < oldest) {
+			oldest = delivery.Event.ID
+		}
+	}
+	return oldest, d.finished
+}
+
+// DeadLetters returns the deliveries that ran out of attempts, oldest
+// first.
+func (d *Dispatcher) DeadLetters() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var deliveries []*Delivery
+	for _, delivery := range d.deliveries {
+		if delivery.Status == StatusFailed {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].seq < deliveries[j].seq
+	})
+	deadLetters := make([]Delivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		deadLetters = append(deadLetters, *delivery)
+	}
+	return deadLetters
+}
+
+// Redeliver takes a dead letter back to pending, with its attempts reset,
+// and delivers it right away.
+func (d *Dispatcher) Redeliver(ID string) (Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delivery, ok := d.deliveries[ID]
+	if !ok {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	if delivery.Status != StatusFailed {
+		return Delivery{}, ErrDeliveryNotFailed
+	}
+	now := d.now().UTC()
+	delivery.Status = StatusPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.redelivered = true
+	d.keepDeadLetters()
+	d.notify()
+	return *delivery, nil
+}
+
+// Run delivers events as they are queued, and retries the failed ones when
+// they are due, until stop is closed.
+func (d *Dispatcher) Run(stop <-chan struct{}) {
+	for {
+		d.deliverDue()
+		timer := time.NewTimer(d.untilNext())
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-d.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// notify wakes Run up. The lock must be held.
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// notifyFinished wakes up whoever waits on Unfinished. The lock must be
+// held.
+func (d *Dispatcher) notifyFinished() {
+	close(d.finished)
+	d.finished = make(chan struct{})
+}
+
+// untilNext returns how long until the next pending delivery is due, up to
+// a minute.
+func (d *Dispatcher) untilNext() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	wait := time.Minute
+	now := d.now()
+	for _, delivery := range d.deliveries {
+		if delivery.Status != StatusPending || delivery.inFlight {
+			continue
+		}
+		if until := delivery.NextAttemptAt.Sub(now); until < wait {
+			wait = until
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// attempt is a delivery being sent.
+type attempt struct {
+	delivery Delivery
+	url      string
+	secret   string
+}
+
+// deliverDue sends every pending delivery that is due, Concurrency at a
+// time, and waits for them.
+func (d *Dispatcher) deliverDue() {
+	d.mu.Lock()
+	now := d.now()
+	var due []attempt
+	for _, delivery := range d.deliveries {
+		if delivery.Status != StatusPending || delivery.inFlight || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		delivery.inFlight = true
+		due = append(due, attempt{
+			delivery: *delivery,
+			url:      d.subscriptions[delivery.SubscriptionID].URL,
+			secret:   d.secrets[delivery.SubscriptionID],
+		})
+	}
+	d.mu.Unlock()
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].delivery.seq < due[j].delivery.seq
+	})
+
+	slots := make(chan struct{}, d.Concurrency)
+	var wg sync.WaitGroup
+	for _, a := range due {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(a attempt) {
+			defer wg.Done()
+			err := d.send(a)
+			d.finish(a.delivery.ID, err)
+			<-slots
+		}(a)
+	}
+	wg.Wait()
+}
+
+// send posts the event of a delivery to its subscription URL. Any status
+// other than 2xx is a failure.
+func (d *Dispatcher) send(a attempt) error {
+	body, err := json.Marshal(a.delivery.Event)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, a.delivery.Event.Type)
+	request.Header.Set(DeliveryHeader, a.delivery.ID)
+	request.Header.Set(SignatureHeader, Sign(a.secret, d.now(), body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("subscriber answered %s", response.Status)
+	}
+	return nil
+}
+
+// finish records the outcome of an attempt: the delivery is forgotten if it
+// succeeded, and otherwise scheduled again or, once out of attempts, kept
+// as a dead letter.
+func (d *Dispatcher) finish(ID string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delivery, ok := d.deliveries[ID]
+	if !ok {
+		return // Unsubscribed meanwhile
+	}
+	delivery.inFlight = false
+	if err == nil {
+		delete(d.deliveries, ID)
+		if delivery.redelivered {
+			d.keepDeadLetters()
+		}
+		d.notifyFinished()
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	logger := logging.Default().With("component", "webhook", "delivery_id", ID, "subscription_id", delivery.SubscriptionID)
+	if delivery.Attempts >= d.MaxAttempts {
+		delivery.Status = StatusFailed
+		delivery.NextAttemptAt = nil
+		delivery.redelivered = false
+		logger.Error("webhook delivery failed for good", "attempts", delivery.Attempts, "error", err)
+		d.dropOldDeadLetters()
+		d.keepDeadLetters()
+		d.notifyFinished()
+		return
+	}
+	next := d.now().UTC().Add(d.backoff(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+	logger.Warn("webhook delivery failed", "attempts", delivery.Attempts, "next_attempt_at", next, "error", err)
+}
+
+// dropOldDeadLetters forgets the oldest dead letters past MaxDeadLetters.
+// The lock must be held.
+func (d *Dispatcher) dropOldDeadLetters() {
+	if d.MaxDeadLetters <= 0 {
+		return
+	}
+	var deadLetters []*Delivery
+	for _, delivery := range d.deliveries {
+		if delivery.Status == StatusFailed {
+			deadLetters = append(deadLetters, delivery)
+		}
+	}
+	if len(deadLetters) <= d.MaxDeadLetters {
+		return
+	}
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].seq < deadLetters[j].seq
+	})
+	for _, delivery := range deadLetters[:len(deadLetters)-d.MaxDeadLetters] {
+		delete(d.deliveries, delivery.ID)
+		logging.Default().Warn("dropped a webhook dead letter past the limit", "component", "webhook", "delivery_id", delivery.ID, "subscription_id", delivery.SubscriptionID, "event_id", delivery.Event.ID)
+	}
+}
+
+// backoff returns how long to wait after the given number of failed
+// attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.Backoff
+	for i := 1; i < attempts && wait < d.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.MaxBackoff {
+		wait = d.MaxBackoff
+	}
+	return wait
+}
+
+// Sign returns the signature header of a delivery of body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + signature(secret, timestamp, body)
+}
+
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature header of a delivery of body, as a subscriber
+// should before trusting it, and that it was sent at most
+// SignatureTolerance before now.
+func Verify(secret, header string, body []byte, now time.Time) error {
+	var timestamp, signed string
+	for _, part := range strings.Split(header, ",") {
+		switch {
+		case strings.HasPrefix(part, "t="):
+			timestamp = part[len("t="):]
+		case strings.HasPrefix(part, "v1="):
+			signed = part[len("v1="):]
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signed == "" {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signed), []byte(signature(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	if now.Sub(time.Unix(seconds, 0)) > SignatureTolerance {
+		return ErrStaleSignature
+	}
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
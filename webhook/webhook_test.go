@@ -0,0 +1,352 @@
+package webhook
+
+import (
+	"encoding/json"
+	app "github.com/erikacarvalho/stone-challenge"
+	"github.com/erikacarvalho/stone-challenge/events"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a subscriber that keeps what it receives and answers with
+// the statuses in replies, then with 204.
+type receiver struct {
+	*httptest.Server
+	mu        sync.Mutex
+	received  []*http.Request
+	bodies    [][]byte
+	replies   []int
+	verifyErr []error
+	secret    string
+}
+
+func newReceiver(replies ...int) *receiver {
+	r := &receiver{replies: replies}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.received = append(r.received, req)
+		r.bodies = append(r.bodies, body)
+		r.verifyErr = append(r.verifyErr, Verify(r.secret, req.Header.Get(SignatureHeader), body, time.Now()))
+		status := http.StatusNoContent
+		if len(r.replies) > 0 {
+			status, r.replies = r.replies[0], r.replies[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	return r
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+func event(id uint64, eventType string) events.Event {
+	return events.Event{ID: id, Type: eventType, Time: time.Now(), AccountIDs: []uint64{1}, Data: json.RawMessage(`{"id":1}`)}
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Run("should deliver signed events to the subscriptions that want them", func(t *testing.T) {
+		all := newReceiver()
+		defer all.Close()
+		transfers := newReceiver()
+		defer transfers.Close()
+		d := NewDispatcher(nil)
+		_, all.secret, _ = d.Subscribe(all.URL, nil)
+		subscription, secret, _ := d.Subscribe(transfers.URL, []string{"transfer.*"})
+		transfers.secret = secret
+
+		d.Handle(event(1, events.AccountCreated))
+		d.Handle(event(2, events.TransferConfirmed))
+		d.deliverDue()
+
+		app.AssertUint64(t, uint64(all.count()), 2)
+		app.AssertUint64(t, uint64(transfers.count()), 1)
+		request := transfers.received[0]
+		app.AssertString(t, request.Method, http.MethodPost)
+		app.AssertString(t, request.Header.Get(EventHeader), events.TransferConfirmed)
+		app.AssertString(t, request.Header.Get(DeliveryHeader), "dlv_2_"+subscription.ID[len("wh_"):])
+		app.AssertError(t, transfers.verifyErr[0], nil)
+		var delivered events.Event
+		json.Unmarshal(transfers.bodies[0], &delivered)
+		app.AssertUint64(t, delivered.ID, 2)
+
+		d.deliverDue()
+		app.AssertUint64(t, uint64(all.count()), 2)
+	})
+
+	t.Run("should retry with exponential backoff and keep dead letters", func(t *testing.T) {
+		r := newReceiver(http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusBadGateway)
+		defer r.Close()
+		clock := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		d := NewDispatcher(nil)
+		d.now = func() time.Time { return clock }
+		d.MaxAttempts = 3
+		d.Backoff = time.Second
+		_, r.secret, _ = d.Subscribe(r.URL, []string{events.TransferCreated})
+
+		d.Handle(event(1, events.TransferCreated))
+		d.deliverDue()
+		app.AssertUint64(t, uint64(r.count()), 1)
+
+		d.deliverDue()
+		app.AssertUint64(t, uint64(r.count()), 1)
+		clock = clock.Add(time.Second)
+		d.deliverDue()
+		app.AssertUint64(t, uint64(r.count()), 2)
+
+		clock = clock.Add(time.Second)
+		d.deliverDue()
+		app.AssertUint64(t, uint64(r.count()), 2)
+		clock = clock.Add(time.Second)
+		d.deliverDue()
+		app.AssertUint64(t, uint64(r.count()), 3)
+
+		deadLetters := d.DeadLetters()
+		app.AssertUint64(t, uint64(len(deadLetters)), 1)
+		app.AssertString(t, deadLetters[0].Status, StatusFailed)
+		app.AssertString(t, deadLetters[0].LastError, "subscriber answered 502 Bad Gateway")
+		clock = clock.Add(time.Hour)
+		d.deliverDue()
+		app.AssertUint64(t, uint64(r.count()), 3)
+
+		redelivered, err := d.Redeliver(deadLetters[0].ID)
+		app.AssertError(t, err, nil)
+		app.AssertString(t, redelivered.Status, StatusPending)
+		d.deliverDue()
+		app.AssertUint64(t, uint64(r.count()), 4)
+		app.AssertUint64(t, uint64(len(d.DeadLetters())), 0)
+
+		_, err = d.Redeliver(deadLetters[0].ID)
+		app.AssertError(t, err, ErrDeliveryNotFound)
+	})
+
+	t.Run("should not redeliver deliveries still being retried", func(t *testing.T) {
+		d := NewDispatcher(nil)
+		d.Subscribe("http://127.0.0.1:1/hooks", nil)
+		d.Handle(event(1, events.AccountCreated))
+		for ID := range d.deliveries {
+			_, err := d.Redeliver(ID)
+			app.AssertError(t, err, ErrDeliveryNotFailed)
+		}
+	})
+
+	t.Run("should deliver from Run until stopped", func(t *testing.T) {
+		r := newReceiver()
+		defer r.Close()
+		d := NewDispatcher(nil)
+		_, r.secret, _ = d.Subscribe(r.URL, nil)
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			d.Run(stop)
+			close(done)
+		}()
+
+		d.Handle(event(1, events.AccountCreated))
+		deadline := time.Now().Add(5 * time.Second)
+		for r.count() == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		app.AssertUint64(t, uint64(r.count()), 1)
+		close(stop)
+		<-done
+	})
+
+	t.Run("should drop the oldest dead letters past the limit", func(t *testing.T) {
+		r := newReceiver(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+		defer r.Close()
+		d := NewDispatcher(nil)
+		d.MaxAttempts = 1
+		d.MaxDeadLetters = 2
+		d.Subscribe(r.URL, nil)
+
+		for id := uint64(1); id <= 3; id++ {
+			d.Handle(event(id, events.TransferCreated))
+			d.deliverDue()
+		}
+
+		deadLetters := d.DeadLetters()
+		app.AssertUint64(t, uint64(len(deadLetters)), 2)
+		app.AssertUint64(t, deadLetters[0].Event.ID, 2)
+		app.AssertUint64(t, deadLetters[1].Event.ID, 3)
+	})
+
+	t.Run("should drop the deliveries of removed subscriptions", func(t *testing.T) {
+		d := NewDispatcher(nil)
+		subscription, _, _ := d.Subscribe("http://127.0.0.1:1/hooks", nil)
+		d.Handle(event(1, events.AccountCreated))
+
+		_, err := d.Unsubscribe(subscription.ID)
+		app.AssertError(t, err, nil)
+		app.AssertUint64(t, uint64(len(d.deliveries)), 0)
+		_, err = d.Unsubscribe(subscription.ID)
+		app.AssertError(t, err, ErrSubscriptionNotFound)
+	})
+}
+
+func TestRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "webhooks.json")
+
+	// run relays the events of outbox to a dispatcher kept at path until
+	// stop is closed, and returns the dispatcher along with a function that
+	// waits for both to stop.
+	run := func(t *testing.T, outbox *events.Outbox, stop chan struct{}) (*Dispatcher, func()) {
+		t.Helper()
+		d, err := OpenDispatcher(nil, path)
+		app.AssertError(t, err, nil)
+		d.Backoff = time.Hour
+		relay := events.NewRelay(outbox)
+		relay.AddSink("webhooks", d)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			relay.Run(stop)
+		}()
+		go func() {
+			defer wg.Done()
+			d.Run(stop)
+		}()
+		return d, wg.Wait
+	}
+	waitFor := func(t *testing.T, r *receiver, n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for r.count() < n && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		app.AssertUint64(t, uint64(r.count()), uint64(n))
+	}
+
+	t.Run("should send again after a restart the deliveries pending at shutdown", func(t *testing.T) {
+		r := newReceiver(http.StatusServiceUnavailable)
+		defer r.Close()
+		outbox := events.NewOutbox()
+		stop := make(chan struct{})
+		d, wait := run(t, outbox, stop)
+		subscription, secret, err := d.Subscribe(r.URL, nil)
+		app.AssertError(t, err, nil)
+		r.secret = secret
+
+		outbox.Publish(event(0, events.TransferCreated))
+		waitFor(t, r, 1)
+		close(stop)
+		wait()
+		app.AssertUint64(t, outbox.State().Offsets["webhooks"], 0)
+
+		restarted := events.RestoreOutbox(outbox.State())
+		stop = make(chan struct{})
+		d, wait = run(t, restarted, stop)
+		defer wait()
+		defer close(stop)
+		found, err := d.Subscription(subscription.ID)
+		app.AssertError(t, err, nil)
+		app.AssertString(t, found.URL, r.URL)
+
+		waitFor(t, r, 2)
+		deadline := time.Now().Add(5 * time.Second)
+		for restarted.State().Offsets["webhooks"] == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		app.AssertUint64(t, restarted.State().Offsets["webhooks"], 1)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		app.AssertString(t, r.received[1].Header.Get(DeliveryHeader), r.received[0].Header.Get(DeliveryHeader))
+		app.AssertError(t, r.verifyErr[1], nil)
+	})
+
+	t.Run("should keep dead letters and the redelivered ones after a restart", func(t *testing.T) {
+		r := newReceiver(http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+		defer r.Close()
+		path := filepath.Join(dir, "dead-letters.json")
+		d, err := OpenDispatcher(nil, path)
+		app.AssertError(t, err, nil)
+		d.MaxAttempts = 1
+		d.Subscribe(r.URL, nil)
+		d.Handle(event(1, events.TransferCreated))
+		d.Handle(event(2, events.TransferCreated))
+		d.deliverDue()
+		deadLetters := d.DeadLetters()
+		app.AssertUint64(t, uint64(len(deadLetters)), 2)
+		d.Redeliver(deadLetters[0].ID)
+
+		d, err = OpenDispatcher(nil, path)
+		app.AssertError(t, err, nil)
+
+		deadLetters = d.DeadLetters()
+		app.AssertUint64(t, uint64(len(deadLetters)), 1)
+		app.AssertUint64(t, deadLetters[0].Event.ID, 2)
+		app.AssertString(t, deadLetters[0].LastError, "subscriber answered 503 Service Unavailable")
+		oldest, _ := d.Unfinished()
+		app.AssertUint64(t, oldest, 1)
+		d.deliverDue()
+		app.AssertUint64(t, uint64(r.count()), 3)
+
+		d, err = OpenDispatcher(nil, path)
+		app.AssertError(t, err, nil)
+		oldest, _ = d.Unfinished()
+		app.AssertUint64(t, oldest, 0)
+		app.AssertUint64(t, uint64(len(d.DeadLetters())), 1)
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	d := NewDispatcher(nil)
+
+	for _, rawURL := range []string{"", "/hooks", "ftp://example.com/hooks", "http://"} {
+		_, _, err := d.Subscribe(rawURL, nil)
+		app.AssertError(t, err, ErrInvalidURL)
+	}
+	for _, pattern := range []string{"transfer", "transfer.deleted", "conta.*"} {
+		_, _, err := d.Subscribe("https://example.com/hooks", []string{pattern})
+		app.AssertError(t, err, ErrInvalidEventType)
+	}
+
+	subscription, secret, err := d.Subscribe("https://example.com/hooks", []string{"*", events.AccountCreated})
+	app.AssertError(t, err, nil)
+	if secret == "" {
+		t.Fatal("got no secret for the new subscription")
+	}
+	found, err := d.Subscription(subscription.ID)
+	app.AssertError(t, err, nil)
+	app.AssertString(t, found.URL, "https://example.com/hooks")
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil)
+	d.Backoff = time.Second
+	d.MaxBackoff = 10 * time.Second
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 30: 10 * time.Second} {
+		if got := d.backoff(attempts); got != want {
+			t.Errorf("got backoff %v after %d attempts; want %v", got, attempts, want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Now()
+	header := Sign("segredo", now, body)
+
+	app.AssertError(t, Verify("segredo", header, body, now), nil)
+	app.AssertError(t, Verify("outro", header, body, now), ErrInvalidSignature)
+	app.AssertError(t, Verify("segredo", header, []byte(`{"id":2}`), now), ErrInvalidSignature)
+	app.AssertError(t, Verify("segredo", "", body, now), ErrInvalidSignature)
+	app.AssertError(t, Verify("segredo", header, body, now.Add(SignatureTolerance+time.Second)), ErrStaleSignature)
+}